@@ -0,0 +1,1006 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a minimal ActivityPub server so that the blog
+ * can be followed from Mastodon and similar (fediverse) servers:
+ *
+ *	/.well-known/webfinger   WebFinger lookup of the blog's actor
+ *	/activitypub/actor       the blog's actor (a `Person`)
+ *	/activitypub/followers   the followers collection
+ *	/activitypub/inbox       accepts `Follow` and `Undo` activities
+ *	/activitypub/outbox      the postings as `Create` activities
+ *	/p/<ID>                  a posting as `Note` or `Article` object
+ *
+ * New, edited, and removed postings are delivered to the followers'
+ * inboxes using HTTP signatures.
+ *
+ * see: https://www.w3.org/TR/activitypub/
+ */
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	se "github.com/mwat56/sourceerror"
+)
+
+const (
+	// `apContentType` is the media type of ActivityPub documents.
+	apContentType = `application/activity+json`
+
+	// `apDirName` is the name of the directory storing the
+	// ActivityPub key and followers (below `AppArgs.DataDir`).
+	apDirName = `activitypub`
+
+	// `apMaxBody` is the max. size of incoming/fetched documents.
+	apMaxBody = 1 << 20
+
+	// `apKeyMinAge` is the min. age of a cached remote key before
+	// it's fetched again for a failing signature (key rotation).
+	apKeyMinAge = time.Minute
+
+	// `apKeyTTL` is the max. time a remote actor's key is cached.
+	apKeyTTL = time.Hour
+
+	// `apMaxClockSkew` is the max. accepted age of a signed request;
+	// it limits the time a captured request can be replayed.
+	apMaxClockSkew = 30 * time.Minute
+
+	// `apMaxKeys` is the max. number of cached remote keys.
+	apMaxKeys = 1024
+
+	// `apPublic` is the special collection addressing everybody.
+	apPublic = `https://www.w3.org/ns/activitystreams#Public`
+
+	// `apTimeout` is the max. duration of a single remote request.
+	apTimeout = 10 * time.Second
+
+	// The activity types sent for changed postings:
+	apCreate = `Create`
+	apDelete = `Delete`
+	apUpdate = `Update`
+)
+
+type (
+	// `TActivityPub` provides the blog's ActivityPub actor.
+	TActivityPub struct {
+		baseURL   string                 // public URL of the blog
+		client    *http.Client           // client for remote requests
+		dir       string                 // directory of key and followers
+		followers map[string]tAPFollower // followers indexed by actor ID
+		key       *rsa.PrivateKey        // key to sign deliveries
+		keys      map[string]tAPKey      // remote actors by their key ID
+		kMtx      sync.Mutex             // guard the remote keys
+		mtx       sync.RWMutex           // guard the followers list
+		private   bool                   // allow local addresses (for testing)
+		user      string                 // the actor's user name
+		wg        sync.WaitGroup         // running deliveries
+	}
+
+	// `tAPActor` is the part of a remote actor we're interested in.
+	tAPActor struct {
+		ID        string `json:"id"`
+		Inbox     string `json:"inbox"`
+		Endpoints struct {
+			SharedInbox string `json:"sharedInbox"`
+		} `json:"endpoints"`
+		PublicKey struct {
+			ID           string `json:"id"`
+			Owner        string `json:"owner"`
+			PublicKeyPem string `json:"publicKeyPem"`
+		} `json:"publicKey"`
+	}
+
+	// `tAPFollower` is a single follower of the blog's actor.
+	tAPFollower struct {
+		Actor       string    `json:"actor"`
+		Inbox       string    `json:"inbox"`
+		SharedInbox string    `json:"sharedInbox,omitempty"`
+		Since       time.Time `json:"since"`
+	}
+
+	// `tAPKey` is a cached remote actor along with its fetch time.
+	tAPKey struct {
+		actor   *tAPActor
+		fetched time.Time
+	}
+
+	// `tAPIncoming` is an activity received by the inbox.
+	tAPIncoming struct {
+		ID     string          `json:"id"`
+		Type   string          `json:"type"`
+		Actor  string          `json:"actor"`
+		Object json.RawMessage `json:"object"`
+	}
+
+	// `tAPObject` is an ActivityStreams object or activity.
+	tAPObject = map[string]any
+)
+
+var (
+	// `apContext` is the JSON-LD context of our documents.
+	apContext = []string{
+		`https://www.w3.org/ns/activitystreams`,
+		`https://w3id.org/security/v1`,
+	}
+
+	// RegEx to detect a Markdown heading at the start of a posting.
+	apHeadingRE = regexp.MustCompile(`^\s*#{1,6}\s`)
+
+	// RegEx to split a `Signature` header into its parameters.
+	apSignatureRE = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+	// `ErrAPSignature` is returned for missing or invalid signatures.
+	ErrAPSignature = errors.New("invalid HTTP signature")
+)
+
+// --------------------------------------------------------------------------
+// constructor function:
+
+// `NewActivityPub()` returns the blog's ActivityPub actor.
+//
+// The actor's key is read from `aDir` or created on first use;
+// the same directory stores the list of followers.
+//
+// Parameters:
+//   - `aBaseURL`: The public URL of the blog (e.g. `https://host`).
+//   - `aUser`: The actor's user name (as in `@user@host`).
+//   - `aDir`: The directory to store the key and followers in.
+//
+// Returns:
+//   - `*TActivityPub`: The new ActivityPub actor.
+//   - `error`: A possible I/O or key error.
+func NewActivityPub(aBaseURL, aUser, aDir string) (*TActivityPub, error) {
+	result := &TActivityPub{
+		baseURL:   strings.TrimSuffix(aBaseURL, `/`),
+		dir:       aDir,
+		followers: make(map[string]tAPFollower),
+		keys:      make(map[string]tAPKey),
+		user:      aUser,
+	}
+	// the remote servers tell us which URLs to fetch or post to:
+	result.client = wmPublicClient(apTimeout, func() bool {
+		return result.private
+	})
+	if err := os.MkdirAll(aDir, 0770); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	if err := result.loadKey(); nil != err {
+		return nil, err
+	}
+	if err := result.loadFollowers(); nil != err {
+		return nil, err
+	}
+
+	return result, nil
+} // NewActivityPub()
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `apDecode()` reads a JSON document of at most `apMaxBody` bytes.
+func apDecode(aReader io.Reader, aData any) error {
+	return json.NewDecoder(io.LimitReader(aReader, apMaxBody)).Decode(aData)
+} // apDecode()
+
+// `apReply()` sends `aData` as an ActivityPub JSON document.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aContentType`: The reply's media type.
+//   - `aData`: The data to send.
+func apReply(aWriter http.ResponseWriter, aRequest *http.Request, aContentType string, aData any) {
+	aWriter.Header().Set(`Content-Type`, aContentType+`; charset=utf-8`)
+	aWriter.Header().Set(`Cache-Control`, `public, max-age=300`)
+	if http.MethodHead == aRequest.Method {
+		return
+	}
+	if err := json.NewEncoder(aWriter).Encode(aData); nil != err {
+		apachelogger.Err("apReply()", fmt.Sprintf("json.Encode(): %v", err))
+	}
+} // apReply()
+
+// `apSameHost()` reports whether both URLs point to the same host.
+func apSameHost(aURL1, aURL2 string) bool {
+	u1, err1 := url.Parse(aURL1)
+	u2, err2 := url.Parse(aURL2)
+
+	return (nil == err1) && (nil == err2) && (0 < len(u1.Host)) &&
+		strings.EqualFold(u1.Host, u2.Host)
+} // apSameHost()
+
+// `apSigningString()` returns the string to sign/verify for
+// `aRequest` covering the given `aHeaders`.
+func apSigningString(aRequest *http.Request, aHeaders []string) string {
+	lines := make([]string, 0, len(aHeaders))
+	for _, name := range aHeaders {
+		name = strings.ToLower(name)
+		switch name {
+		case `(request-target)`:
+			lines = append(lines, name+`: `+
+				strings.ToLower(aRequest.Method)+` `+aRequest.URL.RequestURI())
+		case `host`:
+			host := aRequest.Host
+			if 0 == len(host) {
+				host = aRequest.URL.Host
+			}
+			lines = append(lines, name+`: `+host)
+		default:
+			lines = append(lines, name+`: `+aRequest.Header.Get(name))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+} // apSigningString()
+
+// `APWantsJSON()` reports whether `aRequest` asks for an ActivityPub
+// document instead of an HTML page.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `bool`: `true` if an ActivityPub document is requested.
+func APWantsJSON(aRequest *http.Request) bool {
+	accept := aRequest.Header.Get(`Accept`)
+
+	return strings.Contains(accept, apContentType) ||
+		strings.Contains(accept, `application/ld+json`)
+} // APWantsJSON()
+
+// --------------------------------------------------------------------------
+// TActivityPub methods
+
+// `activity()` returns an activity of `aType` about `aPosting`.
+func (ap *TActivityPub) activity(aType string, aPosting *TPosting) tAPObject {
+	objURL := ap.objectURL(aPosting.id)
+	result := tAPObject{
+		`@context`: apContext,
+		`actor`:    ap.ActorURL(),
+		`to`:       []string{apPublic},
+		`cc`:       []string{ap.followersURL()},
+		`type`:     aType,
+	}
+
+	switch aType {
+	case apCreate:
+		result[`id`] = objURL + `#create`
+		result[`object`] = ap.object(aPosting)
+		result[`published`] = aPosting.Time().UTC().Format(time.RFC3339)
+
+	case apDelete:
+		result[`id`] = objURL + `#delete`
+		result[`object`] = tAPObject{`id`: objURL, `type`: `Tombstone`}
+
+	default: // apUpdate
+		result[`id`] = objURL + `#update-` + strconv.FormatInt(time.Now().UnixNano(), 36)
+		result[`object`] = ap.object(aPosting)
+	}
+
+	return result
+} // activity()
+
+// `actor()` returns the blog's actor document.
+func (ap *TActivityPub) actor() tAPObject {
+	actor := ap.ActorURL()
+	pubDER, _ := x509.MarshalPKIXPublicKey(&ap.key.PublicKey)
+
+	return tAPObject{
+		`@context`:          apContext,
+		`id`:                actor,
+		`type`:              `Person`,
+		`preferredUsername`: ap.user,
+		`name`:              AppArgs.BlogName,
+		`summary`:           AppArgs.BlogName,
+		`url`:               ap.baseURL + `/`,
+		`inbox`:             actor[:strings.LastIndex(actor, `/`)] + `/inbox`,
+		`outbox`:            ap.outboxURL(),
+		`followers`:         ap.followersURL(),
+		`publicKey`: tAPObject{
+			`id`:    ap.keyID(),
+			`owner`: actor,
+			`publicKeyPem`: string(pem.EncodeToMemory(&pem.Block{
+				Type:  `PUBLIC KEY`,
+				Bytes: pubDER,
+			})),
+		},
+	}
+} // actor()
+
+// `ActorURL()` returns the URL (i.e. ID) of the blog's actor.
+func (ap *TActivityPub) ActorURL() string {
+	return ap.baseURL + `/activitypub/actor`
+} // ActorURL()
+
+// `deliver()` sends `aActivity` to all `aInboxes` in background.
+//
+// Parameters:
+//   - `aActivity`: The activity to send.
+//   - `aInboxes`: The list of inbox URLs to send to.
+func (ap *TActivityPub) deliver(aActivity tAPObject, aInboxes []string) {
+	body, err := json.Marshal(aActivity)
+	if nil != err {
+		apachelogger.Err("TActivityPub.deliver()",
+			fmt.Sprintf("json.Marshal(): %v", err))
+		return
+	}
+
+	for _, inbox := range aInboxes {
+		ap.wg.Add(1)
+		go func(aInbox string) {
+			defer ap.wg.Done()
+			if err := ap.post(aInbox, body); nil != err {
+				apachelogger.Err("TActivityPub.deliver()",
+					fmt.Sprintf("POST %s: %v", aInbox, err))
+			}
+		}(inbox)
+	}
+} // deliver()
+
+// `fetchActor()` retrieves the remote actor document at `aURL`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aURL`: The actor's (or its key's) URL.
+//
+// Returns:
+//   - `*tAPActor`: The remote actor.
+//   - `error`: A possible network or decoding error.
+func (ap *TActivityPub) fetchActor(aCtx context.Context, aURL string) (*tAPActor, error) {
+	u, err := url.Parse(aURL)
+	if (nil != err) || ((`https` != u.Scheme) && (`http` != u.Scheme)) {
+		return nil, fmt.Errorf("invalid actor URL %q", aURL)
+	}
+	u.Fragment = ""
+
+	ctx, cancel := context.WithTimeout(aCtx, apTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	req.Header.Set(`Accept`, apContentType)
+
+	resp, err := ap.client.Do(req)
+	if nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+
+	result := new(tAPActor)
+	if err = apDecode(resp.Body, result); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	if (0 == len(result.ID)) || (0 == len(result.Inbox)) {
+		return nil, fmt.Errorf("GET %s: incomplete actor", u)
+	}
+
+	return result, nil
+} // fetchActor()
+
+// `Followers()` returns the number of the actor's followers.
+func (ap *TActivityPub) Followers() int {
+	if nil == ap {
+		return 0
+	}
+	ap.mtx.RLock()
+	defer ap.mtx.RUnlock()
+
+	return len(ap.followers)
+} // Followers()
+
+// `followersURL()` returns the URL of the followers collection.
+func (ap *TActivityPub) followersURL() string {
+	return ap.baseURL + `/activitypub/followers`
+} // followersURL()
+
+// `handleActor()` serves the blog's actor document.
+func (ap *TActivityPub) handleActor(aWriter http.ResponseWriter, aRequest *http.Request) {
+	apReply(aWriter, aRequest, apContentType, ap.actor())
+} // handleActor()
+
+// `handleFollowers()` serves the followers collection.
+//
+// For privacy reasons only the number of followers is published.
+func (ap *TActivityPub) handleFollowers(aWriter http.ResponseWriter, aRequest *http.Request) {
+	apReply(aWriter, aRequest, apContentType, tAPObject{
+		`@context`:   apContext[0],
+		`id`:         ap.followersURL(),
+		`type`:       `OrderedCollection`,
+		`totalItems`: ap.Followers(),
+	})
+} // handleFollowers()
+
+// `handleInbox()` processes an activity sent to the actor's inbox.
+//
+// Only (signed) `Follow` and `Undo` activities are handled, all
+// others are accepted but ignored.
+func (ap *TActivityPub) handleInbox(aWriter http.ResponseWriter, aRequest *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(aWriter, aRequest.Body, apMaxBody))
+	if nil != err {
+		http.Error(aWriter, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	remote, err := ap.verify(aRequest.Context(), aRequest, body)
+	if nil != err {
+		apachelogger.Err("TActivityPub.handleInbox()",
+			fmt.Sprintf("verify(): %v", err))
+		http.Error(aWriter, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var act tAPIncoming
+	if err = json.Unmarshal(body, &act); nil != err {
+		http.Error(aWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if act.Actor != remote.ID {
+		http.Error(aWriter, `actor doesn't match signature`, http.StatusUnauthorized)
+		return
+	}
+
+	switch act.Type {
+	case `Follow`:
+		if ap.objectID(act.Object) != ap.ActorURL() {
+			http.Error(aWriter, `unknown actor`, http.StatusNotFound)
+			return
+		}
+		if err = ap.addFollower(remote); nil != err {
+			apachelogger.Err("TActivityPub.handleInbox()",
+				fmt.Sprintf("addFollower(%s): %v", remote.ID, err))
+			http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ap.deliver(tAPObject{
+			`@context`: apContext[0],
+			`id`:       ap.ActorURL() + `#accept-` + strconv.FormatInt(time.Now().UnixNano(), 36),
+			`type`:     `Accept`,
+			`actor`:    ap.ActorURL(),
+			`object`:   json.RawMessage(body),
+		}, []string{remote.Inbox})
+
+	case `Undo`:
+		var inner tAPIncoming
+		if err = json.Unmarshal(act.Object, &inner); (nil == err) &&
+			(`Follow` == inner.Type) && (act.Actor == inner.Actor) {
+			if err = ap.removeFollower(act.Actor); nil != err {
+				apachelogger.Err("TActivityPub.handleInbox()",
+					fmt.Sprintf("removeFollower(%s): %v", act.Actor, err))
+			}
+		}
+	}
+
+	aWriter.WriteHeader(http.StatusAccepted)
+} // handleInbox()
+
+// `handleObject()` serves `aPosting` as an ActivityPub object.
+func (ap *TActivityPub) handleObject(aWriter http.ResponseWriter, aRequest *http.Request, aPosting *TPosting) {
+	obj := ap.object(aPosting)
+	obj[`@context`] = apContext[0]
+	apReply(aWriter, aRequest, apContentType, obj)
+} // handleObject()
+
+// `handleOutbox()` serves the actor's outbox.
+//
+// Without a `page` query parameter the collection's summary is
+// sent, otherwise the requested page of `Create` activities.
+func (ap *TActivityPub) handleOutbox(aWriter http.ResponseWriter, aRequest *http.Request) {
+	outbox := ap.outboxURL()
+	page, _ := strconv.Atoi(aRequest.URL.Query().Get(`page`))
+	if 0 >= page {
+		apReply(aWriter, aRequest, apContentType, tAPObject{
+			`@context`:   apContext[0],
+			`id`:         outbox,
+			`type`:       `OrderedCollection`,
+			`totalItems`: poPersistence.CountContext(aRequest.Context()),
+			`first`:      outbox + `?page=1`,
+		})
+		return
+	}
+
+	limit := int(AppArgs.PageLength)
+	pl, more := FeedPostings(aRequest.Context(), nil, limit, (page-1)*limit)
+	items := make([]tAPObject, 0, pl.Len())
+	for idx := range *pl {
+		act := ap.activity(apCreate, &(*pl)[idx])
+		delete(act, `@context`)
+		items = append(items, act)
+	}
+
+	result := tAPObject{
+		`@context`:     apContext[0],
+		`id`:           fmt.Sprintf("%s?page=%d", outbox, page),
+		`type`:         `OrderedCollectionPage`,
+		`partOf`:       outbox,
+		`orderedItems`: items,
+	}
+	if more {
+		result[`next`] = fmt.Sprintf("%s?page=%d", outbox, page+1)
+	}
+	if 1 < page {
+		result[`prev`] = fmt.Sprintf("%s?page=%d", outbox, page-1)
+	}
+	apReply(aWriter, aRequest, apContentType, result)
+} // handleOutbox()
+
+// `handleWebFinger()` answers a WebFinger lookup for the actor.
+func (ap *TActivityPub) handleWebFinger(aWriter http.ResponseWriter, aRequest *http.Request) {
+	host := ap.baseURL
+	if u, err := url.Parse(ap.baseURL); nil == err {
+		host = u.Host
+	}
+	subject := `acct:` + ap.user + `@` + host
+
+	switch aRequest.URL.Query().Get(`resource`) {
+	case subject, ap.ActorURL(), ap.baseURL, ap.baseURL + `/`:
+	default:
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+
+	aWriter.Header().Set(`Access-Control-Allow-Origin`, `*`)
+	apReply(aWriter, aRequest, `application/jrd+json`, tAPObject{
+		`subject`: subject,
+		`aliases`: []string{ap.ActorURL(), ap.baseURL + `/`},
+		`links`: []tAPObject{
+			{`rel`: `self`, `type`: apContentType, `href`: ap.ActorURL()},
+			{`rel`: `http://webfinger.net/rel/profile-page`, `type`: `text/html`, `href`: ap.baseURL + `/`},
+		},
+	})
+} // handleWebFinger()
+
+// `inboxes()` returns the (shared) inboxes of all followers.
+func (ap *TActivityPub) inboxes() []string {
+	ap.mtx.RLock()
+	defer ap.mtx.RUnlock()
+
+	seen := make(map[string]bool, len(ap.followers))
+	result := make([]string, 0, len(ap.followers))
+	for _, f := range ap.followers {
+		inbox := f.Inbox
+		if 0 < len(f.SharedInbox) {
+			inbox = f.SharedInbox
+		}
+		if !seen[inbox] {
+			seen[inbox] = true
+			result = append(result, inbox)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+} // inboxes()
+
+// `keyID()` returns the ID of the actor's public key.
+func (ap *TActivityPub) keyID() string {
+	return ap.ActorURL() + `#main-key`
+} // keyID()
+
+// `loadKey()` reads the actor's private key or creates a new one.
+func (ap *TActivityPub) loadKey() error {
+	fName := filepath.Join(ap.dir, `private.pem`)
+	data, err := os.ReadFile(fName) /* #nosec G304 */
+	if nil == err {
+		block, _ := pem.Decode(data)
+		if nil == block {
+			return fmt.Errorf("%s: no PEM data", fName)
+		}
+		if ap.key, err = x509.ParsePKCS1PrivateKey(block.Bytes); nil != err {
+			return se.Wrap(err, 1)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return se.Wrap(err, 8)
+	}
+
+	if ap.key, err = rsa.GenerateKey(rand.Reader, 2048); nil != err {
+		return se.Wrap(err, 1)
+	}
+	data = pem.EncodeToMemory(&pem.Block{
+		Type:  `RSA PRIVATE KEY`,
+		Bytes: x509.MarshalPKCS1PrivateKey(ap.key),
+	})
+	if err = os.WriteFile(fName, data, 0600); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	return nil
+} // loadKey()
+
+// `loadFollowers()` reads the list of followers.
+func (ap *TActivityPub) loadFollowers() error {
+	data, err := os.ReadFile(filepath.Join(ap.dir, `followers.json`))
+	if nil != err {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return se.Wrap(err, 3)
+	}
+
+	var list []tAPFollower
+	if err = json.Unmarshal(data, &list); nil != err {
+		return se.Wrap(err, 1)
+	}
+	for _, f := range list {
+		ap.followers[f.Actor] = f
+	}
+
+	return nil
+} // loadFollowers()
+
+// `addFollower()` adds `aActor` to the followers and stores the list.
+func (ap *TActivityPub) addFollower(aActor *tAPActor) error {
+	ap.mtx.Lock()
+	defer ap.mtx.Unlock()
+
+	if _, ok := ap.followers[aActor.ID]; !ok {
+		ap.followers[aActor.ID] = tAPFollower{
+			Actor:       aActor.ID,
+			Inbox:       aActor.Inbox,
+			SharedInbox: aActor.Endpoints.SharedInbox,
+			Since:       time.Now().UTC().Truncate(time.Second),
+		}
+	}
+
+	return ap.storeFollowers()
+} // addFollower()
+
+// `object()` returns `aPosting` as a `Note` (or, if it starts with
+// a heading, as an `Article`).
+func (ap *TActivityPub) object(aPosting *TPosting) tAPObject {
+	objURL := ap.objectURL(aPosting.id)
+	published := aPosting.Time().UTC()
+	result := tAPObject{
+		`id`:           objURL,
+		`type`:         `Note`,
+		`attributedTo`: ap.ActorURL(),
+		`content`:      feedAbsURLs([]byte(aPosting.Post()), ap.baseURL),
+		`mediaType`:    `text/html`,
+		`published`:    published.Format(time.RFC3339),
+		`url`:          objURL,
+		`to`:           []string{apPublic},
+		`cc`:           []string{ap.followersURL()},
+		`source`: tAPObject{
+			`content`:   string(aPosting.Markdown()),
+			`mediaType`: `text/markdown`,
+		},
+	}
+	if updated := feedUpdated(aPosting).UTC(); updated.After(published.Add(time.Minute)) {
+		result[`updated`] = updated.Format(time.RFC3339)
+	}
+	if apHeadingRE.Match(aPosting.Markdown()) {
+		result[`type`] = `Article`
+		result[`name`] = feedTitle(aPosting.Markdown())
+	}
+
+	return result
+} // object()
+
+// `objectID()` returns the ID of an activity's object which might
+// be either a plain string or an object with an `id` property.
+func (ap *TActivityPub) objectID(aObject json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(aObject, &id); nil == err {
+		return id
+	}
+	var obj struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(aObject, &obj)
+
+	return obj.ID
+} // objectID()
+
+// `objectURL()` returns the URL (i.e. ID) of the posting with `aID`.
+func (ap *TActivityPub) objectURL(aID uint64) string {
+	return ap.baseURL + `/p/` + id2str(aID)
+} // objectURL()
+
+// `outboxURL()` returns the URL of the actor's outbox.
+func (ap *TActivityPub) outboxURL() string {
+	return ap.baseURL + `/activitypub/outbox`
+} // outboxURL()
+
+// `post()` sends the signed `aBody` to `aInbox`.
+func (ap *TActivityPub) post(aInbox string, aBody []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), apTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, aInbox, bytes.NewReader(aBody))
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	req.Header.Set(`Content-Type`, apContentType)
+	req.Header.Set(`Accept`, apContentType)
+	if err = ap.sign(req, aBody); nil != err {
+		return err
+	}
+
+	resp, err := ap.client.Do(req)
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, apMaxBody))
+	if (200 > resp.StatusCode) || (299 < resp.StatusCode) {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+} // post()
+
+// `Publish()` delivers an activity of `aType` (`Create`, `Update`,
+// or `Delete`) about `aPosting` to all followers in background.
+//
+// It's safe to call this method on a `nil` instance in which case
+// nothing happens.
+//
+// Parameters:
+//   - `aType`: The kind of change of `aPosting`.
+//   - `aPosting`: The new, edited, or removed posting.
+func (ap *TActivityPub) Publish(aType string, aPosting *TPosting) {
+	if nil == ap {
+		return
+	}
+	inboxes := ap.inboxes()
+	if 0 == len(inboxes) {
+		return
+	}
+
+	ap.deliver(ap.activity(aType, aPosting), inboxes)
+} // Publish()
+
+// `remoteKey()` returns the remote actor owning the key `aKeyID`.
+//
+// The actor is taken from the cache unless it's older than `aMaxAge`
+// in which case it's fetched (again).
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aKeyID`: The URL of the actor's key.
+//   - `aMaxAge`: The max. age of a cached actor.
+//
+// Returns:
+//   - `*tAPActor`: The remote actor.
+//   - `time.Time`: The time the actor was fetched.
+//   - `error`: A possible network or decoding error.
+func (ap *TActivityPub) remoteKey(aCtx context.Context, aKeyID string, aMaxAge time.Duration) (*tAPActor, time.Time, error) {
+	ap.kMtx.Lock()
+	entry, ok := ap.keys[aKeyID]
+	ap.kMtx.Unlock()
+	if ok && (aMaxAge > time.Since(entry.fetched)) {
+		return entry.actor, entry.fetched, nil
+	}
+
+	remote, err := ap.fetchActor(aCtx, aKeyID)
+	if nil != err {
+		return nil, time.Time{}, err
+	}
+	entry = tAPKey{actor: remote, fetched: time.Now()}
+
+	ap.kMtx.Lock()
+	defer ap.kMtx.Unlock()
+	if _, ok = ap.keys[aKeyID]; !ok && (apMaxKeys <= len(ap.keys)) {
+		// make room by dropping the expired or the oldest key(s)
+		var oldest string
+		for id, key := range ap.keys {
+			if apKeyTTL < time.Since(key.fetched) {
+				delete(ap.keys, id)
+			} else if (0 == len(oldest)) || key.fetched.Before(ap.keys[oldest].fetched) {
+				oldest = id
+			}
+		}
+		if apMaxKeys <= len(ap.keys) {
+			delete(ap.keys, oldest)
+		}
+	}
+	ap.keys[aKeyID] = entry
+
+	return remote, entry.fetched, nil
+} // remoteKey()
+
+// `removeFollower()` removes `aActorID` from the followers and
+// stores the list.
+func (ap *TActivityPub) removeFollower(aActorID string) error {
+	ap.mtx.Lock()
+	defer ap.mtx.Unlock()
+
+	if _, ok := ap.followers[aActorID]; !ok {
+		return nil
+	}
+	delete(ap.followers, aActorID)
+
+	return ap.storeFollowers()
+} // removeFollower()
+
+// `sign()` adds the `Date`, `Digest`, and `Signature` headers
+// to `aRequest`.
+func (ap *TActivityPub) sign(aRequest *http.Request, aBody []byte) error {
+	digest := sha256.Sum256(aBody)
+	aRequest.Header.Set(`Digest`, `SHA-256=`+base64.StdEncoding.EncodeToString(digest[:]))
+	aRequest.Header.Set(`Date`, time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{`(request-target)`, `host`, `date`, `digest`, `content-type`}
+	sum := sha256.Sum256([]byte(apSigningString(aRequest, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ap.key, crypto.SHA256, sum[:])
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	aRequest.Header.Set(`Signature`, fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		ap.keyID(), strings.Join(headers, ` `),
+		base64.StdEncoding.EncodeToString(sig)))
+
+	return nil
+} // sign()
+
+// `storeFollowers()` writes the list of followers.
+//
+// NOTE: The caller must hold the write lock.
+func (ap *TActivityPub) storeFollowers() error {
+	list := make([]tAPFollower, 0, len(ap.followers))
+	for _, f := range ap.followers {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Actor < list[j].Actor
+	})
+	data, err := json.MarshalIndent(list, "", "\t")
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	fName := filepath.Join(ap.dir, `followers.json`)
+	if err = os.WriteFile(fName+`~`, data, 0640); nil != err {
+		return se.Wrap(err, 1)
+	}
+	if err = os.Rename(fName+`~`, fName); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	return nil
+} // storeFollowers()
+
+// `verify()` checks the HTTP signature of `aRequest`.
+//
+// The signing key must belong to the host of the activity's actor;
+// the remote actors are cached for `apKeyTTL`, so not every request
+// results in fetching the key.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aRequest`: The signed request.
+//   - `aBody`: The request's body.
+//
+// Returns:
+//   - `*tAPActor`: The (remote) actor owning the signing key.
+//   - `error`: `ErrAPSignature` or a network error.
+func (ap *TActivityPub) verify(aCtx context.Context, aRequest *http.Request, aBody []byte) (*tAPActor, error) {
+	params := make(map[string]string)
+	for _, match := range apSignatureRE.FindAllStringSubmatch(aRequest.Header.Get(`Signature`), -1) {
+		params[match[1]] = match[2]
+	}
+	keyID, sigStr := params[`keyId`], params[`signature`]
+	if (0 == len(keyID)) || (0 == len(sigStr)) {
+		return nil, fmt.Errorf("%w: missing signature", ErrAPSignature)
+	}
+	headers := strings.Fields(params[`headers`])
+	if 0 == len(headers) {
+		headers = []string{`date`}
+	}
+	covered := strings.ToLower(strings.Join(headers, ` `)) + ` `
+	for _, name := range []string{`(request-target)`, `date`, `digest`} {
+		if !strings.Contains(covered, name+` `) {
+			return nil, fmt.Errorf("%w: %q not signed", ErrAPSignature, name)
+		}
+	}
+
+	digest := sha256.Sum256(aBody)
+	if `SHA-256=`+base64.StdEncoding.EncodeToString(digest[:]) != aRequest.Header.Get(`Digest`) {
+		return nil, fmt.Errorf("%w: digest mismatch", ErrAPSignature)
+	}
+	date, err := http.ParseTime(aRequest.Header.Get(`Date`))
+	if (nil != err) || (apMaxClockSkew < time.Since(date).Abs()) {
+		return nil, fmt.Errorf("%w: invalid date", ErrAPSignature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigStr)
+	if nil != err {
+		return nil, fmt.Errorf("%w: %v", ErrAPSignature, err)
+	}
+	var act struct {
+		Actor string `json:"actor"`
+	}
+	if err = json.Unmarshal(aBody, &act); (nil != err) || !apSameHost(keyID, act.Actor) {
+		// don't fetch keys of other hosts
+		return nil, fmt.Errorf("%w: key %q doesn't match the actor", ErrAPSignature, keyID)
+	}
+
+	// `check()` verifies the signature by the key of `aRemote`.
+	check := func(aRemote *tAPActor) error {
+		if (keyID != aRemote.PublicKey.ID) ||
+			((0 < len(aRemote.PublicKey.Owner)) && (aRemote.ID != aRemote.PublicKey.Owner)) {
+			return fmt.Errorf("%w: unknown key %q", ErrAPSignature, keyID)
+		}
+		block, _ := pem.Decode([]byte(aRemote.PublicKey.PublicKeyPem))
+		if nil == block {
+			return fmt.Errorf("%w: invalid public key", ErrAPSignature)
+		}
+		var pubKey *rsa.PublicKey
+		if key, err := x509.ParsePKIXPublicKey(block.Bytes); nil == err {
+			pubKey, _ = key.(*rsa.PublicKey)
+		} else if key, err := x509.ParsePKCS1PublicKey(block.Bytes); nil == err {
+			pubKey = key
+		}
+		if nil == pubKey {
+			return fmt.Errorf("%w: unsupported public key", ErrAPSignature)
+		}
+
+		sum := sha256.Sum256([]byte(apSigningString(aRequest, headers)))
+		if err := rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, sum[:], sig); nil != err {
+			return fmt.Errorf("%w: %v", ErrAPSignature, err)
+		}
+
+		return nil
+	} // check()
+
+	remote, fetched, err := ap.remoteKey(aCtx, keyID, apKeyTTL)
+	if nil != err {
+		return nil, err
+	}
+	if err = check(remote); (nil != err) && (apKeyMinAge < time.Since(fetched)) {
+		// the remote actor might have changed its key meanwhile
+		if remote, _, err = ap.remoteKey(aCtx, keyID, apKeyMinAge); nil != err {
+			return nil, err
+		}
+		err = check(remote)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	return remote, nil
+} // verify()
+
+// `Wait()` blocks until all running deliveries are done.
+func (ap *TActivityPub) Wait() {
+	if nil != ap {
+		ap.wg.Wait()
+	}
+} // Wait()
+
+/* _EoF_ */
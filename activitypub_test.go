@@ -0,0 +1,276 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// `tFakeInbox` records the activities delivered to a fake remote
+// server after checking their signatures.
+type tFakeInbox struct {
+	ap       *TActivityPub
+	fetches  int // requests of the actor document
+	mtx      sync.Mutex
+	received []tAPIncoming
+	rejected int
+}
+
+func (fi *tFakeInbox) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Request) {
+	switch aRequest.URL.Path {
+	case `/activitypub/actor`:
+		fi.mtx.Lock()
+		fi.fetches++
+		fi.mtx.Unlock()
+		fi.ap.handleActor(aWriter, aRequest)
+
+	case `/activitypub/inbox`:
+		body, _ := io.ReadAll(aRequest.Body)
+		fi.mtx.Lock()
+		defer fi.mtx.Unlock()
+		if _, err := fi.ap.verify(aRequest.Context(), aRequest, body); nil != err {
+			fi.rejected++
+			http.Error(aWriter, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var act tAPIncoming
+		_ = json.Unmarshal(body, &act)
+		fi.received = append(fi.received, act)
+		aWriter.WriteHeader(http.StatusAccepted)
+
+	default:
+		http.NotFound(aWriter, aRequest)
+	}
+} // ServeHTTP()
+
+// `types()` returns the types of the received activities.
+func (fi *tFakeInbox) types() string {
+	fi.mtx.Lock()
+	defer fi.mtx.Unlock()
+
+	list := make([]string, 0, len(fi.received))
+	for _, act := range fi.received {
+		list = append(list, act.Type)
+	}
+	fi.received = nil
+
+	return strings.Join(list, ",")
+} // types()
+
+// `apTestPost()` sends `aActivity` signed by `aSigner` to `aInbox`.
+func apTestPost(t *testing.T, aSigner *TActivityPub, aInbox string, aActivity tAPObject) int {
+	t.Helper()
+
+	body, _ := json.Marshal(aActivity)
+	req, err := http.NewRequest(http.MethodPost, aInbox, bytes.NewReader(body))
+	if nil != err {
+		t.Fatal(err)
+	}
+	req.Header.Set(`Content-Type`, apContentType)
+	if nil != aSigner {
+		if err = aSigner.sign(req, body); nil != err {
+			t.Fatal(err)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+} // apTestPost()
+
+func Test_apSameHost(t *testing.T) {
+	tests := []struct {
+		name string
+		url1 string
+		url2 string
+		want bool
+	}{
+		{" 1", "https://example.com/users/a#main-key", "https://example.com/users/a", true},
+		{" 2", "https://EXAMPLE.com/key", "https://example.com/users/a", true},
+		{" 3", "https://example.com/key", "https://example.org/users/a", false},
+		{" 4", "https://example.com:8443/key", "https://example.com/users/a", false},
+		{" 5", "/key", "/users/a", false},
+		{" 6", "https://example.com/key", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apSameHost(tt.url1, tt.url2); got != tt.want {
+				t.Errorf("apSameHost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_apSameHost()
+
+func TestTActivityPub_federation(t *testing.T) {
+	ph := prepAPITest(t)
+	blog := httptest.NewServer(ph)
+	defer blog.Close()
+	blogAP, err := NewActivityPub(blog.URL, "blog", t.TempDir())
+	if nil != err {
+		t.Fatal(err)
+	}
+	ph.activityPub = blogAP
+	tl, _ := LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	ph.tokenList = tl
+	token, _, _ := tl.Add("poster", TokenScopePost)
+
+	fake := new(tFakeInbox)
+	remote := httptest.NewServer(fake)
+	defer remote.Close()
+	if fake.ap, err = NewActivityPub(remote.URL, "alice", t.TempDir()); nil != err {
+		t.Fatal(err)
+	}
+
+	// WebFinger lookup
+	host := strings.TrimPrefix(blog.URL, "http://")
+	resp, err := http.Get(blog.URL + "/.well-known/webfinger?resource=acct:blog@" + host)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var jrd struct {
+		Links []struct{ Rel, Href string }
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&jrd)
+	resp.Body.Close()
+	if (0 == len(jrd.Links)) || (blogAP.ActorURL() != jrd.Links[0].Href) {
+		t.Fatalf("webfinger links = %v, want %q", jrd.Links, blogAP.ActorURL())
+	}
+
+	inbox := blog.URL + "/activitypub/inbox"
+	follow := tAPObject{
+		"id":     remote.URL + "/follow/1",
+		"type":   "Follow",
+		"actor":  fake.ap.ActorURL(),
+		"object": blogAP.ActorURL(),
+	}
+
+	// unsigned and wrongly signed requests are rejected
+	if got := apTestPost(t, nil, inbox, follow); http.StatusUnauthorized != got {
+		t.Errorf("unsigned Follow: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := apTestPost(t, blogAP, inbox, follow); http.StatusUnauthorized != got {
+		t.Errorf("forged Follow: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	// the test servers use the loopback address:
+	if got := apTestPost(t, fake.ap, inbox, follow); http.StatusUnauthorized != got {
+		t.Errorf("Follow from loopback: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if 0 != fake.fetches {
+		t.Errorf("key fetched %d times, want 0", fake.fetches)
+	}
+	blogAP.private, fake.ap.private = true, true
+
+	// Follow → Accept
+	if got := apTestPost(t, fake.ap, inbox, follow); http.StatusAccepted != got {
+		t.Fatalf("Follow: status = %d, want %d", got, http.StatusAccepted)
+	}
+	blogAP.Wait()
+	if got := fake.types(); "Accept" != got {
+		t.Errorf("after Follow received %q, want %q", got, "Accept")
+	}
+	if 1 != blogAP.Followers() {
+		t.Errorf("Followers() = %d, want 1", blogAP.Followers())
+	}
+	fake.mtx.Lock()
+	if 1 != fake.fetches {
+		t.Errorf("key fetched %d times, want 1", fake.fetches)
+	}
+	fake.mtx.Unlock()
+	if _, err = os.Stat(filepath.Join(blogAP.dir, "followers.json")); nil != err {
+		t.Errorf("followers not stored: %v", err)
+	}
+	if restarted, err := NewActivityPub(blog.URL, "blog", blogAP.dir); nil != err {
+		t.Error(err)
+	} else if 1 != restarted.Followers() {
+		t.Errorf("restarted Followers() = %d, want 1", restarted.Followers())
+	}
+
+	// new, edited, and removed postings get delivered
+	req, _ := http.NewRequest(http.MethodPost, blog.URL+"/api/v1/postings",
+		strings.NewReader(`{"markdown": "# Hello\n\nfediverse"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if resp, err = http.DefaultClient.Do(req); nil != err {
+		t.Fatal(err)
+	}
+	var post tAPIposting
+	_ = json.NewDecoder(resp.Body).Decode(&post)
+	resp.Body.Close()
+	blogAP.Wait()
+	if got := fake.types(); "Create" != got {
+		t.Errorf("after create received %q, want %q", got, "Create")
+	}
+
+	p := NewPosting(str2id(post.ID), "")
+	if err = p.Load(); nil != err {
+		t.Fatal(err)
+	}
+	blogAP.Publish(apUpdate, p)
+	blogAP.Publish(apDelete, p)
+	blogAP.Wait()
+	if got := fake.types(); !strings.Contains(got, "Update") || !strings.Contains(got, "Delete") {
+		t.Errorf("received %q, want Update and Delete", got)
+	}
+	fake.mtx.Lock()
+	if 0 != fake.rejected {
+		t.Errorf("fake inbox rejected %d deliveries", fake.rejected)
+	}
+	fake.mtx.Unlock()
+
+	// a posting as ActivityPub object
+	req, _ = http.NewRequest(http.MethodGet, blog.URL+"/p/"+post.ID, nil)
+	req.Header.Set("Accept", apContentType)
+	if resp, err = http.DefaultClient.Do(req); nil != err {
+		t.Fatal(err)
+	}
+	var obj struct{ ID, Type, Name string }
+	_ = json.NewDecoder(resp.Body).Decode(&obj)
+	resp.Body.Close()
+	if ("Article" != obj.Type) || ("Hello" != obj.Name) {
+		t.Errorf("object = %+v, want an `Article` named `Hello`", obj)
+	}
+
+	// Undo(Follow) removes the follower
+	undo := tAPObject{
+		"id":     remote.URL + "/undo/1",
+		"type":   "Undo",
+		"actor":  fake.ap.ActorURL(),
+		"object": follow,
+	}
+	if got := apTestPost(t, fake.ap, inbox, undo); http.StatusAccepted != got {
+		t.Fatalf("Undo: status = %d, want %d", got, http.StatusAccepted)
+	}
+	if 0 != blogAP.Followers() {
+		t.Errorf("Followers() = %d, want 0", blogAP.Followers())
+	}
+	fake.mtx.Lock()
+	if 1 != fake.fetches {
+		t.Errorf("key fetched %d times, want 1 (cached)", fake.fetches)
+	}
+	fake.mtx.Unlock()
+	blogAP.Publish(apUpdate, p)
+	blogAP.Wait()
+	if got := fake.types(); "" != got {
+		t.Errorf("after Undo received %q, want nothing", got)
+	}
+} // TestTActivityPub_federation()
+
+/* _EoF_ */
@@ -0,0 +1,638 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a JSON based REST API below `/api/v1/`:
+ *
+ *	GET    /api/v1/postings            list postings (newest first)
+ *	POST   /api/v1/postings            create a posting
+ *	GET    /api/v1/postings/{id}       get a single posting
+ *	PUT    /api/v1/postings/{id}       update a posting's text
+ *	DELETE /api/v1/postings/{id}       delete a posting
+ *	POST   /api/v1/postings/{id}/date  change a posting's date/time
+ *	GET    /api/v1/tags                list all #hashtags/@mentions
+ *	GET    /api/v1/search?q=…          search the postings' texts
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	ht "github.com/mwat56/hashtags"
+)
+
+const (
+	// `apiPrefix` is the URL path of all API endpoints.
+	apiPrefix = `/api/v1/`
+
+	// `apiMaxLimit` is the max. number of postings per list request.
+	apiMaxLimit = 1000
+)
+
+type (
+	// `tAPIerror` is the JSON body of an error reply.
+	tAPIerror struct {
+		Error string `json:"error"`
+	}
+
+	// `tAPIposting` is the JSON representation of a posting.
+	tAPIposting struct {
+		ID           string `json:"id"`
+		Date         string `json:"date"`
+		LastModified string `json:"lastModified,omitempty"`
+		Markdown     string `json:"markdown"`
+		HTML         string `json:"html"`
+		URL          string `json:"url"`
+	}
+
+	// `tAPIpostingList` is the JSON representation of a list of postings.
+	tAPIpostingList struct {
+		Postings   []tAPIposting `json:"postings"`
+		NextCursor string        `json:"nextCursor,omitempty"`
+	}
+
+	// `tAPIrequest` is the JSON body accepted by the write endpoints.
+	tAPIrequest struct {
+		Date     string  `json:"date"`
+		Markdown *string `json:"markdown"`
+	}
+
+	// `tAPItag` is the JSON representation of a #hashtag/@mention.
+	tAPItag struct {
+		Tag   string `json:"tag"`
+		Count int    `json:"count"`
+	}
+)
+
+var (
+	// RegEx to match a posting ID in an API path.
+	apiIDRE = regexp.MustCompile(`^[0-9a-fA-F]{16}$`)
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `apiError()` sends a JSON error reply.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aStatus`: The HTTP status code to send.
+//   - `aMessage`: The error message to send.
+func apiError(aWriter http.ResponseWriter, aStatus int, aMessage string) {
+	apiReply(aWriter, aStatus, tAPIerror{Error: aMessage})
+} // apiError()
+
+// `apiPosting()` returns the JSON representation of `aPosting`.
+//
+// Parameters:
+//   - `aPosting`: The posting to convert.
+//
+// Returns:
+//   - `tAPIposting`: The posting's JSON representation.
+func apiPosting(aPosting *TPosting) tAPIposting {
+	result := tAPIposting{
+		ID:       aPosting.IDstr(),
+		Date:     aPosting.Time().Format(time.RFC3339Nano),
+		Markdown: string(aPosting.Markdown()),
+		HTML:     string(aPosting.Post()),
+		URL:      "/p/" + aPosting.IDstr(),
+	}
+	if !aPosting.lastModified.IsZero() {
+		result.LastModified = aPosting.lastModified.Format(time.RFC3339)
+	}
+
+	return result
+} // apiPosting()
+
+// `apiReply()` sends `aData` JSON encoded.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aStatus`: The HTTP status code to send.
+//   - `aData`: The data to send; if `nil` no body is sent.
+func apiReply(aWriter http.ResponseWriter, aStatus int, aData any) {
+	if nil == aData {
+		aWriter.WriteHeader(aStatus)
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, `application/json; charset=utf-8`)
+	aWriter.WriteHeader(aStatus)
+	if err := json.NewEncoder(aWriter).Encode(aData); nil != err {
+		apachelogger.Err("apiReply()",
+			fmt.Sprintf("json.Encode(): %v", err))
+	}
+} // apiReply()
+
+// `apiRequest()` reads and decodes the JSON body of `aRequest`.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The request providing the JSON body.
+//
+// Returns:
+//   - `*tAPIrequest`: The decoded request data.
+//   - `error`: A possible decoding error.
+func apiRequest(aWriter http.ResponseWriter, aRequest *http.Request) (*tAPIrequest, error) {
+	maxSize := AppArgs.MaxFileSize
+	if 0 >= maxSize {
+		maxSize = 1 << 20
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(aWriter, aRequest.Body, maxSize))
+	dec.DisallowUnknownFields()
+
+	result := new(tAPIrequest)
+	if err := dec.Decode(result); nil != err {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty request body")
+		}
+		return nil, err
+	}
+	if nil != result.Markdown {
+		md := string(replCRLF([]byte(*result.Markdown)))
+		result.Markdown = &md
+	}
+
+	return result, nil
+} // apiRequest()
+
+// `apiTime()` parses the date/time strings accepted by the API.
+//
+// Parameters:
+//   - `aDate`: Either an RFC 3339 timestamp or a `YYYY-MM-DD` date.
+//
+// Returns:
+//   - `time.Time`: The parsed date/time.
+//   - `error`: A possible parsing error.
+func apiTime(aDate string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, aDate); nil == err {
+		return t, nil
+	}
+
+	return time.ParseInLocation(`2006-01-02`, aDate, time.Local)
+} // apiTime()
+
+// --------------------------------------------------------------------------
+// TPageHandler methods
+
+// `handleAPI()` serves all requests below `/api/v1/`.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+func (ph *TPageHandler) handleAPI(aWriter http.ResponseWriter, aRequest *http.Request) {
+	if !strings.HasPrefix(aRequest.URL.Path, apiPrefix) {
+		apiError(aWriter, http.StatusNotFound, `unknown API version`)
+		return
+	}
+	parts := strings.Split(strings.Trim(
+		strings.TrimPrefix(aRequest.URL.Path, apiPrefix), `/`), `/`)
+
+	aWriter.Header().Set(`Access-Control-Allow-Methods`,
+		`DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT`)
+	method := aRequest.Method
+	if http.MethodOptions == method {
+		apiReply(aWriter, http.StatusNoContent, nil)
+		return
+	}
+	if http.MethodHead == method {
+		method = http.MethodGet
+	}
+
+	switch parts[0] {
+	case `cache`:
+		if http.MethodGet != method {
+			apiError(aWriter, http.StatusMethodNotAllowed, `method not allowed`)
+			return
+		}
+		if !ph.isAuthenticated(aRequest) {
+			apiError(aWriter, http.StatusUnauthorized, `authentication required`)
+			return
+		}
+		apiReply(aWriter, http.StatusOK, pcCache.Stats())
+
+	case `postings`:
+		if 1 == len(parts) {
+			switch method {
+			case http.MethodGet:
+				ph.apiListPostings(aWriter, aRequest)
+			case http.MethodPost:
+				ph.apiCreatePosting(aWriter, aRequest)
+			default:
+				apiError(aWriter, http.StatusMethodNotAllowed, `method not allowed`)
+			}
+			return
+		}
+
+		if !apiIDRE.MatchString(parts[1]) {
+			apiError(aWriter, http.StatusNotFound, `invalid posting ID`)
+			return
+		}
+		id := str2id(parts[1])
+		if !poPersistence.ExistsContext(aRequest.Context(), id) {
+			apiError(aWriter, http.StatusNotFound, `posting not found`)
+			return
+		}
+
+		if (3 == len(parts)) && (`date` == parts[2]) {
+			switch method {
+			case http.MethodPost, http.MethodPut:
+				ph.apiRedatePosting(aWriter, aRequest, id)
+			default:
+				apiError(aWriter, http.StatusMethodNotAllowed, `method not allowed`)
+			}
+			return
+		}
+		if 2 != len(parts) {
+			apiError(aWriter, http.StatusNotFound, `unknown endpoint`)
+			return
+		}
+
+		switch method {
+		case http.MethodGet:
+			post := NewPosting(id, "")
+			if err := post.LoadContext(aRequest.Context()); nil != err {
+				apiError(aWriter, http.StatusInternalServerError, err.Error())
+				return
+			}
+			apiReply(aWriter, http.StatusOK, apiPosting(post))
+		case http.MethodPatch, http.MethodPut:
+			ph.apiUpdatePosting(aWriter, aRequest, id)
+		case http.MethodDelete:
+			ph.apiDeletePosting(aWriter, id)
+		default:
+			apiError(aWriter, http.StatusMethodNotAllowed, `method not allowed`)
+		}
+
+	case `search`:
+		if http.MethodGet != method {
+			apiError(aWriter, http.StatusMethodNotAllowed, `method not allowed`)
+			return
+		}
+		ph.apiSearch(aWriter, aRequest)
+
+	case `tags`:
+		if http.MethodGet != method {
+			apiError(aWriter, http.StatusMethodNotAllowed, `method not allowed`)
+			return
+		}
+		list := ph.hashList.List()
+		result := make([]tAPItag, 0, len(list))
+		for _, item := range list {
+			result = append(result, tAPItag{Tag: item.Tag, Count: item.Count})
+		}
+		apiReply(aWriter, http.StatusOK, map[string][]tAPItag{`tags`: result})
+
+	default:
+		apiError(aWriter, http.StatusNotFound, `unknown endpoint`)
+	}
+} // handleAPI()
+
+// `apiCreatePosting()` stores a new posting.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+func (ph *TPageHandler) apiCreatePosting(aWriter http.ResponseWriter, aRequest *http.Request) {
+	req, err := apiRequest(aWriter, aRequest)
+	if nil != err {
+		apiError(aWriter, http.StatusBadRequest, err.Error())
+		return
+	}
+	if (nil == req.Markdown) || (0 == len(strings.TrimSpace(*req.Markdown))) {
+		apiError(aWriter, http.StatusBadRequest, `missing markdown`)
+		return
+	}
+
+	var id uint64 // zero means "now"
+	if 0 < len(req.Date) {
+		t, err := apiTime(req.Date)
+		if nil != err {
+			apiError(aWriter, http.StatusBadRequest, err.Error())
+			return
+		}
+		id = time2id(t)
+		if poPersistence.ExistsContext(aRequest.Context(), id) {
+			apiError(aWriter, http.StatusConflict, `posting exists`)
+			return
+		}
+	}
+
+	post := NewPosting(id, *req.Markdown)
+	if _, err = post.StoreContext(aRequest.Context()); nil != err {
+		apachelogger.Err("TPageHandler.apiCreatePosting()",
+			fmt.Sprintf("TPosting.StoreContext(%s): %v", post.IDstr(), err))
+		apiError(aWriter, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	AddTagID(ph.hashList, post)
+	ph.activityPub.Publish(apCreate, post)
+	ph.webmentions.Send(post)
+
+	aWriter.Header().Set(`Location`, apiPrefix+`postings/`+post.IDstr())
+	apiReply(aWriter, http.StatusCreated, apiPosting(post))
+} // apiCreatePosting()
+
+// `apiDeletePosting()` removes the posting with `aID`.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aID`: The ID of the posting to delete.
+func (ph *TPageHandler) apiDeletePosting(aWriter http.ResponseWriter, aID uint64) {
+	post := NewPosting(aID, "")
+	RemovePageScreenshots(post)
+	if err := post.Delete(); nil != err {
+		apachelogger.Err("TPageHandler.apiDeletePosting()",
+			fmt.Sprintf("TPosting.Delete(%s): %v", post.IDstr(), err))
+		apiError(aWriter, http.StatusInternalServerError, err.Error())
+		return
+	}
+	RemoveIDTags(ph.hashList, aID)
+	ph.activityPub.Publish(apDelete, post)
+	ph.webmentions.RemovePost(aID)
+
+	apiReply(aWriter, http.StatusNoContent, nil)
+} // apiDeletePosting()
+
+// `apiListPostings()` sends a list of postings, newest first.
+//
+// Query parameters:
+//   - `cursor`: Only postings older than the posting with this ID.
+//   - `from`, `to`: Only postings of this date range (inclusive).
+//   - `limit`: The max. number of postings to send.
+//   - `tag`: Only postings with this #hashtag/@mention.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+func (ph *TPageHandler) apiListPostings(aWriter http.ResponseWriter, aRequest *http.Request) {
+	var (
+		cursor uint64
+		err    error
+		from   time.Time
+		to     time.Time
+	)
+	query := aRequest.URL.Query()
+
+	limit := int(AppArgs.PageLength)
+	if val := query.Get(`limit`); 0 < len(val) {
+		if limit, err = strconv.Atoi(val); (nil != err) || (0 >= limit) {
+			apiError(aWriter, http.StatusBadRequest, `invalid limit`)
+			return
+		}
+	}
+	if (0 >= limit) || (apiMaxLimit < limit) {
+		limit = apiMaxLimit
+	}
+	if val := query.Get(`cursor`); 0 < len(val) {
+		if !apiIDRE.MatchString(val) {
+			apiError(aWriter, http.StatusBadRequest, `invalid cursor`)
+			return
+		}
+		cursor = str2id(val)
+	}
+	if val := query.Get(`from`); 0 < len(val) {
+		if from, err = apiTime(val); nil != err {
+			apiError(aWriter, http.StatusBadRequest, `invalid from date`)
+			return
+		}
+	}
+	if val := query.Get(`to`); 0 < len(val) {
+		if to, err = apiTime(val); nil != err {
+			apiError(aWriter, http.StatusBadRequest, `invalid to date`)
+			return
+		}
+		if !strings.Contains(val, `T`) {
+			to = to.AddDate(0, 0, 1) // include the whole day
+		}
+	}
+
+	accept := func(aID uint64) bool {
+		if (0 < cursor) && (aID >= cursor) {
+			return false
+		}
+		t := id2time(aID)
+		if (!from.IsZero() && t.Before(from)) || (!to.IsZero() && !t.Before(to)) {
+			return false
+		}
+		return true
+	} // accept()
+
+	var ids []uint64
+	if tag := query.Get(`tag`); 0 < len(tag) {
+		var list []uint64
+		if ht.MarkMention == tag[0] {
+			list = ph.hashList.MentionList(tag)
+		} else {
+			list = ph.hashList.HashList(string(ht.MarkHash) + strings.TrimPrefix(tag, string(ht.MarkHash)))
+		}
+		for _, id := range list {
+			if accept(id) {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		// Not all persistence layers walk in chronological order,
+		// so collect all matching IDs and sort them afterwards.
+		err = poPersistence.WalkContext(aRequest.Context(), func(aID uint64) error {
+			if accept(aID) {
+				ids = append(ids, aID)
+			}
+			return nil
+		})
+		if nil != err {
+			apiError(aWriter, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] > ids[j] // newest first
+	})
+
+	result := tAPIpostingList{Postings: make([]tAPIposting, 0, len(ids))}
+	if limit < len(ids) {
+		ids = ids[:limit]
+		result.NextCursor = id2str(ids[limit-1])
+	}
+	ph.apiLoadPostings(aRequest.Context(), ids, &result)
+
+	apiReply(aWriter, http.StatusOK, result)
+} // apiListPostings()
+
+// `apiLoadPostings()` adds the postings with `aIDs` to `aList`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aIDs`: The IDs of the postings to load.
+//   - `aList`: The list to add the postings to.
+func (ph *TPageHandler) apiLoadPostings(aCtx context.Context, aIDs []uint64, aList *tAPIpostingList) {
+	for _, id := range aIDs {
+		post := NewPosting(id, "")
+		if err := post.LoadContext(aCtx); nil != err {
+			apachelogger.Err("TPageHandler.apiLoadPostings()",
+				fmt.Sprintf("TPosting.Load(%s): %v", id2str(id), err))
+			continue
+		}
+		aList.Postings = append(aList.Postings, apiPosting(post))
+	}
+} // apiLoadPostings()
+
+// `apiRedatePosting()` changes the date/time (i.e. the ID) of the
+// posting with `aID`.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aID`: The ID of the posting to change.
+func (ph *TPageHandler) apiRedatePosting(aWriter http.ResponseWriter, aRequest *http.Request, aID uint64) {
+	req, err := apiRequest(aWriter, aRequest)
+	if nil != err {
+		apiError(aWriter, http.StatusBadRequest, err.Error())
+		return
+	}
+	t, err := apiTime(req.Date)
+	if nil != err {
+		apiError(aWriter, http.StatusBadRequest, `invalid date`)
+		return
+	}
+	nid := time2id(t)
+	if poPersistence.ExistsContext(aRequest.Context(), nid) {
+		apiError(aWriter, http.StatusConflict, `posting exists`)
+		return
+	}
+
+	post := NewPosting(aID, "")
+	if err = post.ChangeID(nid); nil != err {
+		apachelogger.Err("TPageHandler.apiRedatePosting()",
+			fmt.Sprintf("TPosting.ChangeID(%d, %d): %v", aID, nid, err))
+		apiError(aWriter, http.StatusInternalServerError, err.Error())
+		return
+	}
+	RenameIDTags(ph.hashList, aID, nid)
+
+	post = NewPosting(nid, "")
+	if err = post.LoadContext(aRequest.Context()); nil != err {
+		apiError(aWriter, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	if aID != nid {
+		// The posting's URL (i.e. its ActivityPub ID) has changed:
+		ph.activityPub.Publish(apDelete, NewPosting(aID, ""))
+		ph.activityPub.Publish(apCreate, post)
+		ph.webmentions.Send(post)
+	}
+
+	aWriter.Header().Set(`Location`, apiPrefix+`postings/`+post.IDstr())
+	apiReply(aWriter, http.StatusOK, apiPosting(post))
+} // apiRedatePosting()
+
+// `apiSearch()` sends the postings matching the `q` query parameter.
+//
+// Query parameters:
+//   - `q`: The (literal) text to look for.
+//   - `offset`: The number of matching postings to skip.
+//   - `limit`: The max. number of postings to send.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+func (ph *TPageHandler) apiSearch(aWriter http.ResponseWriter, aRequest *http.Request) {
+	query := aRequest.URL.Query()
+	term := strings.TrimSpace(query.Get(`q`))
+	if 0 == len(term) {
+		apiError(aWriter, http.StatusBadRequest, `missing search term`)
+		return
+	}
+	var offset, limit uint64
+	var err error
+	if val := query.Get(`offset`); 0 < len(val) {
+		if offset, err = strconv.ParseUint(val, 10, 32); nil != err {
+			apiError(aWriter, http.StatusBadRequest, `invalid offset`)
+			return
+		}
+	}
+	if val := query.Get(`limit`); 0 < len(val) {
+		if limit, err = strconv.ParseUint(val, 10, 32); nil != err {
+			apiError(aWriter, http.StatusBadRequest, `invalid limit`)
+			return
+		}
+	}
+
+	pl, err := poPersistence.SearchContext(aRequest.Context(),
+		regexp.QuoteMeta(term), uint(offset), uint(limit))
+	if nil != err {
+		apiError(aWriter, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := tAPIpostingList{Postings: make([]tAPIposting, 0, pl.Len())}
+	for idx := range *pl {
+		result.Postings = append(result.Postings, apiPosting(&(*pl)[idx]))
+	}
+
+	apiReply(aWriter, http.StatusOK, result)
+} // apiSearch()
+
+// `apiUpdatePosting()` replaces the text of the posting with `aID`.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aID`: The ID of the posting to update.
+func (ph *TPageHandler) apiUpdatePosting(aWriter http.ResponseWriter, aRequest *http.Request, aID uint64) {
+	req, err := apiRequest(aWriter, aRequest)
+	if nil != err {
+		apiError(aWriter, http.StatusBadRequest, err.Error())
+		return
+	}
+	if (nil == req.Markdown) || (0 == len(strings.TrimSpace(*req.Markdown))) {
+		apiError(aWriter, http.StatusBadRequest, `missing markdown (use DELETE to remove a posting)`)
+		return
+	}
+
+	post := NewPosting(aID, *req.Markdown)
+	if _, err = post.StoreContext(aRequest.Context()); nil != err {
+		apachelogger.Err("TPageHandler.apiUpdatePosting()",
+			fmt.Sprintf("TPosting.StoreContext(%s): %v", post.IDstr(), err))
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrPostingModified) {
+			status = http.StatusConflict
+		}
+		apiError(aWriter, status, err.Error())
+		return
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	UpdateTags(ph.hashList, post)
+	ph.activityPub.Publish(apUpdate, post)
+	ph.webmentions.Send(post)
+
+	apiReply(aWriter, http.StatusOK, apiPosting(post))
+} // apiUpdatePosting()
+
+/* _EoF_ */
@@ -0,0 +1,219 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+// `apiTestCall()` sends a request to the API and returns the response.
+func apiTestCall(t *testing.T, aHandler *TPageHandler, aMethod, aURL, aBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(aMethod, aURL, strings.NewReader(aBody))
+	if 0 < len(aBody) {
+		req.Header.Set(`Content-Type`, `application/json`)
+	}
+	rec := httptest.NewRecorder()
+	aHandler.handleAPI(rec, req)
+
+	return rec
+} // apiTestCall()
+
+func prepAPITest(t *testing.T) *TPageHandler {
+	t.Helper()
+
+	prep4Tests()
+	AppArgs.Screenshot = false
+	ph, err := NewPageHandler()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return ph
+} // prepAPITest()
+
+func TestTPageHandler_handleAPI(t *testing.T) {
+	ph := prepAPITest(t)
+
+	// create
+	rec := apiTestCall(t, ph, http.MethodPost, `/api/v1/postings`,
+		`{"markdown": "Hello #world", "date": "2024-04-01T12:00:00Z"}`)
+	if http.StatusCreated != rec.Code {
+		t.Fatalf("create: status = %d, want %d (%s)", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var post tAPIposting
+	if err := json.Unmarshal(rec.Body.Bytes(), &post); nil != err {
+		t.Fatal(err)
+	}
+	wantID := id2str(time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)))
+	if (wantID != post.ID) || ("Hello #world" != post.Markdown) {
+		t.Errorf("create: got %+v, want ID %q", post, wantID)
+	}
+	if loc := rec.Header().Get(`Location`); `/api/v1/postings/`+wantID != loc {
+		t.Errorf("create: Location = %q", loc)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{" 1", http.MethodPost, `/api/v1/postings`, `{"markdown": "x", "date": "2024-04-01T12:00:00Z"}`, http.StatusConflict},
+		{" 2", http.MethodPost, `/api/v1/postings`, `{"markdown": " "}`, http.StatusBadRequest},
+		{" 3", http.MethodPost, `/api/v1/postings`, `{"text": "x"}`, http.StatusBadRequest},
+		{" 4", http.MethodPost, `/api/v1/postings`, ``, http.StatusBadRequest},
+		{" 5", http.MethodGet, `/api/v1/postings/` + wantID, ``, http.StatusOK},
+		{" 6", http.MethodGet, `/api/v1/postings/0000000000000001`, ``, http.StatusNotFound},
+		{" 7", http.MethodGet, `/api/v1/postings/xyz`, ``, http.StatusNotFound},
+		{" 8", http.MethodPut, `/api/v1/postings/` + wantID, `{"markdown": "Hello again"}`, http.StatusOK},
+		{" 9", http.MethodPut, `/api/v1/postings/` + wantID, `{}`, http.StatusBadRequest},
+		{"10", http.MethodGet, `/api/v1/search?q=again`, ``, http.StatusOK},
+		{"11", http.MethodGet, `/api/v1/search`, ``, http.StatusBadRequest},
+		{"12", http.MethodGet, `/api/v1/tags`, ``, http.StatusOK},
+		{"13", http.MethodGet, `/api/v1/unknown`, ``, http.StatusNotFound},
+		{"14", http.MethodDelete, `/api/v1/postings`, ``, http.StatusMethodNotAllowed},
+		{"15", http.MethodOptions, `/api/v1/postings`, ``, http.StatusNoContent},
+		{"16", http.MethodGet, `/api/v1/postings?limit=x`, ``, http.StatusBadRequest},
+		{"17", http.MethodGet, `/api/v2/postings`, ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := apiTestCall(t, ph, tt.method, tt.url, tt.body); tt.wantStatus != rec.Code {
+				t.Errorf("%s %s: status = %d, want %d (%s)",
+					tt.method, tt.url, rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	// re-date
+	rec = apiTestCall(t, ph, http.MethodPost, `/api/v1/postings/`+wantID+`/date`,
+		`{"date": "2023-04-01T12:00:00Z"}`)
+	if http.StatusOK != rec.Code {
+		t.Fatalf("re-date: status = %d, want %d (%s)", rec.Code, http.StatusOK, rec.Body)
+	}
+	newID := id2str(time2id(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)))
+	if rec = apiTestCall(t, ph, http.MethodGet, `/api/v1/postings/`+wantID, ``); http.StatusNotFound != rec.Code {
+		t.Errorf("re-date: old posting status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec = apiTestCall(t, ph, http.MethodGet, `/api/v1/postings/`+newID, ``); http.StatusOK != rec.Code {
+		t.Errorf("re-date: new posting status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// delete
+	if rec = apiTestCall(t, ph, http.MethodDelete, `/api/v1/postings/`+newID, ``); http.StatusNoContent != rec.Code {
+		t.Errorf("delete: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if poPersistence.Exists(str2id(newID)) {
+		t.Errorf("delete: posting %s still exists", newID)
+	}
+} // TestTPageHandler_handleAPI()
+
+func TestTPageHandler_apiBacklinks(t *testing.T) {
+	ph := prepAPITest(t)
+
+	target := NewPosting(0, "The API target")
+	if _, err := target.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(target.ID(), "").Delete() }()
+
+	rec := apiTestCall(t, ph, http.MethodPost, `/api/v1/postings`,
+		`{"markdown": "See [[`+target.IDstr()+`]]"}`)
+	if http.StatusCreated != rec.Code {
+		t.Fatalf("create: status = %d, want %d (%s)", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var post tAPIposting
+	if err := json.Unmarshal(rec.Body.Bytes(), &post); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(str2id(post.ID), "").Delete() }()
+	if got := Backlinks(target.ID()); (1 != len(got)) || (post.ID != got[0].ID) {
+		t.Errorf("create: Backlinks() = %v, want %s", got, post.ID)
+	}
+
+	if rec = apiTestCall(t, ph, http.MethodPut, `/api/v1/postings/`+post.ID, `{"markdown": "No link"}`); http.StatusOK != rec.Code {
+		t.Fatalf("update: status = %d, want %d (%s)", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := Backlinks(target.ID()); 0 != len(got) {
+		t.Errorf("update: Backlinks() = %v, want none", got)
+	}
+} // TestTPageHandler_apiBacklinks()
+
+func TestTPageHandler_apiListPostings(t *testing.T) {
+	ph := prepAPITest(t)
+
+	for day := 1; 5 >= day; day++ {
+		id := time2id(time.Date(2024, 4, day, 12, 0, 0, 0, time.Local))
+		if _, err := NewPosting(id, "posting").Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantCount  int
+		wantCursor bool
+	}{
+		{" 1", `limit=2`, 2, true},
+		{" 2", `limit=10`, 5, false},
+		{" 3", `limit=5`, 5, false},
+		{" 4", `from=2024-04-02&to=2024-04-03`, 2, false},
+		{" 5", `from=2024-04-06`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiTestCall(t, ph, http.MethodGet, `/api/v1/postings?`+tt.query, ``)
+			var got tAPIpostingList
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); nil != err {
+				t.Fatal(err)
+			}
+			if (tt.wantCount != len(got.Postings)) || (tt.wantCursor != (0 < len(got.NextCursor))) {
+				t.Errorf("list(%s) = %d/%q, want %d/%v",
+					tt.query, len(got.Postings), got.NextCursor, tt.wantCount, tt.wantCursor)
+			}
+		})
+	}
+
+	// follow the cursor through all pages
+	var seen []string
+	for url := `/api/v1/postings?limit=2`; 0 < len(url); {
+		var got tAPIpostingList
+		if err := json.Unmarshal(apiTestCall(t, ph, http.MethodGet, url, ``).Body.Bytes(), &got); nil != err {
+			t.Fatal(err)
+		}
+		for _, p := range got.Postings {
+			seen = append(seen, p.ID)
+		}
+		url = ``
+		if 0 < len(got.NextCursor) {
+			url = `/api/v1/postings?limit=2&cursor=` + got.NextCursor
+		}
+	}
+	if 5 != len(seen) {
+		t.Fatalf("cursor pagination: got %d postings, want 5", len(seen))
+	}
+	for idx := 1; idx < len(seen); idx++ {
+		if seen[idx-1] <= seen[idx] {
+			t.Errorf("cursor pagination: %v not sorted newest first", seen)
+			break
+		}
+	}
+} // TestTPageHandler_apiListPostings()
+
+/* _EoF_ */
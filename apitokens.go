@@ -0,0 +1,383 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides personal API tokens, i.e. revocable bearer
+ * tokens with a limited scope for scripts and other non-browser
+ * clients.
+ *
+ * Only the SHA-256 hash of a token gets stored; the token itself is
+ * shown just once when it's created.
+ */
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+const (
+	// `TokenScopeAdmin` allows all operations.
+	TokenScopeAdmin = `admin`
+
+	// `TokenScopePost` allows reading and creating postings.
+	TokenScopePost = `post`
+
+	// `TokenScopeRead` allows only reading.
+	TokenScopeRead = `read`
+
+	// `tkPrefix` is prepended to all tokens to make them recognisable.
+	tkPrefix = `nele_`
+)
+
+type (
+	// `TAPIToken` describes a single personal API token.
+	TAPIToken struct {
+		Created time.Time `json:"created"` // creation time
+		Hash    string    `json:"hash"`    // hex encoded SHA-256 of the token
+		ID      string    `json:"id"`      // public ID used for revoking
+		Name    string    `json:"name"`    // description given by the user
+		Scope   string    `json:"scope"`   // `admin`, `post`, or `read`
+	}
+
+	// `TTokenList` is the list of all personal API tokens.
+	TTokenList struct {
+		fName  string                // name of the file storing the tokens
+		mtx    sync.RWMutex          // guard against concurrent accesses
+		tokens map[string]*TAPIToken // tokens indexed by their hash
+	}
+)
+
+var (
+	// `ErrTokenInvalid` is returned for unknown or revoked tokens.
+	ErrTokenInvalid = errors.New("invalid API token")
+
+	// `ErrTokenMissing` is returned if a request carries no token.
+	ErrTokenMissing = errors.New("missing API token")
+
+	// `ErrTokenScope` is returned for an unknown token scope.
+	ErrTokenScope = errors.New("invalid token scope (use `admin`, `post`, or `read`)")
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `bearerToken()` returns the bearer token sent with `aRequest`.
+//
+// Parameters:
+//   - `aRequest`: The request to inspect.
+//
+// Returns:
+//   - `string`: The token sent by the remote client.
+//   - `bool`: `true` if a bearer token was sent, `false` otherwise.
+func bearerToken(aRequest *http.Request) (string, bool) {
+	if nil == aRequest {
+		return "", false
+	}
+	auth := aRequest.Header.Get(`Authorization`)
+	if (7 > len(auth)) || !strings.EqualFold(auth[:7], `Bearer `) {
+		return "", false
+	}
+
+	return strings.TrimSpace(auth[7:]), true
+} // bearerToken()
+
+// `tkHash()` returns the hex encoded SHA-256 hash of `aToken`.
+func tkHash(aToken string) string {
+	sum := sha256.Sum256([]byte(aToken))
+
+	return hex.EncodeToString(sum[:])
+} // tkHash()
+
+// `tkRandom()` returns `aLen` hex encoded random bytes.
+func tkRandom(aLen int) (string, error) {
+	buf := make([]byte, aLen)
+	if _, err := rand.Read(buf); nil != err {
+		return "", se.Wrap(err, 1)
+	}
+
+	return hex.EncodeToString(buf), nil
+} // tkRandom()
+
+// --------------------------------------------------------------------------
+// TAPIToken methods
+
+// `Allows()` reports whether the token's scope permits `aRequest`.
+//
+// A `read` token allows only safe (i.e. `GET`, `HEAD`, and `OPTIONS`)
+// requests, a `post` token additionally allows to create new postings,
+// and an `admin` token allows everything.
+//
+// Parameters:
+//   - `aRequest`: The request to check.
+//
+// Returns:
+//   - `bool`: `true` if the request is permitted, `false` otherwise.
+func (t *TAPIToken) Allows(aRequest *http.Request) bool {
+	switch aRequest.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	switch t.Scope {
+	case TokenScopeAdmin:
+		return true
+
+	case TokenScopePost:
+		if http.MethodPost != aRequest.Method {
+			return false
+		}
+		switch strings.TrimSuffix(aRequest.URL.Path, `/`) {
+		case strings.TrimSuffix(apiPrefix, `/`) + `/postings`, `/ap`,
+			mpPath, mpPath + `/media`:
+			return true
+		}
+	}
+
+	return false
+} // Allows()
+
+// --------------------------------------------------------------------------
+// constructor function:
+
+// `LoadTokens()` reads the list of API tokens from `aFilename`.
+//
+// A missing file is not considered an error but results in an
+// empty list.
+//
+// Parameters:
+//   - `aFilename`: The name of the file storing the tokens.
+//
+// Returns:
+//   - `*TTokenList`: The list of API tokens.
+//   - `error`: A possible I/O or decoding error.
+func LoadTokens(aFilename string) (*TTokenList, error) {
+	result := &TTokenList{
+		fName:  aFilename,
+		tokens: make(map[string]*TAPIToken),
+	}
+
+	data, err := os.ReadFile(aFilename) /* #nosec G304 */
+	if nil != err {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, se.Wrap(err, 3)
+	}
+
+	var list []*TAPIToken
+	if err = json.Unmarshal(data, &list); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	for _, tok := range list {
+		result.tokens[tok.Hash] = tok
+	}
+
+	return result, nil
+} // LoadTokens()
+
+// --------------------------------------------------------------------------
+// TTokenList methods
+
+// `Add()` creates a new token with `aName` and `aScope` and stores
+// the updated list.
+//
+// Parameters:
+//   - `aName`: A description of the token's purpose.
+//   - `aScope`: The token's scope (`admin`, `post`, or `read`).
+//
+// Returns:
+//   - `string`: The new token; it can't be retrieved later.
+//   - `*TAPIToken`: The new token's stored data.
+//   - `error`: A possible scope or I/O error.
+func (tl *TTokenList) Add(aName, aScope string) (string, *TAPIToken, error) {
+	switch aScope {
+	case TokenScopeAdmin, TokenScopePost, TokenScopeRead:
+	default:
+		return "", nil, ErrTokenScope
+	}
+
+	id, err := tkRandom(4)
+	if nil != err {
+		return "", nil, err
+	}
+	secret, err := tkRandom(24)
+	if nil != err {
+		return "", nil, err
+	}
+	token := tkPrefix + secret
+	tok := &TAPIToken{
+		Created: time.Now().Truncate(time.Second),
+		Hash:    tkHash(token),
+		ID:      id,
+		Name:    strings.TrimSpace(aName),
+		Scope:   aScope,
+	}
+
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	tl.tokens[tok.Hash] = tok
+	if err = tl.store(); nil != err {
+		delete(tl.tokens, tok.Hash)
+		return "", nil, err
+	}
+
+	return token, tok, nil
+} // Add()
+
+// `Authenticate()` checks the bearer token sent with `aRequest`.
+//
+// Parameters:
+//   - `aRequest`: The request to check.
+//
+// Returns:
+//   - `*TAPIToken`: The matching token's data.
+//   - `error`: `ErrTokenMissing`, `ErrTokenInvalid`, or `nil` on success.
+func (tl *TTokenList) Authenticate(aRequest *http.Request) (*TAPIToken, error) {
+	token, ok := bearerToken(aRequest)
+	if !ok {
+		return nil, ErrTokenMissing
+	}
+
+	return tl.Check(token)
+} // Authenticate()
+
+// `Check()` looks up the given `aToken`.
+//
+// Parameters:
+//   - `aToken`: The token sent by the remote client.
+//
+// Returns:
+//   - `*TAPIToken`: The matching token's data.
+//   - `error`: `ErrTokenInvalid`, or `nil` on success.
+func (tl *TTokenList) Check(aToken string) (*TAPIToken, error) {
+	if nil == tl {
+		return nil, ErrTokenInvalid
+	}
+
+	tl.mtx.RLock()
+	defer tl.mtx.RUnlock()
+
+	if tok, ok := tl.tokens[tkHash(aToken)]; ok {
+		return tok, nil
+	}
+
+	return nil, ErrTokenInvalid
+} // Check()
+
+// `Len()` returns the number of tokens in the list.
+func (tl *TTokenList) Len() int {
+	if nil == tl {
+		return 0
+	}
+	tl.mtx.RLock()
+	defer tl.mtx.RUnlock()
+
+	return len(tl.tokens)
+} // Len()
+
+// `List()` returns all tokens sorted by their creation time.
+//
+// Returns:
+//   - `[]TAPIToken`: A copy of the list's tokens.
+func (tl *TTokenList) List() []TAPIToken {
+	if nil == tl {
+		return nil
+	}
+	tl.mtx.RLock()
+	defer tl.mtx.RUnlock()
+
+	result := make([]TAPIToken, 0, len(tl.tokens))
+	for _, tok := range tl.tokens {
+		result = append(result, *tok)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Created.Equal(result[j].Created) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Created.Before(result[j].Created)
+	})
+
+	return result
+} // List()
+
+// `Revoke()` removes the token with `aID` and stores the updated list.
+//
+// Parameters:
+//   - `aID`: The public ID of the token to remove.
+//
+// Returns:
+//   - `error`: `ErrTokenInvalid` if there's no such token, or an I/O error.
+func (tl *TTokenList) Revoke(aID string) error {
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	for hash, tok := range tl.tokens {
+		if aID == tok.ID {
+			delete(tl.tokens, hash)
+			if err := tl.store(); nil != err {
+				tl.tokens[hash] = tok
+				return err
+			}
+			return nil
+		}
+	}
+
+	return ErrTokenInvalid
+} // Revoke()
+
+// `store()` writes the list to its file.
+//
+// NOTE: The caller must hold the write lock.
+//
+// Returns:
+//   - `error`: A possible I/O error.
+func (tl *TTokenList) store() error {
+	list := make([]*TAPIToken, 0, len(tl.tokens))
+	for _, tok := range tl.tokens {
+		list = append(list, tok)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	data, err := json.MarshalIndent(list, "", "\t")
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	if err = os.MkdirAll(filepath.Dir(tl.fName), 0770); nil != err {
+		return se.Wrap(err, 1)
+	}
+	tmpName := tl.fName + `~`
+	if err = os.WriteFile(tmpName, data, 0600); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	if err = os.Rename(tmpName, tl.fName); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	return nil
+} // store()
+
+/* _EoF_ */
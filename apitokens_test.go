@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+func TestTTokenList(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "tokens.json")
+	tl, err := LoadTokens(fName)
+	if (nil != err) || (0 != tl.Len()) {
+		t.Fatalf("LoadTokens() = %d, %v", tl.Len(), err)
+	}
+
+	if _, _, err = tl.Add("bad", "root"); nil == err {
+		t.Errorf("TTokenList.Add(`root`): expected an error")
+	}
+	token, tok, err := tl.Add(" script ", TokenScopePost)
+	if nil != err {
+		t.Fatalf("TTokenList.Add() error = %v", err)
+	}
+	if !strings.HasPrefix(token, tkPrefix) || ("script" != tok.Name) || (tkHash(token) != tok.Hash) {
+		t.Errorf("TTokenList.Add() = %q, %+v", token, tok)
+	}
+
+	// the stored list must not contain the token itself:
+	tl2, err := LoadTokens(fName)
+	if (nil != err) || (1 != tl2.Len()) {
+		t.Fatalf("LoadTokens() = %d, %v", tl2.Len(), err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/postings", nil)
+	if _, err = tl2.Authenticate(req); ErrTokenMissing != err {
+		t.Errorf("TTokenList.Authenticate() = %v, want %v", err, ErrTokenMissing)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if got, err := tl2.Authenticate(req); (nil != err) || (tok.ID != got.ID) {
+		t.Errorf("TTokenList.Authenticate() = %v, %v", got, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	if _, err = tl2.Authenticate(req); ErrTokenInvalid != err {
+		t.Errorf("TTokenList.Authenticate() = %v, want %v", err, ErrTokenInvalid)
+	}
+
+	if err = tl2.Revoke("unknown"); ErrTokenInvalid != err {
+		t.Errorf("TTokenList.Revoke(`unknown`) = %v", err)
+	}
+	if err = tl2.Revoke(tok.ID); nil != err {
+		t.Errorf("TTokenList.Revoke() error = %v", err)
+	}
+	if tl3, _ := LoadTokens(fName); 0 != tl3.Len() {
+		t.Errorf("TTokenList.Revoke(): %d tokens left", tl3.Len())
+	}
+} // TestTTokenList()
+
+func TestTAPIToken_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		scope  string
+		method string
+		url    string
+		want   bool
+	}{
+		{" 1", TokenScopeRead, http.MethodGet, "/api/v1/postings", true},
+		{" 2", TokenScopeRead, http.MethodPost, "/api/v1/postings", false},
+		{" 3", TokenScopePost, http.MethodPost, "/api/v1/postings", true},
+		{" 4", TokenScopePost, http.MethodPost, "/ap/", true},
+		{" 5", TokenScopePost, http.MethodPut, "/api/v1/postings/0123456789abcdef", false},
+		{" 6", TokenScopePost, http.MethodDelete, "/api/v1/postings/0123456789abcdef", false},
+		{" 7", TokenScopePost, http.MethodPost, "/tokens/", false},
+		{" 8", TokenScopeAdmin, http.MethodDelete, "/api/v1/postings/0123456789abcdef", true},
+		{" 9", TokenScopeAdmin, http.MethodPost, "/tokens/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := &TAPIToken{Scope: tt.scope}
+			if got := tok.Allows(httptest.NewRequest(tt.method, tt.url, nil)); got != tt.want {
+				t.Errorf("TAPIToken.Allows(%s %s) = %v, want %v", tt.method, tt.url, got, tt.want)
+			}
+		})
+	}
+} // TestTAPIToken_Allows()
+
+func TestTPageHandler_ServeHTTP_token(t *testing.T) {
+	ph := prepAPITest(t)
+	tl, err := LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	ph.tokenList = tl
+	readToken, _, _ := tl.Add("reader", TokenScopeRead)
+	postToken, _, _ := tl.Add("poster", TokenScopePost)
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{" 1", readToken, http.MethodGet, "/api/v1/tags", "", http.StatusOK},
+		{" 2", readToken, http.MethodPost, "/api/v1/postings", `{"markdown": "x"}`, http.StatusForbidden},
+		{" 3", postToken, http.MethodPost, "/api/v1/postings", `{"markdown": "x"}`, http.StatusCreated},
+		{" 4", "nele_invalid", http.MethodGet, "/api/v1/tags", "", http.StatusUnauthorized},
+		{" 5", postToken, http.MethodGet, "/tokens/", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			ph.ServeHTTP(rec, req)
+			if tt.want != rec.Code {
+				t.Errorf("ServeHTTP(%s %s) = %d, want %d", tt.method, tt.url, rec.Code, tt.want)
+			}
+		})
+	}
+} // TestTPageHandler_ServeHTTP_token()
+
+/* _EoF_ */
@@ -69,6 +69,82 @@ func doFile(aMe string) {
 	os.Exit(0)
 } // doFile()
 
+// `doMediaClean()` checks for the `mediaClean` commandline argument,
+// removes (or with `dryRun` just lists) all unreferenced media files,
+// and terminates the program.
+func doMediaClean(aMe string) {
+	if !nele.AppArgs.MediaClean {
+		// no cmd line action
+		return
+	}
+	// files in `img/` are only removed after confirming them
+	// on the `/media/` page:
+	removed, err := nele.CleanMedia(context.Background(), nele.AppArgs.DryRun, nil)
+	if nele.AppArgs.DryRun {
+		list := nele.TMediaList{}
+		for _, mf := range removed {
+			if mf.NeedsConfirm() {
+				fmt.Printf("%s\t%s\t(kept: confirm on the /media/ page)\n", mf.Path, mf.SizeStr())
+				continue
+			}
+			list = append(list, mf)
+		}
+		removed = list
+	}
+	for _, mf := range removed {
+		fmt.Printf("%s\t%s\n", mf.Path, mf.SizeStr())
+	}
+	verb := "deleted"
+	if nele.AppArgs.DryRun {
+		verb = "would delete"
+	}
+	log.Printf("\n\t%s %s %d unused files (%d bytes)", aMe, verb, len(removed), removed.Size())
+	if nil != err {
+		log.Fatalf("%s: %v", aMe, err)
+	}
+	os.Exit(0)
+} // doMediaClean()
+
+// `doMDcompare()` checks for the `mdCompare` commandline argument,
+// lists all postings whose HTML would change when switching to the
+// given Markdown renderer, and terminates the program.
+func doMDcompare(aMe string) {
+	if 0 == len(nele.AppArgs.MDcompare) {
+		// no cmd line action
+		return
+	}
+	renderer, err := nele.NewMarkdownRenderer(nele.AppArgs.MDcompare)
+	if nil != err {
+		log.Fatalf("%s: %v", aMe, err)
+	}
+	diffs, err := nele.CompareRenderers(context.Background(), renderer)
+	for _, d := range diffs {
+		fmt.Printf("%016x\tline %d\n\t- %s\n\t+ %s\n", d.ID, d.Line, d.Old, d.New)
+	}
+	log.Printf("\n\t%s: %d postings would change with `%s` instead of `%s`",
+		aMe, len(diffs), renderer.ID(), nele.MarkdownRenderer().ID())
+	if nil != err {
+		log.Fatalf("%s: %v", aMe, err)
+	}
+	os.Exit(0)
+} // doMDcompare()
+
+// `doRelink()` checks for the `relink` commandline argument, migrates
+// the postings' shared uploads into attachments, and terminates
+// the program.
+func doRelink(aMe string) {
+	if !nele.AppArgs.Relink {
+		// no cmd line action
+		return
+	}
+	postings, files, err := nele.RelinkAttachments(context.Background())
+	log.Printf("\n\t%s moved %d files into the attachments of %d postings", aMe, files, postings)
+	if nil != err {
+		log.Fatalf("%s: %v", aMe, err)
+	}
+	os.Exit(0)
+} // doRelink()
+
 // `exit()` Log `aMessage` and terminate the program.
 func exit(aMessage string) {
 	apachelogger.Err("Nele/main", aMessage)
@@ -113,12 +189,6 @@ func setupSignals(aServer *http.Server) {
 			break
 		} // for
 
-		ctx, cancel := context.WithCancel(context.Background())
-		aServer.BaseContext = func(net.Listener) context.Context {
-			return ctx
-		}
-		aServer.RegisterOnShutdown(cancel)
-
 		ctxTimeout, cancelTimeout := context.WithTimeout(
 			context.Background(), time.Second*10)
 		defer cancelTimeout()
@@ -128,6 +198,25 @@ func setupSignals(aServer *http.Server) {
 	}()
 } // setupSignals()
 
+// `tokenCmdline()` checks for and executes API token commandline actions.
+func tokenCmdline() {
+	if 0 == len(nele.AppArgs.TokenFile) {
+		return // without file no token handling
+	}
+
+	// All the following `nele.TokenXxx()` function calls will
+	// terminate the program.
+	if 0 < len(nele.AppArgs.TokenAdd) {
+		nele.TokenAdd(nele.AppArgs.TokenAdd, nele.AppArgs.TokenScope, nele.AppArgs.TokenFile)
+	}
+	if nele.AppArgs.TokenList {
+		nele.TokenList(nele.AppArgs.TokenFile)
+	}
+	if 0 < len(nele.AppArgs.TokenRevoke) {
+		nele.TokenRevoke(nele.AppArgs.TokenRevoke, nele.AppArgs.TokenFile)
+	}
+} // tokenCmdline()
+
 // `userCmdline()` checks for and executes password file commandline actions.
 func userCmdline() {
 	if 0 == len(nele.AppArgs.UserFile) {
@@ -171,9 +260,21 @@ func main() {
 	// Read in a file as a new posting:
 	doFile(Me)
 
+	// Migrate shared uploads into the postings' attachments:
+	doRelink(Me)
+
+	// Remove the media files not used by any posting:
+	doMediaClean(Me)
+
+	// Compare the current Markdown renderer with another one:
+	doMDcompare(Me)
+
 	// Handle password file maintenance:
 	userCmdline()
 
+	// Handle API token maintenance:
+	tokenCmdline()
+
 	if ph, err = nele.NewPageHandler(); nil != err {
 		nele.ShowHelp()
 		exit(fmt.Sprintf("%s: %v", Me, err))
@@ -189,9 +290,11 @@ func main() {
 	// Inspect logging commandline arguments and setup the `ApacheLogger`:
 	handler = apachelogger.Wrap(handler, nele.AppArgs.AccessLog, nele.AppArgs.ErrorLog)
 
-	ctxTimeout, cancelTimeout := context.WithTimeout(
-		context.Background(), time.Second*10)
-	defer cancelTimeout()
+	// The requests' base context gets cancelled on shutdown so that
+	// long running storage operations (e.g. walking all postings)
+	// are aborted as well:
+	ctxBase, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
 
 	// We need a `server` reference to use it in `setupSignals()`
 	// and to set some reasonable timeouts:
@@ -200,7 +303,7 @@ func main() {
 		Addr: nele.AppArgs.Addr,
 		// Return the base context for incoming requests on this server:
 		BaseContext: func(net.Listener) context.Context {
-			return ctxTimeout
+			return ctxBase
 		},
 		// Request handler to invoke:
 		Handler: handler,
@@ -222,6 +325,7 @@ func main() {
 	if 0 < len(nele.AppArgs.ErrorLog) {
 		apachelogger.SetErrorLog(server)
 	}
+	server.RegisterOnShutdown(cancelBase)
 	setupSignals(server)
 
 	if 0 < len(nele.AppArgs.CertKey) && (0 < len(nele.AppArgs.CertPem)) {
@@ -18,40 +18,65 @@ type (
 	// `TAppArgs` is a collection of commandline arguments and INI values.
 	TAppArgs struct {
 		AccessLog     string // (optional) name of page access logfile
+		ActivityPub   bool   // whether to provide an ActivityPub actor
 		Addr          string // listen address ("1.2.3.4:5678")
+		APuser        string // user name of the ActivityPub actor
 		BlogName      string // name/description of this blog
 		CertKey       string // TLS certificate key
 		CertPem       string // private TLS certificate
 		DataDir       string // base directory of application's data
 		delWhitespace bool   // remove whitespace from generated pages
+		DryRun        bool   // only report what `MediaClean` would delete
 		Dump          bool   // Debug: dump this structure to `StdOut`
 		ErrorLog      string // (optional) name of page error logfile
 		GZip          bool   // send compressed data to remote browser
 		HashFile      string // file of hashtag/mention database
+		Highlight     bool   // highlight the syntax of code blocks
+		HTMLallow     string // additional HTML elements/attributes to allow
 		// Intl       string // path/filename of the localisation file
 		Lang     string // default GUI language
 		listen   string // IP of host to listen at
 		LogStack bool   // log stack trace in case of errors
 
+		Markdown    string // name of the Markdown renderer to use
 		MaxFileSize int64  // max. upload file size
 		mfs         string // max. upload file size
+		MDcompare   string // Markdown renderer to compare with
+		MediaClean  bool   // delete unreferenced media files
 
 		Name string // name of the actual program
 
+		PageCache    int64  // max. size of the rendered-page cache
+		PageCacheDir string // (optional) directory of the page cache
+		pcs          string // max. size of the rendered-page cache
+
 		PageLength  uint   // the number of postings to show per page
-		persistence string // either `db`, `fs`, or `tee`.`
+		persistence string // either `db`, `fs`, or `s3`
 		PostAdd     bool   // whether to write a posting from commandline
 		PostFile    string // name of file to post
 		port        int    // port to listen to
+		PublicURL   string // public base URL of the blog
 		Realm       string // host/domain to secure by BasicAuth
+		Relink      bool   // migrate shared uploads to posting attachments
+		S3Bucket    string // name of the S3 bucket storing the postings
+		S3CredFile  string // file with the S3 access keys
+		S3Endpoint  string // URL of the S3 server
+		S3Region    string // region of the S3 server
 		Screenshot  bool   // whether to use page screenshots or not
 		Theme       string // `dark` or `light` display theme
+		TokenAdd    string // name of an API token to create
+		TokenFile   string // name of the file storing the API tokens
+		TokenList   bool   // print out a list of current API tokens
+		TokenRevoke string // ID of an API token to revoke
+		TokenScope  string // scope of the API token to create
+		TrustedHTML bool   // don't sanitise the postings' HTML
 		UserAdd     string // username to add to password list
 		UserCheck   string // username to check in password list
 		UserDelete  string // username to delete from password list
 		UserFile    string // (optional) name of page access logfile
 		UserList    bool   // print out a list of current users
 		UserUpdate  string // username to update in password list
+		Webmention  bool   // whether to send/receive Webmentions
 	}
 )
 
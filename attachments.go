@@ -0,0 +1,507 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides functions to handle the files attached to
+ * a certain posting.
+ *
+ * All attachments of a posting are stored in a directory named after
+ * the posting's ID below `<dataDir>/attachments/` so they can be moved
+ * and removed together with their posting.
+ */
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+const (
+	// `atDirName` is the name of the directory (below `AppArgs.DataDir`)
+	// as well as of the URL directory holding the postings' attachments.
+	atDirName = `attachments`
+)
+
+// --------------------------------------------------------------------------
+// public functions:
+
+// `AttachmentDir()` returns the directory holding the attachments of
+// the posting with `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the posting owning the attachments.
+//
+// Returns:
+//   - `string`: The posting's attachment directory.
+func AttachmentDir(aID uint64) string {
+	return filepath.Join(AppArgs.DataDir, atDirName, id2str(aID))
+} // AttachmentDir()
+
+// `AttachmentURL()` returns the URL path of the file `aName` attached
+// to the posting with `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the posting owning the attachment.
+//   - `aName`: The attachment's file name.
+//
+// Returns:
+//   - `string`: The URL path to access the attachment.
+func AttachmentURL(aID uint64, aName string) string {
+	return `/` + atDirName + `/` + id2str(aID) + `/` + aName
+} // AttachmentURL()
+
+// `Attachments()` returns the names of all files attached to the
+// posting with `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the posting owning the attachments.
+//
+// Returns:
+//   - `[]string`: The sorted list of file names (possibly empty).
+//   - `error`: A possible I/O error, or `nil` on success.
+func Attachments(aID uint64) ([]string, error) {
+	entries, err := os.ReadDir(AttachmentDir(aID))
+	if nil != err {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, se.Wrap(err, 2)
+	}
+
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			result = append(result, entry.Name())
+		}
+	}
+	sort.Strings(result)
+
+	return result, nil
+} // Attachments()
+
+var (
+	// RegEx to find a reference to a local file in a text: a path in
+	// one of the upload directories whether used by a Markdown link
+	// (with or without title), an HTML attribute, a reference
+	// definition, a CSS `url()`, or a shortcode argument.
+	atRefRE = regexp.MustCompile(`(?:^|[^\w.~-])/?((?:` + atDirName + `|img|static)/[^\s"'()<>\[\]{}|\\]+)`)
+	//                                              11111111111111111111111111111111111111111111111111111111
+
+	// RegEx to find links to files in the shared upload directories:
+	// `](/img/name)` or `](/static/name)`.
+	atSharedLinkRE = regexp.MustCompile(`\]\(\s*/(img|static)/([^/\s\)]+)\s*\)`)
+	//                                           1111111111   2222222222
+)
+
+// `References()` returns the files referenced by the postings and
+// by the page templates and stylesheets.
+//
+// The keys are the files' URL paths without the leading slash
+// (e.g. `img/name.png`); a directory (like the one used by a
+// `gallery` shortcode) stands for all the files it contains.
+//
+// If any posting can't be read an error is returned, so callers
+// won't take files for unused which that posting refers to.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `map[string][]uint64`: The referenced files along with the referencing postings (`0` standing for the page templates).
+//   - `error`: A possible error, or `nil` on success.
+func References(aCtx context.Context) (map[string][]uint64, error) {
+	var mtx sync.Mutex
+	result := make(map[string][]uint64)
+	add := func(aRefs []string, aID uint64) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, ref := range aRefs {
+			if ids := result[ref]; (0 == len(ids)) || (aID != ids[len(ids)-1]) {
+				result[ref] = append(ids, aID)
+			}
+		}
+	} // add()
+
+	add(atLayoutReferences(), 0)
+	wf := func(aID uint64) error {
+		post := NewPosting(aID, "")
+		if err := post.LoadContext(aCtx); nil != err {
+			return err // an unknown posting might refer to any file
+		}
+		add(atReferences(post.markdown), aID)
+
+		return nil
+	} // wf()
+	if err := WalkParallel(aCtx, 0, wf, nil); nil != err {
+		return nil, err
+	}
+
+	return result, nil
+} // References()
+
+// `RelinkAttachments()` migrates the files linked from postings
+// in the shared `img/` and `static/` upload directories into the
+// respective posting's attachment directory and updates the links
+// in the postings' text accordingly.
+//
+// A file linked from several postings is copied to each of them.
+// Page screenshot images are left alone since they are handled by
+// the screenshot facility.
+// The original files are removed after all postings were processed
+// unless they are still referenced otherwise.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `int`: The number of postings updated.
+//   - `int`: The number of shared files migrated.
+//   - `error`: The aggregated errors of the migration, or `nil` on success.
+func RelinkAttachments(aCtx context.Context) (int, int, error) {
+	var (
+		mtx      sync.Mutex
+		postings int
+		migrated = make(map[string]bool)
+	)
+
+	wf := func(aID uint64) error {
+		post := NewPosting(aID, "")
+		if err := post.LoadContext(aCtx); nil != err {
+			return err
+		}
+		if 0 == post.Len() {
+			return nil
+		}
+
+		// skip the page screenshots:
+		skip := make(map[string]bool)
+		for _, pair := range checkScreenshotURLs(post.markdown) {
+			skip[pair.imgURL] = true
+		}
+
+		var files []string
+		changed := false
+		markdown := atSharedLinkRE.ReplaceAllFunc(post.markdown, func(aLink []byte) []byte {
+			parts := atSharedLinkRE.FindSubmatch(aLink)
+			name := string(parts[2])
+			if skip[name] {
+				return aLink
+			}
+			src := filepath.Join(AppArgs.DataDir, string(parts[1]), name)
+			attached, err := copyAttachment(src, aID)
+			if nil != err {
+				return aLink // no file, no link change
+			}
+			files = append(files, src)
+			changed = true
+
+			return []byte("](" + AttachmentURL(aID, attached) + ")")
+		})
+		if !changed {
+			return nil
+		}
+		if _, err := post.Set(markdown).Store(); nil != err {
+			return err
+		}
+
+		mtx.Lock()
+		postings++
+		for _, src := range files {
+			migrated[src] = true
+		}
+		mtx.Unlock()
+
+		return nil
+	} // wf()
+
+	err := WalkParallel(aCtx, 0, wf, nil)
+	if nil != err {
+		// Keep the shared files: some postings might still link them.
+		return postings, 0, err
+	}
+
+	// Only remove the files nothing refers to anymore, e.g. by
+	// an HTML `<img>` or a link with a title:
+	refs, err := References(aCtx)
+	if nil != err {
+		return postings, len(migrated), err
+	}
+	for src := range migrated {
+		name, rErr := filepath.Rel(AppArgs.DataDir, src)
+		if (nil != rErr) || atReferenced(refs, filepath.ToSlash(name)) {
+			continue
+		}
+		if rErr = os.Remove(src); nil != rErr {
+			err = errors.Join(err, se.Wrap(rErr, 1))
+		}
+	}
+
+	return postings, len(migrated), err
+} // RelinkAttachments()
+
+// --------------------------------------------------------------------------
+// internal functions:
+
+// `atLayoutReferences()` returns the local files referenced by the
+// page templates and the stylesheets.
+//
+// Returns:
+//   - `[]string`: The files' URL paths without the leading slash.
+func atLayoutReferences() []string {
+	var result []string
+	_ = fs.WalkDir(viewsFS, `.`, func(aPath string, aEntry fs.DirEntry, aErr error) error {
+		if (nil == aErr) && aEntry.Type().IsRegular() {
+			if fc, err := viewsFS.ReadFile(aPath); nil == err {
+				result = append(result, atReferences(fc)...)
+			}
+		}
+		return nil
+	})
+	for _, dir := range []string{`css`, `views`} {
+		_ = filepath.WalkDir(filepath.Join(AppArgs.DataDir, dir), func(aPath string, aEntry fs.DirEntry, aErr error) error {
+			if (nil == aErr) && aEntry.Type().IsRegular() {
+				if fc, err := os.ReadFile(aPath); nil == err { // #nosec G304
+					result = append(result, atReferences(fc)...)
+				}
+			}
+			return nil
+		})
+	}
+
+	return result
+} // atLayoutReferences()
+
+// `atReferenced()` reports whether `aName` (or one of its parent
+// directories) is in `aRefs`.
+//
+// Parameters:
+//   - `aRefs`: The referenced files as returned by `References()`.
+//   - `aName`: The file's URL path without the leading slash.
+//
+// Returns:
+//   - `bool`: `true` if the file is referenced, `false` otherwise.
+func atReferenced(aRefs map[string][]uint64, aName string) bool {
+	for name := aName; (`.` != name) && (`/` != name); name = path.Dir(name) {
+		if _, ok := aRefs[name]; ok {
+			return true
+		}
+	}
+
+	return false
+} // atReferenced()
+
+// `atReferences()` returns the paths of the local files referenced
+// by `aText`.
+//
+// Parameters:
+//   - `aText`: The text (Markdown, HTML, or CSS) to search.
+//
+// Returns:
+//   - `[]string`: The files' URL paths without the leading slash.
+func atReferences(aText []byte) []string {
+	var result []string
+	for _, match := range atRefRE.FindAllSubmatch(aText, -1) {
+		ref := string(match[1])
+		if idx := strings.IndexAny(ref, `?#`); 0 <= idx {
+			ref = ref[:idx]
+		}
+		ref = strings.TrimRight(ref, `.,;:!?*_/`)
+		if name, err := url.PathUnescape(ref); nil == err {
+			ref = name
+		}
+		if ref = path.Clean(ref); strings.Contains(ref, `/`) {
+			result = append(result, ref)
+		}
+	}
+
+	return result
+} // atReferences()
+
+// `atSameContents()` reports whether the file `aName` has the same
+// contents as `aFile`.
+//
+// Parameters:
+//   - `aFile`: The open file to compare.
+//   - `aName`: The path/file name of the file to compare with.
+//
+// Returns:
+//   - `bool`: `true` if both files are equal, `false` otherwise.
+//   - `error`: A possible I/O error, or `nil` on success.
+func atSameContents(aFile *os.File, aName string) (bool, error) {
+	fi1, err := aFile.Stat()
+	if nil != err {
+		return false, se.Wrap(err, 2)
+	}
+	fi2, err := os.Stat(aName)
+	if nil != err {
+		return false, se.Wrap(err, 2)
+	}
+	if fi1.Size() != fi2.Size() {
+		return false, nil
+	}
+
+	other, err := os.Open(aName) /* #nosec G304 */
+	if nil != err {
+		return false, se.Wrap(err, 2)
+	}
+	defer other.Close()
+	if _, err = aFile.Seek(0, io.SeekStart); nil != err {
+		return false, se.Wrap(err, 2)
+	}
+
+	buf1, buf2 := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		n1, err1 := io.ReadFull(aFile, buf1)
+		n2, err2 := io.ReadFull(other, buf2)
+		if (n1 != n2) || !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if errors.Is(err1, io.EOF) || errors.Is(err1, io.ErrUnexpectedEOF) {
+			return true, nil // same size, same bytes read
+		}
+		if err := errors.Join(err1, err2); nil != err {
+			return false, se.Wrap(err, 1)
+		}
+	}
+} // atSameContents()
+
+// `copyAttachment()` copies the file `aSource` into the attachment
+// directory of the posting with `aID`.
+//
+// If the posting already has an attachment of the same name and
+// contents that one is used; if its contents differ the copy gets
+// a unique name (like e.g. `name-1.png`).
+//
+// Parameters:
+//   - `aSource`: The path/file name of the file to copy.
+//   - `aID`: The ID of the posting to attach the file to.
+//
+// Returns:
+//   - `string`: The name of the posting's attachment.
+//   - `error`: A possible I/O error, or `nil` on success.
+func copyAttachment(aSource string, aID uint64) (string, error) {
+	src, err := os.Open(aSource) /* #nosec G304 */
+	if nil != err {
+		return "", se.Wrap(err, 2)
+	}
+	defer src.Close()
+
+	dir := AttachmentDir(aID)
+	if err = os.MkdirAll(dir, 0775); nil != err {
+		return "", se.Wrap(err, 2)
+	}
+	base := filepath.Base(aSource)
+	ext := filepath.Ext(base)
+	for num := 0; ; num++ {
+		name := base
+		if 0 < num {
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), num, ext)
+		}
+		fName := filepath.Join(dir, name)
+		dst, err := os.OpenFile(fName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640) // #nosec G302
+		if nil != err {
+			if !errors.Is(err, fs.ErrExist) {
+				return "", se.Wrap(err, 1)
+			}
+			same, err := atSameContents(src, fName)
+			if nil != err {
+				return "", err
+			}
+			if same {
+				return name, nil
+			}
+			continue // try another name
+		}
+
+		if _, err = src.Seek(0, io.SeekStart); nil == err {
+			_, err = io.Copy(dst, src)
+		}
+		if nil != err {
+			_ = dst.Close()
+			_ = os.Remove(fName)
+			return "", se.Wrap(err, 3)
+		}
+
+		return name, dst.Close()
+	}
+} // copyAttachment()
+
+// `moveAttachments()` moves the attachments of the posting `aOldID`
+// to the posting `aNewID` updating the links in the new posting's
+// text accordingly.
+//
+// Parameters:
+//   - `aOldID`: The posting's former ID.
+//   - `aNewID`: The posting's new ID.
+//
+// Returns:
+//   - `error`: A possible I/O error, or `nil` on success.
+func moveAttachments(aOldID, aNewID uint64) error {
+	oDir := AttachmentDir(aOldID)
+	if fi, err := os.Stat(oDir); (nil != err) || (!fi.IsDir()) {
+		return nil // no attachments
+	}
+
+	nDir := AttachmentDir(aNewID)
+	if _, err := os.Stat(nDir); nil == err {
+		return se.Wrap(fmt.Errorf("%q: %w", nDir, fs.ErrExist), 1)
+	}
+	if err := os.MkdirAll(filepath.Dir(nDir), 0775); nil != err {
+		return se.Wrap(err, 1)
+	}
+	if err := os.Rename(oDir, nDir); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	post := NewPosting(aNewID, "")
+	if err := post.Load(); nil != err {
+		return err
+	}
+	oURL := []byte(`/` + atDirName + `/` + id2str(aOldID) + `/`)
+	nURL := []byte(`/` + atDirName + `/` + id2str(aNewID) + `/`)
+	if !bytes.Contains(post.markdown, oURL) {
+		return nil
+	}
+	_, err := post.Set(bytes.ReplaceAll(post.markdown, oURL, nURL)).Store()
+
+	return err
+} // moveAttachments()
+
+// `removeAttachments()` deletes all files attached to the posting
+// with `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the posting owning the attachments.
+//
+// Returns:
+//   - `error`: A possible I/O error, or `nil` on success.
+func removeAttachments(aID uint64) error {
+	if err := os.RemoveAll(AttachmentDir(aID)); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	return nil
+} // removeAttachments()
+
+/* _EoF_ */
@@ -0,0 +1,295 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+// `prepAttachmentTest()` sets up a clean posting storage and
+// a temporary data directory.
+func prepAttachmentTest(t *testing.T) {
+	t.Helper()
+
+	prep4Tests()
+	oldDir := AppArgs.DataDir
+	AppArgs.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		AppArgs.DataDir = oldDir
+	})
+} // prepAttachmentTest()
+
+// `tFailingStore` is a persistence layer failing to read the posting
+// `failID` after it was read `after` times.
+type tFailingStore struct {
+	IPersistence
+	failID uint64
+	after  int32
+	reads  *atomic.Int32
+}
+
+func (fs tFailingStore) ReadContext(aCtx context.Context, aID uint64) (*TPosting, error) {
+	if (fs.failID == aID) && (fs.after < fs.reads.Add(1)) {
+		return nil, errors.New("unreadable posting")
+	}
+
+	return fs.IPersistence.ReadContext(aCtx, aID)
+} // ReadContext()
+
+// `setFailingStore()` makes the posting `aID` unreadable after
+// `aAfter` reads.
+func setFailingStore(t *testing.T, aID uint64, aAfter int32) {
+	t.Helper()
+
+	old := poPersistence
+	SetPersistence(tFailingStore{old, aID, aAfter, new(atomic.Int32)})
+	t.Cleanup(func() {
+		SetPersistence(old)
+	})
+} // setFailingStore()
+
+func writeTestFile(t *testing.T, aName, aText string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(aName), 0775); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(aName, []byte(aText), 0640); nil != err {
+		t.Fatal(err)
+	}
+} // writeTestFile()
+
+func TestTPosting_attachments(t *testing.T) {
+	prepAttachmentTest(t)
+
+	id := time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local))
+	post := NewPosting(id, "> ![pic]("+AttachmentURL(id, "pic.png")+")")
+	if _, err := post.Store(); nil != err {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(AttachmentDir(id), "pic.png"), "png")
+
+	if got, err := Attachments(id); (nil != err) || (1 != len(got)) || ("pic.png" != got[0]) {
+		t.Errorf("Attachments() = %v, %v", got, err)
+	}
+
+	nid := time2id(time.Date(2023, 4, 1, 12, 0, 0, 0, time.Local))
+	if err := post.ChangeID(nid); nil != err {
+		t.Fatalf("TPosting.ChangeID() error = %v", err)
+	}
+	if _, err := os.Stat(AttachmentDir(id)); !os.IsNotExist(err) {
+		t.Errorf("TPosting.ChangeID(): old attachment directory still exists")
+	}
+	if got, _ := Attachments(nid); 1 != len(got) {
+		t.Errorf("TPosting.ChangeID(): attachments = %v, want [pic.png]", got)
+	}
+	np := NewPosting(nid, "")
+	if err := np.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(np.Markdown()), AttachmentURL(nid, "pic.png")) {
+		t.Errorf("TPosting.ChangeID(): link not updated: %q", np.Markdown())
+	}
+
+	if err := np.Delete(); nil != err {
+		t.Fatalf("TPosting.Delete() error = %v", err)
+	}
+	if _, err := os.Stat(AttachmentDir(nid)); !os.IsNotExist(err) {
+		t.Errorf("TPosting.Delete(): attachment directory still exists")
+	}
+} // TestTPosting_attachments()
+
+func TestRelinkAttachments(t *testing.T) {
+	prepAttachmentTest(t)
+
+	dataDir := AppArgs.DataDir
+	writeTestFile(t, filepath.Join(dataDir, "img", "shared.png"), "png")
+	writeTestFile(t, filepath.Join(dataDir, "static", "doc.pdf"), "pdf")
+	writeTestFile(t, filepath.Join(dataDir, "img", "shot.png"), "screenshot")
+	writeTestFile(t, filepath.Join(dataDir, "img", "kept.png"), "png")
+
+	id1 := time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local))
+	id2 := time2id(time.Date(2024, 4, 2, 12, 0, 0, 0, time.Local))
+	id3 := time2id(time.Date(2024, 4, 3, 12, 0, 0, 0, time.Local))
+	texts := map[uint64]string{
+		id1: "> ![shared](/img/shared.png)\n\n[doc](/static/doc.pdf) ![kept](/img/kept.png)",
+		id2: "> ![shared](/img/shared.png)\n\n[missing](/static/missing.txt)",
+		id3: "[![shot](/img/shot.png)](https://example.com/)\n\n<img src=\"/img/kept.png\" alt=\"\">",
+	}
+	for id, txt := range texts {
+		if _, err := NewPosting(id, txt).Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	postings, files, err := RelinkAttachments(context.Background())
+	if nil != err {
+		t.Fatalf("RelinkAttachments() error = %v", err)
+	}
+	if (2 != postings) || (3 != files) {
+		t.Errorf("RelinkAttachments() = %d, %d, want 2, 3", postings, files)
+	}
+
+	wants := map[uint64][]string{
+		id1: {AttachmentURL(id1, "shared.png"), AttachmentURL(id1, "doc.pdf")},
+		id2: {AttachmentURL(id2, "shared.png"), "/static/missing.txt"},
+		id3: {"/img/shot.png", `src="/img/kept.png"`},
+	}
+	for id, want := range wants {
+		post := NewPosting(id, "")
+		if err = post.Load(); nil != err {
+			t.Fatal(err)
+		}
+		for _, link := range want {
+			if !strings.Contains(string(post.Markdown()), link) {
+				t.Errorf("RelinkAttachments(): %q doesn't contain %q", post.Markdown(), link)
+			}
+		}
+	}
+	if got, _ := Attachments(id2); 1 != len(got) {
+		t.Errorf("RelinkAttachments(): attachments = %v, want [shared.png]", got)
+	}
+	if _, err = os.Stat(filepath.Join(dataDir, "img", "shared.png")); !os.IsNotExist(err) {
+		t.Errorf("RelinkAttachments(): shared file not removed")
+	}
+	if _, err = os.Stat(filepath.Join(dataDir, "img", "shot.png")); nil != err {
+		t.Errorf("RelinkAttachments(): screenshot removed: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dataDir, "img", "kept.png")); nil != err {
+		t.Errorf("RelinkAttachments(): referenced file removed: %v", err)
+	}
+} // TestRelinkAttachments()
+
+func TestRelinkAttachments_collision(t *testing.T) {
+	prepAttachmentTest(t)
+
+	dataDir := AppArgs.DataDir
+	writeTestFile(t, filepath.Join(dataDir, "img", "foo.png"), "img")
+	writeTestFile(t, filepath.Join(dataDir, "static", "foo.png"), "static")
+
+	id1 := time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local))
+	id2 := time2id(time.Date(2024, 4, 2, 12, 0, 0, 0, time.Local))
+	id3 := time2id(time.Date(2024, 4, 3, 12, 0, 0, 0, time.Local))
+	writeTestFile(t, filepath.Join(AttachmentDir(id2), "foo.png"), "uploaded")
+	writeTestFile(t, filepath.Join(AttachmentDir(id3), "foo.png"), "img")
+	texts := map[uint64]string{
+		id1: "![a](/img/foo.png) ![b](/static/foo.png) ![c](/img/foo.png)",
+		id2: "![a](/img/foo.png) ![b](" + AttachmentURL(id2, "foo.png") + ")",
+		id3: "![a](/img/foo.png)",
+	}
+	for id, txt := range texts {
+		if _, err := NewPosting(id, txt).Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := RelinkAttachments(context.Background()); nil != err {
+		t.Fatalf("RelinkAttachments() error = %v", err)
+	}
+	wants := map[uint64]string{
+		id1: "![a](" + AttachmentURL(id1, "foo.png") + ") ![b](" + AttachmentURL(id1, "foo-1.png") + ") ![c](" + AttachmentURL(id1, "foo.png") + ")",
+		id2: "![a](" + AttachmentURL(id2, "foo-1.png") + ") ![b](" + AttachmentURL(id2, "foo.png") + ")",
+		id3: "![a](" + AttachmentURL(id3, "foo.png") + ")",
+	}
+	for id, want := range wants {
+		post := NewPosting(id, "")
+		if err := post.Load(); nil != err {
+			t.Fatal(err)
+		}
+		if got := string(post.Markdown()); got != want {
+			t.Errorf("RelinkAttachments() = %q, want %q", got, want)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(AttachmentDir(id1), "foo.png"):   "img",
+		filepath.Join(AttachmentDir(id1), "foo-1.png"): "static",
+		filepath.Join(AttachmentDir(id2), "foo.png"):   "uploaded",
+		filepath.Join(AttachmentDir(id2), "foo-1.png"): "img",
+		filepath.Join(AttachmentDir(id3), "foo.png"):   "img",
+	}
+	for name, want := range files {
+		if got, err := os.ReadFile(name); (nil != err) || (want != string(got)) {
+			t.Errorf("RelinkAttachments(): %s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if got, _ := Attachments(id3); 1 != len(got) {
+		t.Errorf("RelinkAttachments(): attachments = %v, want [foo.png]", got)
+	}
+} // TestRelinkAttachments_collision()
+
+func TestRelinkAttachments_unreadable(t *testing.T) {
+	prepAttachmentTest(t)
+
+	dataDir := AppArgs.DataDir
+	writeTestFile(t, filepath.Join(dataDir, "img", "shared.png"), "png")
+
+	id1 := time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local))
+	id2 := time2id(time.Date(2024, 4, 2, 12, 0, 0, 0, time.Local))
+	texts := map[uint64]string{
+		id1: "![shared](/img/shared.png)",
+		id2: "<img src=\"/img/shared.png\" alt=\"\">",
+	}
+	for id, txt := range texts {
+		if _, err := NewPosting(id, txt).Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	// readable while relinking, unreadable when looking for references
+	setFailingStore(t, id2, 1)
+
+	if _, _, err := RelinkAttachments(context.Background()); nil == err {
+		t.Error("RelinkAttachments(): expected an error")
+	}
+	if got, _ := Attachments(id1); 1 != len(got) {
+		t.Errorf("RelinkAttachments(): attachments = %v, want [shared.png]", got)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "img", "shared.png")); nil != err {
+		t.Errorf("RelinkAttachments(): referenced file removed: %v", err)
+	}
+	if _, err := References(context.Background()); nil == err {
+		t.Error("References(): expected an error")
+	}
+} // TestRelinkAttachments_unreadable()
+
+func Test_atReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{" 1", `![a](/img/a.png)`, []string{`img/a.png`}},
+		{" 2", `![a](/img/a.png "title")`, []string{`img/a.png`}},
+		{" 3", `<img src="/img/a.png" alt="">`, []string{`img/a.png`}},
+		{" 4", `{{< figure src="/static/b.jpg" >}}`, []string{`static/b.jpg`}},
+		{" 5", `{{< gallery img/trip >}}`, []string{`img/trip`}},
+		{" 6", `[1]: /static/my%20doc.pdf`, []string{`static/my doc.pdf`}},
+		{" 7", `see https://example.com/img/a.png.`, []string{`img/a.png`}},
+		{" 8", `background: url(/img/bg.png?v=2);`, []string{`img/bg.png`}},
+		{" 9", `[x](/attachments/0123456789abcdef/c.txt#top)`, []string{`attachments/0123456789abcdef/c.txt`}},
+		{"10", `myimg/a.png and /images/a.png`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := atReferences([]byte(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("atReferences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_atReferences()
+
+/* _EoF_ */
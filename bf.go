@@ -7,13 +7,13 @@ Copyright © 2020, 2024  M.Watermann, 10247 Berlin, Germany
 package nele
 
 /*
- * This file provides a function to convert MarkDown to HTML.
+ * This file provides a function to convert MarkDown to HTML
+ * using `blackfriday`.
  */
 
 import (
 	"bytes"
 	"regexp"
-	"sync"
 
 	bf "github.com/russross/blackfriday/v2"
 	// bf "gopkg.in/russross/blackfriday.v2"
@@ -36,20 +36,16 @@ var (
 			bf.Strikethrough |
 			bf.Tables)
 
-	// WithRenderer allows overriding the default `blackfriday` renderer.
-	bfRenderer = bf.WithRenderer(
-		bf.NewHTMLRenderer(bf.HTMLRendererParameters{
-			Flags: bf.FootnoteReturnLinks |
-				bf.Smartypants |
-				bf.SmartypantsFractions |
-				bf.SmartypantsDashes |
-				bf.SmartypantsLatexDashes,
-		}),
-	)
-
-	// Guard against race conditions in `MDtoHTML()` when calling
-	// `blackfriday.Run()` concurrently.
-	bfMtx = new(sync.Mutex)
+	// The HTML renderer keeps state while processing a document,
+	// hence `MDtoHTML()` creates a new one with these parameters
+	// for every call which makes it safe for concurrent use.
+	bfParameters = bf.HTMLRendererParameters{
+		Flags: bf.FootnoteReturnLinks |
+			bf.Smartypants |
+			bf.SmartypantsFractions |
+			bf.SmartypantsDashes |
+			bf.SmartypantsLatexDashes,
+	}
 
 	// Text to recognise a PREformatted section.
 	bfPre = []byte("</pre>")
@@ -68,34 +64,72 @@ var (
 	bfSupRE = regexp.MustCompile(`<span aria-label='Return'>.*</span>`)
 )
 
-// `MDtoHTML()` converts the `aMarkdown` data and returns HTML data.
+// `bfFixPre()` removes the redundant CODE markup inside PREformatted
+// sections of `aHTML`.
 //
 // Parameters:
-//   - `aMarkdown` The raw Markdown text to convert.
+//   - `aHTML`: The generated HTML to correct.
 //
 // Returns:
-//   - `[]byte`: The generated HTML data.
-func MDtoHTML(aMarkdown []byte) (rHTML []byte) {
-	var i int // re-use variable
-	bfMtx.Lock()
-	defer bfMtx.Unlock()
-
-	rHTML = bytes.TrimSpace(bf.Run(aMarkdown, bfRenderer, bfExtensions))
-	rHTML = bfSupRE.ReplaceAll(rHTML, []byte("<sup>[return]</sup>"))
-
+//   - `[]byte`: The corrected HTML data.
+func bfFixPre(aHTML []byte) []byte {
 	// Testing for PRE first makes this implementation twice as fast
 	// if there's no PRE in the generated HTML and about the same
 	// speed if there actually is a PRE part.
-	if i = bytes.Index(rHTML, bfPre); 0 > i {
-		return // no need for further RegEx execution
+	if 0 > bytes.Index(aHTML, bfPre) {
+		return aHTML // no need for further RegEx execution
 	}
 
-	rHTML = bfPreCodeRE1.ReplaceAll(rHTML, []byte("$1\n$2\n$3"))
-	if i = bytes.Index(rHTML, bfPreCode); 0 > i {
-		return // no need for the second RegEx execution
+	aHTML = bfPreCodeRE1.ReplaceAll(aHTML, []byte("$1\n$2\n$3"))
+	if 0 > bytes.Index(aHTML, bfPreCode) {
+		return aHTML // no need for the second RegEx execution
 	}
 
-	return bfPreCodeRE2.ReplaceAll(rHTML, []byte("$1 $2>\n$3\n$4"))
+	return bfPreCodeRE2.ReplaceAll(aHTML, []byte("$1 $2>\n$3\n$4"))
+} // bfFixPre()
+
+// `MDtoHTML()` converts the `aMarkdown` data and returns HTML data.
+//
+// The function is safe for concurrent use.
+//
+// Parameters:
+//   - `aMarkdown` The raw Markdown text to convert.
+//
+// Returns:
+//   - `[]byte`: The generated HTML data.
+func MDtoHTML(aMarkdown []byte) []byte {
+	renderer := bf.WithRenderer(bf.NewHTMLRenderer(bfParameters))
+
+	rHTML := bytes.TrimSpace(bf.Run(aMarkdown, renderer, bfExtensions))
+	rHTML = bfSupRE.ReplaceAll(rHTML, []byte("<sup>[return]</sup>"))
+
+	return bfFixPre(rHTML)
 } // MDtoHTML()
 
+// --------------------------------------------------------------------------
+
+type (
+	// `tBFrenderer` is the `IMarkdownRenderer` using `blackfriday`.
+	tBFrenderer struct{}
+)
+
+// `ID()` returns the renderer's identifier.
+//
+// Returns:
+//   - `string`: The renderer's name.
+func (tBFrenderer) ID() string {
+	return mdBlackfriday
+} // ID()
+
+// `Render()` converts `aMarkdown` to HTML using `MDtoHTML()`.
+//
+// Parameters:
+//   - `aMarkdown` The raw Markdown text to convert.
+//
+// Returns:
+//   - `[]byte`: The generated HTML data.
+func (tBFrenderer) Render(aMarkdown []byte) []byte {
+	return MDtoHTML(aMarkdown)
+} // Render()
+
 /* _EoF_ */
@@ -8,6 +8,7 @@ package nele
 
 import (
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -107,4 +108,21 @@ text
 	}
 } // TestMDtoHTML()
 
+func TestMDtoHTML_concurrent(t *testing.T) {
+	md := []byte("# Heading\n\nSome *text* with a footnote[^1].\n\n[^1]: the note\n")
+	want := MDtoHTML(md)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := MDtoHTML(md); !reflect.DeepEqual(got, want) {
+				t.Errorf("MDtoHTML() = \n%s\n>>> want >>>\n%s", got, want)
+			}
+		}()
+	}
+	wg.Wait()
+} // TestMDtoHTML_concurrent()
+
 /* _EoF_ */
@@ -10,11 +10,12 @@ package nele
 
 /*
  * This file provides functions to add postings from the commandline
- * and maintain the user/password list.
+ * and maintain the user/password and API token lists.
  */
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -58,6 +59,73 @@ func AddFilePost(aFilename string) (int, error) {
 
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
 
+// `tokenExit()` prints `aErr` (if any) and terminates the program.
+func tokenExit(aErr error) {
+	if nil != aErr {
+		fmt.Fprintf(os.Stderr, "\n\t%v\n", aErr)
+		os.Exit(1)
+	}
+	os.Exit(0)
+} // tokenExit()
+
+// TokenAdd creates a new personal API token named `aName` with
+// `aScope` and prints it to `StdOut`.
+//
+// NOTE: This function does not return but terminates the program
+// with error code `0` (zero) if successful, or `1` (one) otherwise.
+//
+//	`aName` A description of the token's purpose.
+//	`aScope` The token's scope (`admin`, `post`, or `read`).
+//	`aFilename` The name of the token file to use.
+func TokenAdd(aName, aScope, aFilename string) {
+	tl, err := LoadTokens(aFilename)
+	if nil != err {
+		tokenExit(err)
+	}
+	token, tok, err := tl.Add(aName, aScope)
+	if nil != err {
+		tokenExit(err)
+	}
+	fmt.Printf("\n\tcreated %s token %q (ID %s):\n\n\t%s\n\n\tNOTE: the token can't be shown again.\n",
+		tok.Scope, tok.Name, tok.ID, token)
+	tokenExit(nil)
+} // TokenAdd()
+
+// TokenList reads `aFilename` and lists all API tokens stored in there.
+//
+// NOTE: This function does not return but terminates the program
+// with error code `0` (zero) if successful, or `1` (one) otherwise.
+//
+//	`aFilename` The name of the token file to use.
+func TokenList(aFilename string) {
+	tl, err := LoadTokens(aFilename)
+	if nil != err {
+		tokenExit(err)
+	}
+	for _, tok := range tl.List() {
+		fmt.Printf("%s\t%-5s\t%s\t%s\n",
+			tok.ID, tok.Scope, tok.Created.Format(`2006-01-02 15:04`), tok.Name)
+	}
+	tokenExit(nil)
+} // TokenList()
+
+// TokenRevoke removes the API token with `aID` from `aFilename`.
+//
+// NOTE: This function does not return but terminates the program
+// with error code `0` (zero) if successful, or `1` (one) otherwise.
+//
+//	`aID` The ID of the token to remove.
+//	`aFilename` The name of the token file to use.
+func TokenRevoke(aID, aFilename string) {
+	tl, err := LoadTokens(aFilename)
+	if nil != err {
+		tokenExit(err)
+	}
+	tokenExit(tl.Revoke(aID))
+} // TokenRevoke()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
 // UserAdd reads a password for `aUser` from the commandline
 // and adds it to `aFilename`.
 //
@@ -182,6 +182,13 @@ func copyIniDataToAppArgs() {
 		AppArgs.MaxFileSize = kmg2Num(AppArgs.mfs)
 	}
 
+	if 0 < len(AppArgs.pcs) {
+		AppArgs.PageCache = kmg2Num(AppArgs.pcs)
+	}
+	if 0 < len(AppArgs.PageCacheDir) {
+		AppArgs.PageCacheDir = absolute(AppArgs.DataDir, AppArgs.PageCacheDir)
+	}
+
 	if 0 < len(AppArgs.PostFile) {
 		AppArgs.PostFile = absolute(AppArgs.DataDir, AppArgs.PostFile)
 	}
@@ -190,6 +197,13 @@ func copyIniDataToAppArgs() {
 		AppArgs.Realm = `My Blog`
 	}
 
+	if 0 < len(AppArgs.S3CredFile) {
+		AppArgs.S3CredFile = absolute(AppArgs.DataDir, AppArgs.S3CredFile)
+	}
+
+	// The commandline value might have a trailing slash as well:
+	AppArgs.PublicURL = strings.TrimSuffix(AppArgs.PublicURL, `/`)
+
 	if AppArgs.Screenshot {
 		processScreenshotOptions()
 	}
@@ -205,6 +219,11 @@ func copyIniDataToAppArgs() {
 		AppArgs.Theme = `dark`
 	}
 
+	if 0 < len(AppArgs.TokenFile) {
+		AppArgs.TokenFile = absolute(AppArgs.DataDir, AppArgs.TokenFile)
+	}
+	AppArgs.TokenScope = strings.ToLower(AppArgs.TokenScope)
+
 	if 0 < len(AppArgs.UserFile) {
 		AppArgs.UserFile = absolute(AppArgs.DataDir, AppArgs.UserFile)
 	}
@@ -251,6 +270,14 @@ func InitConfig() {
 	case `db`:
 		persistence = NewDBpersistence(AppArgs.Name)
 
+	case `s3`:
+		s3p, err := NewS3persistence(AppArgs.S3Endpoint, AppArgs.S3Bucket,
+			AppArgs.S3Region, AppArgs.S3CredFile)
+		if nil != err {
+			log.Fatalf("Error: S3 persistence problem: %v", err)
+		}
+		persistence = s3p
+
 	case `fs`:
 		fallthrough
 
@@ -259,6 +286,13 @@ func InitConfig() {
 	}
 	SetPersistence(IPersistence(persistence))
 
+	renderer, err := NewMarkdownRenderer(AppArgs.Markdown)
+	if nil != err {
+		log.Fatalf("Error: %v", err)
+	}
+	SetMarkdownRenderer(renderer)
+	hlActive = AppArgs.Highlight
+	SetSanitiser(NewSanitiser(AppArgs.TrustedHTML, AppArgs.HTMLallow))
 } // InitConfig()
 
 // `parseCmdlineArgs()` parses the actual commandline arguments.
@@ -334,6 +368,16 @@ func readCmdlineArgs() {
 	flag.CommandLine.StringVar(&AppArgs.BlogName, `blogName`, AppArgs.BlogName,
 		"<string> Name of this Blog (shown on every page)\n")
 
+	AppArgs.ActivityPub, _ = iniValues.AsBool(`activityPub`)
+	flag.CommandLine.BoolVar(&AppArgs.ActivityPub, `activityPub`, AppArgs.ActivityPub,
+		"<boolean> Provide an ActivityPub actor (requires `publicURL`)")
+
+	if AppArgs.APuser, ok = iniValues.AsString(`apUser`); (!ok) || (0 == len(AppArgs.APuser)) {
+		AppArgs.APuser = `blog`
+	}
+	flag.CommandLine.StringVar(&AppArgs.APuser, `apUser`, AppArgs.APuser,
+		"<name> User name of the ActivityPub actor (as in `@name@host`)\n")
+
 	if s, ok = iniValues.AsString(`accessLog`); (ok) && (0 < len(s)) {
 		AppArgs.AccessLog = absolute(AppArgs.DataDir, s)
 	}
@@ -381,6 +425,16 @@ func readCmdlineArgs() {
 	flag.CommandLine.StringVar(&AppArgs.HashFile, `hashFile`, AppArgs.HashFile,
 		"<fileName> Name of the file storing #hashtags and @mentions\n")
 
+	if AppArgs.Highlight, ok = iniValues.AsBool(`highlight`); !ok {
+		AppArgs.Highlight = true
+	}
+	flag.CommandLine.BoolVar(&AppArgs.Highlight, `highlight`, AppArgs.Highlight,
+		"<boolean> Highlight the syntax of fenced code blocks")
+
+	AppArgs.HTMLallow, _ = iniValues.AsString(`htmlAllow`)
+	flag.CommandLine.StringVar(&AppArgs.HTMLallow, `htmlAllow`, AppArgs.HTMLallow,
+		"<list> Additional HTML elements/attributes (like `video.src`)\n\tto allow in postings")
+
 	iniFile, _ := iniValues.AsString(`iniFile`)
 	flag.CommandLine.StringVar(&iniFile, `ini`, iniFile,
 		"<fileName> the path/filename of the INI file to use\n")
@@ -401,6 +455,17 @@ func readCmdlineArgs() {
 	flag.CommandLine.BoolVar(&AppArgs.LogStack, "lst", AppArgs.LogStack,
 		"<boolean> Log a stack trace for recovered runtime errors ")
 
+	if AppArgs.Markdown, ok = iniValues.AsString(`markdown`); ok && (0 < len(AppArgs.Markdown)) {
+		AppArgs.Markdown = strings.ToLower(AppArgs.Markdown)
+	} else {
+		AppArgs.Markdown = mdBlackfriday
+	}
+	flag.CommandLine.StringVar(&AppArgs.Markdown, `markdown`, AppArgs.Markdown,
+		"<blackfriday|goldmark> The Markdown renderer to use")
+
+	flag.CommandLine.StringVar(&AppArgs.MDcompare, `mdCompare`, AppArgs.MDcompare,
+		"<renderer> (optional) list the postings whose HTML would change\n\twhen switching to the given Markdown renderer")
+
 	if AppArgs.mfs, ok = iniValues.AsString(`maxfilesize`); ok && (0 < len(AppArgs.mfs)) {
 		AppArgs.mfs = strings.ToLower(AppArgs.mfs)
 	} else {
@@ -409,9 +474,33 @@ func readCmdlineArgs() {
 	flag.CommandLine.StringVar(&AppArgs.mfs, `mfs`, AppArgs.mfs,
 		"<filesize> Max. accepted size of uploaded files")
 
-	//
-	//TODO: read persistence (db|fs|tee)
-	//
+	flag.CommandLine.BoolVar(&AppArgs.MediaClean, `mediaClean`, AppArgs.MediaClean,
+		"<boolean> (optional) delete all uploaded files not used by any posting")
+
+	flag.CommandLine.BoolVar(&AppArgs.DryRun, `dryRun`, AppArgs.DryRun,
+		"<boolean> (optional) with `-mediaClean`: only list the files to delete")
+
+	if AppArgs.pcs, ok = iniValues.AsString(`pageCache`); ok && (0 < len(AppArgs.pcs)) {
+		AppArgs.pcs = strings.ToLower(AppArgs.pcs)
+	} else {
+		AppArgs.pcs = `16mb`
+	}
+	flag.CommandLine.StringVar(&AppArgs.pcs, `pageCache`, AppArgs.pcs,
+		"<size> Max. size of the rendered-page cache (`0` disables it)")
+
+	if s, ok = iniValues.AsString(`pageCacheDir`); ok && (0 < len(s)) {
+		AppArgs.PageCacheDir = absolute(AppArgs.DataDir, s)
+	}
+	flag.CommandLine.StringVar(&AppArgs.PageCacheDir, `pageCacheDir`, AppArgs.PageCacheDir,
+		"<dirName> (optional) Directory to keep the cached pages in (instead of memory)\n")
+
+	if AppArgs.persistence, ok = iniValues.AsString(`persistence`); ok && (0 < len(AppArgs.persistence)) {
+		AppArgs.persistence = strings.ToLower(AppArgs.persistence)
+	} else {
+		AppArgs.persistence = `fs`
+	}
+	flag.CommandLine.StringVar(&AppArgs.persistence, `persistence`, AppArgs.persistence,
+		"<db|fs|s3> The storage to use for postings")
 
 	AppArgs.port, ok = iniValues.AsInt(`port`)
 	if (!ok) || (0 == AppArgs.port) {
@@ -426,6 +515,33 @@ func readCmdlineArgs() {
 	flag.CommandLine.StringVar(&AppArgs.PostFile, `pf`, AppArgs.PostFile,
 		"<fileName> (optional) post file: name of a file to add as new posting")
 
+	if AppArgs.PublicURL, ok = iniValues.AsString(`publicURL`); ok {
+		AppArgs.PublicURL = strings.TrimSuffix(AppArgs.PublicURL, `/`)
+	}
+	flag.CommandLine.StringVar(&AppArgs.PublicURL, `publicURL`, AppArgs.PublicURL,
+		"<URL> Public base URL of this blog (e.g. `https://example.com`)\n")
+
+	flag.CommandLine.BoolVar(&AppArgs.Relink, `relink`, AppArgs.Relink,
+		"<boolean> (optional) move linked files from `img/` and `static/` into the postings' attachments")
+
+	AppArgs.S3Bucket, _ = iniValues.AsString(`s3Bucket`)
+	flag.CommandLine.StringVar(&AppArgs.S3Bucket, `s3Bucket`, AppArgs.S3Bucket,
+		"<name> Name of the S3 bucket storing the postings")
+
+	if s, ok = iniValues.AsString(`s3Credentials`); ok && (0 < len(s)) {
+		AppArgs.S3CredFile = absolute(AppArgs.DataDir, s)
+	}
+	flag.CommandLine.StringVar(&AppArgs.S3CredFile, `s3Credentials`, AppArgs.S3CredFile,
+		"<fileName> Name of the file with the S3 access keys\n")
+
+	AppArgs.S3Endpoint, _ = iniValues.AsString(`s3Endpoint`)
+	flag.CommandLine.StringVar(&AppArgs.S3Endpoint, `s3Endpoint`, AppArgs.S3Endpoint,
+		"<URL> The S3 server's base URL")
+
+	AppArgs.S3Region, _ = iniValues.AsString(`s3Region`)
+	flag.CommandLine.StringVar(&AppArgs.S3Region, `s3Region`, AppArgs.S3Region,
+		"<name> The S3 server's region (default `us-east-1`)")
+
 	AppArgs.Screenshot, _ = iniValues.AsBool(`Screenshot`)
 	flag.CommandLine.BoolVar(&AppArgs.Screenshot, `pv`, AppArgs.Screenshot,
 		"<boolean> Use page preview/screenshot images for links")
@@ -450,6 +566,31 @@ func readCmdlineArgs() {
 	flag.CommandLine.StringVar(&AppArgs.Theme, `theme`, AppArgs.Theme,
 		"<name> The display theme to use ('light' or 'dark')\n")
 
+	flag.CommandLine.StringVar(&AppArgs.TokenAdd, `ta`, AppArgs.TokenAdd,
+		"<name> Token add: create a personal API token with the given name")
+
+	if s, ok = iniValues.AsString(`tokenFile`); ok && (0 < len(s)) {
+		AppArgs.TokenFile = absolute(AppArgs.DataDir, s)
+	} else {
+		AppArgs.TokenFile = absolute(AppArgs.DataDir, `tokens.json`)
+	}
+	flag.CommandLine.StringVar(&AppArgs.TokenFile, `tf`, AppArgs.TokenFile,
+		"<fileName> Name of the file storing the (hashed) API tokens\n")
+
+	flag.CommandLine.BoolVar(&AppArgs.TokenList, `tl`, AppArgs.TokenList,
+		"<boolean> Token list: show all personal API tokens")
+
+	flag.CommandLine.StringVar(&AppArgs.TokenRevoke, `tr`, AppArgs.TokenRevoke,
+		"<ID> Token revoke: remove the API token with the given ID")
+
+	AppArgs.TokenScope = TokenScopeRead
+	flag.CommandLine.StringVar(&AppArgs.TokenScope, `ts`, AppArgs.TokenScope,
+		"<admin|post|read> Token scope: with `-ta` the new token's permissions")
+
+	AppArgs.TrustedHTML, _ = iniValues.AsBool(`trustedHTML`)
+	flag.CommandLine.BoolVar(&AppArgs.TrustedHTML, `trustedHTML`, AppArgs.TrustedHTML,
+		"<boolean> Accept all raw HTML in postings without sanitising")
+
 	flag.CommandLine.StringVar(&AppArgs.UserAdd, `ua`, AppArgs.UserAdd,
 		"<userName> User add: add a username to the password file")
 
@@ -471,6 +612,10 @@ func readCmdlineArgs() {
 	flag.CommandLine.StringVar(&AppArgs.UserUpdate, `uu`, AppArgs.UserUpdate,
 		"<userName> User update: update a username in the password file")
 
+	AppArgs.Webmention, _ = iniValues.AsBool(`webmention`)
+	flag.CommandLine.BoolVar(&AppArgs.Webmention, `webmention`, AppArgs.Webmention,
+		"<boolean> Send and receive Webmentions (requires `publicURL`)")
+
 	iniValues.Clear() // release unneeded memory
 } // readCmdlineArgs()
 
@@ -0,0 +1,520 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides Atom and RSS feeds for the newest postings
+ * and for the postings of a single #hashtag or @mention.
+ */
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mwat56/apachelogger"
+)
+
+const (
+	// `FeedAtom` is the format name of Atom feeds.
+	FeedAtom = `atom`
+
+	// `FeedRSS` is the format name of RSS 2.0 feeds.
+	FeedRSS = `rss`
+
+	// `feedTitleLen` is the max. length of an entry's title.
+	feedTitleLen = 72
+)
+
+type (
+	// `tAtomContent` is an Atom entry's (HTML) content.
+	tAtomContent struct {
+		Type string `xml:"type,attr"`
+		Body string `xml:",chardata"`
+	}
+
+	// `tAtomEntry` is a single Atom feed entry.
+	tAtomEntry struct {
+		Title     string       `xml:"title"`
+		ID        string       `xml:"id"`
+		Link      tAtomLink    `xml:"link"`
+		Published string       `xml:"published"`
+		Updated   string       `xml:"updated"`
+		Content   tAtomContent `xml:"content"`
+	}
+
+	// `tAtomFeed` is the root element of an Atom feed.
+	tAtomFeed struct {
+		XMLName   xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+		Title     string       `xml:"title"`
+		ID        string       `xml:"id"`
+		Updated   string       `xml:"updated"`
+		Links     []tAtomLink  `xml:"link"`
+		Author    string       `xml:"author>name"`
+		Generator string       `xml:"generator"`
+		Entries   []tAtomEntry `xml:"entry"`
+	}
+
+	// `tAtomLink` is an Atom link element.
+	tAtomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+		Type string `xml:"type,attr,omitempty"`
+	}
+
+	// `tRSS` is the root element of an RSS 2.0 feed.
+	tRSS struct {
+		XMLName xml.Name    `xml:"rss"`
+		Version string      `xml:"version,attr"`
+		AtomNS  string      `xml:"xmlns:atom,attr"`
+		Channel tRSSchannel `xml:"channel"`
+	}
+
+	// `tRSSchannel` is the channel of an RSS 2.0 feed.
+	tRSSchannel struct {
+		Title         string     `xml:"title"`
+		Link          string     `xml:"link"`
+		Description   string     `xml:"description"`
+		Self          tAtomLink  `xml:"atom:link"`
+		LastBuildDate string     `xml:"lastBuildDate"`
+		Generator     string     `xml:"generator"`
+		Items         []tRSSitem `xml:"item"`
+	}
+
+	// `tRSSguid` is an RSS item's unique identifier.
+	tRSSguid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+
+	// `tRSSitem` is a single RSS 2.0 item.
+	tRSSitem struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		GUID        tRSSguid `xml:"guid"`
+		PubDate     string   `xml:"pubDate"`
+		Description string   `xml:"description"`
+	}
+)
+
+var (
+	// RegEx to find site-local links in the generated HTML.
+	feedLocalURLRE = regexp.MustCompile(`(\s(?:href|src)=")/([^/])`)
+	//                                    11111111111111111  2222
+
+	// RegEx to remove Markdown markup from an entry's title.
+	feedMarkupRE = regexp.MustCompile(`!?\[([^\]]*)\]\([^\)]*\)|^[\s#>*+-]+|[*~` + "`" + `]+`)
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `feedAbsURLs()` replaces all site-local links in `aHTML` by
+// absolute URLs starting with `aBaseURL`.
+//
+// Parameters:
+//   - `aHTML`: The HTML markup to process.
+//   - `aBaseURL`: The scheme and host to prepend (e.g. `https://host`).
+//
+// Returns:
+//   - `string`: The HTML markup using absolute URLs.
+func feedAbsURLs(aHTML []byte, aBaseURL string) string {
+	return string(feedLocalURLRE.ReplaceAllFunc(aHTML, func(aMatch []byte) []byte {
+		// `aMatch` is `␣href="/x` or `␣src="/x`
+		idx := len(aMatch) - 2
+
+		return []byte(string(aMatch[:idx]) + aBaseURL + string(aMatch[idx:]))
+	}))
+} // feedAbsURLs()
+
+// `feedBaseURL()` returns the scheme and host used by `aRequest`.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `string`: The base URL without a trailing slash.
+func feedBaseURL(aRequest *http.Request) string {
+	scheme := `http`
+	if (nil != aRequest.TLS) ||
+		strings.EqualFold(aRequest.Header.Get(`X-Forwarded-Proto`), `https`) {
+		scheme = `https`
+	}
+
+	return scheme + `://` + aRequest.Host
+} // feedBaseURL()
+
+// `publicBaseURL()` returns the blog's public scheme and host, i.e.
+// the configured `publicURL` or (if that's empty) the one used by
+// `aRequest`.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `string`: The base URL without a trailing slash.
+func publicBaseURL(aRequest *http.Request) string {
+	if 0 < len(AppArgs.PublicURL) {
+		return AppArgs.PublicURL
+	}
+
+	return feedBaseURL(aRequest)
+} // publicBaseURL()
+
+// `feedNotModified()` sets the `ETag` and `Last-Modified` headers and
+// reports whether the remote client's cached copy is still valid.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aLastMod`: The last modification time of the data to send.
+//   - `aETag`: The entity tag of the data to send.
+//
+// Returns:
+//   - `bool`: `true` if a `304 Not Modified` reply was sent.
+func feedNotModified(aWriter http.ResponseWriter, aRequest *http.Request,
+	aLastMod time.Time, aETag string) bool {
+	aLastMod = aLastMod.UTC().Truncate(time.Second)
+	aWriter.Header().Set(`ETag`, aETag)
+	aWriter.Header().Set(`Last-Modified`, aLastMod.Format(http.TimeFormat))
+
+	notModified := false
+	if inm := aRequest.Header.Get(`If-None-Match`); 0 < len(inm) {
+		for _, tag := range strings.Split(inm, `,`) {
+			if tag = strings.TrimSpace(tag); (aETag == tag) || (`*` == tag) {
+				notModified = true
+				break
+			}
+		}
+	} else if ims := aRequest.Header.Get(`If-Modified-Since`); 0 < len(ims) {
+		if t, err := http.ParseTime(ims); nil == err {
+			notModified = !aLastMod.After(t)
+		}
+	}
+	if notModified {
+		aWriter.WriteHeader(http.StatusNotModified)
+	}
+
+	return notModified
+} // feedNotModified()
+
+// `feedTail()` splits a tag/mention URL tail like `name/feed/rss`
+// or `name/feed.json/10,20` into the tag's name, the requested feed
+// format, and the requested slice of postings.
+//
+// Parameters:
+//   - `aTail`: The URL's tail (as returned by `URLparts()`).
+//
+// Returns:
+//   - `string`: The tag's or mention's name.
+//   - `string`: The feed format (`atom`, `json`, or `rss`).
+//   - `string`: The requested slice (JSON feeds only, e.g. `10,20`).
+//   - `bool`: `true` if `aTail` asks for a feed, `false` otherwise.
+func feedTail(aTail string) (string, string, string, bool) {
+	parts := strings.Split(strings.Trim(aTail, `/`), `/`)
+	for idx := len(parts) - 1; 0 < idx; idx-- {
+		var format, page string
+		switch strings.ToLower(parts[idx]) {
+		case `feed`:
+			format = FeedAtom
+			if idx+1 < len(parts) {
+				format = strings.ToLower(parts[idx+1])
+			}
+
+		case `feed.json`:
+			format = FeedJSON
+			if idx+1 < len(parts) {
+				page = parts[idx+1]
+			}
+
+		default:
+			continue
+		}
+		return strings.Join(parts[:idx], `/`), format, page, true
+	}
+
+	return aTail, "", "", false
+} // feedTail()
+
+// `feedHeadline()` returns the first non-empty line of `aMarkdown`
+// as plain text.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's text.
+//
+// Returns:
+//   - `string`: The posting's headline.
+func feedHeadline(aMarkdown []byte) string {
+	for _, line := range strings.Split(string(aMarkdown), "\n") {
+		line = strings.TrimSpace(feedMarkupRE.ReplaceAllString(line, `$1`))
+		if 0 < len(line) {
+			return strings.Join(strings.Fields(line), ` `)
+		}
+	}
+
+	return ``
+} // feedHeadline()
+
+// `feedTitle()` returns a plain-text title derived from the first
+// line of `aMarkdown`.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's text.
+//
+// Returns:
+//   - `string`: The entry's title.
+func feedTitle(aMarkdown []byte) string {
+	title := feedHeadline(aMarkdown)
+	if feedTitleLen < utf8.RuneCountInString(title) {
+		runes := []rune(title)
+		title = strings.TrimSpace(string(runes[:feedTitleLen-1])) + `…`
+	}
+
+	return title
+} // feedTitle()
+
+// `feedUpdated()` returns the last modification time of `aPosting`.
+func feedUpdated(aPosting *TPosting) time.Time {
+	if aPosting.lastModified.IsZero() {
+		return aPosting.Time()
+	}
+
+	return aPosting.lastModified
+} // feedUpdated()
+
+// --------------------------------------------------------------------------
+// public functions:
+
+// `FeedPostings()` returns the newest postings for a feed.
+//
+// If `aList` is `nil` the overall newest postings are returned,
+// otherwise the newest of the postings with the given IDs.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aList`: An optional list of posting IDs (e.g. of a #hashtag).
+//   - `aLimit`: The max. number of postings to return.
+//   - `aOffset`: The number of (newest) postings to skip.
+//
+// Returns:
+//   - `*TPostList`: The postings sorted newest first.
+//   - `bool`: `true` if there are more postings after the returned ones.
+func FeedPostings(aCtx context.Context, aList []uint64, aLimit, aOffset int) (*TPostList, bool) {
+	pl := NewPostList()
+	if 0 >= aLimit {
+		aLimit = int(AppArgs.PageLength)
+	}
+	if 0 > aOffset {
+		aOffset = 0
+	}
+
+	if nil == aList {
+		// `NewestContext()` counts the offset starting with `1`:
+		_ = pl.NewestContext(aCtx, aLimit, aOffset+1) // ignore fs errors here
+		pl.Sort()
+	} else {
+		ids := append([]uint64(nil), aList...)
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] > ids[j] // newest first
+		})
+		if aOffset < len(ids) {
+			ids = ids[aOffset:]
+		} else {
+			ids = nil
+		}
+		for idx, id := range ids {
+			if aLimit < idx {
+				break // one more than needed to check for more
+			}
+			post := NewPosting(id, "")
+			if err := post.LoadContext(aCtx); nil != err {
+				apachelogger.Err("FeedPostings()",
+					fmt.Sprintf("TPosting.Load('%s'): %v", id2str(id), err))
+				continue
+			}
+			pl.Add(post)
+		}
+		pl.Sort()
+	}
+
+	if aLimit < pl.Len() {
+		*pl = (*pl)[:aLimit]
+		return pl, true
+	}
+
+	return pl, false
+} // FeedPostings()
+
+// --------------------------------------------------------------------------
+// TPageHandler methods
+
+// `handleFeed()` serves an Atom or RSS feed of the newest postings.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aFormat`: The feed format (`atom` or `rss`).
+//   - `aTag`: An optional #hashtag or @mention to limit the feed to.
+func (ph *TPageHandler) handleFeed(aWriter http.ResponseWriter,
+	aRequest *http.Request, aFormat, aTag string) {
+	var list []uint64
+	title := AppArgs.BlogName
+	switch {
+	case 0 == len(aTag):
+		// all postings
+
+	case '@' == aTag[0]:
+		list = ph.hashList.MentionList(aTag)
+		title += `: ` + aTag
+		if nil == list {
+			list = []uint64{}
+		}
+
+	default:
+		list = ph.hashList.HashList(aTag)
+		title += `: ` + aTag
+		if nil == list {
+			list = []uint64{}
+		}
+	}
+
+	pl, _ := FeedPostings(aRequest.Context(), list, int(AppArgs.PageLength), 0)
+
+	// The feed's state depends on the listed postings and their
+	// modification times:
+	var lastMod time.Time
+	hash := fnv.New64a()
+	fmt.Fprint(hash, aFormat, aTag)
+	for idx := range *pl {
+		post := &(*pl)[idx]
+		updated := feedUpdated(post)
+		if updated.After(lastMod) {
+			lastMod = updated
+		}
+		fmt.Fprint(hash, post.id, updated.UnixNano())
+	}
+	if lastMod.IsZero() {
+		lastMod = time.Unix(0, 0)
+	}
+	etag := fmt.Sprintf(`W/"%x"`, hash.Sum64())
+	if feedNotModified(aWriter, aRequest, lastMod, etag) {
+		return
+	}
+
+	base := publicBaseURL(aRequest)
+	self := base + aRequest.URL.Path
+	var (
+		data        any
+		contentType string
+	)
+	switch aFormat {
+	case FeedAtom:
+		contentType = `application/atom+xml; charset=utf-8`
+		data = feedAtom(pl, title, base, self, lastMod)
+
+	case FeedRSS:
+		contentType = `application/rss+xml; charset=utf-8`
+		data = feedRSS(pl, title, base, self, lastMod)
+
+	default:
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+
+	out, err := xml.MarshalIndent(data, "", "\t")
+	if nil != err {
+		apachelogger.Err("TPageHandler.handleFeed()",
+			fmt.Sprintf("xml.Marshal(): %v", err))
+		http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `public, max-age=600`)
+	aWriter.Header().Set(`Content-Type`, contentType)
+	if http.MethodHead == aRequest.Method {
+		return
+	}
+	_, _ = aWriter.Write([]byte(xml.Header))
+	_, _ = aWriter.Write(out)
+} // handleFeed()
+
+// `feedAtom()` returns the Atom representation of `aList`.
+func feedAtom(aList *TPostList, aTitle, aBaseURL, aSelf string, aUpdated time.Time) *tAtomFeed {
+	result := &tAtomFeed{
+		Title:   aTitle,
+		ID:      aSelf,
+		Updated: aUpdated.UTC().Format(time.RFC3339),
+		Links: []tAtomLink{
+			{Href: aSelf, Rel: `self`, Type: `application/atom+xml`},
+			{Href: aBaseURL + `/`, Rel: `alternate`, Type: `text/html`},
+		},
+		Author:    AppArgs.BlogName,
+		Generator: `Nele`,
+		Entries:   make([]tAtomEntry, 0, aList.Len()),
+	}
+
+	for idx := range *aList {
+		post := &(*aList)[idx]
+		link := aBaseURL + `/p/` + post.IDstr()
+		result.Entries = append(result.Entries, tAtomEntry{
+			Title:     feedTitle(post.Markdown()),
+			ID:        link,
+			Link:      tAtomLink{Href: link, Rel: `alternate`, Type: `text/html`},
+			Published: post.Time().UTC().Format(time.RFC3339),
+			Updated:   feedUpdated(post).UTC().Format(time.RFC3339),
+			Content: tAtomContent{
+				Type: `html`,
+				Body: feedAbsURLs([]byte(post.Post()), aBaseURL),
+			},
+		})
+	}
+
+	return result
+} // feedAtom()
+
+// `feedRSS()` returns the RSS 2.0 representation of `aList`.
+func feedRSS(aList *TPostList, aTitle, aBaseURL, aSelf string, aUpdated time.Time) *tRSS {
+	result := &tRSS{
+		Version: `2.0`,
+		AtomNS:  `http://www.w3.org/2005/Atom`,
+		Channel: tRSSchannel{
+			Title:         aTitle,
+			Link:          aBaseURL + `/`,
+			Description:   aTitle,
+			Self:          tAtomLink{Href: aSelf, Rel: `self`, Type: `application/rss+xml`},
+			LastBuildDate: aUpdated.UTC().Format(time.RFC1123Z),
+			Generator:     `Nele`,
+			Items:         make([]tRSSitem, 0, aList.Len()),
+		},
+	}
+
+	for idx := range *aList {
+		post := &(*aList)[idx]
+		link := aBaseURL + `/p/` + post.IDstr()
+		result.Channel.Items = append(result.Channel.Items, tRSSitem{
+			Title:       feedTitle(post.Markdown()),
+			Link:        link,
+			GUID:        tRSSguid{IsPermaLink: true, Value: link},
+			PubDate:     post.Time().UTC().Format(time.RFC1123Z),
+			Description: feedAbsURLs([]byte(post.Post()), aBaseURL),
+		})
+	}
+
+	return result
+} // feedRSS()
+
+/* _EoF_ */
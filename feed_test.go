@@ -0,0 +1,146 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+func Test_feedAbsURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{" 1", `<a href="/p/1">x</a>`, `<a href="https://host/p/1">x</a>`},
+		{" 2", `<img src="/img/a.png" alt="">`, `<img src="https://host/img/a.png" alt="">`},
+		{" 3", `<a href="//other/x">x</a>`, `<a href="//other/x">x</a>`},
+		{" 4", `<a href="https://other/x">x</a>`, `<a href="https://other/x">x</a>`},
+		{" 5", `<p>href="/x"</p>`, `<p>href="/x"</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feedAbsURLs([]byte(tt.html), "https://host"); got != tt.want {
+				t.Errorf("feedAbsURLs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_feedAbsURLs()
+
+func Test_feedTail(t *testing.T) {
+	tests := []struct {
+		name       string
+		tail       string
+		wantTag    string
+		wantFormat string
+		wantPage   string
+		wantOK     bool
+	}{
+		{" 1", "golang", "golang", "", "", false},
+		{" 2", "golang/feed", "golang", FeedAtom, "", true},
+		{" 3", "golang/feed/rss", "golang", FeedRSS, "", true},
+		{" 4", "golang/feed/", "golang", FeedAtom, "", true},
+		{" 5", "feed", "feed", "", "", false},
+		{" 6", "golang/feed.json", "golang", FeedJSON, "", true},
+		{" 7", "golang/feed.json/10,20", "golang", FeedJSON, "10,20", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, format, page, ok := feedTail(tt.tail)
+			if (tag != tt.wantTag) || (format != tt.wantFormat) ||
+				(page != tt.wantPage) || (ok != tt.wantOK) {
+				t.Errorf("feedTail(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.tail,
+					tag, format, page, ok, tt.wantTag, tt.wantFormat, tt.wantPage, tt.wantOK)
+			}
+		})
+	}
+} // Test_feedTail()
+
+func Test_feedTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{" 1", "\n# Hello *world*\n\nmore text", "Hello world"},
+		{" 2", "> [a link](https://example.com/) about #golang", "a link about #golang"},
+		{" 3", strings.Repeat("x", 100), strings.Repeat("x", feedTitleLen-1) + "…"},
+		{" 4", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feedTitle([]byte(tt.md)); got != tt.want {
+				t.Errorf("feedTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_feedTitle()
+
+func TestTPageHandler_handleFeed(t *testing.T) {
+	ph := prepAPITest(t)
+	for day := 1; 3 >= day; day++ {
+		id := time2id(time.Date(2024, 4, day, 12, 0, 0, 0, time.Local))
+		if _, err := NewPosting(id, "Posting [link](/p/1)").Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/feed/atom", nil)
+	rec := httptest.NewRecorder()
+	ph.handleFeed(rec, req, FeedAtom, "")
+	if http.StatusOK != rec.Code {
+		t.Fatalf("handleFeed(atom) = %d", rec.Code)
+	}
+	var atom tAtomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &atom); nil != err {
+		t.Fatalf("handleFeed(atom): %v", err)
+	}
+	if 3 != len(atom.Entries) {
+		t.Errorf("handleFeed(atom): %d entries, want 3", len(atom.Entries))
+	} else if !strings.Contains(atom.Entries[0].Content.Body, `href="http://example.com/p/1"`) {
+		t.Errorf("handleFeed(atom): relative URL in %q", atom.Entries[0].Content.Body)
+	}
+
+	// conditional GET:
+	etag := rec.Header().Get("ETag")
+	lastMod := rec.Header().Get("Last-Modified")
+	req = httptest.NewRequest(http.MethodGet, "/feed/atom", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	ph.handleFeed(rec, req, FeedAtom, "")
+	if http.StatusNotModified != rec.Code {
+		t.Errorf("handleFeed(If-None-Match) = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/feed/atom", nil)
+	req.Header.Set("If-Modified-Since", lastMod)
+	rec = httptest.NewRecorder()
+	ph.handleFeed(rec, req, FeedAtom, "")
+	if http.StatusNotModified != rec.Code {
+		t.Errorf("handleFeed(If-Modified-Since) = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feed/rss", nil)
+	rec = httptest.NewRecorder()
+	ph.handleFeed(rec, req, FeedRSS, "")
+	var rss tRSS
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rss); nil != err {
+		t.Fatalf("handleFeed(rss): %v", err)
+	}
+	if 3 != len(rss.Channel.Items) {
+		t.Errorf("handleFeed(rss): %d items, want 3", len(rss.Channel.Items))
+	}
+} // TestTPageHandler_handleFeed()
+
+/* _EoF_ */
@@ -0,0 +1,105 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a CommonMark/GFM compliant Markdown renderer
+ * using `goldmark`.
+ */
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+type (
+	// `tGMrenderer` is the `IMarkdownRenderer` using `goldmark`.
+	tGMrenderer struct {
+		md goldmark.Markdown
+	}
+)
+
+var (
+	// The Markdown parser used to analyse the postings' structure
+	// (e.g. to find the shortcodes); it's configured like the
+	// `goldmark` renderer.
+	gmParser = goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			extension.DefinitionList,
+			extension.Footnote,
+		),
+		goldmark.WithParserOptions(
+			// skip `{#id}` as used by blackfriday
+			parser.WithAttribute(),
+		),
+	).Parser()
+)
+
+// `newGMrenderer()` returns a CommonMark renderer with the GitHub
+// flavoured extensions (tables, strikethrough, autolinks, and task
+// lists) as well as definition lists, footnotes, and typographic
+// punctuation.
+//
+// Returns:
+//   - `*tGMrenderer`: The new renderer.
+func newGMrenderer() *tGMrenderer {
+	return &tGMrenderer{
+		md: goldmark.New(
+			goldmark.WithExtensions(
+				extension.GFM,
+				extension.DefinitionList,
+				extension.Footnote,
+				extension.Typographer,
+			),
+			goldmark.WithParserOptions(
+				// allow for `{#id}` as with blackfriday
+				parser.WithAttribute(),
+			),
+			goldmark.WithRendererOptions(
+				// the postings are written by the blog's owner(s)
+				html.WithUnsafe(),
+			),
+		),
+	}
+} // newGMrenderer()
+
+// `ID()` returns the renderer's identifier.
+//
+// Returns:
+//   - `string`: The renderer's name.
+func (gr *tGMrenderer) ID() string {
+	return mdGoldmark
+} // ID()
+
+// `Render()` converts `aMarkdown` to HTML.
+//
+// The method is safe for concurrent use.
+//
+// Parameters:
+//   - `aMarkdown` The raw Markdown text to convert.
+//
+// Returns:
+//   - `[]byte`: The generated HTML data.
+func (gr *tGMrenderer) Render(aMarkdown []byte) []byte {
+	var buf bytes.Buffer
+	if err := gr.md.Convert(aMarkdown, &buf); nil != err {
+		// `Convert()` fails only if writing to `buf` fails
+		return nil
+	}
+
+	return bfFixPre(bytes.TrimSpace(buf.Bytes()))
+} // Render()
+
+/* _EoF_ */
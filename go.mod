@@ -4,7 +4,9 @@ go 1.22.1
 
 require (
 	github.com/NYTimes/gziphandler v1.1.1
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/microcosm-cc/bluemonday v1.0.27
 	github.com/mwat56/apachelogger v1.7.0
 	github.com/mwat56/cssfs v0.2.7
 	github.com/mwat56/errorhandler v1.1.11
@@ -17,15 +19,20 @@ require (
 	github.com/mwat56/uploadhandler v1.1.11
 	github.com/mwat56/whitespace v0.2.6
 	github.com/russross/blackfriday/v2 v2.1.0
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/net v0.26.0
 )
 
 require (
+	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/chromedp/cdproto v0.0.0-20240721024200-dac8efcb39ce // indirect
 	github.com/chromedp/chromedp v0.9.5 // indirect
 	github.com/chromedp/sysutil v1.0.0 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.4.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	golang.org/x/crypto v0.25.0 // indirect
@@ -0,0 +1,119 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the server-side syntax highlighting
+ * of fenced code blocks.
+ */
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+
+	"github.com/alecthomas/chroma/v2"
+	chtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+var (
+	// Whether to highlight the code blocks (see `InitConfig()`).
+	hlActive bool
+
+	// The formatter emitting classed `SPAN`s only; the colours
+	// are defined by the `dark.css` and `light.css` themes.
+	hlFormatter = chtml.New(
+		chtml.WithClasses(true),
+		chtml.PreventSurroundingPre(true),
+	)
+
+	// Text to recognise a code block with a language tag.
+	hlLangPre = []byte(`<pre class="language-`)
+
+	// RegEx to find the code blocks prepared by `bfFixPre()`.
+	hlPreRE = regexp.MustCompile(`(?s)<pre class="language-(\w+)">\n(.*?)\n</pre>`)
+)
+
+// `hlCode()` returns the highlighted HTML of `aCode` written
+// in `aLang`.
+//
+// Parameters:
+//   - `aLang`: The code's language (name, alias, or file extension).
+//   - `aCode`: The escaped code to highlight.
+//
+// Returns:
+//   - `[]byte`: The highlighted code.
+//   - `bool`: Whether the language is supported.
+func hlCode(aLang, aCode string) ([]byte, bool) {
+	lexer := lexers.Get(aLang)
+	if nil == lexer {
+		return nil, false
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, html.UnescapeString(aCode))
+	if nil != err {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	if err = hlFormatter.Format(&buf, styles.Fallback, iterator); nil != err {
+		return nil, false
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), true
+} // hlCode()
+
+// `hlHighlight()` marks up the syntax of all code blocks in `aHTML`
+// whose language is known.
+//
+// The highlighted blocks get the additional CSS class `chroma`.
+// If highlighting is disabled `aHTML` is returned unchanged.
+//
+// Parameters:
+//   - `aHTML`: The HTML page to process.
+//
+// Returns:
+//   - `[]byte`: The page with highlighted code blocks.
+func hlHighlight(aHTML []byte) []byte {
+	if !hlActive || (0 > bytes.Index(aHTML, hlLangPre)) {
+		return aHTML
+	}
+
+	return hlPreRE.ReplaceAllFunc(aHTML, func(aPre []byte) []byte {
+		match := hlPreRE.FindSubmatch(aPre)
+		code, ok := hlCode(string(match[1]), string(match[2]))
+		if !ok {
+			return aPre
+		}
+
+		result := make([]byte, 0, len(code)+64)
+		result = append(result, hlLangPre...)
+		result = append(result, match[1]...)
+		result = append(result, " chroma\">\n"...)
+		result = append(result, code...)
+
+		return append(result, "\n</pre>"...)
+	})
+} // hlHighlight()
+
+// `hlID()` identifies the highlighting state for the HTML cache.
+//
+// Returns:
+//   - `string`: The highlighting part of a posting's HTML version.
+func hlID() string {
+	if hlActive {
+		return `-hl`
+	}
+
+	return ``
+} // hlID()
+
+/* _EoF_ */
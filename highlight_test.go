@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_hlHighlight(t *testing.T) {
+	defer func(aActive bool) { hlActive = aActive }(hlActive)
+	hlActive = true
+
+	goCode := "```go\n// check\nif a < b {\n\treturn \"x\"\n}\n```"
+	tests := []struct {
+		name     string
+		md       string
+		renderer IMarkdownRenderer
+		want     []string
+		notWant  []string
+	}{
+		{" 1", goCode, tBFrenderer{},
+			[]string{`<pre class="language-go chroma">`, `<span class="c1">// check`, `<span class="k">if</span>`, `&lt;`, `<span class="s">&#34;x&#34;</span>`, "}</span>\n</pre>"},
+			[]string{`<code`}},
+		{" 2", goCode, newGMrenderer(),
+			[]string{`<pre class="language-go chroma">`, `<span class="k">if</span>`},
+			nil},
+		{" 3", "```nolang\nif a < b\n```", tBFrenderer{},
+			[]string{"<pre class=\"language-nolang\">\nif a &lt; b\n</pre>"},
+			[]string{`chroma`}},
+		{" 4", "\tif a < b", tBFrenderer{},
+			[]string{"<pre>\nif a &lt; b\n</pre>"},
+			[]string{`chroma`, `<span`}},
+	}
+	for _, tt := range tests {
+		got := string(hlHighlight(tt.renderer.Render([]byte(tt.md))))
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%q: hlHighlight() = %q, missing %q", tt.name, got, want)
+			}
+		}
+		for _, want := range tt.notWant {
+			if strings.Contains(got, want) {
+				t.Errorf("%q: hlHighlight() = %q, unexpected %q", tt.name, got, want)
+			}
+		}
+	}
+
+	hlActive = false
+	page := MDtoHTML([]byte(goCode))
+	if got := hlHighlight(page); string(got) != string(page) {
+		t.Errorf("hlHighlight() = %q, want unchanged page", got)
+	}
+} // Test_hlHighlight()
+
+/* _EoF_ */
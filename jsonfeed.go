@@ -0,0 +1,276 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides JSON Feed (version 1.1) output for the newest
+ * postings and for the postings of a single #hashtag or @mention.
+ *
+ * see: https://www.jsonfeed.org/version/1.1/
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	ht "github.com/mwat56/hashtags"
+)
+
+const (
+	// `FeedJSON` is the format name of JSON feeds.
+	FeedJSON = `json`
+
+	// `jfVersion` is the JSON Feed version URL.
+	jfVersion = `https://jsonfeed.org/version/1.1`
+)
+
+type (
+	// `tJSONFeed` is the top-level object of a JSON feed.
+	tJSONFeed struct {
+		Version     string          `json:"version"`
+		Title       string          `json:"title"`
+		HomePageURL string          `json:"home_page_url"`
+		FeedURL     string          `json:"feed_url"`
+		NextURL     string          `json:"next_url,omitempty"`
+		Language    string          `json:"language,omitempty"`
+		Authors     []tJSONFeedName `json:"authors,omitempty"`
+		Items       []tJSONFeedItem `json:"items"`
+	}
+
+	// `tJSONFeedAttachment` describes a file linked by a feed item.
+	tJSONFeedAttachment struct {
+		URL         string `json:"url"`
+		MimeType    string `json:"mime_type"`
+		SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+	}
+
+	// `tJSONFeedItem` is a single feed item (i.e. posting).
+	tJSONFeedItem struct {
+		ID            string                `json:"id"`
+		URL           string                `json:"url"`
+		Title         string                `json:"title,omitempty"`
+		ContentHTML   string                `json:"content_html"`
+		ContentText   string                `json:"content_text"`
+		DatePublished string                `json:"date_published"`
+		DateModified  string                `json:"date_modified"`
+		Tags          []string              `json:"tags,omitempty"`
+		Attachments   []tJSONFeedAttachment `json:"attachments,omitempty"`
+	}
+
+	// `tJSONFeedName` is a feed's author.
+	tJSONFeedName struct {
+		Name string `json:"name"`
+	}
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `jfAttachments()` returns the uploaded images linked by `aPosting`.
+//
+// Page screenshots are not considered uploads and thus skipped.
+//
+// Parameters:
+//   - `aPosting`: The posting to inspect.
+//   - `aBaseURL`: The scheme and host to prepend to the images' URLs.
+//
+// Returns:
+//   - `[]tJSONFeedAttachment`: The list of linked images.
+func jfAttachments(aPosting *TPosting, aBaseURL string) []tJSONFeedAttachment {
+	var result []tJSONFeedAttachment
+	md := aPosting.Markdown()
+
+	shots := make(map[string]bool)
+	for _, pair := range checkScreenshotURLs(md) {
+		shots[pair.imgURL] = true
+	}
+	seen := make(map[string]bool)
+	for _, ref := range atReferences(md) {
+		name := `/` + ref
+		if seen[name] || !(TMediaFile{Name: name}).IsImage() {
+			continue
+		}
+		seen[name] = true
+		if strings.HasPrefix(name, `/img/`) && shots[path.Base(name)] {
+			continue
+		}
+
+		att := tJSONFeedAttachment{
+			URL:      aBaseURL + name,
+			MimeType: mime.TypeByExtension(strings.ToLower(path.Ext(name))),
+		}
+		if 0 == len(att.MimeType) {
+			att.MimeType = `application/octet-stream`
+		}
+		if fi, err := os.Stat(filepath.Join(AppArgs.DataDir, filepath.FromSlash(name))); nil == err {
+			att.SizeInBytes = fi.Size()
+		}
+		result = append(result, att)
+	}
+
+	return result
+} // jfAttachments()
+
+// `jfTags()` returns the #hashtags and @mentions used by the postings
+// of `aList` as recorded in the hashtag list.
+//
+// Parameters:
+//   - `aHashList`: The list of #hashtags/@mentions.
+//   - `aList`: The postings to look for.
+//
+// Returns:
+//   - `map[uint64][]string`: The sorted tags indexed by posting ID.
+func jfTags(aHashList *ht.THashTags, aList *TPostList) map[uint64][]string {
+	result := make(map[uint64][]string, aList.Len())
+	if (nil == aHashList) || (0 == aList.Len()) {
+		return result
+	}
+	for _, post := range *aList {
+		result[post.id] = nil
+	}
+
+	for _, item := range aHashList.List() {
+		var ids []uint64
+		if 0 == len(item.Tag) {
+			continue
+		}
+		if ht.MarkMention == item.Tag[0] {
+			ids = aHashList.MentionList(item.Tag)
+		} else {
+			ids = aHashList.HashList(item.Tag)
+		}
+		for _, id := range ids {
+			if tags, ok := result[id]; ok {
+				result[id] = append(tags, item.Tag)
+			}
+		}
+	}
+	for id := range result {
+		sort.Strings(result[id])
+	}
+
+	return result
+} // jfTags()
+
+// --------------------------------------------------------------------------
+// TPageHandler methods
+
+// `handleJSONFeed()` serves a JSON feed of the newest postings.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aPage`: The requested slice like `10,20` (same as with `/n/`).
+//   - `aTag`: An optional #hashtag or @mention to limit the feed to.
+func (ph *TPageHandler) handleJSONFeed(aWriter http.ResponseWriter,
+	aRequest *http.Request, aPage, aTag string) {
+	var list []uint64
+	title := AppArgs.BlogName
+	if 0 < len(aTag) {
+		if ht.MarkMention == aTag[0] {
+			list = ph.hashList.MentionList(aTag)
+		} else {
+			list = ph.hashList.HashList(aTag)
+		}
+		if nil == list {
+			list = []uint64{}
+		}
+		title += `: ` + aTag
+	}
+
+	limit, start := numStart(aPage)
+	if 0 >= limit {
+		limit = int(AppArgs.PageLength)
+	}
+	if 0 >= start {
+		start = 1 // positions count from `1` like with `/n/`
+	}
+	pl, more := FeedPostings(aRequest.Context(), list, limit, start-1)
+
+	// The feed's state depends on the listed postings and their
+	// modification times:
+	var lastMod time.Time
+	hash := fnv.New64a()
+	fmt.Fprint(hash, FeedJSON, aTag, limit, start, more)
+	for idx := range *pl {
+		post := &(*pl)[idx]
+		updated := feedUpdated(post)
+		if updated.After(lastMod) {
+			lastMod = updated
+		}
+		fmt.Fprint(hash, post.id, updated.UnixNano())
+	}
+	if lastMod.IsZero() {
+		lastMod = time.Unix(0, 0)
+	}
+	if feedNotModified(aWriter, aRequest, lastMod, fmt.Sprintf(`W/"%x"`, hash.Sum64())) {
+		return
+	}
+
+	base := publicBaseURL(aRequest)
+	feedPath := strings.TrimSuffix(strings.TrimSuffix(aRequest.URL.Path, `/`), `/`+aPage)
+	feed := tJSONFeed{
+		Version:     jfVersion,
+		Title:       title,
+		HomePageURL: base + `/`,
+		FeedURL:     base + (&url.URL{Path: feedPath}).String(),
+		Language:    AppArgs.Lang,
+		Authors:     []tJSONFeedName{{Name: AppArgs.BlogName}},
+		Items:       make([]tJSONFeedItem, 0, pl.Len()),
+	}
+	if more {
+		feed.NextURL = base + (&url.URL{
+			Path: fmt.Sprintf("%s/%d,%d", feedPath, limit, start+limit),
+		}).String()
+	}
+
+	tags := jfTags(ph.hashList, pl)
+	for idx := range *pl {
+		post := &(*pl)[idx]
+		link := base + `/p/` + post.IDstr()
+		feed.Items = append(feed.Items, tJSONFeedItem{
+			ID:            link,
+			URL:           link,
+			Title:         feedTitle(post.Markdown()),
+			ContentHTML:   feedAbsURLs([]byte(post.Post()), base),
+			ContentText:   string(post.Markdown()),
+			DatePublished: post.Time().Format(time.RFC3339),
+			DateModified:  feedUpdated(post).Format(time.RFC3339),
+			Tags:          tags[post.id],
+			Attachments:   jfAttachments(post, base),
+		})
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `public, max-age=600`)
+	aWriter.Header().Set(`Content-Type`, `application/feed+json; charset=utf-8`)
+	if http.MethodHead == aRequest.Method {
+		return
+	}
+	enc := json.NewEncoder(aWriter)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(feed); nil != err {
+		apachelogger.Err("TPageHandler.handleJSONFeed()",
+			fmt.Sprintf("json.Encode(): %v", err))
+	}
+} // handleJSONFeed()
+
+/* _EoF_ */
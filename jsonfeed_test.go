@@ -0,0 +1,90 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+func Test_jfAttachments(t *testing.T) {
+	prepAttachmentTest(t)
+	writeTestFile(t, filepath.Join(AppArgs.DataDir, "img", "pic.png"), "png")
+
+	post := NewPosting(0, "![pic](/img/pic.png) ![pic](/img/pic.png) [doc](/static/doc.pdf)\n\n"+
+		"[![shot](/img/shot.png)](https://example.com/) ![att](/attachments/0123456789abcdef/x.jpg)")
+	got := jfAttachments(post, "https://host")
+	if 2 != len(got) {
+		t.Fatalf("jfAttachments() = %v, want 2 entries", got)
+	}
+	if ("https://host/img/pic.png" != got[0].URL) || ("image/png" != got[0].MimeType) || (3 != got[0].SizeInBytes) {
+		t.Errorf("jfAttachments()[0] = %+v", got[0])
+	}
+	if ("https://host/attachments/0123456789abcdef/x.jpg" != got[1].URL) || ("image/jpeg" != got[1].MimeType) {
+		t.Errorf("jfAttachments()[1] = %+v", got[1])
+	}
+} // Test_jfAttachments()
+
+func TestTPageHandler_handleJSONFeed(t *testing.T) {
+	ph := prepAPITest(t)
+	for day := 1; 5 >= day; day++ {
+		id := time2id(time.Date(2024, 4, day, 12, 0, 0, 0, time.Local))
+		if _, err := NewPosting(id, "Posting *one*").Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	for page, url := "2", "/feed.json/2"; ; {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		ph.handleJSONFeed(rec, req, page, "")
+		if http.StatusOK != rec.Code {
+			t.Fatalf("handleJSONFeed(%s) = %d", url, rec.Code)
+		}
+		var feed tJSONFeed
+		if err := json.Unmarshal(rec.Body.Bytes(), &feed); nil != err {
+			t.Fatalf("handleJSONFeed(%s): %v", url, err)
+		}
+		if (jfVersion != feed.Version) || ("http://example.com/feed.json" != feed.FeedURL) {
+			t.Errorf("handleJSONFeed(%s) = %q, %q", url, feed.Version, feed.FeedURL)
+		}
+		for _, item := range feed.Items {
+			if "Posting *one*" != item.ContentText {
+				t.Errorf("handleJSONFeed(): content_text = %q", item.ContentText)
+			}
+			seen = append(seen, item.ID)
+		}
+		if 0 == len(feed.NextURL) {
+			break
+		}
+		url = strings.TrimPrefix(feed.NextURL, "http://example.com")
+		page = strings.TrimPrefix(url, "/feed.json/")
+		if 5 < len(seen) {
+			t.Fatalf("handleJSONFeed(): endless pagination at %s", url)
+		}
+	}
+	if 5 != len(seen) {
+		t.Fatalf("handleJSONFeed(): got %d items, want 5", len(seen))
+	}
+	for idx := 1; idx < len(seen); idx++ {
+		if seen[idx-1] <= seen[idx] {
+			t.Errorf("handleJSONFeed(): %v not sorted newest first", seen)
+			break
+		}
+	}
+} // TestTPageHandler_handleJSONFeed()
+
+/* _EoF_ */
@@ -0,0 +1,244 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the interface of the Markdown renderers
+ * and the selection of the renderer to use.
+ */
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+type (
+	// `IMarkdownRenderer` converts the postings' Markdown to HTML.
+	//
+	// Implementations must be safe for concurrent use.
+	IMarkdownRenderer interface {
+		//
+		// `ID()` returns the renderer's identifier.
+		//
+		// Returns:
+		//	- `string`: The renderer's name.
+		ID() string
+
+		//
+		// `Render()` converts `aMarkdown` to HTML.
+		//
+		// Parameters:
+		//	- `aMarkdown` The raw Markdown text to convert.
+		//
+		// Returns:
+		//	- `[]byte`: The generated HTML data.
+		Render(aMarkdown []byte) []byte
+	}
+
+	// `TRenderDiff` describes a posting whose HTML differs between
+	// two renderers.
+	TRenderDiff struct {
+		ID   uint64 // the posting's ID
+		Line int    // number of the first differing line
+		Old  string // that line as generated by the current renderer
+		New  string // that line as generated by the other renderer
+	}
+)
+
+const (
+	// Names of the available renderers:
+	mdBlackfriday = `blackfriday`
+	mdGoldmark    = `goldmark`
+)
+
+var (
+	// The renderer used for the postings.
+	//
+	// It should be considered `R/O` after the initial configuration.
+	mdRenderer IMarkdownRenderer = tBFrenderer{}
+
+	// RegEx to find the whitespace between two HTML tags.
+	mdTagGapRE = regexp.MustCompile(`>\s*<`)
+
+	// RegEx to find a sequence of blanks.
+	mdBlanksRE = regexp.MustCompile(`[ \t]+`)
+
+	// RegEx to find a fenced code block's delimiter.
+	mdFenceRE = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// `MarkdownRenderer()` returns the renderer used for the postings.
+//
+// Returns:
+//   - `IMarkdownRenderer`: The current Markdown renderer.
+func MarkdownRenderer() IMarkdownRenderer {
+	return mdRenderer
+} // MarkdownRenderer()
+
+// `NewMarkdownRenderer()` returns the renderer identified by `aName`.
+//
+// Accepted names are `blackfriday` (or `bf`) and `goldmark` (or
+// `commonmark`, `gfm`).
+//
+// Parameters:
+//   - `aName`: The name of the renderer to use.
+//
+// Returns:
+//   - `IMarkdownRenderer`: The requested renderer.
+//   - `error`: A possible error, or `nil` on success.
+func NewMarkdownRenderer(aName string) (IMarkdownRenderer, error) {
+	switch strings.ToLower(strings.TrimSpace(aName)) {
+	case ``, `bf`, mdBlackfriday:
+		return tBFrenderer{}, nil
+
+	case `commonmark`, `gfm`, mdGoldmark:
+		return newGMrenderer(), nil
+
+	default:
+		return nil, se.Wrap(fmt.Errorf("unknown Markdown renderer '%s'", aName), 1)
+	}
+} // NewMarkdownRenderer()
+
+// `SetMarkdownRenderer()` sets the renderer to use for the postings.
+//
+// A `nil` argument is ignored.
+//
+// Parameters:
+//   - `aRenderer`: The Markdown renderer to use.
+func SetMarkdownRenderer(aRenderer IMarkdownRenderer) {
+	if nil != aRenderer {
+		mdRenderer = aRenderer
+	}
+} // SetMarkdownRenderer()
+
+// `mdTextLines()` calls `aFunc` for each line of `aMarkdown` outside
+// of fenced code blocks, replacing the line by the function's result.
+//
+// Parameters:
+//   - `aMarkdown`: The Markdown text to process.
+//   - `aFunc`: The function to apply to each text line.
+//
+// Returns:
+//   - `[]byte`: The processed Markdown text.
+func mdTextLines(aMarkdown []byte, aFunc func(aLine []byte) []byte) []byte {
+	var fence string
+	lines := bytes.Split(aMarkdown, []byte("\n"))
+	for idx, line := range lines {
+		if m := mdFenceRE.FindSubmatch(line); nil != m {
+			if 0 == len(fence) {
+				fence = string(m[1])
+			} else if fence == string(m[1]) {
+				fence = ``
+			}
+			continue
+		}
+		if 0 == len(fence) {
+			lines[idx] = aFunc(line)
+		}
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+} // mdTextLines()
+
+// `mdNormalise()` reduces `aHTML` to the parts relevant for the
+// display by putting each tag following another one on a line of
+// its own and collapsing all other blanks.
+//
+// Parameters:
+//   - `aHTML`: The HTML to normalise.
+//
+// Returns:
+//   - `[]string`: The lines of the normalised HTML.
+func mdNormalise(aHTML []byte) []string {
+	aHTML = mdTagGapRE.ReplaceAll(bytes.TrimSpace(aHTML), []byte(">\n<"))
+	aHTML = mdBlanksRE.ReplaceAll(aHTML, []byte(` `))
+
+	return strings.Split(string(aHTML), "\n")
+} // mdNormalise()
+
+// `mdDiff()` compares the final HTML generated for `aPosting` by the
+// two given renderers.
+//
+// Parameters:
+//   - `aPosting`: The posting to render.
+//   - `aOld`: The current renderer.
+//   - `aNew`: The renderer to compare with.
+//
+// Returns:
+//   - `int`: The number of the first differing line, or `0` if equal.
+//   - `string`: That line as generated by `aOld`.
+//   - `string`: That line as generated by `aNew`.
+func mdDiff(aPosting *TPosting, aOld, aNew IMarkdownRenderer) (int, string, string) {
+	md := aPosting.Markdown()
+	oPage, _ := phRenderWith(aOld, aPosting, md, 0)
+	nPage, _ := phRenderWith(aNew, aPosting, md, 0)
+	oLines, nLines := mdNormalise(oPage), mdNormalise(nPage)
+
+	for idx := 0; idx < max(len(oLines), len(nLines)); idx++ {
+		var oLine, nLine string
+		if idx < len(oLines) {
+			oLine = oLines[idx]
+		}
+		if idx < len(nLines) {
+			nLine = nLines[idx]
+		}
+		if oLine != nLine {
+			return idx + 1, oLine, nLine
+		}
+	}
+
+	return 0, ``, ``
+} // mdDiff()
+
+// `CompareRenderers()` reports all postings whose HTML would change
+// when switching from the current renderer to `aRenderer`.
+//
+// The postings are compared as shown to the readers, i.e. including
+// the #hashtags/@mentions, shortcodes, highlighting, and sanitising.
+// Differences in whitespace between HTML tags are ignored.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aRenderer`: The renderer to compare with the current one.
+//
+// Returns:
+//   - `[]TRenderDiff`: The list of differing postings.
+//   - `error`: A possible error, or `nil` on success.
+func CompareRenderers(aCtx context.Context, aRenderer IMarkdownRenderer) ([]TRenderDiff, error) {
+	var result []TRenderDiff
+
+	wf := func(aID uint64) error {
+		post := NewPosting(aID, "")
+		if err := post.LoadContext(aCtx); nil != err {
+			return nil // ignore unreadable postings
+		}
+		if line, oLine, nLine := mdDiff(post, mdRenderer, aRenderer); 0 < line {
+			result = append(result, TRenderDiff{
+				ID:   aID,
+				Line: line,
+				Old:  oLine,
+				New:  nLine,
+			})
+		}
+
+		return nil
+	} // wf()
+
+	err := poPersistence.WalkContext(aCtx, wf)
+
+	return result, err
+} // CompareRenderers()
+
+/* _EoF_ */
@@ -0,0 +1,105 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewMarkdownRenderer(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", mdBlackfriday, false},
+		{"bf", mdBlackfriday, false},
+		{"BlackFriday", mdBlackfriday, false},
+		{"goldmark", mdGoldmark, false},
+		{"CommonMark", mdGoldmark, false},
+		{"gfm", mdGoldmark, false},
+		{"pandoc", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NewMarkdownRenderer(tt.name)
+		if (nil != err) != tt.wantErr {
+			t.Errorf("NewMarkdownRenderer(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if (nil != got) && (tt.want != got.ID()) {
+			t.Errorf("NewMarkdownRenderer(%q) = %q, want %q", tt.name, got.ID(), tt.want)
+		}
+	}
+} // TestNewMarkdownRenderer()
+
+func Test_tGMrenderer_Render(t *testing.T) {
+	gm := newGMrenderer()
+	tests := []struct {
+		name string
+		md   string
+		want []string
+	}{
+		{" 1", "- [x] done\n- [ ] open", []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`}},
+		{" 2", "see https://example.com/ here", []string{`<a href="https://example.com/">https://example.com/</a>`}},
+		{" 3", "| a | b |\n|---|---|\n| 1 | 2 |", []string{`<table>`, `<td>1</td>`}},
+		{" 4", "~~gone~~", []string{`<del>gone</del>`}},
+		{" 5", "```go\nfunc x() {}\n```", []string{"<pre class=\"language-go\">\nfunc x() {}\n</pre>"}},
+		{" 6", "1. one\n   - nested\n2. two", []string{"<ol>\n<li>one\n<ul>\n<li>nested</li>"}},
+		{" 7", "## Title {#here}", []string{`<h2 id="here">Title</h2>`}},
+	}
+	for _, tt := range tests {
+		got := string(gm.Render([]byte(tt.md)))
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%q: Render() = %q, missing %q", tt.name, got, want)
+			}
+		}
+	}
+} // Test_tGMrenderer_Render()
+
+func Test_mdDiff(t *testing.T) {
+	bfr, gmr := tBFrenderer{}, newGMrenderer()
+
+	if line, o, n := mdDiff(NewPosting(0, "Some *simple* text."), bfr, gmr); 0 != line {
+		t.Errorf("mdDiff() = %d, %q, %q, want no difference", line, o, n)
+	}
+	if line, o, n := mdDiff(NewPosting(0, "- [ ] task"), bfr, gmr); (1 > line) || !strings.Contains(o, "[ ] task") {
+		t.Errorf("mdDiff() = %d, %q, %q, want a difference", line, o, n)
+	}
+	// the final HTML is compared, i.e. with the #hashtags marked up
+	if line, o, n := mdDiff(NewPosting(0, "- [ ] task #tag"), bfr, gmr); (1 > line) || !strings.Contains(o, `/hl/tag`) {
+		t.Errorf("mdDiff() = %d, %q, %q, want a difference with the tag's link", line, o, n)
+	}
+} // Test_mdDiff()
+
+func TestCompareRenderers(t *testing.T) {
+	prep4Tests()
+
+	p1 := NewPosting(0, "Plain *text* only")
+	p2 := NewPosting(0, "- [x] a task list")
+	for _, p := range []*TPosting{p1, p2} {
+		if _, err := p.Store(); nil != err {
+			t.Fatal(err)
+		}
+		defer p.Delete()
+	}
+
+	diffs, err := CompareRenderers(context.Background(), newGMrenderer())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (1 != len(diffs)) || (p2.ID() != diffs[0].ID) {
+		t.Errorf("CompareRenderers() = %+v, want posting %s only", diffs, p2.IDstr())
+	}
+} // TestCompareRenderers()
+
+/* _EoF_ */
@@ -0,0 +1,392 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the media library, i.e. an overview of all
+ * uploaded files and page screenshots along with the postings
+ * referencing them.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+type (
+	// `TMediaFile` describes a single file of the media library.
+	TMediaFile struct {
+		Kind     string    // `attachment`, `screenshot`, or `upload`
+		Layout   bool      // whether the page templates use the file
+		ModTime  time.Time // last modification (i.e. upload) time
+		Name     string    // URL path of the file
+		Path     string    // path/file name in the local filesystem
+		Postings []uint64  // IDs of the postings referencing the file
+		Size     int64     // file size in bytes
+	}
+
+	// `TMediaList` is a list of media files sorted by their URL path.
+	TMediaList []TMediaFile
+)
+
+// --------------------------------------------------------------------------
+// TMediaFile methods
+
+// `Date()` returns the file's modification time as a string.
+//
+// Returns:
+//   - `string`: The file's date/time formatted as `YYYY-MM-DD hh:mm`.
+func (mf TMediaFile) Date() string {
+	return mf.ModTime.Format(`2006-01-02 15:04`)
+} // Date()
+
+// `IsImage()` reports whether the file can be shown as a thumbnail.
+//
+// Returns:
+//   - `bool`: `true` if the file is an image, `false` otherwise.
+func (mf TMediaFile) IsImage() bool {
+	switch strings.ToLower(path.Ext(mf.Name)) {
+	case `.gif`, `.jpeg`, `.jpg`, `.png`, `.svg`, `.webp`:
+		return true
+	}
+
+	return false
+} // IsImage()
+
+// `IsOrphan()` reports whether neither a posting nor the page
+// templates reference the file.
+//
+// Returns:
+//   - `bool`: `true` if the file is unreferenced, `false` otherwise.
+func (mf TMediaFile) IsOrphan() bool {
+	return (0 == len(mf.Postings)) && !mf.Layout
+} // IsOrphan()
+
+// `NeedsConfirm()` reports whether the file may only be removed
+// after the user confirmed it.
+//
+// The `img/` directory holds the site's own images as well as the
+// page screenshots, so its files are never removed automatically.
+//
+// Returns:
+//   - `bool`: `true` if the file is in the `img/` directory.
+func (mf TMediaFile) NeedsConfirm() bool {
+	return strings.HasPrefix(mf.Name, `/img/`)
+} // NeedsConfirm()
+
+// `PostingIDs()` returns the string representation of the IDs of
+// all postings referencing the file.
+//
+// Returns:
+//   - `[]string`: The list of posting IDs.
+func (mf TMediaFile) PostingIDs() []string {
+	result := make([]string, 0, len(mf.Postings))
+	for _, id := range mf.Postings {
+		result = append(result, id2str(id))
+	}
+
+	return result
+} // PostingIDs()
+
+// `SizeStr()` returns the file size in a human readable form.
+//
+// Returns:
+//   - `string`: The file size (e.g. `1.5 MB`).
+func (mf TMediaFile) SizeStr() string {
+	const unit = 1024
+	if unit > mf.Size {
+		return fmt.Sprintf("%d B", mf.Size)
+	}
+	div, exp := int64(unit), 0
+	for n := mf.Size / unit; unit <= n; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(mf.Size)/float64(div), "KMGTPE"[exp])
+} // SizeStr()
+
+// --------------------------------------------------------------------------
+// TMediaList methods
+
+// `Automatic()` returns the files which may be removed without
+// confirmation.
+//
+// Returns:
+//   - `TMediaList`: The list of files outside the `img/` directory.
+func (ml TMediaList) Automatic() TMediaList {
+	result := TMediaList{}
+	for _, mf := range ml {
+		if !mf.NeedsConfirm() {
+			result = append(result, mf)
+		}
+	}
+
+	return result
+} // Automatic()
+
+// `NeedConfirm()` returns the files which may only be removed after
+// the user confirmed it.
+//
+// Returns:
+//   - `TMediaList`: The list of files in the `img/` directory.
+func (ml TMediaList) NeedConfirm() TMediaList {
+	result := TMediaList{}
+	for _, mf := range ml {
+		if mf.NeedsConfirm() {
+			result = append(result, mf)
+		}
+	}
+
+	return result
+} // NeedConfirm()
+
+// `Orphans()` returns the unreferenced files of the list.
+//
+// Returns:
+//   - `TMediaList`: The list of files no posting refers to.
+func (ml TMediaList) Orphans() TMediaList {
+	result := TMediaList{}
+	for _, mf := range ml {
+		if mf.IsOrphan() {
+			result = append(result, mf)
+		}
+	}
+
+	return result
+} // Orphans()
+
+// `Size()` returns the accumulated size of all listed files.
+//
+// Returns:
+//   - `int64`: The total number of bytes.
+func (ml TMediaList) Size() (rSize int64) {
+	for _, mf := range ml {
+		rSize += mf.Size
+	}
+
+	return
+} // Size()
+
+// --------------------------------------------------------------------------
+// public functions:
+
+// `CleanMedia()` removes all files of the media library which are
+// referenced neither by any posting nor by the page templates.
+//
+// Files in the `img/` directory are only removed if listed in
+// `aConfirmed` (see `TMediaFile.NeedsConfirm()`).
+// Empty attachment directories are removed as well.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aDryRun`: If `true` nothing gets deleted but only reported.
+//   - `aConfirmed`: The URL paths of the `img/` files to remove.
+//
+// Returns:
+//   - `TMediaList`: The list of (to be) removed files.
+//   - `error`: The aggregated I/O errors, or `nil` on success.
+func CleanMedia(aCtx context.Context, aDryRun bool, aConfirmed []string) (TMediaList, error) {
+	ml, err := MediaLibrary(aCtx)
+	if nil != err {
+		return nil, err
+	}
+	orphans := ml.Orphans()
+	if aDryRun {
+		return orphans, nil
+	}
+
+	removed := TMediaList{}
+	for _, mf := range orphans {
+		if mf.NeedsConfirm() && !slices.Contains(aConfirmed, mf.Name) {
+			continue
+		}
+		if rErr := os.Remove(mf.Path); nil != rErr {
+			err = errors.Join(err, se.Wrap(rErr, 1))
+			continue
+		}
+		removed = append(removed, mf)
+		if `attachment` == mf.Kind {
+			// fails silently unless the directory is empty:
+			_ = os.Remove(filepath.Dir(mf.Path))
+		}
+	}
+
+	return removed, err
+} // CleanMedia()
+
+// `MediaLibrary()` returns a list of all files in the `attachments`,
+// `img`, and `static` directories along with the postings referencing
+// them (see `References()`).
+//
+// If any posting can't be read an error is returned, so the files
+// referenced by that posting won't be taken for orphans.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `TMediaList`: The list of files sorted by their URL path.
+//   - `error`: A possible error, or `nil` on success.
+func MediaLibrary(aCtx context.Context) (TMediaList, error) {
+	files := make(map[string]*TMediaFile)
+
+	for _, dir := range []string{`img`, `static`} {
+		if err := mlScanDir(files, dir, `upload`); nil != err {
+			return nil, err
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(AppArgs.DataDir, atDirName))
+	if (nil != err) && !errors.Is(err, os.ErrNotExist) {
+		return nil, se.Wrap(err, 2)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err = mlScanDir(files, path.Join(atDirName, entry.Name()), `attachment`); nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	var mtx sync.Mutex
+	wf := func(aID uint64) error {
+		post := NewPosting(aID, "")
+		if err := post.LoadContext(aCtx); nil != err {
+			return err // an unknown posting might refer to any file
+		}
+		if 0 == post.Len() {
+			return nil // no contents, no references
+		}
+
+		shots := make(map[string]bool)
+		for _, pair := range checkScreenshotURLs(post.markdown) {
+			shots[pair.imgURL] = true
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, ref := range atReferences(post.markdown) {
+			for _, mf := range mlFiles(files, ref) {
+				if (0 == len(mf.Postings)) || (aID != mf.Postings[len(mf.Postings)-1]) {
+					mf.Postings = append(mf.Postings, aID)
+				}
+				if (`upload` == mf.Kind) && shots[path.Base(mf.Name)] {
+					mf.Kind = `screenshot`
+				}
+			}
+		}
+
+		return nil
+	} // wf()
+
+	if err = WalkParallel(aCtx, 0, wf, nil); nil != err {
+		return nil, err
+	}
+	for _, ref := range atLayoutReferences() {
+		for _, mf := range mlFiles(files, ref) {
+			mf.Layout = true
+		}
+	}
+
+	result := make(TMediaList, 0, len(files))
+	for _, mf := range files {
+		sort.Slice(mf.Postings, func(i, j int) bool {
+			return mf.Postings[i] > mf.Postings[j] // newest first
+		})
+		mf.Postings = slices.Compact(mf.Postings)
+		result = append(result, *mf)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+} // MediaLibrary()
+
+// --------------------------------------------------------------------------
+// internal functions:
+
+// `mlFiles()` returns the files referenced by `aRef`.
+//
+// Parameters:
+//   - `aFiles`: The map of files (with the URL path as key).
+//   - `aRef`: The reference (a file or directory) as returned by `atReferences()`.
+//
+// Returns:
+//   - `[]*TMediaFile`: The referenced files.
+func mlFiles(aFiles map[string]*TMediaFile, aRef string) []*TMediaFile {
+	if mf, ok := aFiles[`/`+aRef]; ok {
+		return []*TMediaFile{mf}
+	}
+
+	// a directory (e.g. of a `gallery` shortcode):
+	var result []*TMediaFile
+	prefix := `/` + aRef + `/`
+	for name, mf := range aFiles {
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, mf)
+		}
+	}
+
+	return result
+} // mlFiles()
+
+// `mlScanDir()` adds all regular files in `aDir` to `aFiles`.
+//
+// Parameters:
+//   - `aFiles`: The map of files to update (with the URL path as key).
+//   - `aDir`: The directory (relative to `AppArgs.DataDir`) to scan.
+//   - `aKind`: The kind of files in `aDir`.
+//
+// Returns:
+//   - `error`: A possible I/O error, or `nil` on success.
+func mlScanDir(aFiles map[string]*TMediaFile, aDir, aKind string) error {
+	dir := filepath.Join(AppArgs.DataDir, filepath.FromSlash(aDir))
+	entries, err := os.ReadDir(dir)
+	if nil != err {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return se.Wrap(err, 2)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		fi, err := entry.Info()
+		if nil != err {
+			continue // the file might have been removed meanwhile
+		}
+		name := `/` + path.Join(aDir, entry.Name())
+		aFiles[name] = &TMediaFile{
+			Kind:    aKind,
+			ModTime: fi.ModTime(),
+			Name:    name,
+			Path:    filepath.Join(dir, entry.Name()),
+			Size:    fi.Size(),
+		}
+	}
+
+	return nil
+} // mlScanDir()
+
+/* _EoF_ */
@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+func TestMediaLibrary(t *testing.T) {
+	prepAttachmentTest(t)
+
+	dataDir := AppArgs.DataDir
+	id1 := time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local))
+	id2 := time2id(time.Date(2024, 4, 2, 12, 0, 0, 0, time.Local))
+	writeTestFile(t, filepath.Join(dataDir, "img", "used.png"), "png")
+	writeTestFile(t, filepath.Join(dataDir, "img", "shot.png"), "screenshot")
+	writeTestFile(t, filepath.Join(dataDir, "img", "unused.jpg"), "jpg")
+	writeTestFile(t, filepath.Join(dataDir, "static", "doc.pdf"), "pdf")
+	writeTestFile(t, filepath.Join(dataDir, "img", "favicon.ico"), "ico")
+	writeTestFile(t, filepath.Join(dataDir, "img", "html.png"), "png")
+	writeTestFile(t, filepath.Join(dataDir, "img", "titled.png"), "png")
+	writeTestFile(t, filepath.Join(dataDir, "static", "fig.jpg"), "jpg")
+	writeTestFile(t, filepath.Join(AttachmentDir(id2), "att.txt"), "text")
+	writeTestFile(t, filepath.Join(AttachmentDir(id2), "lost.txt"), "text")
+
+	texts := map[uint64]string{
+		id1: "![used](/img/used.png) [doc](/static/doc.pdf) [gone](/static/gone.pdf)\n\n<img src=\"/img/html.png\" alt=\"\"> ![t](/img/titled.png \"A title\")\n\n{{< figure src=\"/static/fig.jpg\" >}}",
+		id2: "![used](/img/used.png) [att](" + AttachmentURL(id2, "att.txt") + ")\n\n[![shot](/img/shot.png)](https://example.com/)",
+	}
+	for id, txt := range texts {
+		if _, err := NewPosting(id, txt).Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	ml, err := MediaLibrary(context.Background())
+	if nil != err {
+		t.Fatalf("MediaLibrary() error = %v", err)
+	}
+	wants := map[string]struct {
+		kind string
+		refs int
+	}{
+		"/img/used.png":                {"upload", 2},
+		"/img/shot.png":                {"screenshot", 1},
+		"/img/unused.jpg":              {"upload", 0},
+		"/static/doc.pdf":              {"upload", 1},
+		"/img/favicon.ico":             {"upload", 0},
+		"/img/html.png":                {"upload", 1},
+		"/img/titled.png":              {"upload", 1},
+		"/static/fig.jpg":              {"upload", 1},
+		AttachmentURL(id2, "att.txt"):  {"attachment", 1},
+		AttachmentURL(id2, "lost.txt"): {"attachment", 0},
+	}
+	if len(wants) != len(ml) {
+		t.Fatalf("MediaLibrary() = %d files, want %d", len(ml), len(wants))
+	}
+	for _, mf := range ml {
+		want, ok := wants[mf.Name]
+		if !ok {
+			t.Errorf("MediaLibrary(): unexpected file %q", mf.Name)
+			continue
+		}
+		if (want.kind != mf.Kind) || (want.refs != len(mf.Postings)) {
+			t.Errorf("MediaLibrary(%q) = %s/%d, want %s/%d",
+				mf.Name, mf.Kind, len(mf.Postings), want.kind, want.refs)
+		}
+	}
+	// used by the page templates:
+	for _, mf := range ml {
+		if ("/img/favicon.ico" == mf.Name) && (!mf.Layout || mf.IsOrphan()) {
+			t.Errorf("MediaLibrary(%q): Layout = %v, want true", mf.Name, mf.Layout)
+		}
+	}
+	if got := len(ml.Orphans()); 2 != got {
+		t.Errorf("TMediaList.Orphans() = %d, want 2", got)
+	}
+
+	removed, err := CleanMedia(context.Background(), true, nil)
+	if (nil != err) || (2 != len(removed)) || (1 != len(removed.NeedConfirm())) {
+		t.Errorf("CleanMedia(dryRun) = %d, %v", len(removed), err)
+	}
+	if _, err = os.Stat(filepath.Join(dataDir, "img", "unused.jpg")); nil != err {
+		t.Errorf("CleanMedia(dryRun) removed a file: %v", err)
+	}
+
+	// files in `img/` need to be confirmed:
+	if removed, err = CleanMedia(context.Background(), false, nil); (nil != err) || (1 != len(removed)) {
+		t.Errorf("CleanMedia() = %d, %v", len(removed), err)
+	}
+	if _, err = os.Stat(filepath.Join(dataDir, "img", "unused.jpg")); nil != err {
+		t.Errorf("CleanMedia() removed an unconfirmed file: %v", err)
+	}
+	if removed, err = CleanMedia(context.Background(), false, []string{"/img/unused.jpg", "/img/favicon.ico"}); (nil != err) || (1 != len(removed)) {
+		t.Errorf("CleanMedia(confirmed) = %d, %v", len(removed), err)
+	}
+	if ml, _ = MediaLibrary(context.Background()); 8 != len(ml) {
+		t.Errorf("MediaLibrary() after CleanMedia() = %d files, want 8", len(ml))
+	}
+} // TestMediaLibrary()
+
+func TestCleanMedia_unreadable(t *testing.T) {
+	prepAttachmentTest(t)
+
+	dataDir := AppArgs.DataDir
+	id1 := time2id(time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local))
+	id2 := time2id(time.Date(2024, 4, 2, 12, 0, 0, 0, time.Local))
+	writeTestFile(t, filepath.Join(dataDir, "static", "doc.pdf"), "pdf")
+	writeTestFile(t, filepath.Join(AttachmentDir(id2), "att.txt"), "text")
+	texts := map[uint64]string{
+		id1: "Some text",
+		id2: "[doc](/static/doc.pdf) [att](" + AttachmentURL(id2, "att.txt") + ")",
+	}
+	for id, txt := range texts {
+		if _, err := NewPosting(id, txt).Store(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	setFailingStore(t, id2, 0)
+
+	if _, err := MediaLibrary(context.Background()); nil == err {
+		t.Error("MediaLibrary(): expected an error")
+	}
+	if removed, err := CleanMedia(context.Background(), false, nil); (nil == err) || (0 != len(removed)) {
+		t.Errorf("CleanMedia() = %d, %v, want an error", len(removed), err)
+	}
+	for _, name := range []string{
+		filepath.Join(dataDir, "static", "doc.pdf"),
+		filepath.Join(AttachmentDir(id2), "att.txt"),
+	} {
+		if _, err := os.Stat(name); nil != err {
+			t.Errorf("CleanMedia() removed a referenced file: %v", err)
+		}
+	}
+} // TestCleanMedia_unreadable()
+
+func TestTMediaFile_SizeStr(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		want string
+	}{
+		{" 1", 0, "0 B"},
+		{" 2", 1023, "1023 B"},
+		{" 3", 1536, "1.5 KB"},
+		{" 4", 3 << 20, "3.0 MB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (TMediaFile{Size: tt.size}).SizeStr(); got != tt.want {
+				t.Errorf("TMediaFile.SizeStr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // TestTMediaFile_SizeStr()
+
+/* _EoF_ */
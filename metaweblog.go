@@ -0,0 +1,887 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides an XML-RPC endpoint implementing the MetaWeblog
+ * (and the parts of the Blogger) API used by desktop blogging clients:
+ *
+ *	blogger.getUsersBlogs      the (single) blog's ID, name, and URL
+ *	metaWeblog.newPost         create a posting
+ *	metaWeblog.editPost        change a posting
+ *	metaWeblog.getPost         get a posting
+ *	metaWeblog.getRecentPosts  get the newest postings
+ *	metaWeblog.deletePost      remove a posting (as `blogger.deletePost`)
+ *	metaWeblog.newMediaObject  upload a file
+ *
+ * The calls are authenticated by the username/password sent along
+ * with every call which must match one of the `passlist` users.
+ * Failed logins are logged, and a client failing too often gets
+ * locked out for a while.
+ *
+ * see: https://xmlrpc.com/spec.md
+ * and: https://xmlrpc.com/metaWeblogApi.html
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	ht "github.com/mwat56/hashtags"
+	"github.com/mwat56/uploadhandler"
+)
+
+const (
+	// `xrBlogID` is the ID of the (single) blog.
+	xrBlogID = `1`
+
+	// `xrLockout` is how long a client is locked out after too many
+	// failed logins.
+	xrLockout = 15 * time.Minute
+
+	// `xrMaxClients` is the max. number of clients with failed logins
+	// to remember.
+	xrMaxClients = 1024
+
+	// `xrMaxFailures` is the number of failed logins locking out
+	// a client.
+	xrMaxFailures = 5
+
+	// `xrMaxBody` is the max. size of a call without a media object.
+	xrMaxBody = 1 << 20
+
+	// `xrPath` is the URL path of the XML-RPC endpoint.
+	xrPath = `/xmlrpc`
+
+	// `xrTimeFormat` is the layout of `dateTime.iso8601` values.
+	xrTimeFormat = `20060102T15:04:05`
+)
+
+// Fault codes sent to the client.
+const (
+	xrFaultParse    = -32700
+	xrFaultMethod   = -32601
+	xrFaultParams   = -32602
+	xrFaultAuth     = 403
+	xrFaultNotFound = 404
+	xrFaultExists   = 409
+	xrFaultLocked   = 429
+	xrFaultInternal = 500
+)
+
+type (
+	// `tXRusers` is the part of `passlist.TPassList` used to
+	// authenticate the XML-RPC calls.
+	tXRusers interface {
+		Matches(aUser, aPassword string) bool
+	}
+
+	// `tXRlogins` keeps track of the clients' failed logins.
+	//
+	// The zero value is ready to use.
+	tXRlogins struct {
+		clients map[string]tXRfailures
+		mtx     sync.Mutex
+	}
+
+	// `tXRfailures` are a client's failed logins.
+	tXRfailures struct {
+		count int       // number of failed logins
+		last  time.Time // time of the latest failed login
+	}
+
+	// `tXRfault` is an error reported to the client as XML-RPC fault.
+	tXRfault struct {
+		Code    int
+		Message string
+	}
+
+	// `tXRcall` is a decoded XML-RPC method call.
+	tXRcall struct {
+		XMLName xml.Name   `xml:"methodCall"`
+		Method  string     `xml:"methodName"`
+		Params  []tXRvalue `xml:"params>param>value"`
+	}
+
+	// `tXRvalue` is a single (possibly nested) XML-RPC value.
+	tXRvalue struct {
+		Array    *tXRarray  `xml:"array"`
+		Base64   *string    `xml:"base64"`
+		Boolean  *string    `xml:"boolean"`
+		DateTime *string    `xml:"dateTime.iso8601"`
+		Double   *string    `xml:"double"`
+		I4       *string    `xml:"i4"`
+		Int      *string    `xml:"int"`
+		String   *string    `xml:"string"`
+		Struct   *tXRstruct `xml:"struct"`
+		Text     string     `xml:",chardata"`
+	}
+
+	tXRarray struct {
+		Data []tXRvalue `xml:"data>value"`
+	}
+
+	tXRmember struct {
+		Name  string   `xml:"name"`
+		Value tXRvalue `xml:"value"`
+	}
+
+	tXRstruct struct {
+		Members []tXRmember `xml:"member"`
+	}
+
+	// `tXRparams` are the decoded parameters of a method call.
+	tXRparams []any
+)
+
+// Error returns the fault's message,
+// implementing the `error` interface.
+func (xf *tXRfault) Error() string {
+	return fmt.Sprintf("fault %d: %s", xf.Code, xf.Message)
+} // Error()
+
+// `xrError()` returns a new fault with `aCode` and `aMessage`.
+func xrError(aCode int, aMessage string) error {
+	return &tXRfault{Code: aCode, Message: aMessage}
+} // xrError()
+
+// --------------------------------------------------------------------------
+// tXRlogins methods
+
+// `fail()` records a failed login of `aClient`.
+//
+// Parameters:
+//   - `aClient`: The remote client's address.
+//
+// Returns:
+//   - `bool`: Whether `aClient` is locked out now.
+func (xl *tXRlogins) fail(aClient string) bool {
+	xl.mtx.Lock()
+	defer xl.mtx.Unlock()
+
+	now := time.Now()
+	if nil == xl.clients {
+		xl.clients = make(map[string]tXRfailures)
+	}
+	entry, ok := xl.clients[aClient]
+	if !ok && (xrMaxClients <= len(xl.clients)) {
+		xl.prune(now)
+	}
+	if xrLockout < now.Sub(entry.last) {
+		entry.count = 0 // earlier failures expired
+	}
+	entry.count++
+	entry.last = now
+	xl.clients[aClient] = entry
+
+	return xrMaxFailures <= entry.count
+} // fail()
+
+// `locked()` reports whether `aClient` failed to login too often.
+//
+// Parameters:
+//   - `aClient`: The remote client's address.
+//
+// Returns:
+//   - `bool`: Whether `aClient` is locked out.
+func (xl *tXRlogins) locked(aClient string) bool {
+	xl.mtx.Lock()
+	defer xl.mtx.Unlock()
+
+	entry, ok := xl.clients[aClient]
+
+	return ok && (xrMaxFailures <= entry.count) &&
+		(xrLockout >= time.Since(entry.last))
+} // locked()
+
+// `prune()` removes the expired clients and, if there are still too
+// many, the one with the oldest failure.
+//
+// The caller must hold the lock.
+func (xl *tXRlogins) prune(aNow time.Time) {
+	var (
+		oldest string
+		since  time.Time
+	)
+	for client, entry := range xl.clients {
+		if xrLockout < aNow.Sub(entry.last) {
+			delete(xl.clients, client)
+		} else if (0 == len(oldest)) || entry.last.Before(since) {
+			oldest, since = client, entry.last
+		}
+	}
+	if xrMaxClients <= len(xl.clients) {
+		delete(xl.clients, oldest)
+	}
+} // prune()
+
+// `reset()` forgets the failed logins of `aClient`.
+//
+// Parameters:
+//   - `aClient`: The remote client's address.
+func (xl *tXRlogins) reset(aClient string) {
+	xl.mtx.Lock()
+	defer xl.mtx.Unlock()
+
+	delete(xl.clients, aClient)
+} // reset()
+
+// --------------------------------------------------------------------------
+// tXRparams methods
+
+// `integer()` returns the parameter at `aIndex` as an integer.
+func (xp tXRparams) integer(aIndex int) int {
+	if aIndex < len(xp) {
+		switch val := xp[aIndex].(type) {
+		case int:
+			return val
+		case string:
+			i, _ := strconv.Atoi(strings.TrimSpace(val))
+			return i
+		}
+	}
+
+	return 0
+} // integer()
+
+// `str()` returns the parameter at `aIndex` as a string.
+func (xp tXRparams) str(aIndex int) string {
+	if aIndex < len(xp) {
+		switch val := xp[aIndex].(type) {
+		case string:
+			return val
+		case int:
+			return strconv.Itoa(val)
+		}
+	}
+
+	return ""
+} // str()
+
+// `structure()` returns the parameter at `aIndex` as a struct.
+func (xp tXRparams) structure(aIndex int) map[string]any {
+	if aIndex < len(xp) {
+		if m, ok := xp[aIndex].(map[string]any); ok {
+			return m
+		}
+	}
+
+	return map[string]any{}
+} // structure()
+
+// --------------------------------------------------------------------------
+// tXRvalue methods
+
+// `decode()` returns the Go representation of the XML-RPC value.
+//
+// Returns:
+//   - `any`: One of `[]any`, `[]byte`, `bool`, `float64`, `int`,
+//     `map[string]any`, `string`, or `time.Time`.
+//   - `error`: A possible decoding error.
+func (xv *tXRvalue) decode() (any, error) {
+	switch {
+	case nil != xv.Array:
+		result := make([]any, 0, len(xv.Array.Data))
+		for idx := range xv.Array.Data {
+			val, err := xv.Array.Data[idx].decode()
+			if nil != err {
+				return nil, err
+			}
+			result = append(result, val)
+		}
+		return result, nil
+
+	case nil != xv.Base64:
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(*xv.Base64), ``))
+
+	case nil != xv.Boolean:
+		return `1` == strings.TrimSpace(*xv.Boolean), nil
+
+	case nil != xv.DateTime:
+		return xrTime(*xv.DateTime)
+
+	case nil != xv.Double:
+		return strconv.ParseFloat(strings.TrimSpace(*xv.Double), 64)
+
+	case nil != xv.I4:
+		return strconv.Atoi(strings.TrimSpace(*xv.I4))
+
+	case nil != xv.Int:
+		return strconv.Atoi(strings.TrimSpace(*xv.Int))
+
+	case nil != xv.String:
+		return *xv.String, nil
+
+	case nil != xv.Struct:
+		result := make(map[string]any, len(xv.Struct.Members))
+		for idx := range xv.Struct.Members {
+			val, err := xv.Struct.Members[idx].Value.decode()
+			if nil != err {
+				return nil, err
+			}
+			result[xv.Struct.Members[idx].Name] = val
+		}
+		return result, nil
+	}
+
+	return xv.Text, nil // no type means string
+} // decode()
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `xrClient()` returns the address of the remote client sending
+// `aRequest` (without the port).
+func xrClient(aRequest *http.Request) string {
+	if host, _, err := net.SplitHostPort(aRequest.RemoteAddr); nil == err {
+		return host
+	}
+
+	return aRequest.RemoteAddr
+} // xrClient()
+
+// `xrDecode()` reads the XML-RPC method call sent with `aRequest`.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `string`: The name of the called method.
+//   - `tXRparams`: The call's parameters.
+//   - `error`: A possible decoding error.
+func xrDecode(aWriter http.ResponseWriter, aRequest *http.Request) (string, tXRparams, error) {
+	maxSize := int64(xrMaxBody)
+	if maxSize < AppArgs.MaxFileSize {
+		// base64 encoded media objects need a third more space
+		maxSize = AppArgs.MaxFileSize/3*4 + xrMaxBody
+	}
+	var call tXRcall
+	dec := xml.NewDecoder(http.MaxBytesReader(aWriter, aRequest.Body, maxSize))
+	dec.CharsetReader = func(aCharset string, aInput io.Reader) (io.Reader, error) {
+		if strings.EqualFold(`utf-8`, aCharset) || strings.EqualFold(`us-ascii`, aCharset) {
+			return aInput, nil
+		}
+		return nil, errors.New(`unsupported charset ` + aCharset)
+	}
+	if err := dec.Decode(&call); nil != err {
+		return "", nil, err
+	}
+
+	params := make(tXRparams, 0, len(call.Params))
+	for idx := range call.Params {
+		val, err := call.Params[idx].decode()
+		if nil != err {
+			return "", nil, err
+		}
+		params = append(params, val)
+	}
+
+	return strings.TrimSpace(call.Method), params, nil
+} // xrDecode()
+
+// `xrEncode()` writes the XML-RPC representation of `aValue`
+// to `aBuffer`.
+//
+// Parameters:
+//   - `aBuffer`: The buffer to write to.
+//   - `aValue`: The value to encode.
+func xrEncode(aBuffer *bytes.Buffer, aValue any) {
+	aBuffer.WriteString(`<value>`)
+	switch val := aValue.(type) {
+	case bool:
+		if val {
+			aBuffer.WriteString(`<boolean>1</boolean>`)
+		} else {
+			aBuffer.WriteString(`<boolean>0</boolean>`)
+		}
+
+	case []byte:
+		aBuffer.WriteString(`<base64>` + base64.StdEncoding.EncodeToString(val) + `</base64>`)
+
+	case float64:
+		aBuffer.WriteString(`<double>` + strconv.FormatFloat(val, 'f', -1, 64) + `</double>`)
+
+	case int:
+		aBuffer.WriteString(`<int>` + strconv.Itoa(val) + `</int>`)
+
+	case string:
+		aBuffer.WriteString(`<string>`)
+		_ = xml.EscapeText(aBuffer, []byte(val))
+		aBuffer.WriteString(`</string>`)
+
+	case time.Time:
+		aBuffer.WriteString(`<dateTime.iso8601>` + val.Format(xrTimeFormat) + `</dateTime.iso8601>`)
+
+	case []any:
+		aBuffer.WriteString(`<array><data>`)
+		for _, item := range val {
+			xrEncode(aBuffer, item)
+		}
+		aBuffer.WriteString(`</data></array>`)
+
+	case []string:
+		aBuffer.WriteString(`<array><data>`)
+		for _, item := range val {
+			xrEncode(aBuffer, item)
+		}
+		aBuffer.WriteString(`</data></array>`)
+
+	case map[string]any:
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		aBuffer.WriteString(`<struct>`)
+		for _, name := range names {
+			aBuffer.WriteString(`<member><name>`)
+			_ = xml.EscapeText(aBuffer, []byte(name))
+			aBuffer.WriteString(`</name>`)
+			xrEncode(aBuffer, val[name])
+			aBuffer.WriteString(`</member>`)
+		}
+		aBuffer.WriteString(`</struct>`)
+
+	default:
+		aBuffer.WriteString(`<string></string>`)
+	}
+	aBuffer.WriteString(`</value>`)
+} // xrEncode()
+
+// `xrMarkdown()` returns the Markdown text of a MetaWeblog post struct.
+//
+// The `title` becomes the posting's heading while the `categories`
+// and `mt_keywords` not already used by the text are appended as
+// #hashtags (or @mentions).
+//
+// Parameters:
+//   - `aContent`: The post struct sent by the client.
+//   - `aBaseURL`: The blog's public scheme and host.
+//
+// Returns:
+//   - `string`: The posting's Markdown text.
+func xrMarkdown(aContent map[string]any, aBaseURL string) string {
+	str := func(aName string) string {
+		s, _ := aContent[aName].(string)
+		return strings.TrimSpace(string(replCRLF([]byte(s))))
+	}
+
+	var parts []string
+	if title := str(`title`); 0 < len(title) {
+		parts = append(parts, `# `+title)
+	}
+	text := str(`description`)
+	if more := str(`mt_text_more`); 0 < len(more) {
+		text = strings.TrimSpace(text + "\n\n" + more)
+	}
+	if 0 < len(text) {
+		// links to uploaded media objects are stored relative
+		text = strings.ReplaceAll(text, aBaseURL+`/`+atDirName+`/`, `/`+atDirName+`/`)
+		parts = append(parts, text)
+	}
+
+	categories, _ := aContent[`categories`].([]any)
+	if keywords := str(`mt_keywords`); 0 < len(keywords) {
+		for _, kw := range strings.Split(keywords, `,`) {
+			categories = append(categories, kw)
+		}
+	}
+	var tags []any
+	for _, cat := range categories {
+		tag := mpCategory(mpString(cat))
+		if (0 == len(tag)) || xrHasTag(text, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	if line := mpTags(tags); 0 < len(line) {
+		parts = append(parts, line)
+	}
+
+	return strings.Join(parts, "\n\n")
+} // xrMarkdown()
+
+// `xrHasTag()` reports whether `aText` already uses `aTag`.
+func xrHasTag(aText, aTag string) bool {
+	re, err := regexp.Compile(`(?i)(^|\s)` + regexp.QuoteMeta(aTag) + `\b`)
+	if nil != err {
+		return false
+	}
+
+	return re.MatchString(aText)
+} // xrHasTag()
+
+// `xrReply()` sends `aResult` (or the fault `aErr`) as XML-RPC
+// method response.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aResult`: The method's result.
+//   - `aErr`: A possible error to send instead of `aResult`.
+func xrReply(aWriter http.ResponseWriter, aResult any, aErr error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header + `<methodResponse>`)
+	if nil != aErr {
+		var fault *tXRfault
+		if !errors.As(aErr, &fault) {
+			fault = &tXRfault{Code: xrFaultInternal, Message: aErr.Error()}
+		}
+		buf.WriteString(`<fault>`)
+		xrEncode(&buf, map[string]any{
+			`faultCode`:   fault.Code,
+			`faultString`: fault.Message,
+		})
+		buf.WriteString(`</fault>`)
+	} else {
+		buf.WriteString(`<params><param>`)
+		xrEncode(&buf, aResult)
+		buf.WriteString(`</param></params>`)
+	}
+	buf.WriteString("</methodResponse>\n")
+
+	// XML-RPC reports faults with a `200 OK` status as well:
+	aWriter.Header().Set(`Content-Type`, `text/xml; charset=utf-8`)
+	aWriter.Header().Set(`Content-Length`, strconv.Itoa(buf.Len()))
+	if _, err := aWriter.Write(buf.Bytes()); nil != err {
+		apachelogger.Err("xrReply()",
+			fmt.Sprintf("Writer.Write(): %v", err))
+	}
+} // xrReply()
+
+// `xrTime()` parses the `dateTime.iso8601` value `aTime`.
+//
+// The XML-RPC spec doesn't define a time zone, so values without
+// one are taken as local time.
+func xrTime(aTime string) (time.Time, error) {
+	aTime = strings.TrimSpace(aTime)
+	for _, layout := range []string{time.RFC3339, `20060102T15:04:05Z07:00`, `2006-01-02T15:04:05Z07:00`} {
+		if t, err := time.Parse(layout, aTime); nil == err {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{xrTimeFormat, `2006-01-02T15:04:05`, `20060102T150405`} {
+		if t, err := time.ParseInLocation(layout, aTime, time.Local); nil == err {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New(`invalid dateTime.iso8601 value: ` + aTime)
+} // xrTime()
+
+// --------------------------------------------------------------------------
+// TPageHandler methods
+
+// `handleXMLRPC()` serves the XML-RPC requests.
+//
+// Every failed login is logged; after `xrMaxFailures` of them the
+// client's calls are rejected for `xrLockout` without checking the
+// credentials.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aUsers`: The list of users allowed to call the methods.
+func (ph *TPageHandler) handleXMLRPC(aWriter http.ResponseWriter, aRequest *http.Request, aUsers tXRusers) {
+	if http.MethodPost != aRequest.Method {
+		aWriter.Header().Set(`Allow`, http.MethodPost)
+		http.Error(aWriter, `XML-RPC server accepts POST requests only.`,
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	method, params, err := xrDecode(aWriter, aRequest)
+	if nil != err {
+		xrReply(aWriter, nil, xrError(xrFaultParse, `parse error: `+err.Error()))
+		return
+	}
+
+	// The index of the username parameter:
+	uIdx := 1
+	switch method {
+	case `blogger.deletePost`, `metaWeblog.deletePost`:
+		uIdx = 2 // appkey, postid, username, password
+	}
+	client := xrClient(aRequest)
+	if ph.xrLogins.locked(client) {
+		xrReply(aWriter, nil, xrError(xrFaultLocked, `too many failed logins, try again later`))
+		return
+	}
+	if (nil == aUsers) || !aUsers.Matches(params.str(uIdx), params.str(uIdx+1)) {
+		msg := fmt.Sprintf("failed login of %q from %s", params.str(uIdx), client)
+		if ph.xrLogins.fail(client) {
+			msg += fmt.Sprintf(" (locked out for %v)", xrLockout)
+		}
+		apachelogger.Err("TPageHandler.handleXMLRPC()", msg)
+		xrReply(aWriter, nil, xrError(xrFaultAuth, `invalid username or password`))
+		return
+	}
+	ph.xrLogins.reset(client)
+
+	var result any
+	base := publicBaseURL(aRequest)
+	switch method {
+	case `blogger.getUsersBlogs`, `metaWeblog.getUsersBlogs`:
+		result = []any{map[string]any{
+			`blogid`:   xrBlogID,
+			`blogName`: AppArgs.BlogName,
+			`url`:      base + `/`,
+			`xmlrpc`:   base + xrPath,
+			`isAdmin`:  true,
+		}}
+
+	case `blogger.deletePost`, `metaWeblog.deletePost`:
+		result, err = ph.xrDeletePost(aRequest, params.str(1))
+
+	case `metaWeblog.editPost`:
+		result, err = ph.xrEditPost(aRequest, params.str(0), params.structure(3), base)
+
+	case `metaWeblog.getCategories`:
+		result = ph.xrCategories(base)
+
+	case `metaWeblog.getPost`:
+		result, err = ph.xrGetPost(aRequest, params.str(0), base)
+
+	case `metaWeblog.getRecentPosts`:
+		result, err = ph.xrRecentPosts(aRequest, params.integer(3), base)
+
+	case `metaWeblog.newMediaObject`:
+		result, err = ph.xrNewMediaObject(aWriter, aRequest, params.structure(3), base)
+
+	case `metaWeblog.newPost`:
+		result, err = ph.xrNewPost(aRequest, params.structure(3), base)
+
+	default:
+		err = xrError(xrFaultMethod, `unknown method `+method)
+	}
+
+	xrReply(aWriter, result, err)
+} // handleXMLRPC()
+
+// `xrCategories()` returns the #hashtags as MetaWeblog categories.
+func (ph *TPageHandler) xrCategories(aBaseURL string) []any {
+	list := ph.hashList.List()
+	result := make([]any, 0, len(list))
+	for _, item := range list {
+		if !strings.HasPrefix(item.Tag, string(ht.MarkHash)) {
+			continue
+		}
+		name := strings.TrimPrefix(item.Tag, string(ht.MarkHash))
+		result = append(result, map[string]any{
+			`description`: name,
+			`htmlUrl`:     aBaseURL + `/hl/` + name,
+			`rssUrl`:      aBaseURL + `/hl/` + name + `/feed/rss`,
+			`title`:       name,
+		})
+	}
+
+	return result
+} // xrCategories()
+
+// `xrDeletePost()` removes the posting with `aPostID`.
+func (ph *TPageHandler) xrDeletePost(aRequest *http.Request, aPostID string) (bool, error) {
+	id := str2id(aPostID)
+	if (0 == id) || !poPersistence.ExistsContext(aRequest.Context(), id) {
+		return false, xrError(xrFaultNotFound, `posting not found`)
+	}
+	post := NewPosting(id, "")
+	RemovePageScreenshots(post)
+	if err := post.Delete(); nil != err {
+		apachelogger.Err("TPageHandler.xrDeletePost()",
+			fmt.Sprintf("TPosting.Delete(%s): %v", post.IDstr(), err))
+		return false, err
+	}
+	RemoveIDTags(ph.hashList, id)
+	ph.activityPub.Publish(apDelete, post)
+	ph.webmentions.RemovePost(id)
+
+	return true, nil
+} // xrDeletePost()
+
+// `xrEditPost()` replaces the text of the posting with `aPostID`.
+func (ph *TPageHandler) xrEditPost(aRequest *http.Request, aPostID string, aContent map[string]any, aBaseURL string) (bool, error) {
+	id := str2id(aPostID)
+	post := NewPosting(id, "")
+	if (0 == id) || (nil != post.LoadContext(aRequest.Context())) {
+		return false, xrError(xrFaultNotFound, `posting not found`)
+	}
+	md := xrMarkdown(aContent, aBaseURL)
+	if 0 == len(md) {
+		return false, xrError(xrFaultParams, `missing content`)
+	}
+
+	post.Set([]byte(mpAdopt(md, id)))
+	if _, err := post.StoreContext(aRequest.Context()); nil != err {
+		apachelogger.Err("TPageHandler.xrEditPost()",
+			fmt.Sprintf("TPosting.StoreContext(%s): %v", post.IDstr(), err))
+		return false, err
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	UpdateTags(ph.hashList, post)
+	ph.activityPub.Publish(apUpdate, post)
+	ph.webmentions.Send(post)
+
+	return true, nil
+} // xrEditPost()
+
+// `xrGetPost()` returns the posting with `aPostID`.
+func (ph *TPageHandler) xrGetPost(aRequest *http.Request, aPostID string, aBaseURL string) (map[string]any, error) {
+	id := str2id(aPostID)
+	post := NewPosting(id, "")
+	if (0 == id) || (nil != post.LoadContext(aRequest.Context())) {
+		return nil, xrError(xrFaultNotFound, `posting not found`)
+	}
+
+	return ph.xrPost(post, aBaseURL), nil
+} // xrGetPost()
+
+// `xrNewMediaObject()` stores the uploaded file as attachment.
+//
+// The file is handed to the upload handler just like a file sent by
+// the `/si/` form; it's moved to the posting using it once that
+// posting is stored (see `mpAdopt()`).
+func (ph *TPageHandler) xrNewMediaObject(aWriter http.ResponseWriter, aRequest *http.Request, aFile map[string]any, aBaseURL string) (map[string]any, error) {
+	name, _ := aFile[`name`].(string)
+	bits, _ := aFile[`bits`].([]byte)
+	if name = filepath.Base(strings.TrimSpace(name)); (0 == len(bits)) || (`.` == name) || (`/` == name) {
+		return nil, xrError(xrFaultParams, `missing file name or data`)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile(`file`, name)
+	if nil == err {
+		if _, err = fw.Write(bits); nil == err {
+			err = mw.Close()
+		}
+	}
+	if nil != err {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(aRequest.Context(),
+		http.MethodPost, aRequest.URL.String(), &body)
+	if nil != err {
+		return nil, err
+	}
+	req.Header.Set(`Content-Type`, mw.FormDataContentType())
+
+	id := NewPosting(0, "").ID()
+	dir := AttachmentDir(id)
+	if err = os.MkdirAll(dir, 0775); nil != err {
+		apachelogger.Err("TPageHandler.xrNewMediaObject()",
+			fmt.Sprintf("os.MkdirAll(%s): %v", dir, err))
+		return nil, err
+	}
+	txt, status := uploadhandler.NewHandler(dir, `file`, AppArgs.MaxFileSize).
+		ServeUpload(aWriter, req)
+	if 200 != status {
+		_ = removeAttachments(id)
+		return nil, xrError(status, txt)
+	}
+
+	return map[string]any{
+		`url`: aBaseURL + AttachmentURL(id, filepath.Base(txt)),
+	}, nil
+} // xrNewMediaObject()
+
+// `xrNewPost()` creates a new posting.
+func (ph *TPageHandler) xrNewPost(aRequest *http.Request, aContent map[string]any, aBaseURL string) (string, error) {
+	var id uint64
+	if t, ok := aContent[`dateCreated`].(time.Time); ok && !t.IsZero() {
+		id = time2id(t)
+		if poPersistence.ExistsContext(aRequest.Context(), id) {
+			return "", xrError(xrFaultExists, `posting exists`)
+		}
+	}
+	post := NewPosting(id, "")
+	md := xrMarkdown(aContent, aBaseURL)
+	if 0 == len(md) {
+		return "", xrError(xrFaultParams, `missing content`)
+	}
+
+	post.Set([]byte(mpAdopt(md, post.ID())))
+	if _, err := post.StoreContext(aRequest.Context()); nil != err {
+		apachelogger.Err("TPageHandler.xrNewPost()",
+			fmt.Sprintf("TPosting.StoreContext(%s): %v", post.IDstr(), err))
+		return "", err
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	AddTagID(ph.hashList, post)
+	ph.activityPub.Publish(apCreate, post)
+	ph.webmentions.Send(post)
+
+	return post.IDstr(), nil
+} // xrNewPost()
+
+// `xrPost()` returns `aPost` as MetaWeblog post struct.
+//
+// A heading at the start of the posting is returned as `title`.
+func (ph *TPageHandler) xrPost(aPost *TPosting, aBaseURL string) map[string]any {
+	var title string
+	md := string(aPost.Markdown())
+	if heading := mpNameRE.FindString(md); 0 < len(heading) {
+		title = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(heading), `#`))
+		md = md[len(heading):]
+	}
+	categories := []any{}
+	for _, tag := range jfTags(ph.hashList, &TPostList{*aPost})[aPost.ID()] {
+		categories = append(categories, strings.TrimPrefix(tag, string(ht.MarkHash)))
+	}
+	link := aBaseURL + `/p/` + aPost.IDstr()
+
+	return map[string]any{
+		`categories`:  categories,
+		`dateCreated`: aPost.Time(),
+		`description`: strings.TrimSpace(md),
+		`link`:        link,
+		`permaLink`:   link,
+		`postid`:      aPost.IDstr(),
+		`title`:       title,
+	}
+} // xrPost()
+
+// `xrRecentPosts()` returns the newest `aLimit` postings.
+func (ph *TPageHandler) xrRecentPosts(aRequest *http.Request, aLimit int, aBaseURL string) ([]any, error) {
+	if 0 >= aLimit {
+		aLimit = int(AppArgs.PageLength)
+	}
+	pl := NewPostList()
+	if err := pl.NewestContext(aRequest.Context(), aLimit, 0); nil != err {
+		return nil, err
+	}
+	result := make([]any, 0, pl.Len())
+	for idx := range *pl {
+		result = append(result, ph.xrPost(&(*pl)[idx], aBaseURL))
+	}
+
+	return result, nil
+} // xrRecentPosts()
+
+/* _EoF_ */
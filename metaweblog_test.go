@@ -0,0 +1,342 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tXRvalue_decode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  any
+	}{
+		{" 1", `<value>plain</value>`, "plain"},
+		{" 2", `<value><string>a &amp; b</string></value>`, "a & b"},
+		{" 3", `<value><i4>42</i4></value>`, 42},
+		{" 4", `<value><int>-7</int></value>`, -7},
+		{" 5", `<value><boolean>1</boolean></value>`, true},
+		{" 6", `<value><double>1.5</double></value>`, 1.5},
+		{" 7", `<value><base64>aGVs
+			bG8=</base64></value>`, []byte("hello")},
+		{" 8", `<value><dateTime.iso8601>20240401T12:30:00</dateTime.iso8601></value>`,
+			time.Date(2024, 4, 1, 12, 30, 0, 0, time.Local)},
+		{" 9", `<value><array><data><value>x</value><value><int>1</int></value></data></array></value>`,
+			[]any{"x", 1}},
+		{"10", `<value><struct><member><name>title</name><value><string>T</string></value></member>
+			<member><name>tags</name><value><array><data/></array></value></member></struct></value>`,
+			map[string]any{"title": "T", "tags": []any{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var xv tXRvalue
+			if err := xml.Unmarshal([]byte(tt.value), &xv); nil != err {
+				t.Fatal(err)
+			}
+			got, err := xv.decode()
+			if nil != err {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+} // Test_tXRvalue_decode()
+
+func Test_xrMarkdown(t *testing.T) {
+	base := "https://blog.example.com"
+	tests := []struct {
+		name    string
+		content map[string]any
+		want    string
+	}{
+		{" 1", map[string]any{"description": "Hello"}, "Hello"},
+		{" 2", map[string]any{"title": "Title", "description": "Hello\r\nWorld"}, "# Title\n\nHello\nWorld"},
+		{" 3", map[string]any{"description": "Hello #go", "categories": []any{"Go", "web"}}, "Hello #go\n\n#web"},
+		{" 4", map[string]any{"description": "x", "mt_keywords": "a, b c"}, "x\n\n#a #bc"},
+		{" 5", map[string]any{"description": `<img src="` + base + `/attachments/1/a.png">`, "mt_text_more": "more"},
+			`<img src="/attachments/1/a.png">` + "\n\nmore"},
+		{" 6", map[string]any{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := xrMarkdown(tt.content, base); got != tt.want {
+				t.Errorf("xrMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_xrMarkdown()
+
+// `tXRtestUsers` accepts a single user.
+type tXRtestUsers struct{}
+
+func (tXRtestUsers) Matches(aUser, aPassword string) bool {
+	return ("writer" == aUser) && ("secret" == aPassword)
+} // Matches()
+
+func TestTPageHandler_handleXMLRPC(t *testing.T) {
+	ph := prepAPITest(t)
+	oldDir := AppArgs.DataDir
+	AppArgs.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		AppArgs.DataDir = oldDir
+	})
+
+	// `call()` sends the method call and returns its result or fault.
+	call := func(aMethod string, aParams ...any) (any, *tXRfault) {
+		t.Helper()
+		var buf bytes.Buffer
+		buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>` + aMethod + `</methodName><params>`)
+		for _, param := range aParams {
+			buf.WriteString(`<param>`)
+			xrEncode(&buf, param)
+			buf.WriteString(`</param>`)
+		}
+		buf.WriteString(`</params></methodCall>`)
+
+		rec := httptest.NewRecorder()
+		ph.handleXMLRPC(rec, httptest.NewRequest(http.MethodPost, xrPath, &buf), tXRtestUsers{})
+		var resp struct {
+			Params []tXRvalue `xml:"params>param>value"`
+			Fault  *tXRvalue  `xml:"fault>value"`
+		}
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); nil != err {
+			t.Fatalf("%s: %v\n%s", aMethod, err, rec.Body)
+		}
+		if nil != resp.Fault {
+			val, _ := resp.Fault.decode()
+			m, _ := val.(map[string]any)
+			code, _ := m["faultCode"].(int)
+			msg, _ := m["faultString"].(string)
+			return nil, &tXRfault{Code: code, Message: msg}
+		}
+		if 1 != len(resp.Params) {
+			t.Fatalf("%s: missing result\n%s", aMethod, rec.Body)
+		}
+		val, err := resp.Params[0].decode()
+		if nil != err {
+			t.Fatal(err)
+		}
+		return val, nil
+	}
+
+	// authentication
+	if _, fault := call("blogger.getUsersBlogs", "", "writer", "wrong"); (nil == fault) || (xrFaultAuth != fault.Code) {
+		t.Errorf("wrong password: fault = %v, want code %d", fault, xrFaultAuth)
+	}
+	if _, fault := call("metaWeblog.getPost", "1", "intruder", "secret"); (nil == fault) || (xrFaultAuth != fault.Code) {
+		t.Errorf("unknown user: fault = %v, want code %d", fault, xrFaultAuth)
+	}
+	rec := httptest.NewRecorder()
+	ph.handleXMLRPC(rec, httptest.NewRequest(http.MethodGet, xrPath, nil), tXRtestUsers{})
+	if http.StatusMethodNotAllowed != rec.Code {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	// blogs
+	res, fault := call("blogger.getUsersBlogs", "appkey", "writer", "secret")
+	if blogs, _ := res.([]any); (nil != fault) || (1 != len(blogs)) {
+		t.Fatalf("getUsersBlogs = %#v, %v", res, fault)
+	} else if blog, _ := blogs[0].(map[string]any); xrBlogID != blog["blogid"] {
+		t.Errorf("blogid = %v, want %q", blog["blogid"], xrBlogID)
+	}
+
+	// newPost
+	date := time.Date(2024, 4, 1, 12, 30, 0, 0, time.Local)
+	res, fault = call("metaWeblog.newPost", xrBlogID, "writer", "secret", map[string]any{
+		"title":       "Desktop",
+		"description": "Written <em>offline</em>.",
+		"categories":  []any{"client"},
+		"dateCreated": date,
+	}, true)
+	postID, _ := res.(string)
+	if (nil != fault) || (id2str(time2id(date)) != postID) {
+		t.Fatalf("newPost = %#v, %v; want %q", res, fault, id2str(time2id(date)))
+	}
+	post := NewPosting(str2id(postID), "")
+	defer post.Delete()
+	if err := post.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "# Desktop\n\nWritten <em>offline</em>.\n\n#client"; string(post.Markdown()) != want {
+		t.Errorf("newPost markdown = %q, want %q", post.Markdown(), want)
+	}
+	if _, fault = call("metaWeblog.newPost", xrBlogID, "writer", "secret", map[string]any{
+		"description": "again", "dateCreated": date}, true); (nil == fault) || (xrFaultExists != fault.Code) {
+		t.Errorf("duplicate newPost: fault = %v, want code %d", fault, xrFaultExists)
+	}
+
+	// getPost
+	res, fault = call("metaWeblog.getPost", postID, "writer", "secret")
+	got, _ := res.(map[string]any)
+	if (nil != fault) || ("Desktop" != got["title"]) ||
+		("Written <em>offline</em>.\n\n#client" != got["description"]) ||
+		!strings.HasSuffix(got["link"].(string), "/p/"+postID) {
+		t.Errorf("getPost = %#v, %v", res, fault)
+	}
+	if _, fault = call("metaWeblog.getPost", "0123456789abcdef", "writer", "secret"); (nil == fault) || (xrFaultNotFound != fault.Code) {
+		t.Errorf("unknown getPost: fault = %v, want code %d", fault, xrFaultNotFound)
+	}
+
+	// newMediaObject
+	res, fault = call("metaWeblog.newMediaObject", xrBlogID, "writer", "secret", map[string]any{
+		"name": "../pic.png", "type": "image/png", "bits": []byte("PNG"),
+	})
+	media, _ := res.(map[string]any)
+	if url, _ := media["url"].(string); (nil != fault) || !strings.Contains(url, "/"+atDirName+"/") {
+		t.Errorf("newMediaObject = %#v, %v", res, fault)
+	}
+	if _, fault = call("metaWeblog.newMediaObject", xrBlogID, "writer", "secret", map[string]any{
+		"name": "empty.png"}); (nil == fault) || (xrFaultParams != fault.Code) {
+		t.Errorf("empty newMediaObject: fault = %v, want code %d", fault, xrFaultParams)
+	}
+
+	// editPost
+	res, fault = call("metaWeblog.editPost", postID, "writer", "secret", map[string]any{
+		"title":       "Desktop",
+		"description": "Revised #client",
+		"categories":  []any{"client"},
+	}, true)
+	if ok, _ := res.(bool); (nil != fault) || !ok {
+		t.Errorf("editPost = %#v, %v", res, fault)
+	}
+	if err := post.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "# Desktop\n\nRevised #client"; string(post.Markdown()) != want {
+		t.Errorf("editPost markdown = %q, want %q", post.Markdown(), want)
+	}
+
+	// getRecentPosts
+	res, fault = call("metaWeblog.getRecentPosts", xrBlogID, "writer", "secret", 500)
+	found := false
+	list, _ := res.([]any)
+	for _, item := range list {
+		if m, _ := item.(map[string]any); postID == m["postid"] {
+			found = true
+		}
+	}
+	if (nil != fault) || !found {
+		t.Errorf("getRecentPosts: posting %s not found (%v)", postID, fault)
+	}
+
+	// deletePost
+	res, fault = call("blogger.deletePost", "appkey", postID, "writer", "secret", true)
+	if ok, _ := res.(bool); (nil != fault) || !ok {
+		t.Errorf("deletePost = %#v, %v", res, fault)
+	}
+	if poPersistence.Exists(str2id(postID)) {
+		t.Error("deleted posting still exists")
+	}
+	if _, fault = call("metaWeblog.deletePost", "appkey", postID, "writer", "secret", true); (nil == fault) || (xrFaultNotFound != fault.Code) {
+		t.Errorf("second deletePost: fault = %v, want code %d", fault, xrFaultNotFound)
+	}
+
+	if _, fault = call("wp.getOptions", xrBlogID, "writer", "secret"); (nil == fault) || (xrFaultMethod != fault.Code) {
+		t.Errorf("unknown method: fault = %v, want code %d", fault, xrFaultMethod)
+	}
+} // TestTPageHandler_handleXMLRPC()
+
+func TestTPageHandler_handleXMLRPC_lockout(t *testing.T) {
+	ph := prepAPITest(t)
+
+	// `call()` returns the fault code of `getUsersBlogs` from `aClient`.
+	call := func(aClient, aPassword string) int {
+		t.Helper()
+		var buf bytes.Buffer
+		buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>blogger.getUsersBlogs</methodName><params>`)
+		for _, param := range []string{"appkey", "writer", aPassword} {
+			buf.WriteString(`<param>`)
+			xrEncode(&buf, param)
+			buf.WriteString(`</param>`)
+		}
+		buf.WriteString(`</params></methodCall>`)
+
+		req := httptest.NewRequest(http.MethodPost, xrPath, &buf)
+		req.RemoteAddr = aClient + `:4711`
+		rec := httptest.NewRecorder()
+		ph.handleXMLRPC(rec, req, tXRtestUsers{})
+		if !strings.Contains(rec.Body.String(), `<fault>`) {
+			return 0
+		}
+		var resp struct {
+			Fault tXRvalue `xml:"fault>value"`
+		}
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); nil != err {
+			t.Fatal(err)
+		}
+		val, _ := resp.Fault.decode()
+		m, _ := val.(map[string]any)
+		code, _ := m["faultCode"].(int)
+
+		return code
+	} // call()
+
+	for i := 1; i < xrMaxFailures; i++ {
+		if got := call(`192.0.2.1`, `wrong`); xrFaultAuth != got {
+			t.Fatalf("failure %d: fault = %d, want %d", i, got, xrFaultAuth)
+		}
+	}
+	if got := call(`192.0.2.1`, `secret`); 0 != got {
+		t.Errorf("valid login: fault = %d, want none", got)
+	}
+	// the valid login reset the counter:
+	for i := 1; i <= xrMaxFailures; i++ {
+		if got := call(`192.0.2.1`, `wrong`); xrFaultAuth != got {
+			t.Fatalf("failure %d: fault = %d, want %d", i, got, xrFaultAuth)
+		}
+	}
+	if got := call(`192.0.2.1`, `secret`); xrFaultLocked != got {
+		t.Errorf("locked out: fault = %d, want %d", got, xrFaultLocked)
+	}
+	if got := call(`192.0.2.2`, `secret`); 0 != got {
+		t.Errorf("other client: fault = %d, want none", got)
+	}
+} // TestTPageHandler_handleXMLRPC_lockout()
+
+func Test_tXRlogins_prune(t *testing.T) {
+	var xl tXRlogins
+	for i := 0; i < xrMaxClients; i++ {
+		xl.fail(fmt.Sprintf("client%d", i))
+	}
+	xl.clients["client0"] = tXRfailures{xrMaxFailures, time.Now().Add(-2 * xrLockout)}
+	xl.clients["client1"] = tXRfailures{xrMaxFailures, time.Now().Add(-time.Minute)}
+
+	xl.fail("newcomer")
+	if got := len(xl.clients); xrMaxClients != got {
+		t.Errorf("tXRlogins.fail() clients = %d, want %d", got, xrMaxClients)
+	}
+	if _, ok := xl.clients["client0"]; ok {
+		t.Error("tXRlogins.fail(): expired client kept")
+	}
+	if !xl.locked("client1") {
+		t.Error("tXRlogins.locked() = false, want true")
+	}
+
+	xl.fail("another")
+	if got := len(xl.clients); xrMaxClients != got {
+		t.Errorf("tXRlogins.fail() clients = %d, want %d", got, xrMaxClients)
+	}
+	if _, ok := xl.clients["client1"]; ok {
+		t.Error("tXRlogins.fail(): oldest client kept")
+	}
+} // Test_tXRlogins_prune()
+
+/* _EoF_ */
@@ -0,0 +1,656 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a Micropub endpoint so that postings can be
+ * written with third-party (e.g. mobile) editors:
+ *
+ *	GET  /micropub?q=config          the endpoint's configuration
+ *	GET  /micropub?q=source&url=…    a posting's properties
+ *	POST /micropub                   create/update/delete a posting
+ *	POST /micropub/media             upload a file
+ *
+ * Clients authenticate with a personal API token sent either as
+ * `Authorization: Bearer …` header or as `access_token` parameter.
+ *
+ * see: https://www.w3.org/TR/micropub/
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	ht "github.com/mwat56/hashtags"
+	"github.com/mwat56/uploadhandler"
+)
+
+const (
+	// `mpMaxBody` is the max. size of a JSON request.
+	mpMaxBody = 1 << 20
+
+	// `mpPath` is the URL path of the Micropub endpoint.
+	mpPath = `/micropub`
+)
+
+type (
+	// `tMPerror` is the body of an error reply.
+	tMPerror struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}
+
+	// `tMPrequest` is a (JSON or form-encoded) Micropub request.
+	tMPrequest struct {
+		Action     string           `json:"action"`
+		Add        map[string][]any `json:"add"`
+		Delete     any              `json:"delete"` // `[]any` or `map[string]any`
+		Properties map[string][]any `json:"properties"`
+		Replace    map[string][]any `json:"replace"`
+		Type       []string         `json:"type"`
+		URL        string           `json:"url"`
+	}
+)
+
+var (
+	// RegEx to find our own attachments linked by a posting.
+	mpAttachmentRE = regexp.MustCompile(`/` + atDirName + `/([0-9a-f]+)/([^/\s\)"]+)`)
+
+	// RegEx to find a heading at the start of a posting.
+	mpNameRE = regexp.MustCompile(`^\s*#\s+[^\n]*\n*`)
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `mpAdopt()` moves the files uploaded by the media endpoint (and not
+// belonging to another posting) into the attachments of the posting
+// with `aID` and updates their links in `aMarkdown` accordingly.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's text.
+//   - `aID`: The ID of the posting to attach the files to.
+//
+// Returns:
+//   - `string`: The posting's updated text.
+func mpAdopt(aMarkdown string, aID uint64) string {
+	postID := id2str(aID)
+
+	return mpAttachmentRE.ReplaceAllStringFunc(aMarkdown, func(aLink string) string {
+		match := mpAttachmentRE.FindStringSubmatch(aLink)
+		oid := str2id(match[1])
+		if (postID == match[1]) || (0 == oid) || poPersistence.Exists(oid) {
+			return aLink
+		}
+		src := filepath.Join(AttachmentDir(oid), match[2])
+		name, err := copyAttachment(src, aID)
+		if nil != err {
+			apachelogger.Err("mpAdopt()",
+				fmt.Sprintf("copyAttachment(%s, %s): %v", src, postID, err))
+			return aLink
+		}
+		_ = os.Remove(src)
+		_ = os.Remove(filepath.Dir(src)) // fails if not empty
+
+		return AttachmentURL(aID, name)
+	})
+} // mpAdopt()
+
+// `mpCategory()` returns `aCategory` as a #hashtag or @mention.
+//
+// Parameters:
+//   - `aCategory`: A category of a Micropub request.
+//
+// Returns:
+//   - `string`: The tag to insert into a posting (or an empty string).
+func mpCategory(aCategory string) string {
+	aCategory = strings.TrimSpace(aCategory)
+	if strings.Contains(aCategory, `://`) {
+		return "" // a person tag (URL) can't be expressed as a tag
+	}
+	mark := string(ht.MarkHash)
+	if strings.HasPrefix(aCategory, string(ht.MarkMention)) {
+		mark = string(ht.MarkMention)
+	}
+	aCategory = strings.Join(strings.Fields(strings.TrimLeft(aCategory, `#@`)), ``)
+	if 0 == len(aCategory) {
+		return ""
+	}
+
+	return mark + aCategory
+} // mpCategory()
+
+// `mpError()` sends a Micropub error reply.
+func mpError(aWriter http.ResponseWriter, aStatus int, aError, aDescription string) {
+	apiReply(aWriter, aStatus, tMPerror{Error: aError, Description: aDescription})
+} // mpError()
+
+// `mpFormProperties()` returns the properties of a form-encoded request.
+func mpFormProperties(aValues url.Values) map[string][]any {
+	result := make(map[string][]any, len(aValues))
+	for key, list := range aValues {
+		switch key {
+		case `access_token`, `action`, `h`, `url`:
+			continue
+		}
+		if strings.HasPrefix(key, `mp-`) {
+			continue
+		}
+		key = strings.TrimSuffix(key, `[]`)
+		for _, val := range list {
+			result[key] = append(result[key], val)
+		}
+	}
+
+	return result
+} // mpFormProperties()
+
+// `mpMarkdown()` returns the Markdown text built from the `content`,
+// `name`, `photo`, and `category` properties of a request.
+//
+// Parameters:
+//   - `aProperties`: The properties of the posting.
+//   - `aBaseURL`: The blog's public URL to remove from photo links.
+//
+// Returns:
+//   - `string`: The posting's Markdown text.
+func mpMarkdown(aProperties map[string][]any, aBaseURL string) string {
+	var parts []string
+	if name := mpProperty(aProperties, `name`); 0 < len(name) {
+		parts = append(parts, `# `+name)
+	}
+	if content := mpProperty(aProperties, `content`); 0 < len(content) {
+		parts = append(parts, content)
+	}
+	if photos := mpPhotos(aProperties[`photo`], aBaseURL); 0 < len(photos) {
+		parts = append(parts, photos)
+	}
+	if tags := mpTags(aProperties[`category`]); 0 < len(tags) {
+		parts = append(parts, tags)
+	}
+
+	return strings.Join(parts, "\n\n")
+} // mpMarkdown()
+
+// `mpPhotos()` returns the Markdown images of the given photo values.
+func mpPhotos(aPhotos []any, aBaseURL string) string {
+	lines := make([]string, 0, len(aPhotos))
+	for _, photo := range aPhotos {
+		link, alt := mpString(photo), ""
+		if obj, ok := photo.(map[string]any); ok {
+			alt, _ = obj[`alt`].(string)
+		}
+		if 0 == len(link) {
+			continue
+		}
+		link = strings.TrimPrefix(link, aBaseURL)
+		lines = append(lines, `![`+alt+`](`+link+`)`)
+	}
+
+	return strings.Join(lines, "\n")
+} // mpPhotos()
+
+// `mpPostID()` returns the ID of the posting addressed by `aURL`.
+func mpPostID(aURL string) uint64 {
+	u, err := url.Parse(aURL)
+	if nil != err {
+		return 0
+	}
+	path, _, id := URLparts(u.Path)
+	if `p` != path {
+		return 0
+	}
+
+	return id
+} // mpPostID()
+
+// `mpProperty()` returns the first value of the property `aName`.
+func mpProperty(aProperties map[string][]any, aName string) string {
+	if list := aProperties[aName]; 0 < len(list) {
+		return strings.TrimSpace(mpString(list[0]))
+	}
+
+	return ""
+} // mpProperty()
+
+// `mpRemoveTag()` removes all occurrences of `aTag` from `aMarkdown`.
+func mpRemoveTag(aMarkdown, aTag string) string {
+	re, err := regexp.Compile(`(?im)(^|[ \t]+)` + regexp.QuoteMeta(aTag) + `\b[ \t]*`)
+	if nil != err {
+		return aMarkdown
+	}
+	result := re.ReplaceAllStringFunc(aMarkdown, func(aMatch string) string {
+		if strings.HasPrefix(aMatch, ` `) || strings.HasPrefix(aMatch, "\t") {
+			if strings.HasSuffix(aMatch, ` `) || strings.HasSuffix(aMatch, "\t") {
+				return ` `
+			}
+		}
+		return ``
+	})
+
+	return strings.TrimSpace(result)
+} // mpRemoveTag()
+
+// `mpRequest()` reads a JSON or form-encoded Micropub request.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `*tMPrequest`: The decoded request.
+//   - `error`: A possible decoding error.
+func mpRequest(aWriter http.ResponseWriter, aRequest *http.Request) (*tMPrequest, error) {
+	result := new(tMPrequest)
+	if strings.HasPrefix(aRequest.Header.Get(`Content-Type`), `application/json`) {
+		dec := json.NewDecoder(http.MaxBytesReader(aWriter, aRequest.Body, mpMaxBody))
+		if err := dec.Decode(result); nil != err {
+			return nil, err
+		}
+		if (0 < len(result.Type)) && (`h-entry` != result.Type[0]) {
+			return nil, fmt.Errorf("unsupported type %q", result.Type[0])
+		}
+		return result, nil
+	}
+
+	if err := aRequest.ParseMultipartForm(AppArgs.MaxFileSize); (nil != err) &&
+		!errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	if h := aRequest.FormValue(`h`); (0 < len(h)) && (`entry` != h) {
+		return nil, fmt.Errorf("unsupported type %q", h)
+	}
+	result.Action = aRequest.FormValue(`action`)
+	result.URL = aRequest.FormValue(`url`)
+	result.Properties = mpFormProperties(aRequest.Form)
+
+	return result, nil
+} // mpRequest()
+
+// `mpString()` returns the string value of a property's value which
+// might be a plain string or an object like `{"html": …}` or
+// `{"value": …, "alt": …}`.
+func mpString(aValue any) string {
+	switch val := aValue.(type) {
+	case string:
+		return val
+	case map[string]any:
+		for _, key := range []string{`value`, `html`, `markdown`, `text`} {
+			if str, ok := val[key].(string); ok {
+				return str
+			}
+		}
+	}
+
+	return ""
+} // mpString()
+
+// `mpTags()` returns the given categories as a line of tags.
+func mpTags(aCategories []any) string {
+	tags := make([]string, 0, len(aCategories))
+	for _, cat := range aCategories {
+		if tag := mpCategory(mpString(cat)); 0 < len(tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return strings.Join(tags, ` `)
+} // mpTags()
+
+// --------------------------------------------------------------------------
+// TPageHandler methods
+
+// `handleMicropub()` serves all requests to the Micropub endpoint.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aTail`: The URL's remaining path (`media` or empty).
+func (ph *TPageHandler) handleMicropub(aWriter http.ResponseWriter, aRequest *http.Request, aTail string) {
+	token, ok := bearerToken(aRequest)
+	if !ok {
+		token = aRequest.FormValue(`access_token`)
+	}
+	if 0 == len(token) {
+		mpError(aWriter, http.StatusUnauthorized, `unauthorized`, ErrTokenMissing.Error())
+		return
+	}
+	tok, err := ph.tokenList.Check(token)
+	if nil != err {
+		mpError(aWriter, http.StatusUnauthorized, `unauthorized`, err.Error())
+		return
+	}
+	if !tok.Allows(aRequest) {
+		mpError(aWriter, http.StatusForbidden, `insufficient_scope`, `token scope: `+tok.Scope)
+		return
+	}
+	base := publicBaseURL(aRequest)
+
+	switch aRequest.Method {
+	case http.MethodGet, http.MethodHead:
+		ph.mpQuery(aWriter, aRequest, base)
+		return
+
+	case http.MethodPost:
+		// handled below
+
+	default:
+		mpError(aWriter, http.StatusMethodNotAllowed, `invalid_request`, aRequest.Method)
+		return
+	}
+
+	if `media` == aTail {
+		ph.mpMedia(aWriter, aRequest, base)
+		return
+	}
+	req, err := mpRequest(aWriter, aRequest)
+	if nil != err {
+		mpError(aWriter, http.StatusBadRequest, `invalid_request`, err.Error())
+		return
+	}
+
+	switch req.Action {
+	case ``, `create`:
+		ph.mpCreate(aWriter, aRequest, req, base)
+
+	case `delete`, `update`:
+		if TokenScopeAdmin != tok.Scope {
+			mpError(aWriter, http.StatusForbidden, `insufficient_scope`,
+				req.Action+` requires an admin token`)
+			return
+		}
+		id := mpPostID(req.URL)
+		if (0 == id) || !poPersistence.ExistsContext(aRequest.Context(), id) {
+			mpError(aWriter, http.StatusBadRequest, `invalid_request`, `unknown url `+req.URL)
+			return
+		}
+		if `delete` == req.Action {
+			ph.mpDelete(aWriter, id)
+		} else {
+			ph.mpUpdate(aWriter, aRequest, req, id, base)
+		}
+
+	default:
+		mpError(aWriter, http.StatusBadRequest, `invalid_request`,
+			`unsupported action `+req.Action)
+	}
+} // handleMicropub()
+
+// `mpCreate()` creates a new posting.
+func (ph *TPageHandler) mpCreate(aWriter http.ResponseWriter, aRequest *http.Request, aReq *tMPrequest, aBaseURL string) {
+	var id uint64
+	if published := mpProperty(aReq.Properties, `published`); 0 < len(published) {
+		t, err := apiTime(published)
+		if nil != err {
+			mpError(aWriter, http.StatusBadRequest, `invalid_request`, `invalid published date`)
+			return
+		}
+		id = time2id(t)
+		if poPersistence.ExistsContext(aRequest.Context(), id) {
+			mpError(aWriter, http.StatusConflict, `invalid_request`, `posting exists`)
+			return
+		}
+	}
+	post := NewPosting(id, "")
+	md := mpMarkdown(aReq.Properties, aBaseURL)
+
+	// A photo file sent along with the posting becomes its attachment:
+	if (nil != aRequest.MultipartForm) && (0 < len(aRequest.MultipartForm.File[`photo`])) {
+		if err := os.MkdirAll(AttachmentDir(post.ID()), 0775); nil != err {
+			mpError(aWriter, http.StatusInternalServerError, `invalid_request`, err.Error())
+			return
+		}
+		txt, status := uploadhandler.NewHandler(AttachmentDir(post.ID()), `photo`,
+			AppArgs.MaxFileSize).ServeUpload(aWriter, aRequest)
+		if 200 != status {
+			_ = removeAttachments(post.ID())
+			mpError(aWriter, status, `invalid_request`, txt)
+			return
+		}
+		md = strings.TrimSpace(md + "\n\n![](" + AttachmentURL(post.ID(), filepath.Base(txt)) + ")")
+	}
+	if 0 == len(strings.TrimSpace(md)) {
+		mpError(aWriter, http.StatusBadRequest, `invalid_request`, `missing content`)
+		return
+	}
+
+	post.Set([]byte(mpAdopt(md, post.ID())))
+	if _, err := post.StoreContext(aRequest.Context()); nil != err {
+		apachelogger.Err("TPageHandler.mpCreate()",
+			fmt.Sprintf("TPosting.StoreContext(%s): %v", post.IDstr(), err))
+		mpError(aWriter, http.StatusInternalServerError, `invalid_request`, err.Error())
+		return
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	AddTagID(ph.hashList, post)
+	ph.activityPub.Publish(apCreate, post)
+	ph.webmentions.Send(post)
+
+	aWriter.Header().Set(`Location`, aBaseURL+`/p/`+post.IDstr())
+	aWriter.WriteHeader(http.StatusCreated)
+} // mpCreate()
+
+// `mpDelete()` removes the posting with `aID`.
+func (ph *TPageHandler) mpDelete(aWriter http.ResponseWriter, aID uint64) {
+	post := NewPosting(aID, "")
+	RemovePageScreenshots(post)
+	if err := post.Delete(); nil != err {
+		apachelogger.Err("TPageHandler.mpDelete()",
+			fmt.Sprintf("TPosting.Delete(%s): %v", post.IDstr(), err))
+		mpError(aWriter, http.StatusInternalServerError, `invalid_request`, err.Error())
+		return
+	}
+	RemoveIDTags(ph.hashList, aID)
+	ph.activityPub.Publish(apDelete, post)
+	ph.webmentions.RemovePost(aID)
+
+	aWriter.WriteHeader(http.StatusNoContent)
+} // mpDelete()
+
+// `mpMedia()` stores an uploaded file.
+//
+// The file is stored as attachment of a (not yet existing) posting
+// and moved to the actual posting once it's created (see `mpAdopt()`).
+func (ph *TPageHandler) mpMedia(aWriter http.ResponseWriter, aRequest *http.Request, aBaseURL string) {
+	id := NewPosting(0, "").ID()
+	dir := AttachmentDir(id)
+	if err := os.MkdirAll(dir, 0775); nil != err {
+		apachelogger.Err("TPageHandler.mpMedia()",
+			fmt.Sprintf("os.MkdirAll(%s): %v", dir, err))
+		mpError(aWriter, http.StatusInternalServerError, `invalid_request`, err.Error())
+		return
+	}
+
+	txt, status := uploadhandler.NewHandler(dir, `file`, AppArgs.MaxFileSize).
+		ServeUpload(aWriter, aRequest)
+	if 200 != status {
+		_ = removeAttachments(id)
+		mpError(aWriter, status, `invalid_request`, txt)
+		return
+	}
+
+	aWriter.Header().Set(`Location`, aBaseURL+AttachmentURL(id, filepath.Base(txt)))
+	aWriter.WriteHeader(http.StatusCreated)
+} // mpMedia()
+
+// `mpQuery()` answers the `config`, `source`, and `syndicate-to`
+// queries.
+func (ph *TPageHandler) mpQuery(aWriter http.ResponseWriter, aRequest *http.Request, aBaseURL string) {
+	switch aRequest.FormValue(`q`) {
+	case `config`:
+		apiReply(aWriter, http.StatusOK, map[string]any{
+			`media-endpoint`: aBaseURL + mpPath + `/media`,
+			`syndicate-to`:   []any{},
+			`q`:              []string{`config`, `source`, `syndicate-to`},
+		})
+
+	case `syndicate-to`:
+		apiReply(aWriter, http.StatusOK, map[string]any{
+			`syndicate-to`: []any{},
+		})
+
+	case `source`:
+		id := mpPostID(aRequest.FormValue(`url`))
+		post := NewPosting(id, "")
+		if (0 == id) || (nil != post.LoadContext(aRequest.Context())) {
+			mpError(aWriter, http.StatusBadRequest, `invalid_request`,
+				`unknown url `+aRequest.FormValue(`url`))
+			return
+		}
+
+		categories := []any{}
+		for _, tag := range jfTags(ph.hashList, &TPostList{*post})[id] {
+			categories = append(categories, strings.TrimPrefix(tag, string(ht.MarkHash)))
+		}
+		props := map[string]any{
+			`content`:   []any{string(post.Markdown())},
+			`category`:  categories,
+			`published`: []any{post.Time().Format(time.RFC3339)},
+			`url`:       []any{aBaseURL + `/p/` + post.IDstr()},
+		}
+
+		wanted := aRequest.Form[`properties[]`]
+		if 0 == len(wanted) {
+			wanted = aRequest.Form[`properties`]
+		}
+		if 0 == len(wanted) {
+			apiReply(aWriter, http.StatusOK, map[string]any{
+				`type`:       []string{`h-entry`},
+				`properties`: props,
+			})
+			return
+		}
+		selected := make(map[string]any, len(wanted))
+		for _, name := range wanted {
+			if val, ok := props[name]; ok {
+				selected[name] = val
+			}
+		}
+		apiReply(aWriter, http.StatusOK, map[string]any{`properties`: selected})
+
+	default:
+		mpError(aWriter, http.StatusBadRequest, `invalid_request`,
+			`unsupported query `+aRequest.FormValue(`q`))
+	}
+} // mpQuery()
+
+// `mpUpdate()` applies the `replace`, `add`, and `delete` operations
+// of an update request to the posting with `aID`.
+func (ph *TPageHandler) mpUpdate(aWriter http.ResponseWriter, aRequest *http.Request, aReq *tMPrequest, aID uint64, aBaseURL string) {
+	post := NewPosting(aID, "")
+	if err := post.LoadContext(aRequest.Context()); nil != err {
+		mpError(aWriter, http.StatusInternalServerError, `invalid_request`, err.Error())
+		return
+	}
+	md := string(post.Markdown())
+	tags := jfTags(ph.hashList, &TPostList{*post})[aID]
+	removeTags := func() {
+		for _, tag := range tags {
+			md = mpRemoveTag(md, tag)
+		}
+	}
+
+	// `content` replaces the whole text, hence it must come first:
+	for _, prop := range []string{`content`, `name`, `category`, `photo`} {
+		values, ok := aReq.Replace[prop]
+		if !ok {
+			continue
+		}
+		switch prop {
+		case `category`:
+			removeTags()
+			if line := mpTags(values); 0 < len(line) {
+				md += "\n\n" + line
+			}
+		case `content`:
+			if 0 < len(values) {
+				md = mpString(values[0])
+			}
+		case `name`:
+			md = mpNameRE.ReplaceAllString(md, ``)
+			if name := mpProperty(aReq.Replace, `name`); 0 < len(name) {
+				md = `# ` + name + "\n\n" + md
+			}
+		case `photo`:
+			md += "\n\n" + mpPhotos(values, aBaseURL)
+		}
+	}
+	for _, prop := range []string{`content`, `category`, `photo`} {
+		values := aReq.Add[prop]
+		if 0 == len(values) {
+			continue
+		}
+		switch prop {
+		case `category`:
+			if line := mpTags(values); 0 < len(line) {
+				md += "\n\n" + line
+			}
+		case `content`:
+			for _, val := range values {
+				md += "\n\n" + mpString(val)
+			}
+		case `photo`:
+			md += "\n\n" + mpPhotos(values, aBaseURL)
+		}
+	}
+	switch del := aReq.Delete.(type) {
+	case []any: // remove whole properties
+		for _, prop := range del {
+			switch prop {
+			case `category`:
+				removeTags()
+			case `name`:
+				md = mpNameRE.ReplaceAllString(md, ``)
+			}
+		}
+	case map[string]any: // remove single values
+		if list, ok := del[`category`].([]any); ok {
+			for _, cat := range list {
+				if tag := mpCategory(mpString(cat)); 0 < len(tag) {
+					md = mpRemoveTag(md, tag)
+				}
+			}
+		}
+	}
+
+	md = strings.TrimSpace(md)
+	if 0 == len(md) {
+		mpError(aWriter, http.StatusBadRequest, `invalid_request`, `empty posting (use action=delete instead)`)
+		return
+	}
+	post.Set([]byte(mpAdopt(md, aID)))
+	if _, err := post.StoreContext(aRequest.Context()); nil != err {
+		apachelogger.Err("TPageHandler.mpUpdate()",
+			fmt.Sprintf("TPosting.StoreContext(%s): %v", post.IDstr(), err))
+		mpError(aWriter, http.StatusInternalServerError, `invalid_request`, err.Error())
+		return
+	}
+	if AppArgs.Screenshot {
+		PrepareLinkScreenshots(post)
+	}
+	UpdateTags(ph.hashList, post)
+	ph.activityPub.Publish(apUpdate, post)
+	ph.webmentions.Send(post)
+
+	aWriter.WriteHeader(http.StatusNoContent)
+} // mpUpdate()
+
+/* _EoF_ */
@@ -0,0 +1,204 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_mpCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		cat  string
+		want string
+	}{
+		{" 1", "go", "#go"},
+		{" 2", "#go", "#go"},
+		{" 3", " open source ", "#opensource"},
+		{" 4", "@someone", "@someone"},
+		{" 5", "https://someone.example.org/", ""},
+		{" 6", "#", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mpCategory(tt.cat); got != tt.want {
+				t.Errorf("mpCategory(%q) = %q, want %q", tt.cat, got, tt.want)
+			}
+		})
+	}
+} // Test_mpCategory()
+
+func Test_mpMarkdown(t *testing.T) {
+	base := "https://blog.example.com"
+	tests := []struct {
+		name  string
+		props map[string][]any
+		want  string
+	}{
+		{" 1", map[string][]any{"content": {"Hello"}}, "Hello"},
+		{" 2", map[string][]any{"content": {"Hello"}, "category": {"a", "b"}}, "Hello\n\n#a #b"},
+		{" 3", map[string][]any{"name": {"Title"}, "content": {map[string]any{"html": "<b>x</b>"}}}, "# Title\n\n<b>x</b>"},
+		{" 4", map[string][]any{"photo": {base + "/attachments/1/a.png", map[string]any{"value": "https://x.org/b.jpg", "alt": "B"}}},
+			"![](/attachments/1/a.png)\n![B](https://x.org/b.jpg)"},
+		{" 5", map[string][]any{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mpMarkdown(tt.props, base); got != tt.want {
+				t.Errorf("mpMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_mpMarkdown()
+
+func TestTPageHandler_handleMicropub(t *testing.T) {
+	ph := prepAPITest(t)
+	oldDir := AppArgs.DataDir
+	AppArgs.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		AppArgs.DataDir = oldDir
+	})
+	tl, err := LoadTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	ph.tokenList = tl
+	postToken, _, _ := tl.Add("mobile", TokenScopePost)
+	adminToken, _, _ := tl.Add("admin", TokenScopeAdmin)
+
+	call := func(aToken, aMethod, aURL, aType, aBody string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(aMethod, aURL, strings.NewReader(aBody))
+		if 0 < len(aType) {
+			req.Header.Set("Content-Type", aType)
+		}
+		if 0 < len(aToken) {
+			req.Header.Set("Authorization", "Bearer "+aToken)
+		}
+		rec := httptest.NewRecorder()
+		ph.ServeHTTP(rec, req)
+		return rec
+	}
+	const form = "application/x-www-form-urlencoded"
+	const js = "application/json"
+	load := func(aLocation string) *TPosting {
+		t.Helper()
+		p := NewPosting(mpPostID(aLocation), "")
+		if err := p.Load(); nil != err {
+			t.Fatalf("Load(%s): %v", aLocation, err)
+		}
+		return p
+	}
+
+	// authentication
+	if rec := call("", http.MethodGet, "/micropub?q=config", "", ""); http.StatusUnauthorized != rec.Code {
+		t.Errorf("no token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := call("nele_wrong", http.MethodGet, "/micropub?q=config", "", ""); http.StatusUnauthorized != rec.Code {
+		t.Errorf("invalid token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// q=config
+	rec := call(postToken, http.MethodGet, "/micropub?q=config", "", "")
+	var cfg map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &cfg)
+	if (http.StatusOK != rec.Code) || ("http://example.com/micropub/media" != cfg["media-endpoint"]) {
+		t.Errorf("q=config = %d %s", rec.Code, rec.Body)
+	}
+
+	// form-encoded create with `access_token` parameter
+	body := url.Values{
+		"h":            {"entry"},
+		"content":      {"Hello from my phone"},
+		"category[]":   {"mobile", "indieweb"},
+		"access_token": {postToken},
+	}.Encode()
+	rec = call("", http.MethodPost, "/micropub", form, body)
+	if http.StatusCreated != rec.Code {
+		t.Fatalf("form create: status = %d, want %d (%s)", rec.Code, http.StatusCreated, rec.Body)
+	}
+	loc := rec.Header().Get("Location")
+	if want := "Hello from my phone\n\n#mobile #indieweb"; string(load(loc).Markdown()) != want {
+		t.Errorf("form create: markdown = %q, want %q", load(loc).Markdown(), want)
+	}
+
+	// JSON create adopting an uploaded photo
+	mediaID := NewPosting(0, "").ID()
+	writeTestFile(t, filepath.Join(AttachmentDir(mediaID), "pic.png"), "PNG")
+	rec = call(postToken, http.MethodPost, "/micropub", js, `{"type": ["h-entry"], "properties": {
+		"name": ["Holiday"], "content": ["Sunny"], "category": ["travel"],
+		"photo": ["http://example.com`+AttachmentURL(mediaID, "pic.png")+`"],
+		"published": ["2024-05-01T10:00:00Z"]}}`)
+	if http.StatusCreated != rec.Code {
+		t.Fatalf("JSON create: status = %d, want %d (%s)", rec.Code, http.StatusCreated, rec.Body)
+	}
+	jLoc := rec.Header().Get("Location")
+	jPost := load(jLoc)
+	if want := "# Holiday\n\nSunny\n\n![](" + AttachmentURL(jPost.ID(), "pic.png") + ")\n\n#travel"; string(jPost.Markdown()) != want {
+		t.Errorf("JSON create: markdown = %q, want %q", jPost.Markdown(), want)
+	}
+	if _, err = os.Stat(filepath.Join(AttachmentDir(jPost.ID()), "pic.png")); nil != err {
+		t.Errorf("photo not adopted: %v", err)
+	}
+	if _, err = os.Stat(AttachmentDir(mediaID)); nil == err {
+		t.Error("media directory not removed")
+	}
+
+	// q=source
+	rec = call(postToken, http.MethodGet, "/micropub?q=source&properties[]=content&url="+url.QueryEscape(jLoc), "", "")
+	var src struct {
+		Type       []string
+		Properties map[string][]string
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &src)
+	if (0 != len(src.Type)) || (1 != len(src.Properties)) ||
+		(string(jPost.Markdown()) != src.Properties["content"][0]) {
+		t.Errorf("q=source = %s", rec.Body)
+	}
+
+	// update needs an admin token
+	upd := `{"action": "update", "url": "` + loc + `",
+		"replace": {"content": ["Changed #mobile"]},
+		"add": {"category": ["later"]},
+		"delete": {"category": ["mobile"]}}`
+	if rec = call(postToken, http.MethodPost, "/micropub", js, upd); http.StatusForbidden != rec.Code {
+		t.Errorf("update with post token: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec = call(adminToken, http.MethodPost, "/micropub", js, upd); http.StatusNoContent != rec.Code {
+		t.Fatalf("update: status = %d, want %d (%s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if want := "Changed\n\n#later"; string(load(loc).Markdown()) != want {
+		t.Errorf("update: markdown = %q, want %q", load(loc).Markdown(), want)
+	}
+
+	// delete
+	del := `{"action": "delete", "url": "` + loc + `"}`
+	if rec = call(postToken, http.MethodPost, "/micropub", js, del); http.StatusForbidden != rec.Code {
+		t.Errorf("delete with post token: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec = call(adminToken, http.MethodPost, "/micropub", js, del); http.StatusNoContent != rec.Code {
+		t.Errorf("delete: status = %d, want %d (%s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if poPersistence.Exists(mpPostID(loc)) {
+		t.Error("deleted posting still exists")
+	}
+	if rec = call(adminToken, http.MethodPost, "/micropub", js, `{"action": "undelete", "url": "`+loc+`"}`); http.StatusBadRequest != rec.Code {
+		t.Errorf("undelete: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	_ = jPost.Delete()
+} // TestTPageHandler_handleMicropub()
+
+/* _EoF_ */
@@ -0,0 +1,461 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a cache of rendered pages.
+ *
+ * Pages are cached for anonymous visitors only, keyed by their URL
+ * path, language, and theme. A cached page is dropped as soon as one
+ * of the postings it shows is changed; all cached pages become stale
+ * when postings are added or removed, when the #hashtags/@mentions
+ * (shown on every page) change, and at midnight (because every page
+ * shows the current date).
+ */
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+)
+
+const (
+	// `pcFilePrefix` is the name prefix of the cache files.
+	pcFilePrefix = `pc-`
+)
+
+type (
+	// `tPCentry` is a single cached page.
+	tPCentry struct {
+		body    []byte            // the page (`nil` if stored on disk)
+		day     string            // the date the page was rendered
+		elem    *list.Element     // the entry's position in the LRU list
+		etag    string            // the page's `ETag`
+		gen     tPCgeneration     // the state the page was rendered in
+		header  map[string]string // additional headers to send
+		ids     []uint64          // IDs of the postings shown
+		key     string            // the entry's cache key
+		lastMod time.Time         // the page's `Last-Modified` time
+		size    int64             // the page's size
+	}
+
+	// `tPCgeneration` identifies the state of the data shown on
+	// every page (number of postings, #hashtags, @mentions).
+	tPCgeneration struct {
+		postings uint64 // postings added/removed
+		tags     int64  // time of the latest hashlist change
+	}
+
+	// `tPageCache` is the cache of rendered pages.
+	tPageCache struct {
+		dir     string               // directory of the cache files (optional)
+		entries map[string]*tPCentry // entries indexed by their key
+		lru     *list.List           // keys, most recently used first
+		maxSize int64                // max. size of all cached pages
+		mtx     sync.Mutex           // guard against concurrent accesses
+		stats   TPageCacheStats      // the cache's statistics
+	}
+
+	// `tPCwriter` records a page while it's sent to the remote user.
+	tPCwriter struct {
+		http.ResponseWriter
+		buf    bytes.Buffer
+		gen    tPCgeneration // the state when rendering started
+		ids    []uint64      // IDs of the postings shown
+		key    string        // the page's cache key
+		status int           // the reply's HTTP status
+		valid  bool          // whether the page was validated
+	}
+
+	// `TPageCacheStats` are the page cache's statistics.
+	TPageCacheStats struct {
+		Entries       int   `json:"entries"`       // number of cached pages
+		Evictions     int64 `json:"evictions"`     // pages removed for lack of space
+		Hits          int64 `json:"hits"`          // requests served from the cache
+		Invalidations int64 `json:"invalidations"` // pages removed because of changes
+		MaxSize       int64 `json:"maxSize"`       // max. size of all cached pages
+		Misses        int64 `json:"misses"`        // requests for uncached pages
+		Size          int64 `json:"size"`          // size of all cached pages
+	}
+)
+
+var (
+	// `pcCache` is the cache of rendered pages (`nil` if disabled).
+	pcCache *tPageCache
+
+	// `pcPostings` counts the postings added or removed.
+	pcPostings atomic.Uint64
+
+	// `pcHeaders` are the reply headers stored along with a page.
+	pcHeaders = []string{`Cache-Control`, `Content-Type`, `Link`}
+
+	// `pcPaths` are the (first) URL path parts of the cacheable pages.
+	pcPaths = map[string]bool{
+		``: true, `datenschutz`: true, `faq`: true, `hl`: true,
+		`impressum`: true, `imprint`: true, `licence`: true,
+		`license`: true, `lizenz`: true, `m`: true, `ml`: true,
+		`mm`: true, `n`: true, `p`: true, `privacy`: true, `w`: true,
+		`ww`: true,
+	}
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `pcCurrent()` returns the current state of the data shown on every
+// page.
+func pcCurrent() tPCgeneration {
+	return tPCgeneration{
+		postings: pcPostings.Load(),
+		tags:     htChanged.Load(),
+	}
+} // pcCurrent()
+
+// `pcKey()` returns the cache key of the page requested by `aRequest`,
+// or an empty string if the page can't be cached.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `string`: The page's cache key.
+func pcKey(aRequest *http.Request) string {
+	if (nil == pcCache) || (0 < len(aRequest.Header.Get(`Authorization`))) {
+		return "" // logged in users see additional controls
+	}
+	path, tail, _ := URLparts(aRequest.URL.Path)
+	if !pcPaths[path] {
+		return ""
+	}
+	if _, _, _, ok := feedTail(tail); ok && ((`hl` == path) || (`ml` == path)) {
+		return "" // feeds have their own validators
+	}
+	if (`p` == path) && APWantsJSON(aRequest) {
+		return ""
+	}
+	for name := range aRequest.URL.Query() {
+		switch name {
+		case `lang`, `theme`:
+		default:
+			return "" // e.g. `/?p=…` redirections
+		}
+	}
+	lang, theme := pageLangTheme(aRequest)
+
+	return lang + `|` + theme + `|` + aRequest.URL.Path
+} // pcKey()
+
+// `pcPostingsChanged()` records that postings were added or removed,
+// making all cached pages stale.
+func pcPostingsChanged() {
+	pcPostings.Add(1)
+} // pcPostingsChanged()
+
+// `pcToday()` returns the current date.
+func pcToday() string {
+	return time.Now().Format(time.DateOnly)
+} // pcToday()
+
+// `newPageCache()` returns a new page cache.
+//
+// Parameters:
+//   - `aMaxSize`: The max. size of all cached pages (zero disables caching).
+//   - `aDir`: The directory to store the pages in (empty for memory).
+//
+// Returns:
+//   - `*tPageCache`: The new page cache, or `nil` if disabled.
+func newPageCache(aMaxSize int64, aDir string) *tPageCache {
+	if 0 >= aMaxSize {
+		return nil
+	}
+	result := &tPageCache{
+		dir:     aDir,
+		entries: make(map[string]*tPCentry),
+		lru:     list.New(),
+		maxSize: aMaxSize,
+	}
+	result.stats.MaxSize = aMaxSize
+
+	if 0 < len(aDir) {
+		if err := os.MkdirAll(aDir, 0775); nil != err {
+			apachelogger.Err("newPageCache()",
+				fmt.Sprintf("os.MkdirAll(%q): %v", aDir, err))
+			result.dir = ""
+		} else if files, err := filepath.Glob(filepath.Join(aDir, pcFilePrefix+`*`)); nil == err {
+			// pages cached by a previous run might be outdated:
+			for _, fName := range files {
+				_ = os.Remove(fName)
+			}
+		}
+	}
+
+	return result
+} // newPageCache()
+
+// --------------------------------------------------------------------------
+// tPageCache methods
+
+// `drop()` removes all cached pages showing one of the postings with
+// `aIDs`.
+//
+// Parameters:
+//   - `aIDs`: The IDs of the changed postings.
+func (pc *tPageCache) drop(aIDs ...uint64) {
+	if nil == pc {
+		return
+	}
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	for _, entry := range pc.entries {
+		for _, id := range entry.ids {
+			if slices.Contains(aIDs, id) {
+				pc.remove(entry)
+				pc.stats.Invalidations++
+				break
+			}
+		}
+	}
+} // drop()
+
+// `fileName()` returns the name of the file storing the page with
+// `aKey`.
+func (pc *tPageCache) fileName(aKey string) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(aKey))
+
+	return filepath.Join(pc.dir, fmt.Sprintf("%s%016x.html", pcFilePrefix, hash.Sum64()))
+} // fileName()
+
+// `get()` returns the cached page with `aKey` and its body.
+//
+// Parameters:
+//   - `aKey`: The page's cache key.
+//
+// Returns:
+//   - `*tPCentry`: The cached page or `nil` if there's none.
+//   - `[]byte`: The page's body.
+func (pc *tPageCache) get(aKey string) (*tPCentry, []byte) {
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	entry, ok := pc.entries[aKey]
+	if ok && ((entry.gen != pcCurrent()) || (entry.day != pcToday())) {
+		pc.remove(entry)
+		pc.stats.Invalidations++
+		ok = false
+	}
+	if !ok {
+		pc.stats.Misses++
+		return nil, nil
+	}
+
+	body := entry.body
+	if nil == body {
+		var err error
+		if body, err = os.ReadFile(pc.fileName(aKey)); nil != err {
+			apachelogger.Err("tPageCache.get()",
+				fmt.Sprintf("os.ReadFile(%q): %v", pc.fileName(aKey), err))
+			pc.remove(entry)
+			pc.stats.Misses++
+			return nil, nil
+		}
+	}
+	pc.lru.MoveToFront(entry.elem)
+	pc.stats.Hits++
+
+	return entry, body
+} // get()
+
+// `put()` adds `aEntry` with the page `aBody` to the cache.
+//
+// Parameters:
+//   - `aEntry`: The page's cache entry.
+//   - `aBody`: The page to cache.
+func (pc *tPageCache) put(aEntry *tPCentry, aBody []byte) {
+	aEntry.size = int64(len(aBody))
+	if aEntry.size > pc.maxSize {
+		return
+	}
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	if old, ok := pc.entries[aEntry.key]; ok {
+		pc.remove(old)
+	}
+	for (0 < pc.lru.Len()) && (pc.stats.Size+aEntry.size > pc.maxSize) {
+		pc.remove(pc.entries[pc.lru.Back().Value.(string)])
+		pc.stats.Evictions++
+	}
+
+	if 0 < len(pc.dir) {
+		if err := os.WriteFile(pc.fileName(aEntry.key), aBody, 0640); nil != err {
+			apachelogger.Err("tPageCache.put()",
+				fmt.Sprintf("os.WriteFile(%q): %v", pc.fileName(aEntry.key), err))
+			return
+		}
+	} else {
+		aEntry.body = aBody
+	}
+	aEntry.elem = pc.lru.PushFront(aEntry.key)
+	pc.entries[aEntry.key] = aEntry
+	pc.stats.Size += aEntry.size
+} // put()
+
+// `recorder()` returns a writer recording the page with `aKey` while
+// sending it to `aWriter`.
+//
+// Parameters:
+//   - `aKey`: The page's cache key.
+//   - `aWriter`: The writer to respond to the remote user.
+//
+// Returns:
+//   - `*tPCwriter`: The recording writer.
+func (pc *tPageCache) recorder(aKey string, aWriter http.ResponseWriter) *tPCwriter {
+	return &tPCwriter{
+		ResponseWriter: aWriter,
+		gen:            pcCurrent(),
+		key:            aKey,
+	}
+} // recorder()
+
+// `remove()` deletes `aEntry` from the cache.
+//
+// NOTE: The caller must hold the cache's lock.
+func (pc *tPageCache) remove(aEntry *tPCentry) {
+	if nil == aEntry {
+		return
+	}
+	if 0 < len(pc.dir) {
+		_ = os.Remove(pc.fileName(aEntry.key))
+	}
+	pc.lru.Remove(aEntry.elem)
+	delete(pc.entries, aEntry.key)
+	pc.stats.Size -= aEntry.size
+} // remove()
+
+// `serve()` sends the cached page with `aKey` (if any).
+//
+// Parameters:
+//   - `aKey`: The page's cache key.
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `bool`: `true` if the page was served from the cache.
+func (pc *tPageCache) serve(aKey string, aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	entry, body := pc.get(aKey)
+	if nil == entry {
+		return false
+	}
+
+	for name, value := range entry.header {
+		aWriter.Header().Set(name, value)
+	}
+	if feedNotModified(aWriter, aRequest, entry.lastMod, entry.etag) {
+		return true
+	}
+	_, _ = aWriter.Write(body)
+
+	return true
+} // serve()
+
+// `Stats()` returns the cache's statistics.
+//
+// Returns:
+//   - `TPageCacheStats`: The cache's current statistics.
+func (pc *tPageCache) Stats() TPageCacheStats {
+	if nil == pc {
+		return TPageCacheStats{}
+	}
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	result := pc.stats
+	result.Entries = len(pc.entries)
+
+	return result
+} // Stats()
+
+// --------------------------------------------------------------------------
+// tPCwriter methods
+
+// `store()` adds the recorded page to the cache if it was sent
+// completely and successfully.
+func (cw *tPCwriter) store() {
+	if (!cw.valid) || (http.StatusOK != cw.status) || (0 == cw.buf.Len()) {
+		return
+	}
+	header := make(map[string]string, len(pcHeaders))
+	for _, name := range pcHeaders {
+		if value := cw.Header().Get(name); 0 < len(value) {
+			header[name] = value
+		}
+	}
+	lastMod, _ := http.ParseTime(cw.Header().Get(`Last-Modified`))
+
+	pcCache.put(&tPCentry{
+		day:     pcToday(),
+		etag:    cw.Header().Get(`ETag`),
+		gen:     cw.gen,
+		header:  header,
+		ids:     cw.ids,
+		key:     cw.key,
+		lastMod: lastMod,
+	}, bytes.Clone(cw.buf.Bytes()))
+} // store()
+
+// `validated()` records the IDs of the postings shown by the page.
+//
+// Parameters:
+//   - `aIDs`: The IDs of the postings shown.
+func (cw *tPCwriter) validated(aIDs []uint64) {
+	cw.ids, cw.valid = aIDs, true
+} // validated()
+
+// `Write()` sends `aData` to the remote user while recording it.
+//
+// Parameters:
+//   - `aData`: The data to send.
+//
+// Returns:
+//   - `int`: The number of bytes sent.
+//   - `error`: A possible I/O error.
+func (cw *tPCwriter) Write(aData []byte) (int, error) {
+	if 0 == cw.status {
+		cw.status = http.StatusOK
+	}
+	cw.buf.Write(aData)
+
+	return cw.ResponseWriter.Write(aData)
+} // Write()
+
+// `WriteHeader()` sends the reply's HTTP status code.
+//
+// Parameters:
+//   - `aStatus`: The HTTP status code to send.
+func (cw *tPCwriter) WriteHeader(aStatus int) {
+	if 0 == cw.status {
+		cw.status = aStatus
+	}
+	cw.ResponseWriter.WriteHeader(aStatus)
+} // WriteHeader()
+
+/* _EoF_ */
@@ -0,0 +1,154 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_tPageCache_put(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		pc := newPageCache(10, dir)
+		pc.put(&tPCentry{key: "a", gen: pcCurrent(), day: pcToday(), ids: []uint64{1}}, []byte("aaaa"))
+		pc.put(&tPCentry{key: "b", gen: pcCurrent(), day: pcToday(), ids: []uint64{2}}, []byte("bbbb"))
+		if _, body := pc.get("a"); "aaaa" != string(body) {
+			t.Errorf("%q: get(a) = %q, want %q", dir, body, "aaaa")
+		}
+
+		// "b" is the least recently used entry
+		pc.put(&tPCentry{key: "c", gen: pcCurrent(), day: pcToday(), ids: []uint64{1, 3}}, []byte("cccc"))
+		if entry, _ := pc.get("b"); nil != entry {
+			t.Errorf("%q: evicted entry still cached", dir)
+		}
+		pc.put(&tPCentry{key: "d"}, []byte("too large a page"))
+
+		pc.drop(1)
+		stats := pc.Stats()
+		if (0 != stats.Entries) || (0 != stats.Size) || (1 != stats.Evictions) ||
+			(2 != stats.Invalidations) || (1 != stats.Hits) || (1 != stats.Misses) {
+			t.Errorf("%q: Stats() = %+v", dir, stats)
+		}
+		if 0 < len(dir) {
+			if files, _ := os.ReadDir(dir); 0 < len(files) {
+				t.Errorf("%q: %d cache files left", dir, len(files))
+			}
+		}
+	}
+
+	// stale entries
+	pc := newPageCache(100, "")
+	pc.put(&tPCentry{key: "old", gen: pcCurrent(), day: "2019-04-13"}, []byte("x"))
+	pc.put(&tPCentry{key: "gen", gen: pcCurrent(), day: pcToday()}, []byte("y"))
+	pcPostingsChanged()
+	for _, key := range []string{"old", "gen"} {
+		if entry, _ := pc.get(key); nil != entry {
+			t.Errorf("stale entry %q served", key)
+		}
+	}
+
+	if nil != newPageCache(0, "") {
+		t.Error("newPageCache(0) != nil")
+	}
+} // Test_tPageCache_put()
+
+func TestTPageHandler_pageCache(t *testing.T) {
+	ph := prepAPITest(t)
+	if nil == pcCache {
+		t.Fatal("page cache disabled")
+	}
+
+	p := NewPosting(0, "The #first version")
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer p.Delete()
+
+	// `get()` requests `aPath` returning the reply and whether it
+	// was served from the cache.
+	get := func(aPath, aAuth string) (*httptest.ResponseRecorder, bool) {
+		hits := pcCache.Stats().Hits
+		req := httptest.NewRequest(http.MethodGet, aPath, nil)
+		if 0 < len(aAuth) {
+			req.Header.Set("Authorization", aAuth)
+		}
+		rec := httptest.NewRecorder()
+		ph.ServeHTTP(rec, req)
+		return rec, hits < pcCache.Stats().Hits
+	}
+
+	path := "/p/" + p.IDstr()
+	first, cached := get(path, "")
+	if cached || (http.StatusOK != first.Code) {
+		t.Fatalf("first request: status = %d, cached = %v", first.Code, cached)
+	}
+	rec, cached := get(path, "")
+	if !cached {
+		t.Error("second request not served from the cache")
+	}
+	if (rec.Body.String() != first.Body.String()) || (rec.Header().Get("ETag") != first.Header().Get("ETag")) {
+		t.Error("cached page differs")
+	}
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	ph.ServeHTTP(rec, req)
+	if http.StatusNotModified != rec.Code {
+		t.Errorf("cached conditional GET: status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if _, cached = get(path+"?lang=en&theme=light", ""); cached {
+		t.Error("other language/theme served from the cache")
+	}
+	if _, cached = get(path, "Basic dXNlcjpwYXNz"); cached {
+		t.Error("authenticated request served from the cache")
+	}
+
+	// lists are dropped when a posting shown is changed
+	if _, cached = get("/n/", ""); cached {
+		t.Error("first list request served from the cache")
+	}
+	if _, cached = get("/n/", ""); !cached {
+		t.Error("second list request not served from the cache")
+	}
+	p.Set([]byte("The #second version, revised"))
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	for _, page := range []string{path, "/n/"} {
+		if rec, cached = get(page, ""); cached || !strings.Contains(rec.Body.String(), "revised") {
+			t.Errorf("%s: outdated page served", page)
+		}
+	}
+
+	// a new posting makes all pages stale
+	if _, cached = get("/n/", ""); !cached {
+		t.Error("list not cached again")
+	}
+	np := NewPosting(0, "Another posting")
+	if _, err := np.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer np.Delete()
+	if rec, cached = get("/n/", ""); cached || !strings.Contains(rec.Body.String(), "Another posting") {
+		t.Error("list without the new posting served")
+	}
+	if _, cached = get(path, ""); cached {
+		t.Error("page with outdated posting count served")
+	}
+
+	if stats := pcCache.Stats(); (0 == stats.Entries) || (0 == stats.Misses) || (0 == stats.Invalidations) {
+		t.Errorf("Stats() = %+v", stats)
+	}
+} // TestTPageHandler_pageCache()
+
+/* _EoF_ */
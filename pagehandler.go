@@ -8,12 +8,14 @@ Copyright © 2019, 2024  M.Watermann, 10247 Berlin, Germany
 package nele
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"regexp"
 	"runtime/debug"
@@ -35,13 +37,15 @@ import (
 type (
 	// TPageHandler provides the handling of HTTP request/response.
 	TPageHandler struct {
-		cssFS    http.Handler                  // CSS file server
-		hashList *ht.THashTags                 // #hashtags/@mentions list
-		imgUp    *uploadhandler.TUploadHandler // `img` upload handler
-		staticFS http.Handler                  // `static` file server
-		staticUp *uploadhandler.TUploadHandler // `static` upload handler
-		userList *passlist.TPassList           // user/password list
-		viewList *TViewList                    // list of template/views
+		activityPub *TActivityPub       // ActivityPub actor
+		cssFS       http.Handler        // CSS file server
+		hashList    *ht.THashTags       // #hashtags/@mentions list
+		staticFS    http.Handler        // `static` file server
+		tokenList   *TTokenList         // personal API tokens
+		userList    *passlist.TPassList // user/password list
+		viewList    *TViewList          // list of template/views
+		webmentions *TWebmentions       // received Webmentions
+		xrLogins    tXRlogins           // failed XML-RPC logins
 	}
 )
 
@@ -93,6 +97,8 @@ func NewPageHandler() (*TPageHandler, error) {
 		AppArgs.PageLength = 20 //TODO: make this configurable
 	}
 
+	pcCache = newPageCache(AppArgs.PageCache, AppArgs.PageCacheDir)
+
 	result.staticFS = jffs.FileServer(AppArgs.DataDir + `/`)
 
 	if AppArgs.Screenshot {
@@ -106,6 +112,33 @@ func NewPageHandler() (*TPageHandler, error) {
 		result.userList = nil
 	}
 
+	if 0 < len(AppArgs.TokenFile) {
+		if result.tokenList, err = LoadTokens(AppArgs.TokenFile); nil != err {
+			log.Printf("NewPageHandler(): %v\nAPI TOKENS DISABLED!", err)
+			result.tokenList = nil
+		}
+	}
+
+	if AppArgs.ActivityPub {
+		if 0 == len(AppArgs.PublicURL) {
+			log.Println("NewPageHandler(): missing public URL\nACTIVITYPUB DISABLED!")
+		} else if result.activityPub, err = NewActivityPub(AppArgs.PublicURL,
+			AppArgs.APuser, filepath.Join(AppArgs.DataDir, apDirName)); nil != err {
+			log.Printf("NewPageHandler(): %v\nACTIVITYPUB DISABLED!", err)
+			result.activityPub = nil
+		}
+	}
+
+	if AppArgs.Webmention {
+		if 0 == len(AppArgs.PublicURL) {
+			log.Println("NewPageHandler(): missing public URL\nWEBMENTIONS DISABLED!")
+		} else if result.webmentions, err = NewWebmentions(AppArgs.PublicURL,
+			filepath.Join(AppArgs.DataDir, wmFileName)); nil != err {
+			log.Printf("NewPageHandler(): %v\nWEBMENTIONS DISABLED!", err)
+			result.webmentions = nil
+		}
+	}
+
 	return result, nil
 } // NewPageHandler()
 
@@ -248,9 +281,16 @@ func URLparts(aURL string) (rPath, rTail string, rID uint64) {
 // --------------------------------------------------------------------------
 // TPageHandler methods
 
-// `basicPageData()` returns a list of data to be inserted into the
-// `view`/templates.
-func (ph *TPageHandler) basicPageData(aRequest *http.Request) *TemplateData {
+// `pageLangTheme()` returns the language and theme to use for the
+// page requested by `aRequest`.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request (may be `nil`).
+//
+// Returns:
+//   - `string`: The page's language (`de` or `en`).
+//   - `string`: The page's theme (`dark` or `light`).
+func pageLangTheme(aRequest *http.Request) (string, string) {
 	lang, theme := AppArgs.Lang, AppArgs.Theme
 	if nil != aRequest {
 		var val string // re-use variable
@@ -268,14 +308,21 @@ func (ph *TPageHandler) basicPageData(aRequest *http.Request) *TemplateData {
 		}
 	}
 
+	return lang, theme
+} // pageLangTheme()
+
+// `basicPageData()` returns a list of data to be inserted into the
+// `view`/templates.
+func (ph *TPageHandler) basicPageData(aRequest *http.Request) *TemplateData {
+	lang, theme := pageLangTheme(aRequest)
+
 	y, m, d := time.Now().Date()
 	now := fmt.Sprintf("%d-%02d-%02d", y, m, d)
-	err := ph.userList.IsAuthenticated(aRequest)
 	pageData := NewTemplateData().
 		Set("Blogname", AppArgs.BlogName).
 		Set(`CSS`, template.HTML(`<link rel="stylesheet" type="text/css" title="mwat's styles" href="/css/stylesheet.css"><link rel="stylesheet" type="text/css" href="/css/`+theme+`.css"><link rel="stylesheet" type="text/css" href="/css/fonts.css">`)).
 		Set("HashCount", ph.hashList.HashCount()).
-		Set(`isAuth`, nil == err).
+		Set(`isAuth`, ph.isAuthenticated(aRequest)).
 		Set(`Lang`, lang).
 		Set("MentionCount", ph.hashList.MentionCount()).
 		Set("monthURL", "/m/"+now).
@@ -289,6 +336,33 @@ func (ph *TPageHandler) basicPageData(aRequest *http.Request) *TemplateData {
 	return pageData
 } // basicPageData()
 
+// `checkToken()` verifies the API token sent with `aRequest` and
+// whether its scope permits the request.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `bool`: `true` if the request may proceed, `false` if it was denied.
+func (ph *TPageHandler) checkToken(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	tok, err := ph.tokenList.Authenticate(aRequest)
+	if nil != err {
+		aWriter.Header().Set(`WWW-Authenticate`,
+			`Bearer realm="`+AppArgs.Realm+`", error="invalid_token"`)
+		http.Error(aWriter, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	if !tok.Allows(aRequest) {
+		aWriter.Header().Set(`WWW-Authenticate`,
+			`Bearer realm="`+AppArgs.Realm+`", error="insufficient_scope"`)
+		http.Error(aWriter, `insufficient token scope`, http.StatusForbidden)
+		return false
+	}
+
+	return true
+} // checkToken()
+
 // `GetErrorPage()` returns an error page for `aStatus`,
 // implementing the `TErrorPager` interface.
 //
@@ -328,6 +402,16 @@ func (ph *TPageHandler) GetErrorPage(aData []byte, aStatus int) []byte {
 // `finishReply()` sends `aPage` with `aData` to `aWriter`.
 func (ph *TPageHandler) finishReply(aPage string,
 	aWriter http.ResponseWriter, aData *TemplateData) {
+	if _, ok := aWriter.(*tHeadWriter); ok {
+		// `HEAD` requests don't need the page's body
+		aWriter.Header().Set(`Content-Type`, `text/html; charset=utf-8`)
+		return
+	}
+	if pl, ok := aData.Get(`Postings`); ok {
+		if list, ok := pl.(*TPostList); ok {
+			list.render() // the template then uses the cached HTML
+		}
+	}
 	if err := ph.viewList.Render(aPage, aWriter, aData); nil != err {
 		apachelogger.Err("TPageHandler.finishReply()",
 			fmt.Sprintf("viewList.Render('%s'): %v", aPage, err))
@@ -337,15 +421,48 @@ func (ph *TPageHandler) finishReply(aPage string,
 // `handleGET()` processes the HTTP GET requests.
 func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 	aRequest *http.Request) {
+	if key := pcKey(aRequest); 0 < len(key) {
+		if pcCache.serve(key, aWriter, aRequest) {
+			return
+		}
+		if _, ok := aWriter.(*tHeadWriter); !ok {
+			cw := pcCache.recorder(key, aWriter)
+			defer cw.store()
+			aWriter = cw
+		}
+	}
 	pageData := ph.basicPageData(aRequest)
 	path, tail, rID := URLparts(aRequest.URL.Path)
 
 	switch path { // handle URLs case-insensitive
 
+	case `.well-known`:
+		if (`webfinger` == tail) && (nil != ph.activityPub) {
+			ph.activityPub.handleWebFinger(aWriter, aRequest)
+		} else {
+			http.NotFound(aWriter, aRequest)
+		}
+
 	case `a`:
 		http.Redirect(aWriter, aRequest, "/ap/",
 			http.StatusMovedPermanently)
 
+	case `activitypub`: // the blog's ActivityPub actor
+		if nil == ph.activityPub {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		switch tail {
+		case `actor`:
+			ph.activityPub.handleActor(aWriter, aRequest)
+		case `followers`:
+			ph.activityPub.handleFollowers(aWriter, aRequest)
+		case `outbox`:
+			ph.activityPub.handleOutbox(aWriter, aRequest)
+		default:
+			http.NotFound(aWriter, aRequest)
+		}
+
 	case `ap`: // add a new post
 		if auth, ok := pageData.Get(`isAuth`); ok && (auth == true) {
 			ph.finishReply(path, aWriter,
@@ -375,7 +492,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		var p *TPosting
 		if auth, ok := pageData.Get(`isAuth`); ok && (auth == true) {
 			p = NewPosting(rID, "")
-			if err := p.Load(); nil != err {
+			if err := p.LoadContext(aRequest.Context()); nil != err {
 				apachelogger.Err("TPageHandler.handleGET(dp)",
 					fmt.Sprintf("TPosting.Load('%s'): %v", p.IDstr(), err))
 				http.NotFound(aWriter, aRequest)
@@ -412,7 +529,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		var p *TPosting
 		if auth, ok := pageData.Get(`isAuth`); ok && (auth == true) {
 			p = NewPosting(rID, "")
-			if err := p.Load(); nil != err {
+			if err := p.LoadContext(aRequest.Context()); nil != err {
 				apachelogger.Err("TPageHandler.handleGET(ep)",
 					fmt.Sprintf("TPosting.Load('%s'): %v", p.IDstr(), err))
 				http.NotFound(aWriter, aRequest)
@@ -437,6 +554,9 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		ph.finishReply(path, aWriter, pageData)
 
 	case `faq`:
+		if newPageValidator(aRequest, pageData).notModified(aWriter, aRequest) {
+			return
+		}
 		ph.finishReply(`faq`, aWriter, pageData)
 
 	case `faq.html`:
@@ -447,14 +567,35 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		http.Redirect(aWriter, aRequest, `/img/`+path,
 			http.StatusMovedPermanently)
 
+	case `feed`: // Atom/RSS feed of the newest postings
+		switch tail {
+		case ``, FeedAtom:
+			ph.handleFeed(aWriter, aRequest, FeedAtom, ``)
+		case FeedRSS:
+			ph.handleFeed(aWriter, aRequest, FeedRSS, ``)
+		default:
+			http.NotFound(aWriter, aRequest)
+		}
+
+	case `feed.json`: // JSON feed of the newest postings
+		ph.handleJSONFeed(aWriter, aRequest, tail, ``)
+
 	case "fonts":
 		ph.staticFS.ServeHTTP(aWriter, aRequest)
 
 	case "hl": // #hashtag list
-		if 0 < len(tail) {
-			ph.handleTagMentions(
+		if tag, format, page, ok := feedTail(tail); ok {
+			if FeedJSON == format {
+				ph.handleJSONFeed(aWriter, aRequest, page, string(ht.MarkHash)+tag)
+			} else {
+				ph.handleFeed(aWriter, aRequest, format, string(ht.MarkHash)+tag)
+			}
+		} else if 0 < len(tail) {
+			ph.handleTagMentions(aRequest,
 				ph.hashList.HashList(string(ht.MarkHash)+tail),
-				pageData, aWriter)
+				pageData.Set(`FeedTitle`, AppArgs.BlogName+`: #`+tail).
+					Set(`FeedURL`, `/hl/`+tail+`/feed`),
+				aWriter)
 		} else {
 			http.Redirect(aWriter, aRequest, "/n/",
 				http.StatusSeeOther)
@@ -481,7 +622,13 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 	case "img":
 		ph.staticFS.ServeHTTP(aWriter, aRequest)
 
+	case "attachments": // a posting's attachment
+		ph.staticFS.ServeHTTP(aWriter, aRequest)
+
 	case "imprint", "impressum":
+		if newPageValidator(aRequest, pageData).notModified(aWriter, aRequest) {
+			return
+		}
 		ph.finishReply(`imprint`, aWriter, pageData)
 
 	case `index`, `index.html`, `index.php`, `index.shtml`:
@@ -493,7 +640,18 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 				ph.sfh.ServeHTTP(aWriter, aRequest)
 		*/
 
+	case `media`: // media library
+		if auth, ok := pageData.Get(`isAuth`); ok && (true == auth) {
+			ph.handleMedia(aRequest.Context(), nil, false, pageData, aWriter)
+		} else {
+			http.Redirect(aWriter, aRequest, "/n/",
+				http.StatusUnauthorized)
+		}
+
 	case "licence", "license", "lizenz":
+		if newPageValidator(aRequest, pageData).notModified(aWriter, aRequest) {
+			return
+		}
 		ph.finishReply(`licence`, aWriter, pageData)
 
 	case `m`, `mm`: // handle a given month
@@ -507,13 +665,16 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		} else {
 			y, m, d = getYMD(tail)
 			// Allow indexing for lists older 30 days
-			t := time.Date(y, m, d+30, 0, 0, 0, 0, time.Local)
-			if t.Before(time.Now()) {
+			if listIndexable(y, m, d) {
 				robots = `index,follow`
 			}
 		}
 		date := fmt.Sprintf("%d-%02d-%02d", y, m, d)
-		pl := NewPostList().Month(y, m)
+		pl := NewPostList().MonthContext(aRequest.Context(), y, m)
+		if newPageValidator(aRequest, pageData).addPostings(pl).
+			notModified(aWriter, aRequest) {
+			return
+		}
 		ph.finishReply(`searchresult`, aWriter,
 			pageData.Set(`Matches`, pl.Len()).
 				Set(`monthURL`, "/m/"+date).
@@ -526,9 +687,18 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 			http.StatusMovedPermanently)
 
 	case "ml": // @mention list
-		if 0 < len(tail) {
-			ph.handleTagMentions(ph.hashList.MentionList("@"+tail),
-				pageData, aWriter)
+		if tag, format, page, ok := feedTail(tail); ok {
+			if FeedJSON == format {
+				ph.handleJSONFeed(aWriter, aRequest, page, "@"+tag)
+			} else {
+				ph.handleFeed(aWriter, aRequest, format, "@"+tag)
+			}
+		} else if 0 < len(tail) {
+			ph.handleTagMentions(aRequest,
+				ph.hashList.MentionList("@"+tail),
+				pageData.Set(`FeedTitle`, AppArgs.BlogName+`: @`+tail).
+					Set(`FeedURL`, `/ml/`+tail+`/feed`),
+				aWriter)
 		} else {
 			http.Redirect(aWriter, aRequest, "/n/",
 				http.StatusSeeOther)
@@ -537,7 +707,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 	case `n`: // handle newest postings
 		// `tail` can be a string like `10,30` meaning:
 		// show 10 postings, starting with (list-)position 30.
-		ph.handleRoot(tail, pageData, aWriter)
+		ph.handleRoot(aRequest, tail, pageData, aWriter)
 
 	case `np`:
 		http.Redirect(aWriter, aRequest, "/n/"+tail,
@@ -551,18 +721,42 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		}
 
 		p := NewPosting(rID, "")
-		if err := p.Load(); nil != err {
+		if err := p.LoadContext(aRequest.Context()); nil != err {
 			apachelogger.Err("TPageHandler.handleGET(p)",
 				fmt.Sprintf("TPosting.Load(%q): %v", p.IDstr(), err))
 			http.NotFound(aWriter, aRequest)
 			return
 		}
+		if (nil != ph.activityPub) && APWantsJSON(aRequest) {
+			ph.activityPub.handleObject(aWriter, aRequest, p)
+			return
+		}
 
 		date := p.Date()
-		aWriter.Header().Set(`Cache-Control`, `private, max-age=864000`) // 10 days
-		aWriter.Header().Set(`Last-Modified`, p.LastModified())
+		validator := newPageValidator(aRequest, pageData).addPosting(p)
+		if nil != ph.webmentions {
+			aWriter.Header().Set(`Link`, `<`+ph.webmentions.baseURL+`/webmention>; rel="webmention"`)
+			auth, _ := pageData.Get(`isAuth`)
+			mentions := ph.webmentions.List(rID, true == auth)
+			for _, wm := range mentions {
+				validator.add(wm.ID, wm.Approved, wm.Received.UnixNano())
+			}
+			pageData = pageData.Set(`Webmentions`, mentions)
+		}
+		backlinks := Backlinks(rID)
+		for _, bl := range backlinks {
+			validator.add(bl.ID, bl.Title)
+		}
+		if validator.notModified(aWriter, aRequest) {
+			return
+		}
 
-		pageData = pageData.Set(`monthURL`, `/m/`+date).
+		lang, _ := pageData.Get(`Lang`)
+		langStr, _ := lang.(string)
+		pageData = pageData.Set(`Meta`, postingMeta(p,
+			jfTags(ph.hashList, &TPostList{*p})[rID], publicBaseURL(aRequest), langStr)).
+			Set(`Backlinks`, backlinks).
+			Set(`monthURL`, `/m/`+date).
 			Set("Posting", p).
 			Set("weekURL", "/w/"+date)
 		ph.finishReply("article", aWriter, pageData)
@@ -576,6 +770,9 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 			http.StatusMovedPermanently)
 
 	case "privacy", "datenschutz":
+		if newPageValidator(aRequest, pageData).notModified(aWriter, aRequest) {
+			return
+		}
 		ph.finishReply(`privacy`, aWriter, pageData)
 
 	case `pv`: // page preview
@@ -595,7 +792,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 
 	case `q`: // handle a query/search
 		if 0 < len(tail) {
-			ph.handleSearch(tail, pageData, aWriter)
+			ph.handleSearch(aRequest, tail, pageData, aWriter)
 		} else {
 			http.Redirect(aWriter, aRequest, "/n/", http.StatusSeeOther)
 		}
@@ -615,7 +812,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		auth, ok := pageData.Get(`isAuth`)
 		if ok && (true == auth) {
 			p = NewPosting(rID, "")
-			if err := p.Load(); nil != err {
+			if err := p.LoadContext(aRequest.Context()); nil != err {
 				apachelogger.Err("TPageHandler.handleGET(rp)",
 					fmt.Sprintf("TPosting.Load('%s'): %v", p.IDstr(), err))
 				http.NotFound(aWriter, aRequest)
@@ -640,7 +837,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		ph.finishReply(path, aWriter, pageData)
 
 	case "robots.txt":
-		ph.staticFS.ServeHTTP(aWriter, aRequest)
+		ph.handleRobots(aWriter, aRequest)
 
 	case `s`: // search text => `q`
 		http.Redirect(aWriter, aRequest, "/q/"+tail,
@@ -688,6 +885,17 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 	case "static": // deliver a static resource
 		ph.staticFS.ServeHTTP(aWriter, aRequest)
 
+	case `sitemap.xml`:
+		ph.handleSitemap(aWriter, aRequest, 0)
+
+	case `tokens`: // personal API tokens
+		if auth, ok := pageData.Get(`isAuth`); ok && (true == auth) {
+			ph.handleTokens("", pageData, aWriter)
+		} else {
+			http.Redirect(aWriter, aRequest, "/n/",
+				http.StatusUnauthorized)
+		}
+
 	case `v`: // page preview
 		http.Redirect(aWriter, aRequest, "/pv/"+tail,
 			http.StatusMovedPermanently)
@@ -707,13 +915,16 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		} else {
 			y, m, d = getYMD(tail)
 			// Allow indexing for lists older 30 days
-			t := time.Date(y, m, d+30, 0, 0, 0, 0, time.Local)
-			if t.Before(time.Now()) {
+			if listIndexable(y, m, d) {
 				robots = `index,follow`
 			}
 		}
 		date := fmt.Sprintf("%d-%02d-%02d", y, m, d)
-		pl := NewPostList().Week(y, m, d)
+		pl := NewPostList().WeekContext(aRequest.Context(), y, m, d)
+		if newPageValidator(aRequest, pageData).addPostings(pl).
+			notModified(aWriter, aRequest) {
+			return
+		}
 		ph.finishReply(`searchresult`, aWriter,
 			pageData.Set(`Matches`, pl.Len()).
 				Set(`monthURL`, `/m/`+date).
@@ -724,7 +935,8 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 	case `x`, `xp`, `xt`: // eXchange #tags/@mentions
 		if auth, ok := pageData.Get(`isAuth`); ok && (auth == true) {
 			ph.finishReply(`xt`, aWriter,
-				pageData.Set(`Robots`, `noindex,nofollow`))
+				pageData.Set(`Robots`, `noindex,nofollow`).
+					Set(`TagLog`, TagRenameLog()))
 		} else {
 			http.Redirect(aWriter, aRequest, "/n/",
 				http.StatusUnauthorized)
@@ -751,7 +963,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 		} else if val = aRequest.FormValue("w"); 0 < len(val) {
 			ph.reDir(aWriter, aRequest, "/w/"+val)
 		} else {
-			ph.handleRoot("", pageData, aWriter)
+			ph.handleRoot(aRequest, "", pageData, aWriter)
 		}
 
 	case `admin`, `cgi-bin`, `config`, `console`, `echo.php`,
@@ -761,6 +973,10 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter,
 			http.StatusMovedPermanently)
 
 	default:
+		if page := smPageNo(path); 0 < page { // partial sitemap
+			ph.handleSitemap(aWriter, aRequest, page)
+			return
+		}
 		// if nothing matched (above) reply to the request
 		// with an HTTP 404 not found error.
 		http.NotFound(aWriter, aRequest)
@@ -782,6 +998,13 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 	)
 	path, tail, rID := URLparts(aRequest.URL.Path)
 	switch path {
+	case `activitypub`: // the ActivityPub actor's inbox
+		if (nil != ph.activityPub) && (`inbox` == tail) {
+			ph.activityPub.handleInbox(aWriter, aRequest)
+		} else {
+			http.NotFound(aWriter, aRequest)
+		}
+
 	case `ap`: // add a new post
 		if val = aRequest.FormValue("abort"); 0 < len(val) {
 			http.Redirect(aWriter, aRequest, "/n/",
@@ -794,6 +1017,9 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 			if _, err = p.Store(); nil != err {
 				apachelogger.Err("TPageHandler.handlePOST('a')",
 					fmt.Sprintf("TPosting.Store(%s): %v", p.IDstr(), err))
+			} else {
+				ph.activityPub.Publish(apCreate, p)
+				ph.webmentions.Send(p)
 			}
 			if AppArgs.Screenshot {
 				PrepareLinkScreenshots(p)
@@ -835,15 +1061,21 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 
 		t = time.Date(y, mo, d, h, mi, s, n, time.Local)
 		nid := time2id(t)
-		if err = poPersistence.Rename(oid, nid); nil != err {
+		if err = op.ChangeID(nid); nil != err {
 			apachelogger.Err("TPageHandler.handlePOST('dp')",
-				fmt.Sprintf("Persistence.Rename(%d, %d): %v", oid, nid, err))
+				fmt.Sprintf("TPosting.ChangeID(%d, %d): %v", oid, nid, err))
 		}
 
 		RenameIDTags(ph.hashList, oid, nid)
 
 		np := NewPosting(nid, "")
-		np.Load()
+		np.LoadContext(aRequest.Context())
+		if (nil == err) && (oid != nid) {
+			// The posting's URL (i.e. its ActivityPub ID) has changed:
+			ph.activityPub.Publish(apDelete, NewPosting(oid, ""))
+			ph.activityPub.Publish(apCreate, np)
+			ph.webmentions.Send(np)
+		}
 		if AppArgs.Screenshot {
 			PrepareLinkScreenshots(np)
 		}
@@ -864,7 +1096,7 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 		nTxt := replCRLF([]byte(aRequest.FormValue("manuscript")))
 
 		p := NewPosting(rID, "")
-		if err = p.Load(); nil != err {
+		if err = p.LoadContext(aRequest.Context()); nil != err {
 			apachelogger.Err("TPageHandler.handlePOST(ep)",
 				fmt.Sprintf("TPosting.Load(%s): %v", p.IDstr(), err))
 		} else {
@@ -876,6 +1108,9 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 				// let's hope for the best …
 				_, _ = p.Set(old).Store()
 			}
+		} else {
+			ph.activityPub.Publish(apUpdate, p)
+			ph.webmentions.Send(p)
 		}
 		if AppArgs.Screenshot {
 			PrepareLinkScreenshots(p)
@@ -898,6 +1133,22 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 			http.Redirect(aWriter, aRequest, "/n/", http.StatusMovedPermanently)
 		}
 
+	case `media`: // clean up the media library
+		var removed TMediaList
+		dryRun := 0 < len(aRequest.FormValue("dryrun"))
+		if dryRun || (0 < len(aRequest.FormValue("delete"))) {
+			if removed, err = CleanMedia(aRequest.Context(), dryRun,
+				aRequest.PostForm["img"]); nil != err {
+				apachelogger.Err("TPageHandler.handlePOST('media')",
+					fmt.Sprintf("CleanMedia(%v): %v", dryRun, err))
+			}
+		}
+		if nil == removed {
+			removed = TMediaList{}
+		}
+		ph.handleMedia(aRequest.Context(), removed, dryRun,
+			ph.basicPageData(aRequest), aWriter)
+
 	case `pv`: // update page previews/screenshots
 		if AppArgs.Screenshot {
 			if val = aRequest.FormValue("abort"); 0 < len(val) {
@@ -926,6 +1177,9 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 		if err = post.Delete(); nil != err {
 			apachelogger.Err("TPageHandler.handlePOST('r')",
 				fmt.Sprintf("TPosting.Delete(%s): %v", post.IDstr(), err))
+		} else {
+			ph.activityPub.Publish(apDelete, post)
+			ph.webmentions.RemovePost(post.ID())
 		}
 		RemoveIDTags(ph.hashList, str2id(tail))
 
@@ -937,10 +1191,6 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 			return
 		}
 
-		if nil == ph.imgUp { // lazy initialisation
-			ph.imgUp = uploadhandler.NewHandler(filepath.Join(AppArgs.DataDir, "/img/"),
-				"imgFile", AppArgs.MaxFileSize)
-		}
 		ph.handleUpload(aWriter, aRequest, true)
 
 	case `ss`: // store static
@@ -950,12 +1200,61 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 			return
 		}
 
-		if nil == ph.staticUp { // lazy initialisation
-			ph.staticUp = uploadhandler.NewHandler(filepath.Join(AppArgs.DataDir, "/static/"),
-				"statFile", AppArgs.MaxFileSize)
-		}
 		ph.handleUpload(aWriter, aRequest, false)
 
+	case `tokens`: // create/revoke personal API tokens
+		var token string
+		if nil == ph.tokenList {
+			http.Error(aWriter, `API tokens disabled`,
+				http.StatusServiceUnavailable)
+			return
+		}
+		if val = aRequest.FormValue("revoke"); 0 < len(val) {
+			if err := ph.tokenList.Revoke(val); nil != err {
+				apachelogger.Err("TPageHandler.handlePOST('tokens')",
+					fmt.Sprintf("TTokenList.Revoke(%q): %v", val, err))
+			}
+		} else if val = strings.TrimSpace(aRequest.FormValue("name")); 0 < len(val) {
+			var err error
+			if token, _, err = ph.tokenList.Add(val, aRequest.FormValue("scope")); nil != err {
+				apachelogger.Err("TPageHandler.handlePOST('tokens')",
+					fmt.Sprintf("TTokenList.Add(%q): %v", val, err))
+			}
+		}
+		ph.handleTokens(token, ph.basicPageData(aRequest), aWriter)
+
+	case `webmention`: // receive a Webmention
+		if nil == ph.webmentions {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		if err = ph.webmentions.Receive(aRequest.FormValue("source"),
+			aRequest.FormValue("target")); nil != err {
+			if errors.Is(err, ErrWebmentionLimit) {
+				http.Error(aWriter, err.Error(), http.StatusTooManyRequests)
+			} else {
+				http.Error(aWriter, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		aWriter.WriteHeader(http.StatusAccepted)
+
+	case `wm`: // moderate Webmentions
+		if nil == ph.webmentions {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		if val = aRequest.FormValue("approve"); 0 < len(val) {
+			err = ph.webmentions.Approve(val)
+		} else if val = aRequest.FormValue("delete"); 0 < len(val) {
+			err = ph.webmentions.Delete(val)
+		}
+		if nil != err {
+			apachelogger.Err("TPageHandler.handlePOST('wm')",
+				fmt.Sprintf("moderate(%q): %v", val, err))
+		}
+		http.Redirect(aWriter, aRequest, "/p/"+tail, http.StatusSeeOther)
+
 	case `xt`: // eXchange #tags/@mentions
 		if val = aRequest.FormValue("abort"); 0 < len(val) {
 			http.Redirect(aWriter, aRequest, "/n/",
@@ -963,15 +1262,43 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 			return
 		}
 
-		if val = aRequest.FormValue("search"); 0 < len(val) {
-			if r := aRequest.FormValue("replace"); 0 < len(r) {
-				ReplaceTag(ph.hashList,
-					strings.TrimSpace(val),
-					strings.TrimSpace(r)) // background operation
+		search := strings.TrimSpace(aRequest.FormValue("search"))
+		replace := strings.TrimSpace(aRequest.FormValue("replace"))
+		pageData := ph.basicPageData(aRequest).
+			Set(`Robots`, `noindex,nofollow`).
+			Set(`Search`, search).
+			Set(`Replace`, replace)
+		var (
+			entry   *TTagLogEntry
+			skipped []string
+		)
+		switch {
+		case 0 < len(aRequest.FormValue("undo")):
+			entry, skipped, err = UndoTagRename(ph.hashList,
+				aRequest.FormValue("undo"))
+			pageData.Set(`Undone`, entry)
+
+		case 0 < len(aRequest.FormValue("apply")):
+			keys := aRequest.PostForm["post"]
+			if nil == keys {
+				keys = []string{} // none selected
 			}
+			entry, skipped, err = ApplyTagRename(aRequest.Context(),
+				ph.hashList, search, replace, keys)
+			pageData.Set(`Applied`, entry)
+
+		case (0 < len(search)) && (0 < len(replace)):
+			var changes []TTagChange
+			changes, err = PreviewTagRename(aRequest.Context(), search, replace)
+			pageData.Set(`Changes`, changes).Set(`Preview`, true)
 		}
-		http.Redirect(aWriter, aRequest, "/x/",
-			http.StatusSeeOther)
+		if nil != err {
+			apachelogger.Err("TPageHandler.handlePOST('xt')", err.Error())
+			pageData.Set(`Error`, err.Error())
+		}
+		ph.finishReply(`xt`, aWriter,
+			pageData.Set(`Skipped`, skipped).
+				Set(`TagLog`, TagRenameLog()))
 
 	default:
 		// // If nothing matched (above) reply to the request
@@ -984,8 +1311,34 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 	}
 } // handlePOST()
 
+// `handleMedia()` serves the media library page.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aRemoved`: The list of (to be) removed files, or `nil` if no cleanup was requested.
+//   - `aDryRun`: Whether `aRemoved` was just a dry-run.
+//   - `aData`: The template data to use.
+//   - `aWriter`: The writer to respond to the remote user.
+func (ph *TPageHandler) handleMedia(aCtx context.Context, aRemoved TMediaList,
+	aDryRun bool, aData *TemplateData, aWriter http.ResponseWriter) {
+	ml, err := MediaLibrary(aCtx)
+	if nil != err {
+		apachelogger.Err("TPageHandler.handleMedia()",
+			fmt.Sprintf("MediaLibrary(): %v", err))
+	}
+
+	ph.finishReply(`media`, aWriter,
+		aData.Set(`Cleaned`, nil != aRemoved).
+			Set(`DryRun`, aDryRun).
+			Set(`Media`, ml).
+			Set(`Orphans`, len(ml.Orphans())).
+			Set(`Removed`, aRemoved).
+			Set(`RemovedSize`, TMediaFile{Size: aRemoved.Size()}.SizeStr()).
+			Set(`Robots`, `noindex,nofollow`))
+} // handleMedia()
+
 // `handleRoot()` serves the logical web-root directory.
-func (ph *TPageHandler) handleRoot(aNumStr string,
+func (ph *TPageHandler) handleRoot(aRequest *http.Request, aNumStr string,
 	aData *TemplateData, aWriter http.ResponseWriter) {
 	limit, offset := numStart(aNumStr)
 	if 0 == limit {
@@ -993,7 +1346,11 @@ func (ph *TPageHandler) handleRoot(aNumStr string,
 	}
 
 	pl := NewPostList()
-	_ = pl.Newest(limit, offset) // ignore fs errors here
+	_ = pl.NewestContext(aRequest.Context(), limit, offset) // ignore fs errors here
+	if newPageValidator(aRequest, aData).addPostings(pl).
+		notModified(aWriter, aRequest) {
+		return
+	}
 
 	aData = aData.Set(`Postings`, pl).
 		Set("Robots", "noindex,follow")
@@ -1005,10 +1362,14 @@ func (ph *TPageHandler) handleRoot(aNumStr string,
 } // handleRoot()
 
 // `handleSearch()` serves the search results.
-func (ph *TPageHandler) handleSearch(aTerm string,
+func (ph *TPageHandler) handleSearch(aRequest *http.Request, aTerm string,
 	aData *TemplateData, aWriter http.ResponseWriter) {
 
-	pl := SearchPostings(regexp.QuoteMeta(strings.Trim(aTerm, `"`)))
+	pl := SearchPostingsContext(aRequest.Context(), regexp.QuoteMeta(strings.Trim(aTerm, `"`)))
+	if newPageValidator(aRequest, aData).addPostings(pl).
+		notModified(aWriter, aRequest) {
+		return
+	}
 
 	ph.finishReply(`searchresult`, aWriter,
 		aData.Set(`Robots`, `noindex,follow`).
@@ -1033,7 +1394,7 @@ func (ph *TPageHandler) handleShare(aShare string, aWriter http.ResponseWriter,
 } // handleShare()
 
 // `handleTagMentions()` add the hashtag/mention list to `aData`
-func (ph *TPageHandler) handleTagMentions(aList []uint64, aData *TemplateData, aWriter http.ResponseWriter) {
+func (ph *TPageHandler) handleTagMentions(aRequest *http.Request, aList []uint64, aData *TemplateData, aWriter http.ResponseWriter) {
 	var ( // re-use variables
 		err  error
 		id   uint64
@@ -1043,7 +1404,7 @@ func (ph *TPageHandler) handleTagMentions(aList []uint64, aData *TemplateData, a
 	if 0 < len(aList) {
 		for _, id = range aList {
 			post = NewPosting(id, "")
-			if err = post.Load(); nil != err {
+			if err = post.LoadContext(aRequest.Context()); nil != err {
 				apachelogger.Err("TPageHandler.handleTagMentions()",
 					fmt.Sprintf("TPosting.Load('%s'): %v", id2str(id), err))
 				continue
@@ -1051,6 +1412,10 @@ func (ph *TPageHandler) handleTagMentions(aList []uint64, aData *TemplateData, a
 			pl.Add(post)
 		}
 	}
+	if newPageValidator(aRequest, aData).addPostings(pl).
+		notModified(aWriter, aRequest) {
+		return
+	}
 
 	ph.finishReply(`searchresult`, aWriter,
 		aData.Set(`Robots`, `index,follow`).
@@ -1058,32 +1423,75 @@ func (ph *TPageHandler) handleTagMentions(aList []uint64, aData *TemplateData, a
 			Set(`Postings`, pl)) // .Sort()
 } // handleTagMentions()
 
+// `handleTokens()` serves the page listing the personal API tokens.
+//
+// Parameters:
+//   - `aToken`: A newly created token to show (once), or an empty string.
+//   - `aData`: The template data to use.
+//   - `aWriter`: The writer to respond to the remote user.
+func (ph *TPageHandler) handleTokens(aToken string, aData *TemplateData,
+	aWriter http.ResponseWriter) {
+	ph.finishReply(`tokens`, aWriter,
+		aData.Set(`NewToken`, aToken).
+			Set(`Robots`, `noindex,nofollow`).
+			Set(`Tokens`, ph.tokenList.List()))
+} // handleTokens()
+
 // `handleUpload()` processes a file upload.
 func (ph *TPageHandler) handleUpload(aWriter http.ResponseWriter, aRequest *http.Request, isImage bool) {
 	var (
-		status   int
-		img, txt string
+		status          int
+		field, img, txt string
 	)
+	// The uploaded file is stored as an attachment of a new posting:
+	post := NewPosting(0, "")
+	dir := AttachmentDir(post.ID())
+	if err := os.MkdirAll(dir, 0775); nil != err {
+		apachelogger.Err("TPageHandler.handleUpload()",
+			fmt.Sprintf("os.MkdirAll(%s): %v", dir, err))
+		http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	if isImage {
-		img = "!"
-		txt, status = ph.imgUp.ServeUpload(aWriter, aRequest)
+		field, img = "imgFile", "!"
 	} else {
-		txt, status = ph.staticUp.ServeUpload(aWriter, aRequest)
+		field = "statFile"
 	}
+	txt, status = uploadhandler.NewHandler(dir, field, AppArgs.MaxFileSize).
+		ServeUpload(aWriter, aRequest)
 
 	if 200 == status {
-		fName := strings.TrimPrefix(txt, AppArgs.DataDir)
-		post := NewPosting(0, "\n\n\n> "+img+"["+fName+"]("+fName+")\n\n")
+		fName := filepath.Base(txt)
+		fURL := AttachmentURL(post.ID(), fName)
+		post.Set([]byte("\n\n\n> " + img + "[" + fName + "](" + fURL + ")\n\n"))
 		if _, err := post.Store(); nil != err {
 			apachelogger.Err("TPageHandler.handleUpload()",
 				fmt.Sprintf("TPosting.Store(%s): %v", post.IDstr(), err))
 		}
 		http.Redirect(aWriter, aRequest, "/e/"+post.IDstr(), http.StatusSeeOther)
 	} else {
+		_ = removeAttachments(post.ID())
 		http.Error(aWriter, txt, status)
 	}
 } // handleUpload()
 
+// `isAuthenticated()` reports whether `aRequest` carries either
+// valid BasicAuth credentials or an `admin` API token.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `bool`: `true` if the remote user is authenticated, `false` otherwise.
+func (ph *TPageHandler) isAuthenticated(aRequest *http.Request) bool {
+	if _, ok := bearerToken(aRequest); ok {
+		tok, err := ph.tokenList.Authenticate(aRequest)
+		return (nil == err) && (TokenScopeAdmin == tok.Scope)
+	}
+
+	return nil == ph.userList.IsAuthenticated(aRequest)
+} // isAuthenticated()
+
 // `Len()` returns the length of the internal views list.
 //
 // Returns:
@@ -1101,15 +1509,29 @@ func (ph *TPageHandler) Len() int {
 // Returns:
 //   - `bool`: Whether or not to require authentication.
 func (ph *TPageHandler) NeedAuthentication(aRequest *http.Request) bool {
+	if _, ok := bearerToken(aRequest); ok {
+		return true // always check a given API token
+	}
+
 	path, _, _ := URLparts(aRequest.URL.Path)
 	switch path {
+	case `api`: // JSON API: reading is public, writing is not
+		switch aRequest.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return false
+		}
+		return true
+
 	case `ap`, // add new post
 		`dp`,            // change post's date
 		`ep`,            // edit post
 		`il`,            // init hash list
+		`media`,         // media library
 		`rp`,            // remove post
 		`share`,         // share another URL
 		`ss`,            // store images, store static data
+		`tokens`,        // personal API tokens
+		`wm`,            // moderate Webmentions
 		`pv`,            // update Screenshot
 		`x`, `xp`, `xt`: // eXchange #tags/@mentions
 		return true
@@ -1167,22 +1589,43 @@ func (ph *TPageHandler) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Re
 
 	aWriter.Header().Set(`Access-Control-Allow-Methods`, `GET, HEAD, POST`)
 	if ph.NeedAuthentication(aRequest) {
-		if nil == ph.userList {
+		if _, ok := bearerToken(aRequest); ok {
+			if !ph.checkToken(aWriter, aRequest) {
+				return
+			}
+		} else if nil == ph.userList {
 			passlist.Deny(AppArgs.Realm, aWriter)
 			return
-		}
-		if err := ph.userList.IsAuthenticated(aRequest); nil != err {
+		} else if err := ph.userList.IsAuthenticated(aRequest); nil != err {
 			passlist.Deny(AppArgs.Realm, aWriter)
 			return
 		}
 	}
 
+	if strings.HasPrefix(aRequest.URL.Path, `/api/`) {
+		ph.handleAPI(aWriter, aRequest)
+		return
+	}
+	switch path, tail, _ := URLparts(aRequest.URL.Path); path {
+	case `micropub`:
+		ph.handleMicropub(aWriter, aRequest, tail)
+		return
+
+	case `xmlrpc`, `xmlrpc.php`:
+		var users tXRusers
+		if nil != ph.userList {
+			users = ph.userList
+		}
+		ph.handleXMLRPC(aWriter, aRequest, users)
+		return
+	}
+
 	switch aRequest.Method {
 	case `GET`:
 		ph.handleGET(aWriter, aRequest)
 
 	case `HEAD`:
-		ph.handleGET(aWriter, aRequest)
+		ph.handleGET(&tHeadWriter{aWriter}, aRequest)
 
 	case `OPTIONS`:
 		aWriter.WriteHeader(http.StatusOK)
@@ -23,7 +23,7 @@ func Test_NewPageHandler(t *testing.T) {
 		want    int
 		wantErr bool
 	}{
-		{"1", 18, false},
+		{"1", 20, false},
 		// TODO: Add test cases.
 	}
 	for _, tt := range tests {
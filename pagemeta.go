@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the metadata (OpenGraph, Twitter Card, and
+ * schema.org JSON-LD) of a single posting's page so that links to
+ * the posting get a proper preview on social sites and chat tools.
+ *
+ * see: https://ogp.me/
+ * and: https://schema.org/BlogPosting
+ */
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	ht "github.com/mwat56/hashtags"
+)
+
+const (
+	// `pmDescriptionLen` is the max. length of a page's description.
+	pmDescriptionLen = 200
+)
+
+type (
+	// `tPageMeta` is the metadata of a posting's page
+	// (used by the `02htmlhead.gohtml` template).
+	tPageMeta struct {
+		Description string         // a plain text excerpt
+		Image       string         // absolute URL of a preview image
+		JSONLD      map[string]any // schema.org `BlogPosting` data
+		Locale      string         // the page's language and territory
+		Modified    string         // last modification time
+		Published   string         // publication time
+		SiteName    string         // the blog's name
+		Tags        []string       // the posting's #hashtags
+		Title       string         // the posting's title
+		URL         string         // absolute URL of the posting
+	}
+)
+
+var (
+	// RegEx to find the first image embedded by Markdown or HTML
+	// markup (which includes the link screenshots).
+	pmImageRE = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^\s\)>]+)|<img\s[^>]*?src\s*=\s*["']([^"']+)["']`)
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `pmAbsURL()` returns `aURL` as an absolute URL.
+func pmAbsURL(aURL, aBaseURL string) string {
+	if ssSchemeRE.MatchString(aURL) {
+		return aURL
+	}
+	if strings.HasPrefix(aURL, `//`) {
+		return `https:` + aURL
+	}
+	if !strings.HasPrefix(aURL, `/`) {
+		aURL = `/` + aURL
+	}
+
+	return aBaseURL + aURL
+} // pmAbsURL()
+
+// `pmDescription()` returns a plain text excerpt of `aMarkdown`
+// skipping a leading heading which is used as title.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's text.
+//
+// Returns:
+//   - `string`: The posting's description.
+func pmDescription(aMarkdown []byte) string {
+	text := string(aMarkdown)
+	if heading := mpNameRE.FindString(text); 0 < len(heading) {
+		text = text[len(heading):]
+	}
+
+	var words []string
+	for _, line := range strings.Split(text, "\n") {
+		line = feedMarkupRE.ReplaceAllString(line, `$1`)
+		words = append(words, strings.Fields(line)...)
+	}
+	result := strings.Join(words, ` `)
+	if pmDescriptionLen < utf8.RuneCountInString(result) {
+		runes := []rune(result)
+		result = strings.TrimSpace(string(runes[:pmDescriptionLen-1])) + `…`
+	}
+
+	return result
+} // pmDescription()
+
+// `pmImage()` returns the first image embedded by `aMarkdown`.
+func pmImage(aMarkdown []byte) string {
+	match := pmImageRE.FindSubmatch(aMarkdown)
+	if nil == match {
+		return ""
+	}
+	if 0 < len(match[1]) {
+		return string(match[1])
+	}
+
+	return string(match[2])
+} // pmImage()
+
+// `postingMeta()` returns the metadata of the page showing `aPosting`.
+//
+// Parameters:
+//   - `aPosting`: The posting to describe.
+//   - `aTags`: The #hashtags/@mentions used by the posting.
+//   - `aBaseURL`: The blog's public scheme and host.
+//   - `aLang`: The page's language.
+//
+// Returns:
+//   - `*tPageMeta`: The page's metadata.
+func postingMeta(aPosting *TPosting, aTags []string, aBaseURL, aLang string) *tPageMeta {
+	md := aPosting.Markdown()
+	result := &tPageMeta{
+		Description: pmDescription(md),
+		Locale:      `en_US`,
+		Modified:    feedUpdated(aPosting).Format(time.RFC3339),
+		Published:   aPosting.Time().Format(time.RFC3339),
+		SiteName:    AppArgs.BlogName,
+		Title:       feedTitle(md),
+		URL:         aBaseURL + `/p/` + aPosting.IDstr(),
+	}
+	if `de` == aLang {
+		result.Locale = `de_DE`
+	}
+	if img := pmImage(md); 0 < len(img) {
+		result.Image = pmAbsURL(img, aBaseURL)
+	}
+	for _, tag := range aTags {
+		if strings.HasPrefix(tag, string(ht.MarkHash)) {
+			result.Tags = append(result.Tags, strings.TrimPrefix(tag, string(ht.MarkHash)))
+		}
+	}
+
+	result.JSONLD = map[string]any{
+		`@context`:         `https://schema.org`,
+		`@type`:            `BlogPosting`,
+		`dateModified`:     result.Modified,
+		`datePublished`:    result.Published,
+		`description`:      result.Description,
+		`headline`:         result.Title,
+		`inLanguage`:       aLang,
+		`mainEntityOfPage`: result.URL,
+		`publisher`: map[string]string{
+			`@type`: `Organization`,
+			`name`:  result.SiteName,
+			`url`:   aBaseURL + `/`,
+		},
+		`url`: result.URL,
+	}
+	if 0 < len(result.Image) {
+		result.JSONLD[`image`] = result.Image
+	}
+	if 0 < len(result.Tags) {
+		result.JSONLD[`keywords`] = strings.Join(result.Tags, `, `)
+	}
+
+	return result
+} // postingMeta()
+
+/* _EoF_ */
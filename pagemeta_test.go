@@ -0,0 +1,138 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_pmDescription(t *testing.T) {
+	long := strings.Repeat("word ", 60)
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{" 1", "# Title\n\nSome *bold* text\n> with a [link](https://example.com).", "Some bold text with a link."},
+		{" 2", "Just one line", "Just one line"},
+		{" 3", "# Only a title\n", ""},
+		{" 4", long, strings.TrimSpace(long[:pmDescriptionLen-1]) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pmDescription([]byte(tt.md)); got != tt.want {
+				t.Errorf("pmDescription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_pmDescription()
+
+func Test_pmImage(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{" 1", "text ![alt](/attachments/1/a.png) ![b](/b.png)", "/attachments/1/a.png"},
+		{" 2", "> [![page](/img/shot.png)](https://example.com)", "/img/shot.png"},
+		{" 3", `<p><img alt="x" src="https://cdn.example.org/x.jpg"></p> ![y](/y.png)`, "https://cdn.example.org/x.jpg"},
+		{" 4", "[a link](https://example.com)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pmImage([]byte(tt.md)); got != tt.want {
+				t.Errorf("pmImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_pmImage()
+
+func Test_pmAbsURL(t *testing.T) {
+	base := "https://blog.example.com"
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{" 1", "/img/a.png", base + "/img/a.png"},
+		{" 2", "img/a.png", base + "/img/a.png"},
+		{" 3", "https://x.org/a.png", "https://x.org/a.png"},
+		{" 4", "//x.org/a.png", "https://x.org/a.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pmAbsURL(tt.url, base); got != tt.want {
+				t.Errorf("pmAbsURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+} // Test_pmAbsURL()
+
+func TestTPageHandler_postingMeta(t *testing.T) {
+	ph := prepAPITest(t)
+	oldURL := AppArgs.PublicURL
+	AppArgs.PublicURL = "https://blog.example.com"
+	t.Cleanup(func() {
+		AppArgs.PublicURL = oldURL
+	})
+
+	p := NewPosting(0, "# Sharing \"links\"\n\nA <preview> of ![shot](/img/shot.png) for everybody.")
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer p.Delete()
+
+	rec := httptest.NewRecorder()
+	ph.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/p/"+p.IDstr(), nil))
+	page := rec.Body.String()
+	if http.StatusOK != rec.Code {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	url := AppArgs.PublicURL + "/p/" + p.IDstr()
+	for _, want := range []string{
+		`<meta property="og:title" content="Sharing &#34;links&#34;">`,
+		`<meta property="og:url" content="` + url + `">`,
+		`<meta property="og:image" content="https://blog.example.com/img/shot.png">`,
+		`<meta property="og:description" content="A &lt;preview&gt; of shot for everybody.">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+		`<link rel="canonical" href="` + url + `">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page misses %s", want)
+		}
+	}
+
+	match := regexp.MustCompile(`(?s)<script type="application/ld\+json">(.*?)</script>`).FindStringSubmatch(page)
+	if nil == match {
+		t.Fatal("page misses JSON-LD")
+	}
+	var ld map[string]any
+	if err := json.Unmarshal([]byte(match[1]), &ld); nil != err {
+		t.Fatalf("invalid JSON-LD: %v\n%s", err, match[1])
+	}
+	if ("BlogPosting" != ld["@type"]) || (`Sharing "links"` != ld["headline"]) || (url != ld["url"]) {
+		t.Errorf("JSON-LD = %v", ld)
+	}
+
+	// other pages don't carry a posting's metadata
+	rec = httptest.NewRecorder()
+	ph.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/n/", nil))
+	if strings.Contains(rec.Body.String(), `og:title`) {
+		t.Error("index page has posting metadata")
+	}
+} // TestTPageHandler_postingMeta()
+
+/* _EoF_ */
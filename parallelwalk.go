@@ -0,0 +1,274 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+type (
+	// `tPostHeap` is a min-heap of postings ordered by their IDs,
+	// i.e. with the oldest posting on top (see [heap.Interface]).
+	tPostHeap []TPosting
+
+	// `TProgressFunc` is called by [WalkParallel] after each
+	// processed posting.
+	//
+	// The calls are serialised, so an implementation doesn't need
+	// any locking of its own.
+	//
+	// Parameters:
+	//	- `aDone`: The number of postings processed so far.
+	//	- `aFailed`: The number of callbacks that returned an error.
+	//	- `aTotal`: The (estimated) total number of postings.
+	TProgressFunc func(aDone, aFailed, aTotal int)
+)
+
+// `WalkParallel()` visits all existing postings calling `aWalkFunc`
+// for each of them with at most `aWorkers` calls in flight.
+//
+// Postings are handed out in the order the persistence layer's
+// `WalkContext()` provides them (i.e. newest first) but, due to the
+// concurrent processing, `aWalkFunc` can't rely on any order.
+//
+// If `aWalkFunc` returns `ErrSkipAll` no further postings are handed
+// out, the callbacks already running are allowed to finish, and the
+// walk returns without an error.
+// All other errors returned by `aWalkFunc` don't stop the walk but
+// get collected and returned together (see [errors.Join]).
+//
+// Parameters:
+//   - `aCtx`: The context to observe; cancelling it stops the walk.
+//   - `aWorkers`: The max. number of concurrent callbacks; if less than `1` the number of CPUs is used.
+//   - `aWalkFunc`: The function to call for each posting.
+//   - `aProgress`: An optional function to report the walk's progress (may be `nil`).
+//
+// Returns:
+//   - `error`: The aggregated errors of the walk, or `nil` on success.
+func WalkParallel(aCtx context.Context, aWorkers int, aWalkFunc TWalkFunc, aProgress TProgressFunc) error {
+	return walkParallel(aCtx, poPersistence, aWorkers, aWalkFunc, aProgress)
+} // WalkParallel()
+
+// `Len()` is part of [heap.Interface].
+func (ph tPostHeap) Len() int {
+	return len(ph)
+} // Len()
+
+// `Less()` is part of [heap.Interface].
+func (ph tPostHeap) Less(i, j int) bool {
+	return ph[i].id < ph[j].id
+} // Less()
+
+// `Pop()` is part of [heap.Interface].
+func (ph *tPostHeap) Pop() any {
+	old := *ph
+	last := len(old) - 1
+	result := old[last]
+	*ph = old[:last]
+
+	return result
+} // Pop()
+
+// `Push()` is part of [heap.Interface].
+func (ph *tPostHeap) Push(aPosting any) {
+	*ph = append(*ph, aPosting.(TPosting))
+} // Push()
+
+// `Swap()` is part of [heap.Interface].
+func (ph tPostHeap) Swap(i, j int) {
+	ph[i], ph[j] = ph[j], ph[i]
+} // Swap()
+
+// `searchParallel()` looks for `aText` in all postings provided by
+// `aPersistence` using [walkParallel].
+//
+// Other than with the sequential walk the offset and limit refer to
+// the matching postings (as with an SQL query), not to all postings
+// visited.
+// With a limit only the newest `aOffset + aLimit` matches are kept
+// while searching, and postings older than all of them aren't even
+// read.
+//
+// A posting that got removed during the search is ignored while any
+// other read error fails the search.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPersistence`: The persistence layer to search.
+//   - `aText`: The (case insensitive) regular expression to look for.
+//   - `aOffset`: The number of matching postings to skip.
+//   - `aLimit`: The max. number of postings to return; `0` means no limit.
+//
+// Returns:
+//   - `*TPostList`: The sorted list of matching postings.
+//   - `error`: A possible error, or `nil` on success.
+func searchParallel(aCtx context.Context, aPersistence IPersistence, aText string, aOffset, aLimit uint) (*TPostList, error) {
+	re, err := regexp.Compile("(?i)" + aText)
+	if nil != err {
+		return nil, se.Wrap(err, 2)
+	}
+
+	var (
+		keep    int       // the max. number of matches to keep; 0: all
+		matches tPostHeap // the newest matches found so far
+		mtx     sync.Mutex
+	)
+	if 0 < aLimit {
+		keep = int(aOffset + aLimit)
+	}
+
+	// `tooOld()` reports whether `aID` can't make it into the result.
+	tooOld := func(aID uint64) bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		return (0 < keep) && (keep <= matches.Len()) && (aID < matches[0].id)
+	} // tooOld()
+
+	wf := func(aID uint64) error {
+		if tooOld(aID) {
+			return nil
+		}
+		post, err := aPersistence.ReadContext(aCtx, aID)
+		if nil != err {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil // removed meanwhile
+			}
+			return err
+		}
+		if !re.Match(post.markdown) {
+			return nil
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		heap.Push(&matches, *post)
+		if (0 < keep) && (keep < matches.Len()) {
+			heap.Pop(&matches) // drop the oldest match
+		}
+
+		return nil
+	} // wf()
+
+	if err = walkParallel(aCtx, aPersistence, 0, wf, nil); nil != err {
+		return nil, err
+	}
+
+	if uint(matches.Len()) <= aOffset {
+		return NewPostList(), nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].id > matches[j].id // newest first
+	})
+	result := TPostList(matches[aOffset:])
+	if (0 < aLimit) && (uint(result.Len()) > aLimit) {
+		result = result[:aLimit]
+	}
+
+	return &result, nil
+} // searchParallel()
+
+// `walkParallel()` implements [WalkParallel] for the given persistence
+// layer.
+//
+// Parameters:
+//   - `aCtx`: The context to observe; cancelling it stops the walk.
+//   - `aPersistence`: The persistence layer to walk.
+//   - `aWorkers`: The max. number of concurrent callbacks.
+//   - `aWalkFunc`: The function to call for each posting.
+//   - `aProgress`: An optional function to report the walk's progress.
+//
+// Returns:
+//   - `error`: The aggregated errors of the walk, or `nil` on success.
+func walkParallel(aCtx context.Context, aPersistence IPersistence, aWorkers int, aWalkFunc TWalkFunc, aProgress TProgressFunc) error {
+	if nil == aPersistence {
+		return se.Wrap(errors.New("no persistence layer"), 1)
+	}
+	if 1 > aWorkers {
+		aWorkers = runtime.NumCPU()
+	}
+	total := 0
+	if nil != aProgress {
+		total = aPersistence.CountContext(aCtx)
+	}
+
+	// `ctx` gets cancelled by an `ErrSkipAll` from any worker:
+	ctx, cancel := context.WithCancel(aCtx)
+	defer cancel()
+
+	var (
+		done, failed int
+		errList      []error
+		mtx          sync.Mutex
+		wg           sync.WaitGroup
+	)
+	idChan := make(chan uint64) // unbuffered: hand out on demand only
+
+	for w := 0; w < aWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range idChan {
+				if nil != ctx.Err() {
+					continue // drain the channel without further work
+				}
+				err := aWalkFunc(id)
+
+				mtx.Lock()
+				done++
+				if errors.Is(err, ErrSkipAll) {
+					cancel()
+				} else if nil != err {
+					failed++
+					errList = append(errList, fmt.Errorf("%s: %w", id2str(id), err))
+				}
+				if nil != aProgress {
+					aProgress(done, failed, total)
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	err := aPersistence.WalkContext(ctx, func(aID uint64) error {
+		select {
+		case idChan <- aID:
+			return nil
+		case <-ctx.Done():
+			return ErrSkipAll
+		}
+	})
+	close(idChan)
+	wg.Wait()
+
+	if (nil != err) && (nil == aCtx.Err()) && errors.Is(err, context.Canceled) {
+		err = nil // cancelled by a worker's `ErrSkipAll`
+	}
+	if nil != err {
+		errList = append(errList, err)
+	} else if err = aCtx.Err(); nil != err {
+		// the caller's context got cancelled before any worker noticed
+		errList = append(errList, se.Wrap(err, 1))
+	}
+
+	return errors.Join(errList...)
+} // walkParallel()
+
+/* _EoF_ */
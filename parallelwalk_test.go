@@ -0,0 +1,209 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+// `tVanishingStore` is a persistence layer whose posting `goneID`
+// got removed after being listed.
+type tVanishingStore struct {
+	IPersistence
+	goneID uint64
+}
+
+func (vs tVanishingStore) ReadContext(aCtx context.Context, aID uint64) (*TPosting, error) {
+	if vs.goneID == aID {
+		return nil, se.Wrap(os.ErrNotExist, 1)
+	}
+
+	return vs.IPersistence.ReadContext(aCtx, aID)
+} // ReadContext()
+
+// `prepWalkTest()` returns a fake S3 storage with `aNum` postings.
+func prepWalkTest(t *testing.T, aNum int) (*TS3persistence, []uint64) {
+	t.Helper()
+
+	s3p, _ := prepS3Test(t, 0)
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	ids := make([]uint64, 0, aNum)
+	for i := 0; i < aNum; i++ {
+		id := time2id(base.Add(time.Duration(i) * time.Hour))
+		if _, err := s3p.Create(NewPosting(id, fmt.Sprintf("posting #%d", i%3))); nil != err {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	return s3p, ids
+} // prepWalkTest()
+
+func Test_walkParallel_bounded(t *testing.T) {
+	s3p, ids := prepWalkTest(t, 24)
+
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{" 1", 1},
+		{" 2", 3},
+		{" 3", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight, visited atomic.Int32
+			wf := func(aID uint64) error {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					m := maxInFlight.Load()
+					if (n <= m) || maxInFlight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				visited.Add(1)
+
+				return nil
+			} // wf()
+
+			lastDone, lastTotal := 0, 0
+			progress := func(aDone, aFailed, aTotal int) {
+				lastDone, lastTotal = aDone, aTotal
+			}
+			if err := walkParallel(context.Background(), s3p, tt.workers, wf, progress); nil != err {
+				t.Fatalf("walkParallel() error = %v", err)
+			}
+			if got := int(visited.Load()); len(ids) != got {
+				t.Errorf("walkParallel() visited = %d, want %d", got, len(ids))
+			}
+			if got := int(maxInFlight.Load()); tt.workers < got {
+				t.Errorf("walkParallel() in flight = %d, want <= %d", got, tt.workers)
+			}
+			if (len(ids) != lastDone) || (len(ids) != lastTotal) {
+				t.Errorf("walkParallel() progress = %d/%d, want %d/%d",
+					lastDone, lastTotal, len(ids), len(ids))
+			}
+		})
+	}
+} // Test_walkParallel_bounded()
+
+func Test_walkParallel_errors(t *testing.T) {
+	s3p, ids := prepWalkTest(t, 12)
+	errBad := errors.New("bad posting")
+	bad := map[uint64]bool{ids[1]: true, ids[5]: true, ids[10]: true}
+
+	var visited atomic.Int32
+	failed := 0
+	err := walkParallel(context.Background(), s3p, 4, func(aID uint64) error {
+		visited.Add(1)
+		if bad[aID] {
+			return errBad
+		}
+		return nil
+	}, func(aDone, aFailed, aTotal int) {
+		failed = aFailed
+	})
+	if !errors.Is(err, errBad) {
+		t.Errorf("walkParallel() error = %v, want %v", err, errBad)
+	}
+	if len(bad) != failed {
+		t.Errorf("walkParallel() failed = %d, want %d", failed, len(bad))
+	}
+	if got := int(visited.Load()); len(ids) != got {
+		t.Errorf("walkParallel() visited = %d, want %d", got, len(ids))
+	}
+
+	// `ErrSkipAll` stops the walk without an error:
+	visited.Store(0)
+	err = walkParallel(context.Background(), s3p, 2, func(aID uint64) error {
+		if 3 <= visited.Add(1) {
+			return ErrSkipAll
+		}
+		return nil
+	}, nil)
+	if nil != err {
+		t.Errorf("walkParallel() ErrSkipAll: error = %v", err)
+	}
+	if got := int(visited.Load()); len(ids) <= got {
+		t.Errorf("walkParallel() ErrSkipAll: visited = %d, want < %d", got, len(ids))
+	}
+
+	// a cancelled context is reported:
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = walkParallel(ctx, s3p, 2, func(uint64) error { return nil }, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("walkParallel() cancelled: error = %v, want %v", err, context.Canceled)
+	}
+} // Test_walkParallel_errors()
+
+func Test_searchParallel(t *testing.T) {
+	s3p, ids := prepWalkTest(t, 12) // four postings each of #0, #1, #2
+
+	tests := []struct {
+		name   string
+		text   string
+		offset uint
+		limit  uint
+		want   int
+	}{
+		{" 1", `#1`, 0, 0, 4},
+		{" 2", `#1`, 1, 0, 3},
+		{" 3", `#1`, 1, 2, 2},
+		{" 4", `#1`, 4, 0, 0},
+		{" 5", `posting`, 0, 5, 5},
+		{" 6", `nothing`, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := searchParallel(context.Background(), s3p, tt.text, tt.offset, tt.limit)
+			if nil != err {
+				t.Fatalf("searchParallel() error = %v", err)
+			}
+			if tt.want != got.Len() {
+				t.Errorf("searchParallel() = %d, want %d", got.Len(), tt.want)
+			}
+			if !got.IsSorted() {
+				t.Errorf("searchParallel() result not sorted")
+			}
+		})
+	}
+
+	if _, err := searchParallel(context.Background(), s3p, `[`, 0, 0); nil == err {
+		t.Errorf("searchParallel() invalid RegEx: expected error")
+	}
+
+	// the newest matches of `#1` are the postings 10, 7, 4, 1
+	got, err := searchParallel(context.Background(), s3p, `#1`, 1, 2)
+	if (nil != err) || (2 != got.Len()) ||
+		(ids[7] != (*got)[0].id) || (ids[4] != (*got)[1].id) {
+		t.Errorf("searchParallel() = %v, %v, want [%d %d]", got, err, ids[7], ids[4])
+	}
+
+	fs := tFailingStore{s3p, ids[5], 0, new(atomic.Int32)}
+	if _, err := searchParallel(context.Background(), fs, `posting`, 0, 0); nil == err {
+		t.Errorf("searchParallel() unreadable posting: expected error")
+	}
+	vs := tVanishingStore{s3p, ids[6]}
+	if got, err := searchParallel(context.Background(), vs, `posting`, 0, 0); (nil != err) || (11 != got.Len()) {
+		t.Errorf("searchParallel() removed posting = %v, %v, want 11", got, err)
+	}
+} // Test_searchParallel()
+
+/* _EoF_ */
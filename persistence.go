@@ -8,6 +8,7 @@ Copyright © 2024 M.Watermann, 10247 Berlin, Germany
 package nele
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -174,6 +175,81 @@ type (
 		// Returns:
 		//	- `error`: a possible error occurring the traversal process.
 		Walk(aWalkFunc TWalkFunc) error
+
+		//
+		// The following methods are the context-aware variants of the
+		// methods above. They behave the same way but abort (returning
+		// the context's error) as soon as `aCtx` is cancelled or its
+		// deadline is exceeded.
+		//
+
+		// `CountContext()` is the context-aware variant of `Count()`.
+		CountContext(aCtx context.Context) int
+
+		// `CreateContext()` is the context-aware variant of `Create()`.
+		CreateContext(aCtx context.Context, aPost *TPosting) (int, error)
+
+		// `DeleteContext()` is the context-aware variant of `Delete()`.
+		DeleteContext(aCtx context.Context, aID uint64) error
+
+		// `ExistsContext()` is the context-aware variant of `Exists()`.
+		ExistsContext(aCtx context.Context, aID uint64) bool
+
+		// `ReadContext()` is the context-aware variant of `Read()`.
+		ReadContext(aCtx context.Context, aID uint64) (*TPosting, error)
+
+		// `RenameContext()` is the context-aware variant of `Rename()`.
+		RenameContext(aCtx context.Context, aOldID, aNewID uint64) error
+
+		// `SearchContext()` is the context-aware variant of `Search()`.
+		SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error)
+
+		// `UpdateContext()` is the context-aware variant of `Update()`.
+		UpdateContext(aCtx context.Context, aPost *TPosting) (int, error)
+
+		// `WalkContext()` is the context-aware variant of `Walk()`.
+		//
+		// The traversal stops before the next posting is visited if
+		// `aCtx` gets cancelled.
+		WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error
+	}
+
+	// `IHTMLstore` is an optional extension of `IPersistence`
+	// implemented by persistence layers able to keep the rendered
+	// HTML of a posting next to its Markdown text.
+	//
+	// A stored page is only valid for the posting's text version
+	// identified by its last modification time and the renderer
+	// which produced it.
+	IHTMLstore interface {
+		//
+		// `ReadHTML()` returns the stored HTML of the posting `aID`.
+		//
+		// Parameters:
+		//	- `aID`: The unique identifier of the posting.
+		//	- `aLastModified`: The posting's last modification time.
+		//	- `aRenderer`: The identifier of the Markdown renderer.
+		//
+		// Returns:
+		//	- `[]byte`: The posting's HTML.
+		//	- `bool`: Whether a valid HTML page was found.
+		ReadHTML(aID uint64, aLastModified time.Time, aRenderer string) ([]byte, bool)
+
+		//
+		// `StoreHTML()` stores the HTML rendered from the posting `aID`.
+		//
+		// Nothing is stored if `aLastModified` doesn't match the
+		// persistent posting's last modification time.
+		//
+		// Parameters:
+		//	- `aID`: The unique identifier of the posting.
+		//	- `aLastModified`: The posting's last modification time.
+		//	- `aRenderer`: The identifier of the Markdown renderer.
+		//	- `aHTML`: The HTML to store.
+		//
+		// Returns:
+		//	- `error`: A possible error, or `nil` on success.
+		StoreHTML(aID uint64, aLastModified time.Time, aRenderer string, aHTML []byte) error
 	}
 )
 
@@ -229,6 +305,7 @@ func PostingBaseDirectory() string {
 //   - `aPersistence`: The persistence layer to use for storing/retrieving postings.
 func SetPersistence(aPersistence IPersistence) {
 	poPersistence = aPersistence
+	wlIndex.reset()
 } // SetPersistence()
 
 // `SetPostingBaseDirectory()` sets the base directory used for
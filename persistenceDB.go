@@ -52,6 +52,16 @@ type (
 		Rename(aOldID, aNewID uint64) error
 		Search(aText string, aOffset, aLimit uint) (*TPostList, error)
 		Walk(aWalkFunc TWalkFunc) error
+
+		CountContext(aCtx context.Context) int
+		CreateContext(aCtx context.Context, aPost *TPosting) (int, error)
+		DeleteContext(aCtx context.Context, aID uint64) error
+		ExistsContext(aCtx context.Context, aID uint64) bool
+		ReadContext(aCtx context.Context, aID uint64) (*TPosting, error)
+		RenameContext(aCtx context.Context, aOldID, aNewID uint64) error
+		SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error)
+		UpdateContext(aCtx context.Context, aPost *TPosting) (int, error)
+		WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error
 	}
 )
 */
@@ -172,6 +182,7 @@ func init() {
 	var (
 		_ IPersistence = TDBpersistence{}
 		_ IPersistence = (*TDBpersistence)(nil)
+		_ IHTMLstore   = TDBpersistence{}
 	)
 } // init()
 
@@ -186,6 +197,16 @@ const dbInitTable = `
 	);
 `
 
+// The SQL statement to create the table of rendered postings
+const dbInitHTMLTable = `
+	CREATE TABLE IF NOT EXISTS "html" (
+		"id" INTEGER PRIMARY KEY,
+		"lastModified" INTEGER NOT NULL,
+		"renderer" TEXT NOT NULL,
+		"html" TEXT NOT NULL
+	);
+`
+
 // `initDatabase()` initialises a new SQLite database connection and
 // checks whether it supports full-text search (FTS5).
 //
@@ -225,11 +246,15 @@ func initDatabase(aPathFile string) (*sql.DB, bool, error) {
 		return nil, false, se.Wrap(err, 3)
 	}
 
-	// Create the table
+	// Create the tables
 	if _, err = db.Exec(dbInitTable); err != nil {
 		db.Close()
 		return nil, false, se.Wrap(err, 2)
 	}
+	if _, err = db.Exec(dbInitHTMLTable); err != nil {
+		db.Close()
+		return nil, false, se.Wrap(err, 2)
+	}
 
 	// Check and add FTS5 database
 	hasFTS, err := initFTS5(db)
@@ -310,17 +335,28 @@ const dbGetCount = `SELECT COUNT(*) FROM postings`
 // Returns:
 //   - `int`: The number of available postings, or `0` in case of errors.
 func (dbp TDBpersistence) Count() int {
-	var result int
-
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
 	defer cancel()
 
-	if err := dbp.db.QueryRowContext(ctx, dbGetCount).Scan(&result); err != nil {
+	return dbp.CountContext(ctx)
+} // Count()
+
+// `CountContext()` returns the number of postings currently available.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `int`: The number of available postings, or `0` in case of errors.
+func (dbp TDBpersistence) CountContext(aCtx context.Context) int {
+	var result int
+
+	if err := dbp.db.QueryRowContext(aCtx, dbGetCount).Scan(&result); err != nil {
 		return 0 //, fmt.Errorf("error counting rows: %v", err)
 	}
 
 	return result
-} // Count()
+} // CountContext()
 
 const dbCreateRow = `INSERT INTO postings(id, lastModifies, markdown) VALUES(?, ?, ?)`
 
@@ -336,6 +372,23 @@ const dbCreateRow = `INSERT INTO postings(id, lastModifies, markdown) VALUES(?,
 //   - `int`: The number of bytes stored.
 //   - 'error`:` A possible error, or `nil` on success.
 func (dbp TDBpersistence) Create(aPost *TPosting) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
+	defer cancel()
+
+	return dbp.CreateContext(ctx, aPost)
+} // Create()
+
+// `CreateContext()` creates a new posting in the database
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPost`: The `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes stored.
+//   - 'error`:` A possible error, or `nil` on success.
+func (dbp TDBpersistence) CreateContext(aCtx context.Context, aPost *TPosting) (int, error) {
 	if nil == aPost {
 		return 0, se.Wrap(ErrEmptyPosting, 1)
 	}
@@ -346,10 +399,7 @@ func (dbp TDBpersistence) Create(aPost *TPosting) (int, error) {
 	dbLM := time2dbInt(aPost.lastModified)
 	dbText := string(aPost.markdown)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
-	defer cancel()
-
-	result, err := dbp.db.ExecContext(ctx, dbCreateRow, dbID, dbLM, dbText)
+	result, err := dbp.db.ExecContext(aCtx, dbCreateRow, dbID, dbLM, dbText)
 	if err != nil {
 		return 0, se.Wrap(err, 3)
 	}
@@ -361,9 +411,13 @@ func (dbp TDBpersistence) Create(aPost *TPosting) (int, error) {
 	return int(unsafe.Sizeof(aPost.id)) +
 		int(unsafe.Sizeof(aPost.lastModified)) +
 		aPost.Len(), nil
-} // Create()
+} // CreateContext()
+
+const (
+	dbDeleteRow = `DELETE FROM postings WHERE id = ?`
 
-const dbDeleteRow = `DELETE FROM postings WHERE id = ?`
+	dbDeleteHTML = `DELETE FROM html WHERE id = ?`
+)
 
 // `Delete()` removes the posting/article from the filesystem
 // and returns a possible I/O error.
@@ -377,14 +431,27 @@ const dbDeleteRow = `DELETE FROM postings WHERE id = ?`
 // Side Effects:
 //   - Invalidates the internal count cache.
 func (dbp TDBpersistence) Delete(aID uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
+	defer cancel()
+
+	return dbp.DeleteContext(ctx, aID)
+} // Delete()
+
+// `DeleteContext()` removes the posting/article from the database
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to delete.
+//
+// Returns:
+//   - 'error`: A possible I/O error, or `nil` on success.
+func (dbp TDBpersistence) DeleteContext(aCtx context.Context, aID uint64) error {
 	dbp.mtx.Lock()
 	defer dbp.mtx.Unlock()
 
 	dbID := id2dbInt(aID)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
-	defer cancel()
-
-	res, err := dbp.db.ExecContext(ctx, dbDeleteRow, dbID)
+	res, err := dbp.db.ExecContext(aCtx, dbDeleteRow, dbID)
 	if err != nil {
 		return se.Wrap(err, 2)
 	}
@@ -398,9 +465,10 @@ func (dbp TDBpersistence) Delete(aID uint64) error {
 	if 0 == rowsAffected {
 		return fmt.Errorf("no rows deleted")
 	}
+	_, _ = dbp.db.ExecContext(aCtx, dbDeleteHTML, dbID)
 
 	return nil
-} // Delete()
+} // DeleteContext()
 
 const dbExistRow = `SELECT EXISTS(SELECT 1 FROM postings WHERE id = ?)`
 
@@ -414,19 +482,32 @@ const dbExistRow = `SELECT EXISTS(SELECT 1 FROM postings WHERE id = ?)`
 // Returns:
 //   - `bool`: `true` if the file exists, `false` otherwise.
 func (dbp TDBpersistence) Exists(aID uint64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
+	defer cancel()
+
+	return dbp.ExistsContext(ctx, aID)
+} // Exists()
+
+// `ExistsContext()` checks if a record with the given ID exists in
+// the database observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to check.
+//
+// Returns:
+//   - `bool`: `true` if the record exists, `false` otherwise.
+func (dbp TDBpersistence) ExistsContext(aCtx context.Context, aID uint64) bool {
 	dbp.mtx.RLock()
 	defer dbp.mtx.RUnlock()
 
 	var result bool
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
-	defer cancel()
-
-	if err := dbp.db.QueryRowContext(ctx, dbExistRow, aID).Scan(&result); err != nil {
+	if err := dbp.db.QueryRowContext(aCtx, dbExistRow, aID).Scan(&result); err != nil {
 		return false
 	}
 
 	return result
-} // Exists()
+} // ExistsContext()
 
 // `PathFileName()` returns the posting's complete path-/filename.
 //
@@ -454,6 +535,22 @@ const dbReadRow = `SELECT id, lastModified, markdown FROM postings WHERE id = ?`
 //   - `*TPosting`: The `TPosting` instance containing the article's data, or `nil` if the record doesn't exist.
 //   - 'error`: A possible I/O error, or `nil` on success.
 func (dbp TDBpersistence) Read(aID uint64) (*TPosting, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
+	defer cancel()
+
+	return dbp.ReadContext(ctx, aID)
+} // Read()
+
+// `ReadContext()` reads the posting from the database observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to be read.
+//
+// Returns:
+//   - `*TPosting`: The `TPosting` instance containing the article's data, or `nil` if the record doesn't exist.
+//   - 'error`: A possible I/O error, or `nil` on success.
+func (dbp TDBpersistence) ReadContext(aCtx context.Context, aID uint64) (*TPosting, error) {
 	dbp.mtx.RLock()
 	defer dbp.mtx.RUnlock()
 
@@ -461,10 +558,7 @@ func (dbp TDBpersistence) Read(aID uint64) (*TPosting, error) {
 		dbID, dbLM int64
 		dbText     string
 	)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
-	defer cancel()
-
-	err := dbp.db.QueryRowContext(ctx, dbReadRow, id2dbInt(aID)).
+	err := dbp.db.QueryRowContext(aCtx, dbReadRow, id2dbInt(aID)).
 		Scan(&dbID, &dbLM, &dbText)
 	if err != nil {
 		return nil, se.Wrap(err, 3)
@@ -476,7 +570,38 @@ func (dbp TDBpersistence) Read(aID uint64) (*TPosting, error) {
 		markdown:     []byte(dbText),
 	}
 	return post, nil
-} // Read()
+} // ReadContext()
+
+const dbReadHTML = `SELECT html FROM html WHERE id = ? AND lastModified = ? AND renderer = ?`
+
+// `ReadHTML()` returns the stored HTML of the posting `aID`.
+//
+// The HTML is only returned if it was rendered by `aRenderer`
+// from the posting's version of `aLastModified`.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting.
+//   - `aLastModified`: The posting's last modification time.
+//   - `aRenderer`: The identifier of the Markdown renderer.
+//
+// Returns:
+//   - `[]byte`: The posting's HTML.
+//   - `bool`: Whether a valid HTML page was found.
+func (dbp TDBpersistence) ReadHTML(aID uint64, aLastModified time.Time, aRenderer string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
+	defer cancel()
+	dbp.mtx.RLock()
+	defer dbp.mtx.RUnlock()
+
+	var dbHTML string
+	err := dbp.db.QueryRowContext(ctx, dbReadHTML, id2dbInt(aID),
+		time2dbInt(aLastModified), aRenderer).Scan(&dbHTML)
+	if nil != err {
+		return nil, false
+	}
+
+	return []byte(dbHTML), true
+} // ReadHTML()
 
 const dbRenameRow = `UPDATE postings SET id = ? WHERE id = ?"`
 
@@ -489,14 +614,28 @@ const dbRenameRow = `UPDATE postings SET id = ? WHERE id = ?"`
 // Returns:
 //   - `error`: An error if the operation fails, or `nil` on success.
 func (dbp TDBpersistence) Rename(aOldID, aNewID uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
+	defer cancel()
+
+	return dbp.RenameContext(ctx, aOldID, aNewID)
+} // Rename()
+
+// `RenameContext()` renames a posting from its old ID to a new ID
+// observing `aCtx`.
+//
+// Parameters:
+//   - aCtx: The context to observe.
+//   - aOldID: The unique identifier of the posting to be renamed.
+//   - aNewID: The new unique identifier for the new posting.
+//
+// Returns:
+//   - `error`: An error if the operation fails, or `nil` on success.
+func (dbp TDBpersistence) RenameContext(aCtx context.Context, aOldID, aNewID uint64) error {
 	dbp.mtx.Lock()
 	defer dbp.mtx.Unlock()
 
 	dbOldID, dbNewID := id2dbInt(aOldID), id2dbInt(aNewID)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
-	defer cancel()
-
-	result, err := dbp.db.ExecContext(ctx, dbRenameRow, dbNewID, dbOldID)
+	result, err := dbp.db.ExecContext(aCtx, dbRenameRow, dbNewID, dbOldID)
 	if err != nil {
 		return se.Wrap(err, 2)
 	}
@@ -505,9 +644,11 @@ func (dbp TDBpersistence) Rename(aOldID, aNewID uint64) error {
 	if _, err = result.RowsAffected(); err != nil {
 		return se.Wrap(err, 1)
 	}
+	// the rendered HTML is re-created on demand
+	_, _ = dbp.db.ExecContext(aCtx, dbDeleteHTML, dbOldID)
 
 	return nil
-} // Rename()
+} // RenameContext()
 
 const (
 	dbSearchLIKE = `SELECT id, lastModified, markup FROM postings WHERE markup LIKE ? LIMIT ? OFFSET ? ORDER BY id DESC`
@@ -537,6 +678,25 @@ const (
 //   - `*TPostList`: The list of search results, or `nil` in case of errors.
 //   - `error`: If the search operation fails, or `nil` on success.
 func (dbp TDBpersistence) Search(aText string, aOffset, aLimit uint) (*TPostList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
+	defer cancel()
+
+	return dbp.SearchContext(ctx, aText, aOffset, aLimit)
+} // Search()
+
+// `SearchContext()` retrieves a list of postings based on a search term
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aText`: The search query string.
+//   - `aOffset`: An offset in the database result set of the search results.
+//   - `aLimit`: The maximum number of search results to return.
+//
+// Returns:
+//   - `*TPostList`: The list of search results, or `nil` in case of errors.
+//   - `error`: If the search operation fails, or `nil` on success.
+func (dbp TDBpersistence) SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error) {
 	dbp.mtx.RLock()
 	defer dbp.mtx.RUnlock()
 
@@ -555,10 +715,7 @@ func (dbp TDBpersistence) Search(aText string, aOffset, aLimit uint) (*TPostList
 		aText = fmt.Sprintf("%%%s%%", aText)
 		search = dbSearchLIKE
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
-	defer cancel()
-
-	if rows, err = dbp.db.QueryContext(ctx, search, aText, aLimit, aOffset); err != nil {
+	if rows, err = dbp.db.QueryContext(aCtx, search, aText, aLimit, aOffset); err != nil {
 		return nil, se.Wrap(err, 1)
 	}
 	defer rows.Close()
@@ -585,7 +742,38 @@ func (dbp TDBpersistence) Search(aText string, aOffset, aLimit uint) (*TPostList
 	}
 
 	return postlist, nil
-} // Search()
+} // SearchContext()
+
+// The HTML is only stored for the current version of the posting.
+const dbStoreHTML = `INSERT OR REPLACE INTO html(id, lastModified, renderer, html)
+	SELECT id, lastModified, ?, ? FROM postings WHERE id = ? AND lastModified = ?`
+
+// `StoreHTML()` stores the HTML rendered from the posting `aID`.
+//
+// Nothing is stored if `aLastModified` doesn't match the posting's
+// last modification time in the database.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting.
+//   - `aLastModified`: The posting's last modification time.
+//   - `aRenderer`: The identifier of the Markdown renderer.
+//   - `aHTML`: The HTML to store.
+//
+// Returns:
+//   - `error`: A possible error, or `nil` on success.
+func (dbp TDBpersistence) StoreHTML(aID uint64, aLastModified time.Time, aRenderer string, aHTML []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<1)
+	defer cancel()
+	dbp.mtx.Lock()
+	defer dbp.mtx.Unlock()
+
+	if _, err := dbp.db.ExecContext(ctx, dbStoreHTML, aRenderer,
+		string(aHTML), id2dbInt(aID), time2dbInt(aLastModified)); nil != err {
+		return se.Wrap(err, 2)
+	}
+
+	return nil
+} // StoreHTML()
 
 const dbUpdateRow = `UPDATE postings SET lastModified = ?, markdown = ? WHERE id = ?"`
 
@@ -606,16 +794,33 @@ const dbUpdateRow = `UPDATE postings SET lastModified = ?, markdown = ? WHERE id
 // Side Effects:
 //   - Invalidates the internal count cache.
 func (dbp TDBpersistence) Update(aPost *TPosting) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
+	defer cancel()
+
+	return dbp.UpdateContext(ctx, aPost)
+} // Update()
+
+// `UpdateContext()` updates the article's Markdown in the database
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPost`: A `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes written to the file.
+//   - 'error`:` A possible I/O error, or `nil` on success.
+func (dbp TDBpersistence) UpdateContext(aCtx context.Context, aPost *TPosting) (int, error) {
+	if nil == aPost {
+		return 0, se.Wrap(ErrEmptyPosting, 1)
+	}
 	dbp.mtx.Lock()
 	defer dbp.mtx.Unlock()
 
 	dbID := id2dbInt(aPost.id)
 	dbLM := time2dbInt(aPost.lastModified)
 	dbText := string(aPost.markdown)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<2)
-	defer cancel()
-
-	result, err := dbp.db.ExecContext(ctx, dbUpdateRow, dbLM, dbText, dbID)
+	result, err := dbp.db.ExecContext(aCtx, dbUpdateRow, dbLM, dbText, dbID)
 	if err != nil {
 		return 0, se.Wrap(err, 2)
 	}
@@ -628,7 +833,7 @@ func (dbp TDBpersistence) Update(aPost *TPosting) (int, error) {
 	return int(unsafe.Sizeof(aPost.id)) +
 		int(unsafe.Sizeof(aPost.lastModified)) +
 		aPost.Len(), nil
-} // Update()
+} // UpdateContext()
 
 const dbWalkRows = `SELECT id FROM postings ORDER BY id DESC;`
 
@@ -644,7 +849,23 @@ func (dbp TDBpersistence) Walk(aWalkFunc TWalkFunc) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second<<3)
 	defer cancel()
 
-	rows, err := dbp.db.QueryContext(ctx, dbWalkRows)
+	return dbp.WalkContext(ctx, aWalkFunc)
+} // Walk()
+
+// `WalkContext()` visits all existing postings, calling `aWalkFunc`
+// for each posting.
+//
+// The traversal is aborted as soon as `aCtx` is done; in that case
+// the context's error is returned.
+//
+// Parameters:
+//   - `aCtx`: The context to observe during the traversal.
+//   - `aWalkFunc`: The function to call for each posting.
+//
+// Returns:
+//   - `error`: a possible error occurring the traversal process.
+func (dbp TDBpersistence) WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error {
+	rows, err := dbp.db.QueryContext(aCtx, dbWalkRows)
 	if err != nil {
 		return se.Wrap(err, 2)
 	}
@@ -661,6 +882,9 @@ dirLoop: // Iterate over rows
 		}
 		id := dbInt2id(dbID)
 
+		if err := aCtx.Err(); nil != err {
+			return se.Wrap(err, 1)
+		}
 		if err := aWalkFunc(id); nil != err {
 			if errors.Is(err, ErrSkipAll) {
 				break dirLoop
@@ -675,6 +899,6 @@ dirLoop: // Iterate over rows
 	}
 
 	return nil
-} // Walk()
+} // WalkContext()
 
 /* _EoF_ */
@@ -9,6 +9,7 @@ package nele
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -51,6 +52,16 @@ type (
 		Rename(aOldID, aNewID uint64) error
 		Search(aText string, aOffset, aLimit uint) (*TPostList, error)
 		Walk(aWalkFunc TWalkFunc) error
+
+		CountContext(aCtx context.Context) int
+		CreateContext(aCtx context.Context, aPost *TPosting) (int, error)
+		DeleteContext(aCtx context.Context, aID uint64) error
+		ExistsContext(aCtx context.Context, aID uint64) bool
+		ReadContext(aCtx context.Context, aID uint64) (*TPosting, error)
+		RenameContext(aCtx context.Context, aOldID, aNewID uint64) error
+		SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error)
+		UpdateContext(aCtx context.Context, aPost *TPosting) (int, error)
+		WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error
 	}
 )
 */
@@ -187,6 +198,31 @@ func id2filename(aID uint64) string {
 	return path.Join(dir, fname) + `.md`
 } // id2filename()
 
+// `id2htmlname()` returns the name of the file holding the rendered
+// HTML of the posting identified by `aID`.
+//
+// Parameters:
+//   - `aID`: A posting's ID to be converted to a file name.
+//
+// Return Value:
+//   - `string`: The HTML file name based on the provided uint64.
+func id2htmlname(aID uint64) string {
+	return path.Join(id2dir(aID), id2str(aID)) + `.html`
+} // id2htmlname()
+
+// `fsHTMLheader()` returns the first line of a posting's HTML file
+// identifying the text version and the renderer used.
+//
+// Parameters:
+//   - `aLastModified`: The posting's last modification time.
+//   - `aRenderer`: The identifier of the Markdown renderer.
+//
+// Returns:
+//   - `[]byte`: The HTML file's header line.
+func fsHTMLheader(aLastModified time.Time, aRenderer string) []byte {
+	return []byte(fmt.Sprintf("<!-- %s %d -->\n", aRenderer, aLastModified.UnixNano()))
+} // fsHTMLheader()
+
 // `mkDir()` creates the directory for storing an article
 // returning the created directory.
 //
@@ -215,6 +251,7 @@ func init() {
 	var (
 		_ IPersistence = TFSpersistence{}
 		_ IPersistence = (*TFSpersistence)(nil)
+		_ IHTMLstore   = TFSpersistence{}
 	)
 } // init()
 
@@ -247,6 +284,20 @@ func NewFSpersistence() *TFSpersistence {
 // Side Effects:
 //   - Updates the count cache.
 func (fsp TFSpersistence) Count() int {
+	return fsp.CountContext(context.Background())
+} // Count()
+
+// `CountContext()` returns the number of postings currently available.
+//
+// Parameters:
+//   - `aCtx`: The context to observe while counting.
+//
+// Returns:
+//   - `int`: The number of available postings, or `0` in case of errors.
+//
+// Side Effects:
+//   - Updates the count cache.
+func (fsp TFSpersistence) CountContext(aCtx context.Context) int {
 	fsp.mtx.RLock()
 	defer fsp.mtx.RUnlock()
 
@@ -268,6 +319,9 @@ func (fsp TFSpersistence) Count() int {
 		return 0 // we can't recover from this :-(
 	}
 	for _, dName = range dNames {
+		if nil != aCtx.Err() {
+			return 0 // don't cache an incomplete result
+		}
 		if fNames, err = filepath.Glob(dName + `/*.md`); nil == err {
 			result += int32(len(fNames))
 		}
@@ -275,7 +329,7 @@ func (fsp TFSpersistence) Count() int {
 	atomic.StoreInt32(&µCountCache, result)
 
 	return int(result)
-} // Count()
+} // CountContext()
 
 // `Create()` creates a new posting in the filesystem.
 //
@@ -292,20 +346,41 @@ func (fsp TFSpersistence) Count() int {
 // Side Effects:
 //   - Invalidates the internal count cache.
 func (fsp TFSpersistence) Create(aPost *TPosting) (int, error) {
+	return fsp.CreateContext(context.Background(), aPost)
+} // Create()
+
+// `CreateContext()` creates a new posting in the filesystem
+// unless `aCtx` is already done.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPost`: The `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes written to the file.
+//   - 'error`:` A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (fsp TFSpersistence) CreateContext(aCtx context.Context, aPost *TPosting) (int, error) {
 	if nil == aPost {
 		return 0, se.Wrap(ErrEmptyPosting, 1)
 	}
+	if err := aCtx.Err(); nil != err {
+		return 0, se.Wrap(err, 1)
+	}
 	fsp.mtx.Lock()
 	defer fsp.mtx.Unlock()
 
 	return fsp.store(aPost, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
-} // Create()
+} // CreateContext()
 
 // called by [Delete] and [store], both of which are already locked
 func (fsp TFSpersistence) delete(aID uint64) error {
 	err := delFile(id2filename(aID))
 	if nil == err {
 		atomic.StoreInt32(&µCountCache, 0) // invalidate count cache
+		_ = delFile(id2htmlname(aID))
 	}
 
 	return err
@@ -323,11 +398,30 @@ func (fsp TFSpersistence) delete(aID uint64) error {
 // Side Effects:
 //   - Invalidates the internal count cache.
 func (fsp TFSpersistence) Delete(aID uint64) error {
+	return fsp.DeleteContext(context.Background(), aID)
+} // Delete()
+
+// `DeleteContext()` removes the posting/article from the filesystem
+// unless `aCtx` is already done.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to delete.
+//
+// Returns:
+//   - 'error`: A possible I/O error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (fsp TFSpersistence) DeleteContext(aCtx context.Context, aID uint64) error {
+	if err := aCtx.Err(); nil != err {
+		return se.Wrap(err, 1)
+	}
 	fsp.mtx.Lock()
 	defer fsp.mtx.Unlock()
 
 	return fsp.delete(aID)
-} // Delete()
+} // DeleteContext()
 
 // `Exists()` checks if a file with the given ID exists in the filesystem.
 //
@@ -339,6 +433,22 @@ func (fsp TFSpersistence) Delete(aID uint64) error {
 // Returns:
 //   - `bool`: `true` if the file exists, `false` otherwise.
 func (fsp TFSpersistence) Exists(aID uint64) bool {
+	return fsp.ExistsContext(context.Background(), aID)
+} // Exists()
+
+// `ExistsContext()` checks if a file with the given ID exists in the
+// filesystem unless `aCtx` is already done.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to check.
+//
+// Returns:
+//   - `bool`: `true` if the file exists, `false` otherwise.
+func (fsp TFSpersistence) ExistsContext(aCtx context.Context, aID uint64) bool {
+	if nil != aCtx.Err() {
+		return false
+	}
 	fsp.mtx.RLock()
 	defer fsp.mtx.RUnlock()
 
@@ -349,7 +459,7 @@ func (fsp TFSpersistence) Exists(aID uint64) bool {
 	}
 
 	return (0 < fi.Size())
-} // Exists()
+} // ExistsContext()
 
 // `PathFileName()` returns the posting's complete path-/filename.
 //
@@ -375,6 +485,23 @@ func (fsp TFSpersistence) PathFileName(aID uint64) string {
 //   - `*TPosting`: The `TPosting` instance containing the article's data, or `nil` if the file does not exist.
 //   - 'error`: A possible I/O error, or `nil` on success.
 func (fsp TFSpersistence) Read(aID uint64) (*TPosting, error) {
+	return fsp.ReadContext(context.Background(), aID)
+} // Read()
+
+// `ReadContext()` reads the posting from disk unless `aCtx` is
+// already done.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to be read.
+//
+// Returns:
+//   - `*TPosting`: The `TPosting` instance containing the article's data, or `nil` if the file does not exist.
+//   - 'error`: A possible I/O error, or `nil` on success.
+func (fsp TFSpersistence) ReadContext(aCtx context.Context, aID uint64) (*TPosting, error) {
+	if err := aCtx.Err(); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
 	fsp.mtx.Lock()
 	defer fsp.mtx.Unlock()
 
@@ -404,7 +531,36 @@ func (fsp TFSpersistence) Read(aID uint64) (*TPosting, error) {
 	}
 
 	return post, nil
-} // Read()
+} // ReadContext()
+
+// `ReadHTML()` returns the stored HTML of the posting `aID`.
+//
+// The HTML is only returned if it was rendered by `aRenderer`
+// from the posting's version of `aLastModified`.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting.
+//   - `aLastModified`: The posting's last modification time.
+//   - `aRenderer`: The identifier of the Markdown renderer.
+//
+// Returns:
+//   - `[]byte`: The posting's HTML.
+//   - `bool`: Whether a valid HTML page was found.
+func (fsp TFSpersistence) ReadHTML(aID uint64, aLastModified time.Time, aRenderer string) ([]byte, bool) {
+	fsp.mtx.RLock()
+	defer fsp.mtx.RUnlock()
+
+	bs, err := os.ReadFile(id2htmlname(aID)) /* #nosec G304 */
+	if nil != err {
+		return nil, false
+	}
+	header := fsHTMLheader(aLastModified, aRenderer)
+	if !bytes.HasPrefix(bs, header) {
+		return nil, false // outdated page
+	}
+
+	return bs[len(header):], true
+} // ReadHTML()
 
 // `Rename()` renames a posting from its old ID to a new ID.
 //
@@ -415,6 +571,23 @@ func (fsp TFSpersistence) Read(aID uint64) (*TPosting, error) {
 // Returns:
 //   - `error`: An error if the operation fails, or `nil` on success.
 func (fsp TFSpersistence) Rename(aOldID, aNewID uint64) error {
+	return fsp.RenameContext(context.Background(), aOldID, aNewID)
+} // Rename()
+
+// `RenameContext()` renames a posting from its old ID to a new ID
+// unless `aCtx` is already done.
+//
+// Parameters:
+//   - aCtx: The context to observe.
+//   - aOldID: The unique identifier of the posting to be renamed.
+//   - aNewID: The new unique identifier for the new posting.
+//
+// Returns:
+//   - `error`: An error if the operation fails, or `nil` on success.
+func (fsp TFSpersistence) RenameContext(aCtx context.Context, aOldID, aNewID uint64) error {
+	if err := aCtx.Err(); nil != err {
+		return se.Wrap(err, 1)
+	}
 	fsp.mtx.Lock()
 	defer fsp.mtx.Unlock()
 
@@ -436,9 +609,11 @@ func (fsp TFSpersistence) Rename(aOldID, aNewID uint64) error {
 
 		return se.Wrap(err, 4)
 	}
+	// the rendered HTML is re-created on demand
+	_ = delFile(id2htmlname(aOldID))
 
 	return nil
-} // Rename()
+} // RenameContext()
 
 // `Search()` retrieves a list of postings based on a search term.
 //
@@ -458,48 +633,27 @@ func (fsp TFSpersistence) Rename(aOldID, aNewID uint64) error {
 //   - `*TPostList`: The list of search results, or `nil` in case of errors.
 //   - `error`: If the search operation fails, or `nil` on success.
 func (fsp TFSpersistence) Search(aText string, aOffset, aLimit uint) (*TPostList, error) {
-	// fsp.mtx.RLock()
-	// locking here will cause a deadlock because the called
-	// `posting.Load()` method will call our `Read()` method
-	// which in turn wait for a lock as well ...
-	// defer fsp.mtx.RUnlock()
-
-	var lCnt, oCnt uint
-	result := NewPostList()
-	if 0 == aLimit {
-		aLimit = 1 << 15 // 64K
-	}
-
-	wf := func(aID uint64) error {
-		oCnt++
-		if oCnt < aOffset {
-			// starting offset not reached yet
-			return nil
-		}
-		lCnt++
-		if lCnt > aLimit {
-			// reached the requested limit
-			return ErrSkipAll
-		}
-		post := NewPosting(aID, "")
-		if err := post.Load(); nil != err { // this calls `Read()` ...
-			lCnt--
-			return nil
-		}
-
-		re := regexp.MustCompile("(?i)" + aText)
-		if hit := re.Find(post.markdown); nil != hit {
-			result.insert(post)
-		}
-
-		return nil
-	} // wf()
-
-	fsp.Walk(wf)
-
-	return result, nil
+	return fsp.SearchContext(context.Background(), aText, aOffset, aLimit)
 } // Search()
 
+// `SearchContext()` retrieves a list of postings based on a search term.
+//
+// The search is aborted as soon as `aCtx` is done; in that case the
+// context's error is returned.
+//
+// Parameters:
+//   - `aCtx`: The context to observe while searching.
+//   - `aText`: The search query string.
+//   - `aOffset`: The number of matching postings to skip.
+//   - `aLimit`: The maximum number of search results to return.
+//
+// Returns:
+//   - `*TPostList`: The list of search results, or `nil` in case of errors.
+//   - `error`: If the search operation fails, or `nil` on success.
+func (fsp TFSpersistence) SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error) {
+	return searchParallel(aCtx, fsp, aText, aOffset, aLimit)
+} // SearchContext()
+
 // `store()` writes the article's Markdown to disk returning
 // the number of bytes written and a possible I/O error.
 //
@@ -541,6 +695,51 @@ func (fsp TFSpersistence) store(aPost *TPosting, aMode int) (int, error) {
 	return mdFile.Write(aPost.markdown)
 } // store()
 
+// `StoreHTML()` writes the HTML rendered from the posting `aID`
+// next to the posting's Markdown file.
+//
+// Nothing is stored if `aLastModified` doesn't match the posting
+// file's modification time.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting.
+//   - `aLastModified`: The posting's last modification time.
+//   - `aRenderer`: The identifier of the Markdown renderer.
+//   - `aHTML`: The HTML to store.
+//
+// Returns:
+//   - `error`: A possible I/O error, or `nil` on success.
+func (fsp TFSpersistence) StoreHTML(aID uint64, aLastModified time.Time, aRenderer string, aHTML []byte) error {
+	fsp.mtx.Lock()
+	defer fsp.mtx.Unlock()
+
+	fi, err := os.Stat(id2filename(aID))
+	if (nil != err) || !fi.ModTime().Equal(aLastModified) {
+		return nil // no or another version of the posting
+	}
+
+	// Write to a temporary file first so that concurrent readers
+	// never see an incomplete page.
+	tmp, err := os.CreateTemp(id2dir(aID), `.html-*`)
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	tName := tmp.Name()
+	_, err = tmp.Write(append(fsHTMLheader(aLastModified, aRenderer), aHTML...))
+	if cErr := tmp.Close(); nil == err {
+		err = cErr
+	}
+	if nil == err {
+		err = os.Rename(tName, id2htmlname(aID))
+	}
+	if nil != err {
+		_ = os.Remove(tName)
+		return se.Wrap(err, 4)
+	}
+
+	return nil
+} // StoreHTML()
+
 // `Update()` updates the article's Markdown on disk.
 //
 // It returns the number of bytes written to the file and a possible I/O error.
@@ -558,14 +757,34 @@ func (fsp TFSpersistence) store(aPost *TPosting, aMode int) (int, error) {
 // Side Effects:
 // - Invalidates the internal count cache.
 func (fsp TFSpersistence) Update(aPost *TPosting) (int, error) {
+	return fsp.UpdateContext(context.Background(), aPost)
+} // Update()
+
+// `UpdateContext()` updates the article's Markdown on disk unless
+// `aCtx` is already done.
+//
+// Parameters:
+// - `aCtx`: The context to observe.
+// - `aPost`: A `TPosting` instance containing the article's data.
+//
+// Returns:
+// - `int`: The number of bytes written to the file.
+// - 'error`:` A possible I/O error, or `nil` on success.
+//
+// Side Effects:
+// - Invalidates the internal count cache.
+func (fsp TFSpersistence) UpdateContext(aCtx context.Context, aPost *TPosting) (int, error) {
 	if nil == aPost {
 		return 0, se.Wrap(ErrEmptyPosting, 1)
 	}
+	if err := aCtx.Err(); nil != err {
+		return 0, se.Wrap(err, 1)
+	}
 	fsp.mtx.Lock()
 	defer fsp.mtx.Unlock()
 
 	return fsp.store(aPost, os.O_WRONLY|os.O_TRUNC)
-} // Update()
+} // UpdateContext()
 
 // `Walk()` visits all existing postings, calling `aWalkFunc`
 // for each posting.
@@ -576,6 +795,22 @@ func (fsp TFSpersistence) Update(aPost *TPosting) (int, error) {
 // Returns:
 //   - `error`: a possible error occurring the traversal process.
 func (fsp TFSpersistence) Walk(aWalkFunc TWalkFunc) error {
+	return fsp.WalkContext(context.Background(), aWalkFunc)
+} // Walk()
+
+// `WalkContext()` visits all existing postings, calling `aWalkFunc`
+// for each posting.
+//
+// The traversal is aborted as soon as `aCtx` is done; in that case
+// the context's error is returned.
+//
+// Parameters:
+//   - `aCtx`: The context to observe during the traversal.
+//   - `aWalkFunc`: The function to call for each posting.
+//
+// Returns:
+//   - `error`: a possible error occurring the traversal process.
+func (fsp TFSpersistence) WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error {
 	// fsp.mtx.Lock()
 	// defer fsp.mtx.Unlock()
 
@@ -616,6 +851,9 @@ dirLoop:
 			}
 			fn = fn[:len(fn)-3] // exclude extension `.md`
 
+			if err := aCtx.Err(); nil != err {
+				return se.Wrap(err, 1)
+			}
 			if err := aWalkFunc(str2id(fn)); nil != err {
 				if errors.Is(err, ErrSkipAll) {
 					break dirLoop
@@ -626,6 +864,6 @@ dirLoop:
 	}
 
 	return nil
-} // Walk()
+} // WalkContext()
 
 /* _EoF_ */
@@ -0,0 +1,941 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+/* Defined in `persistence.go`:
+type (
+	TPosting struct {
+		id           uint64    // integer representation of date/time
+		lastModified time.Time // file modification time
+		markdown     []byte    // article contents in Markdown markup
+	}
+
+	TPostList []TPosting
+
+	TWalkFunc func(aID uint64) error
+
+	IPersistence interface {
+		Create(aPost *TPosting) (int, error)
+		Read(aID uint64) (*TPosting, error)
+		Update(aPost *TPosting) (int, error)
+		Delete(aID uint64) error
+
+		Count() int
+		Exists(aID uint64) bool
+		PathFileName(aID uint64) string
+		Rename(aOldID, aNewID uint64) error
+		Search(aText string, aOffset, aLimit uint) (*TPostList, error)
+		Walk(aWalkFunc TWalkFunc) error
+
+		CountContext(aCtx context.Context) int
+		CreateContext(aCtx context.Context, aPost *TPosting) (int, error)
+		DeleteContext(aCtx context.Context, aID uint64) error
+		ExistsContext(aCtx context.Context, aID uint64) bool
+		ReadContext(aCtx context.Context, aID uint64) (*TPosting, error)
+		RenameContext(aCtx context.Context, aOldID, aNewID uint64) error
+		SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error)
+		UpdateContext(aCtx context.Context, aPost *TPosting) (int, error)
+		WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error
+	}
+)
+*/
+
+type (
+	// `tS3credentials` holds the access keys of an S3 account.
+	tS3credentials struct {
+		accessKey string
+		secretKey string
+	}
+
+	// `TS3persistence` is an `IPersistence` implementation storing
+	// the postings in an S3-compatible object storage.
+	//
+	// Each posting is stored as an object named like its filename
+	// in the file-based persistence layer (i.e. `<dir>/<id>.md`).
+	TS3persistence struct {
+		_        struct{}
+		bucket   string         // name of the bucket to use
+		client   *http.Client   // HTTP client talking to the server
+		count    *atomic.Int32  // cache of the current posting count
+		creds    tS3credentials // the account's access keys
+		endpoint *url.URL       // the server's base URL
+		etags    *sync.Map      // object ETags for optimistic locking
+		mtx      *sync.RWMutex  // pointer to avoid copying warnings
+		region   string         // signing region
+	}
+
+	// `tS3listResult` is the response body of a `ListObjectsV2` request.
+	tS3listResult struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+)
+
+var (
+	// `ErrPostingModified` is returned when a posting was changed in
+	// the persistence layer since it was last read.
+	ErrPostingModified = errors.New("posting modified concurrently")
+
+	// RegEx to check a posting's object name
+	s3KeyRE = regexp.MustCompile(`^\d{4}[0-9a-f]{3}/([0-9a-f]{16})\.md$`)
+)
+
+const (
+	// The default region used to sign requests.
+	s3DefaultRegion = `us-east-1`
+
+	// The hash of an empty request body.
+	s3EmptyHash = `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`
+)
+
+// --------------------------------------------------------------------------
+
+// `init()` ensures proper interface implementation.
+func init() {
+	var (
+		_ IPersistence = TS3persistence{}
+		_ IPersistence = (*TS3persistence)(nil)
+	)
+} // init()
+
+// --------------------------------------------------------------------------
+// constructor function
+
+// `NewS3persistence()` creates a new instance of `TS3persistence`.
+//
+// The credentials file is a simple text file containing the lines
+//
+//	accessKey = <the account's access key>
+//	secretKey = <the account's secret key>
+//
+// Parameters:
+//   - `aEndpoint`: The S3 server's base URL (e.g. `https://s3.example.com`).
+//   - `aBucket`: The name of the bucket to store the postings in.
+//   - `aRegion`: The region to use for signing requests.
+//   - `aCredFile`: The path-/filename of the credentials file.
+//
+// Returns:
+//   - `*TS3persistence`: A persistence instance.
+//   - `error`: A possible error during initialisation.
+func NewS3persistence(aEndpoint, aBucket, aRegion, aCredFile string) (*TS3persistence, error) {
+	if aEndpoint = strings.TrimSpace(aEndpoint); 0 == len(aEndpoint) {
+		return nil, se.Wrap(errors.New("missing S3 endpoint"), 1)
+	}
+	if aBucket = strings.TrimSpace(aBucket); 0 == len(aBucket) {
+		return nil, se.Wrap(errors.New("missing S3 bucket"), 1)
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(aEndpoint, `/`))
+	if nil != err {
+		return nil, se.Wrap(err, 2)
+	}
+	creds, err := readS3credentials(aCredFile)
+	if nil != err {
+		return nil, err // err is already wrapped
+	}
+	if aRegion = strings.TrimSpace(aRegion); 0 == len(aRegion) {
+		aRegion = s3DefaultRegion
+	}
+
+	return &TS3persistence{
+		bucket:   aBucket,
+		client:   &http.Client{Timeout: time.Second << 4},
+		count:    new(atomic.Int32),
+		creds:    creds,
+		endpoint: endpoint,
+		etags:    new(sync.Map),
+		mtx:      new(sync.RWMutex),
+		region:   aRegion,
+	}, nil
+} // NewS3persistence()
+
+// --------------------------------------------------------------------------
+// private helper functions:
+
+// `id2key()` returns the object name of the posting with `aID`.
+//
+// The name is constructed like the path/filename used by the
+// file-based persistence layer but without its base directory.
+//
+// Parameters:
+//   - `aID`: A posting's ID to be converted to an object name.
+//
+// Returns:
+//   - `string`: The object name based on `aID`.
+func id2key(aID uint64) string {
+	fname := id2str(aID)
+
+	return fmt.Sprintf(`%04d%s/%s.md`, id2time(aID).Year(), fname[:3], fname)
+} // id2key()
+
+// `readS3credentials()` reads the access keys from `aFilename`.
+//
+// Parameters:
+//   - `aFilename`: The name of the credentials file to read.
+//
+// Returns:
+//   - `tS3credentials`: The access keys read.
+//   - `error`: A possible I/O or format error.
+func readS3credentials(aFilename string) (tS3credentials, error) {
+	var result tS3credentials
+
+	file, err := os.Open(aFilename) // #nosec G304
+	if nil != err {
+		return result, se.Wrap(err, 2)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (0 == len(line)) || ('#' == line[0]) || (';' == line[0]) {
+			continue
+		}
+		key, val, ok := strings.Cut(line, `=`)
+		if !ok {
+			continue
+		}
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case `accesskey`:
+			result.accessKey = val
+		case `secretkey`:
+			result.secretKey = val
+		}
+	}
+	if err = scanner.Err(); nil != err {
+		return result, se.Wrap(err, 1)
+	}
+	if (0 == len(result.accessKey)) || (0 == len(result.secretKey)) {
+		return result, se.Wrap(fmt.Errorf("incomplete S3 credentials in %q", aFilename), 1)
+	}
+
+	return result, nil
+} // readS3credentials()
+
+// `s3hash()` returns the hex encoded SHA256 hash of `aData`.
+func s3hash(aData []byte) string {
+	sum := sha256.Sum256(aData)
+
+	return hex.EncodeToString(sum[:])
+} // s3hash()
+
+// `s3hmac()` returns the HMAC-SHA256 of `aData` using `aKey`.
+func s3hmac(aKey []byte, aData string) []byte {
+	mac := hmac.New(sha256.New, aKey)
+	mac.Write([]byte(aData))
+
+	return mac.Sum(nil)
+} // s3hmac()
+
+// --------------------------------------------------------------------------
+// TS3persistence methods
+
+// `Count()` returns the number of postings currently available.
+//
+// NOTE: This method is resource intensive as it has to list all
+// objects in the bucket. Its result is cached until the next
+// modification of the bucket's content.
+//
+// Returns:
+//   - `int`: The number of available postings, or `0` in case of errors.
+//
+// Side Effects:
+//   - Updates the count cache.
+func (s3p TS3persistence) Count() int {
+	return s3p.CountContext(context.Background())
+} // Count()
+
+// `CountContext()` returns the number of postings currently available
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `int`: The number of available postings, or `0` in case of errors.
+//
+// Side Effects:
+//   - Updates the count cache.
+func (s3p TS3persistence) CountContext(aCtx context.Context) int {
+	if result := s3p.count.Load(); 0 < result {
+		return int(result)
+	}
+
+	keys, err := s3p.list(aCtx)
+	if nil != err {
+		return 0
+	}
+	s3p.count.Store(int32(len(keys)))
+
+	return len(keys)
+} // CountContext()
+
+// `Create()` creates a new posting in the object storage.
+//
+// If the provided `aPost` is `nil`, an `ErrEmptyPosting` error
+// is returned. If an object for the posting already exists, an
+// `ErrPostingModified` error is returned.
+//
+// Parameters:
+//   - `aPost`: The `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes stored.
+//   - 'error`:` A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) Create(aPost *TPosting) (int, error) {
+	return s3p.CreateContext(context.Background(), aPost)
+} // Create()
+
+// `CreateContext()` creates a new posting in the object storage
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPost`: The `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes stored.
+//   - 'error`:` A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) CreateContext(aCtx context.Context, aPost *TPosting) (int, error) {
+	if nil == aPost {
+		return 0, se.Wrap(ErrEmptyPosting, 1)
+	}
+	s3p.mtx.Lock()
+	defer s3p.mtx.Unlock()
+
+	return s3p.store(aCtx, aPost, map[string]string{`If-None-Match`: `*`})
+} // CreateContext()
+
+// `Delete()` removes the posting/article from the object storage.
+//
+// A non-existing object is not considered an error here.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting to delete.
+//
+// Returns:
+//   - 'error`: A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) Delete(aID uint64) error {
+	return s3p.DeleteContext(context.Background(), aID)
+} // Delete()
+
+// `DeleteContext()` removes the posting/article from the object
+// storage observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to delete.
+//
+// Returns:
+//   - 'error`: A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) DeleteContext(aCtx context.Context, aID uint64) error {
+	s3p.mtx.Lock()
+	defer s3p.mtx.Unlock()
+
+	return s3p.delete(aCtx, aID)
+} // DeleteContext()
+
+// called by [DeleteContext], [RenameContext] and [store], all of which
+// are already locked
+func (s3p TS3persistence) delete(aCtx context.Context, aID uint64) error {
+	resp, err := s3p.do(aCtx, http.MethodDelete, id2key(aID), nil, nil, nil)
+	if nil != err {
+		return err // err is already wrapped
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		s3p.etags.Delete(aID)
+		s3p.count.Store(0) // invalidate count cache
+		return nil
+	}
+
+	return se.Wrap(fmt.Errorf("S3 DELETE %q: %s", id2key(aID), resp.Status), 9)
+} // delete()
+
+// `do()` sends a signed request to the S3 server.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aMethod`: The HTTP method to use.
+//   - `aKey`: The object name (may be empty for bucket requests).
+//   - `aQuery`: Optional query parameters.
+//   - `aHeader`: Optional additional request headers.
+//   - `aBody`: Optional request body.
+//
+// Returns:
+//   - `*http.Response`: The server's response.
+//   - `error`: A possible error, or `nil` on success.
+func (s3p TS3persistence) do(aCtx context.Context, aMethod, aKey string, aQuery url.Values, aHeader map[string]string, aBody []byte) (*http.Response, error) {
+	u := *s3p.endpoint
+	u.Path = path.Join(`/`, u.Path, s3p.bucket, aKey)
+	if 0 < len(aQuery) {
+		u.RawQuery = aQuery.Encode()
+	}
+
+	// The context is cancelled when the response body gets closed.
+	ctx, cancel := context.WithTimeout(aCtx, time.Second<<3)
+	req, err := http.NewRequestWithContext(ctx, aMethod, u.String(), bytes.NewReader(aBody))
+	if nil != err {
+		cancel()
+		return nil, se.Wrap(err, 3)
+	}
+	for key, val := range aHeader {
+		req.Header.Set(key, val)
+	}
+	req.ContentLength = int64(len(aBody))
+	s3p.sign(req, aBody, time.Now())
+
+	resp, err := s3p.client.Do(req)
+	if nil != err {
+		cancel()
+		return nil, se.Wrap(err, 3)
+	}
+	resp.Body = &tS3body{resp.Body, cancel}
+
+	return resp, nil
+} // do()
+
+// `Exists()` checks if a posting with the given ID exists in the
+// object storage.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting to check.
+//
+// Returns:
+//   - `bool`: `true` if the posting exists, `false` otherwise.
+func (s3p TS3persistence) Exists(aID uint64) bool {
+	return s3p.ExistsContext(context.Background(), aID)
+} // Exists()
+
+// `ExistsContext()` checks if a posting with the given ID exists in
+// the object storage observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to check.
+//
+// Returns:
+//   - `bool`: `true` if the posting exists, `false` otherwise.
+func (s3p TS3persistence) ExistsContext(aCtx context.Context, aID uint64) bool {
+	s3p.mtx.RLock()
+	defer s3p.mtx.RUnlock()
+
+	resp, err := s3p.do(aCtx, http.MethodHead, id2key(aID), nil, nil, nil)
+	if nil != err {
+		return false
+	}
+	resp.Body.Close()
+
+	return (http.StatusOK == resp.StatusCode) && (0 != resp.ContentLength)
+} // ExistsContext()
+
+// `list()` returns the names of all posting objects in the bucket
+// sorted in descending order (i.e. youngest first).
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `[]string`: The list of object names.
+//   - `error`: A possible error, or `nil` on success.
+func (s3p TS3persistence) list(aCtx context.Context) ([]string, error) {
+	var result []string
+
+	query := url.Values{}
+	query.Set(`list-type`, `2`)
+	for {
+		resp, err := s3p.do(aCtx, http.MethodGet, ``, query, nil, nil)
+		if nil != err {
+			return nil, err // err is already wrapped
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if nil != err {
+			return nil, se.Wrap(err, 3)
+		}
+		if http.StatusOK != resp.StatusCode {
+			return nil, se.Wrap(fmt.Errorf("S3 list %q: %s", s3p.bucket, resp.Status), 1)
+		}
+
+		var lr tS3listResult
+		if err = xml.Unmarshal(body, &lr); nil != err {
+			return nil, se.Wrap(err, 1)
+		}
+		for _, obj := range lr.Contents {
+			if s3KeyRE.MatchString(obj.Key) {
+				result = append(result, obj.Key)
+			}
+		}
+		if !lr.IsTruncated || (0 == len(lr.NextContinuationToken)) {
+			break
+		}
+		query.Set(`continuation-token`, lr.NextContinuationToken)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(result)))
+
+	return result, nil
+} // list()
+
+// `PathFileName()` returns the posting's complete object URL.
+//
+// The returned URL is in the format:
+//
+//	<endpoint>/<bucket>/<dir>/<posting_id>.md
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting to handle.
+//
+// Returns:
+//   - `string`: The object URL associated with `aID`.
+func (s3p TS3persistence) PathFileName(aID uint64) string {
+	u := *s3p.endpoint
+	u.Path = path.Join(`/`, u.Path, s3p.bucket, id2key(aID))
+
+	return u.String()
+} // PathFileName()
+
+// `Read()` reads the posting from the object storage.
+//
+// The object's ETag is remembered to detect concurrent modifications
+// when the posting is updated later on.
+//
+// Parameters:
+//   - `aID`: The unique identifier of the posting to be read.
+//
+// Returns:
+//   - `*TPosting`: The `TPosting` instance containing the article's data, or `nil` if the object does not exist.
+//   - 'error`: A possible error, or `nil` on success.
+func (s3p TS3persistence) Read(aID uint64) (*TPosting, error) {
+	return s3p.ReadContext(context.Background(), aID)
+} // Read()
+
+// `ReadContext()` reads the posting from the object storage
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aID`: The unique identifier of the posting to be read.
+//
+// Returns:
+//   - `*TPosting`: The `TPosting` instance containing the article's data, or `nil` if the object does not exist.
+//   - 'error`: A possible error, or `nil` on success.
+func (s3p TS3persistence) ReadContext(aCtx context.Context, aID uint64) (*TPosting, error) {
+	s3p.mtx.RLock()
+	defer s3p.mtx.RUnlock()
+
+	key := id2key(aID)
+	resp, err := s3p.do(aCtx, http.MethodGet, key, nil, nil, nil)
+	if nil != err {
+		return nil, err // err is already wrapped
+	}
+	defer resp.Body.Close()
+
+	if http.StatusOK != resp.StatusCode {
+		if http.StatusNotFound == resp.StatusCode {
+			return nil, se.Wrap(os.ErrNotExist, 2)
+		}
+		return nil, se.Wrap(fmt.Errorf("S3 GET %q: %s", key, resp.Status), 1)
+	}
+
+	bs, err := io.ReadAll(resp.Body)
+	if nil != err {
+		return nil, se.Wrap(err, 2)
+	}
+	if etag := resp.Header.Get(`ETag`); 0 < len(etag) {
+		s3p.etags.Store(aID, etag)
+	}
+
+	lastMod, err := http.ParseTime(resp.Header.Get(`Last-Modified`))
+	if nil != err {
+		lastMod = time.Now()
+	}
+	post := &TPosting{
+		id:           aID,
+		lastModified: lastMod,
+		markdown:     bytes.TrimSpace(bs),
+	}
+	if nil == post.markdown {
+		// `bytes.TrimSpace()` returns `nil` instead of an empty slice
+		post.markdown = []byte(``)
+	}
+
+	return post, nil
+} // ReadContext()
+
+// `Rename()` renames a posting from its old ID to a new ID.
+//
+// Since S3 doesn't provide a rename operation the object is copied
+// to its new name and then removed from the old one.
+//
+// Parameters:
+//   - aOldID: The unique identifier of the posting to be renamed.
+//   - aNewID: The new unique identifier for the new posting.
+//
+// Returns:
+//   - `error`: An error if the operation fails, or `nil` on success.
+func (s3p TS3persistence) Rename(aOldID, aNewID uint64) error {
+	return s3p.RenameContext(context.Background(), aOldID, aNewID)
+} // Rename()
+
+// `RenameContext()` renames a posting from its old ID to a new ID
+// observing `aCtx`.
+//
+// Parameters:
+//   - aCtx: The context to observe.
+//   - aOldID: The unique identifier of the posting to be renamed.
+//   - aNewID: The new unique identifier for the new posting.
+//
+// Returns:
+//   - `error`: An error if the operation fails, or `nil` on success.
+func (s3p TS3persistence) RenameContext(aCtx context.Context, aOldID, aNewID uint64) error {
+	s3p.mtx.Lock()
+	defer s3p.mtx.Unlock()
+
+	source := url.PathEscape(s3p.bucket) + `/` + id2key(aOldID)
+	header := map[string]string{
+		`If-None-Match`:     `*`,
+		`X-Amz-Copy-Source`: source,
+	}
+	resp, err := s3p.do(aCtx, http.MethodPut, id2key(aNewID), nil, header, nil)
+	if nil != err {
+		return err // err is already wrapped
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// copied successfully
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return se.Wrap(ErrPostingModified, 4)
+	default:
+		return se.Wrap(fmt.Errorf("S3 COPY %q: %s", source, resp.Status), 6)
+	}
+
+	return s3p.delete(aCtx, aOldID)
+} // RenameContext()
+
+// `Search()` retrieves a list of postings based on a search term.
+//
+// A zero value of `aLimit` means: no limit alt all.
+//
+// The returned `TPostList` type is a slice of `TPosting` instances, where
+// `TPosting` is a struct representing a single posting. If the returned
+// slice is an empty list then no matching postings were found; if it is
+// `nil` it means there was an error retrieving the matches.
+//
+// Parameters:
+//   - `aText`: The search query string.
+//   - `aOffset`: An offset in the result set of the search results.
+//   - `aLimit`: The maximum number of search results to return.
+//
+// Returns:
+//   - `*TPostList`: The list of search results, or `nil` in case of errors.
+//   - `error`: If the search operation fails, or `nil` on success.
+func (s3p TS3persistence) Search(aText string, aOffset, aLimit uint) (*TPostList, error) {
+	return s3p.SearchContext(context.Background(), aText, aOffset, aLimit)
+} // Search()
+
+// `SearchContext()` retrieves a list of postings based on a search term
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aText`: The search query string.
+//   - `aOffset`: The number of matching postings to skip.
+//   - `aLimit`: The maximum number of search results to return.
+//
+// Returns:
+//   - `*TPostList`: The list of search results, or `nil` in case of errors.
+//   - `error`: If the search operation fails, or `nil` on success.
+func (s3p TS3persistence) SearchContext(aCtx context.Context, aText string, aOffset, aLimit uint) (*TPostList, error) {
+	return searchParallel(aCtx, s3p, aText, aOffset, aLimit)
+} // SearchContext()
+
+// `sign()` adds an AWS Signature Version 4 to `aRequest`.
+//
+// Parameters:
+//   - `aRequest`: The request to sign.
+//   - `aBody`: The request's payload.
+//   - `aTime`: The time of signing.
+func (s3p TS3persistence) sign(aRequest *http.Request, aBody []byte, aTime time.Time) {
+	const algorithm = `AWS4-HMAC-SHA256`
+
+	aTime = aTime.UTC()
+	amzDate := aTime.Format(`20060102T150405Z`)
+	day := aTime.Format(`20060102`)
+	payloadHash := s3EmptyHash
+	if 0 < len(aBody) {
+		payloadHash = s3hash(aBody)
+	}
+	aRequest.Header.Set(`X-Amz-Content-Sha256`, payloadHash)
+	aRequest.Header.Set(`X-Amz-Date`, amzDate)
+
+	// canonical headers: `host` plus all `x-amz-*` and conditional ones
+	headers := map[string]string{`host`: aRequest.URL.Host}
+	for key, vals := range aRequest.Header {
+		lk := strings.ToLower(key)
+		if strings.HasPrefix(lk, `x-amz-`) || strings.HasPrefix(lk, `if-`) {
+			headers[lk] = strings.TrimSpace(strings.Join(vals, `,`))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for key := range headers {
+		names = append(names, key)
+	}
+	slices.Sort(names)
+	var canonHeaders strings.Builder
+	for _, key := range names {
+		canonHeaders.WriteString(key + `:` + headers[key] + "\n")
+	}
+	signedHeaders := strings.Join(names, `;`)
+
+	// S3 expects the query parameters sorted and `%20` for spaces
+	query := strings.ReplaceAll(aRequest.URL.Query().Encode(), `+`, `%20`)
+	canonRequest := strings.Join([]string{
+		aRequest.Method,
+		aRequest.URL.EscapedPath(),
+		query,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + `/` + s3p.region + `/s3/aws4_request`
+	toSign := strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		s3hash([]byte(canonRequest)),
+	}, "\n")
+
+	key := s3hmac([]byte(`AWS4`+s3p.creds.secretKey), day)
+	key = s3hmac(key, s3p.region)
+	key = s3hmac(key, `s3`)
+	key = s3hmac(key, `aws4_request`)
+	signature := hex.EncodeToString(s3hmac(key, toSign))
+
+	aRequest.Header.Set(`Authorization`, algorithm+
+		` Credential=`+s3p.creds.accessKey+`/`+scope+
+		`, SignedHeaders=`+signedHeaders+
+		`, Signature=`+signature)
+} // sign()
+
+// `store()` writes the article's Markdown to the object storage
+// returning the number of bytes written and a possible error.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPost`: A `TPosting` instance containing the article's data.
+//   - `aHeader`: The conditional request headers to use.
+//
+// Returns:
+//   - `int`: The number of bytes written.
+//   - 'error`:` A possible error.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) store(aCtx context.Context, aPost *TPosting, aHeader map[string]string) (int, error) {
+	// Locking is done by `CreateContext()` and `UpdateContext()`.
+	if 0 == len(aPost.markdown) {
+		return 0, s3p.delete(aCtx, aPost.id)
+	}
+
+	key := id2key(aPost.id)
+	aHeader[`Content-Type`] = `text/markdown; charset=utf-8`
+	resp, err := s3p.do(aCtx, http.MethodPut, key, nil, aHeader, aPost.markdown)
+	if nil != err {
+		return 0, err // err is already wrapped
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		// stored successfully
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return 0, se.Wrap(ErrPostingModified, 4)
+	default:
+		return 0, se.Wrap(fmt.Errorf("S3 PUT %q: %s", key, resp.Status), 6)
+	}
+
+	if etag := resp.Header.Get(`ETag`); 0 < len(etag) {
+		s3p.etags.Store(aPost.id, etag)
+	}
+	s3p.count.Store(0) // invalidate count cache
+	aPost.lastModified = time.Now()
+
+	return len(aPost.markdown), nil
+} // store()
+
+// `Update()` updates the article's Markdown in the object storage.
+//
+// If the posting was read before, its ETag is used to make sure that
+// it wasn't modified by another process in the meantime; in that case
+// an `ErrPostingModified` error is returned.
+//
+// If the provided `aPost` is `nil`, an `ErrEmptyPosting` error
+// is returned.
+//
+// Parameters:
+//   - `aPost`: A `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes written.
+//   - 'error`:` A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) Update(aPost *TPosting) (int, error) {
+	return s3p.UpdateContext(context.Background(), aPost)
+} // Update()
+
+// `UpdateContext()` updates the article's Markdown in the object
+// storage observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aPost`: A `TPosting` instance containing the article's data.
+//
+// Returns:
+//   - `int`: The number of bytes written.
+//   - 'error`:` A possible error, or `nil` on success.
+//
+// Side Effects:
+//   - Invalidates the internal count cache.
+func (s3p TS3persistence) UpdateContext(aCtx context.Context, aPost *TPosting) (int, error) {
+	if nil == aPost {
+		return 0, se.Wrap(ErrEmptyPosting, 1)
+	}
+	s3p.mtx.Lock()
+	defer s3p.mtx.Unlock()
+
+	header := map[string]string{}
+	if etag, ok := s3p.etags.Load(aPost.id); ok {
+		header[`If-Match`] = etag.(string)
+	}
+
+	return s3p.store(aCtx, aPost, header)
+} // UpdateContext()
+
+// `Walk()` visits all existing postings, calling `aWalkFunc`
+// for each posting.
+//
+// The postings are visited in descending order (youngest first).
+//
+// Parameters:
+//   - `aWalkFunc`: The function to call for each posting.
+//
+// Returns:
+//   - `error`: a possible error occurring the traversal process.
+func (s3p TS3persistence) Walk(aWalkFunc TWalkFunc) error {
+	return s3p.WalkContext(context.Background(), aWalkFunc)
+} // Walk()
+
+// `WalkContext()` visits all existing postings, calling `aWalkFunc`
+// for each posting.
+//
+// The traversal is aborted as soon as `aCtx` is done; in that case
+// the context's error is returned.
+//
+// Parameters:
+//   - `aCtx`: The context to observe during the traversal.
+//   - `aWalkFunc`: The function to call for each posting.
+//
+// Returns:
+//   - `error`: a possible error occurring the traversal process.
+func (s3p TS3persistence) WalkContext(aCtx context.Context, aWalkFunc TWalkFunc) error {
+	keys, err := s3p.list(aCtx)
+	if nil != err {
+		return err // err is already wrapped
+	}
+	s3p.count.Store(int32(len(keys)))
+
+	for _, key := range keys {
+		matches := s3KeyRE.FindStringSubmatch(key)
+		if 2 > len(matches) {
+			continue // no proper object name
+		}
+		if err = aCtx.Err(); nil != err {
+			return se.Wrap(err, 1)
+		}
+
+		if err = aWalkFunc(str2id(matches[1])); nil != err {
+			if errors.Is(err, ErrSkipAll) {
+				break
+			}
+			return se.Wrap(err, 5)
+		}
+	}
+
+	return nil
+} // WalkContext()
+
+// --------------------------------------------------------------------------
+
+type (
+	// `tS3body` releases the request's context when the response
+	// body gets closed.
+	tS3body struct {
+		io.ReadCloser
+		cancel context.CancelFunc
+	}
+)
+
+// `Close()` closes the response body and cancels the request context.
+func (b *tS3body) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+} // Close()
+
+/* _EoF_ */
@@ -0,0 +1,335 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+type (
+	// `tFakeS3` is a minimal in-process stand-in for an S3 server.
+	tFakeS3 struct {
+		mtx     sync.Mutex
+		objects map[string][]byte
+		mtimes  map[string]time.Time
+		pageLen int // max. number of keys per listing page
+	}
+)
+
+func fakeETag(aData []byte) string {
+	sum := md5.Sum(aData)
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+} // fakeETag()
+
+func (fs *tFakeS3) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Request) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+
+	if !strings.HasPrefix(aRequest.Header.Get(`Authorization`), `AWS4-HMAC-SHA256 Credential=testKey/`) {
+		http.Error(aWriter, `AccessDenied`, http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(aRequest.URL.Path, `/`), `/`)
+	if `postings` != bucket {
+		http.Error(aWriter, `NoSuchBucket`, http.StatusNotFound)
+		return
+	}
+
+	if 0 == len(key) { // ListObjectsV2
+		keys := make([]string, 0, len(fs.objects))
+		for k := range fs.objects {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		start := 0
+		if token := aRequest.URL.Query().Get(`continuation-token`); 0 < len(token) {
+			start = sort.SearchStrings(keys, token)
+		}
+		end, truncated := len(keys), false
+		if (0 < fs.pageLen) && (start+fs.pageLen < end) {
+			end, truncated = start+fs.pageLen, true
+		}
+		fmt.Fprint(aWriter, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>`)
+		for _, k := range keys[start:end] {
+			fmt.Fprintf(aWriter, `<Contents><Key>%s</Key></Contents>`, k)
+		}
+		fmt.Fprintf(aWriter, `<IsTruncated>%t</IsTruncated>`, truncated)
+		if truncated {
+			fmt.Fprintf(aWriter, `<NextContinuationToken>%s</NextContinuationToken>`, keys[end])
+		}
+		fmt.Fprint(aWriter, `</ListBucketResult>`)
+		return
+	}
+
+	data, exists := fs.objects[key]
+	switch aRequest.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		aWriter.Header().Set(`ETag`, fakeETag(data))
+		aWriter.Header().Set(`Last-Modified`, fs.mtimes[key].UTC().Format(http.TimeFormat))
+		aWriter.Header().Set(`Content-Length`, fmt.Sprint(len(data)))
+		if http.MethodGet == aRequest.Method {
+			aWriter.Write(data)
+		}
+
+	case http.MethodPut:
+		if `*` == aRequest.Header.Get(`If-None-Match`) && exists {
+			aWriter.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if m := aRequest.Header.Get(`If-Match`); (0 < len(m)) && (!exists || (m != fakeETag(data))) {
+			aWriter.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if src := aRequest.Header.Get(`X-Amz-Copy-Source`); 0 < len(src) {
+			_, srcKey, _ := strings.Cut(src, `/`)
+			srcData, ok := fs.objects[srcKey]
+			if !ok {
+				http.NotFound(aWriter, aRequest)
+				return
+			}
+			data = srcData
+		} else {
+			data, _ = io.ReadAll(aRequest.Body)
+		}
+		fs.objects[key] = data
+		fs.mtimes[key] = time.Now()
+		aWriter.Header().Set(`ETag`, fakeETag(data))
+
+	case http.MethodDelete:
+		delete(fs.objects, key)
+		delete(fs.mtimes, key)
+		aWriter.WriteHeader(http.StatusNoContent)
+
+	default:
+		aWriter.WriteHeader(http.StatusMethodNotAllowed)
+	}
+} // ServeHTTP()
+
+// `prepS3Test()` starts a fake S3 server and returns a persistence
+// instance using it.
+func prepS3Test(t *testing.T, aPageLen int) (*TS3persistence, *tFakeS3) {
+	t.Helper()
+
+	fake := &tFakeS3{
+		objects: make(map[string][]byte),
+		mtimes:  make(map[string]time.Time),
+		pageLen: aPageLen,
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	credFile := filepath.Join(t.TempDir(), `s3.cred`)
+	if err := os.WriteFile(credFile, []byte("# test keys\naccessKey = testKey\nsecretKey = \"testSecret\"\n"), 0600); nil != err {
+		t.Fatal(err)
+	}
+
+	s3p, err := NewS3persistence(server.URL, `postings`, ``, credFile)
+	if nil != err {
+		t.Fatalf("NewS3persistence() error = %v", err)
+	}
+
+	return s3p, fake
+} // prepS3Test()
+
+func TestNewS3persistence(t *testing.T) {
+	credFile := filepath.Join(t.TempDir(), `s3.cred`)
+	os.WriteFile(credFile, []byte("accessKey = a\nsecretKey = b\n"), 0600)
+	badFile := filepath.Join(t.TempDir(), `bad.cred`)
+	os.WriteFile(badFile, []byte("accessKey = a\n"), 0600)
+
+	tests := []struct {
+		name     string
+		endpoint string
+		bucket   string
+		credFile string
+		wantErr  bool
+	}{
+		{"1", "http://localhost:9000", "postings", credFile, false},
+		{"2", "", "postings", credFile, true},
+		{"3", "http://localhost:9000", "", credFile, true},
+		{"4", "http://localhost:9000", "postings", badFile, true},
+		{"5", "http://localhost:9000", "postings", "/does/not/exist", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewS3persistence(tt.endpoint, tt.bucket, ``, tt.credFile)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("NewS3persistence() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (s3DefaultRegion != got.region) {
+				t.Errorf("NewS3persistence() region = %q, want %q", got.region, s3DefaultRegion)
+			}
+		})
+	}
+} // TestNewS3persistence()
+
+func TestTS3persistence_CRUD(t *testing.T) {
+	s3p, _ := prepS3Test(t, 0)
+
+	id := time2id(time.Date(2024, 5, 17, 12, 0, 0, 0, time.Local))
+	post := NewPosting(id, "hello S3")
+
+	if n, err := s3p.Create(post); (nil != err) || (8 != n) {
+		t.Fatalf("Create() = %d, %v", n, err)
+	}
+	if _, err := s3p.Create(post); !errors.Is(err, ErrPostingModified) {
+		t.Errorf("Create() twice: error = %v, want %v", err, ErrPostingModified)
+	}
+	if !s3p.Exists(id) {
+		t.Errorf("Exists(%x) = false, want true", id)
+	}
+
+	got, err := s3p.Read(id)
+	if nil != err {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if "hello S3" != string(got.markdown) {
+		t.Errorf("Read() = %q, want %q", got.markdown, "hello S3")
+	}
+
+	if _, err = s3p.Update(got.Set([]byte("updated"))); nil != err {
+		t.Errorf("Update() error = %v", err)
+	}
+
+	nid := id + 1
+	if err = s3p.Rename(id, nid); nil != err {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if s3p.Exists(id) || !s3p.Exists(nid) {
+		t.Errorf("Rename(): old exists = %v, new exists = %v", s3p.Exists(id), s3p.Exists(nid))
+	}
+
+	if err = s3p.Delete(nid); nil != err {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err = s3p.Read(nid); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Read() deleted: error = %v, want %v", err, os.ErrNotExist)
+	}
+} // TestTS3persistence_CRUD()
+
+func TestTS3persistence_Update_conflict(t *testing.T) {
+	s3p, fake := prepS3Test(t, 0)
+
+	id := time2id(time.Date(2024, 5, 17, 12, 0, 0, 0, time.Local))
+	if _, err := s3p.Create(NewPosting(id, "version 1")); nil != err {
+		t.Fatal(err)
+	}
+	post, err := s3p.Read(id)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// simulate another process changing the object
+	fake.mtx.Lock()
+	fake.objects[id2key(id)] = []byte("version 2")
+	fake.mtx.Unlock()
+
+	if _, err = s3p.Update(post.Set([]byte("version 3"))); !errors.Is(err, ErrPostingModified) {
+		t.Errorf("Update() error = %v, want %v", err, ErrPostingModified)
+	}
+
+	// after re-reading the update must succeed
+	if post, err = s3p.Read(id); nil != err {
+		t.Fatal(err)
+	}
+	if _, err = s3p.Update(post.Set([]byte("version 3"))); nil != err {
+		t.Errorf("Update() error = %v", err)
+	}
+} // TestTS3persistence_Update_conflict()
+
+func TestTS3persistence_Walk(t *testing.T) {
+	s3p, fake := prepS3Test(t, 2) // force paginated listings
+
+	base := time.Date(2023, 12, 30, 0, 0, 0, 0, time.Local)
+	var want []uint64
+	for i := 0; i < 5; i++ {
+		id := time2id(base.Add(time.Duration(i) * 24 * time.Hour))
+		if _, err := s3p.Create(NewPosting(id, fmt.Sprintf("posting #%d", i))); nil != err {
+			t.Fatal(err)
+		}
+		want = append([]uint64{id}, want...) // youngest first
+	}
+	fake.objects["2024abc/README.txt"] = []byte("not a posting")
+
+	if got := s3p.Count(); 5 != got {
+		t.Errorf("Count() = %d, want 5", got)
+	}
+
+	var got []uint64
+	if err := s3p.Walk(func(aID uint64) error {
+		got = append(got, aID)
+		if 3 == len(got) {
+			return ErrSkipAll
+		}
+		return nil
+	}); nil != err {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if fmt.Sprint(want[:3]) != fmt.Sprint(got) {
+		t.Errorf("Walk() = %v, want %v", got, want[:3])
+	}
+
+	pl, err := s3p.Search(`#3`, 0, 0)
+	if (nil != err) || (1 != pl.Len()) {
+		t.Errorf("Search() = %v, %v", pl, err)
+	}
+} // TestTS3persistence_Walk()
+
+func TestTS3persistence_WalkContext(t *testing.T) {
+	s3p, _ := prepS3Test(t, 0)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		id := time2id(base.Add(time.Duration(i) * time.Hour))
+		if _, err := s3p.Create(NewPosting(id, "posting")); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	visited := 0
+	err := s3p.WalkContext(ctx, func(aID uint64) error {
+		visited++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WalkContext() error = %v, want %v", err, context.Canceled)
+	}
+	if 1 != visited {
+		t.Errorf("WalkContext() visited = %d, want 1", visited)
+	}
+
+	if _, err = s3p.ReadContext(ctx, time2id(base)); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadContext() error = %v, want %v", err, context.Canceled)
+	}
+} // TestTS3persistence_WalkContext()
+
+/* _EoF_ */
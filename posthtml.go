@@ -0,0 +1,207 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a cache of the postings' rendered HTML.
+ */
+
+import (
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+)
+
+type (
+	// `tPHentry` is the rendered HTML of a single posting.
+	tPHentry struct {
+		html         template.HTML // the posting's final HTML
+		lastModified time.Time     // the version of the posting's text
+		renderer     string        // the renderer which produced `html`
+	}
+)
+
+const (
+	// Maximum number of postings kept in memory.
+	phMaxEntries = 2048
+
+	// Version of the HTML post-processing (e.g. `MarkupTags()`,
+	// shortcodes, wiki links);
+	// it must be changed whenever its output changes to invalidate
+	// the pages already stored.
+	phVersion = `7`
+)
+
+var (
+	// The in-memory cache of rendered postings.
+	phCache = make(map[uint64]tPHentry, phMaxEntries)
+
+	// Guard against concurrent access of `phCache`.
+	phMtx sync.RWMutex
+)
+
+// `phRendererID()` identifies the HTML produced by the current
+// Markdown renderer, syntax highlighting, sanitiser, post-processing,
+// and shortcode templates.
+//
+// Returns:
+//   - `string`: The identifier of the posting's HTML version.
+func phRendererID() string {
+	return mdRenderer.ID() + `-` + phVersion + hlID() + `-` + saSanitiser.ID() +
+		`-` + scTemplatesID()
+} // phRendererID()
+
+// `phDrop()` removes the posting `aID` from the in-memory cache.
+//
+// Parameters:
+//   - `aID`: The ID of the posting to remove.
+func phDrop(aID uint64) {
+	phMtx.Lock()
+	delete(phCache, aID)
+	phMtx.Unlock()
+} // phDrop()
+
+// `phGet()` returns the cached HTML of the posting `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the posting to look up.
+//   - `aLastModified`: The posting's last modification time.
+//
+// Returns:
+//   - `template.HTML`: The posting's HTML.
+//   - `bool`: Whether a current HTML version was found.
+func phGet(aID uint64, aLastModified time.Time) (template.HTML, bool) {
+	phMtx.RLock()
+	entry, ok := phCache[aID]
+	phMtx.RUnlock()
+
+	if !ok || (phRendererID() != entry.renderer) ||
+		!entry.lastModified.Equal(aLastModified) {
+		return ``, false
+	}
+
+	return entry.html, true
+} // phGet()
+
+// `phPut()` adds the HTML of the posting `aID` to the in-memory cache.
+//
+// If the cache is full an arbitrary entry gets evicted.
+//
+// Parameters:
+//   - `aID`: The ID of the posting.
+//   - `aLastModified`: The posting's last modification time.
+//   - `aHTML`: The posting's rendered HTML.
+func phPut(aID uint64, aLastModified time.Time, aHTML template.HTML) {
+	phMtx.Lock()
+	defer phMtx.Unlock()
+
+	if _, ok := phCache[aID]; !ok && (phMaxEntries <= len(phCache)) {
+		for id := range phCache {
+			delete(phCache, id)
+			break
+		}
+	}
+	phCache[aID] = tPHentry{
+		html:         aHTML,
+		lastModified: aLastModified,
+		renderer:     phRendererID(),
+	}
+} // phPut()
+
+// `postHTML()` returns the final HTML of `aPosting`.
+//
+// The HTML is looked up in the in-memory cache first, then in the
+// persistence layer (if it supports storing HTML); only if neither
+// holds the current version the posting's Markdown gets rendered.
+//
+// Parameters:
+//   - `aPosting`: The posting to render.
+//
+// Returns:
+//   - `template.HTML`: The posting's HTML markup.
+func postHTML(aPosting *TPosting) template.HTML {
+	// `Markdown()` may (re-)load the text thus updating `lastModified`
+	md := aPosting.Markdown()
+	id, lm := aPosting.id, aPosting.lastModified
+
+	if result, ok := phGet(id, lm); ok {
+		return result
+	}
+
+	store, ok := poPersistence.(IHTMLstore)
+	if ok {
+		if page, found := store.ReadHTML(id, lm, phRendererID()); found {
+			result := template.HTML(page) // #nosec G203
+			phPut(id, lm, result)
+
+			return result
+		}
+	}
+
+	page, volatile := phRender(aPosting, md, 0)
+	result := template.HTML(page) // #nosec G203
+	if volatile {
+		// the page depends on data other than the posting's text
+		return result
+	}
+	if ok {
+		if err := store.StoreHTML(id, lm, phRendererID(), page); nil != err {
+			apachelogger.Err("postHTML()",
+				fmt.Sprintf("StoreHTML('%s'): %v", id2str(id), err))
+		}
+	}
+	phPut(id, lm, result)
+
+	return result
+} // postHTML()
+
+// `phRender()` converts the Markdown of `aPosting` to its final HTML
+// using the configured Markdown renderer.
+//
+// Parameters:
+//   - `aPosting`: The posting to render.
+//   - `aMarkdown`: The posting's Markdown text.
+//   - `aDepth`: The nesting level of embedded postings.
+//
+// Returns:
+//   - `[]byte`: The posting's HTML.
+//   - `bool`: Whether the HTML must not be cached.
+func phRender(aPosting *TPosting, aMarkdown []byte, aDepth int) ([]byte, bool) {
+	return phRenderWith(mdRenderer, aPosting, aMarkdown, aDepth)
+} // phRender()
+
+// `phRenderWith()` converts the Markdown of `aPosting` to its final
+// HTML using `aRenderer`.
+//
+// Parameters:
+//   - `aRenderer`: The Markdown renderer to use.
+//   - `aPosting`: The posting to render.
+//   - `aMarkdown`: The posting's Markdown text.
+//   - `aDepth`: The nesting level of embedded postings.
+//
+// Returns:
+//   - `[]byte`: The posting's HTML.
+//   - `bool`: Whether the HTML must not be cached.
+func phRenderWith(aRenderer IMarkdownRenderer, aPosting *TPosting, aMarkdown []byte, aDepth int) ([]byte, bool) {
+	md, byTitle := wlPrepare(aMarkdown)
+	md, calls := scPrepare(md, aPosting, aDepth)
+	// the shortcodes are expanded after sanitising since their
+	// markup is provided by the program (or the site's templates)
+	page := saSanitiser.Sanitise(hlHighlight(aRenderer.Render(MarkupTags(md))))
+	page, volatile := scExpand(page, calls)
+
+	// links by title may point to another posting later
+	return page, volatile || byTitle
+} // phRenderWith()
+
+/* _EoF_ */
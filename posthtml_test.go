@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_postHTML(t *testing.T) {
+	prep4Tests()
+	SetPersistence(NewFSpersistence())
+
+	p := NewPosting(0, "A *first* #test")
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer p.Delete()
+
+	// a freshly loaded posting gets its HTML stored
+	p1 := NewPosting(p.ID(), "")
+	want := string(p1.Post())
+	if !strings.Contains(want, "<em>first</em>") || !strings.Contains(want, `href="/hl/test"`) {
+		t.Errorf("Post() = %q", want)
+	}
+	hName := id2htmlname(p.ID())
+	if _, err := os.Stat(hName); nil != err {
+		t.Fatalf("HTML file not stored: %v", err)
+	}
+
+	// the stored HTML is used instead of rendering again
+	phDrop(p.ID())
+	if err := os.WriteFile(hName, append(fsHTMLheader(p1.lastModified, phRendererID()),
+		[]byte("<p>stored</p>")...), 0640); nil != err {
+		t.Fatal(err)
+	}
+	if got := string(NewPosting(p.ID(), "").Post()); "<p>stored</p>" != got {
+		t.Errorf("Post() = %q, want the stored HTML", got)
+	}
+
+	// a changed posting is rendered again
+	p.Set([]byte("A *second* text"))
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	if got := string(NewPosting(p.ID(), "").Post()); !strings.Contains(got, "<em>second</em>") {
+		t.Errorf("Post() = %q, want the changed text", got)
+	}
+
+	// an unsaved text isn't stored
+	p2 := NewPosting(p.ID(), "An *unsaved* text")
+	if got := string(p2.Post()); !strings.Contains(got, "<em>unsaved</em>") {
+		t.Errorf("Post() = %q, want the unsaved text", got)
+	}
+	if bs, _ := os.ReadFile(hName); strings.Contains(string(bs), "unsaved") {
+		t.Error("unsaved text stored")
+	}
+
+	if err := p.Delete(); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(hName); nil == err {
+		t.Error("HTML file not removed")
+	}
+} // Test_postHTML()
+
+func TestTPostList_render(t *testing.T) {
+	prep4Tests()
+	SetPersistence(NewFSpersistence())
+
+	pl := NewPostList()
+	for i := 0; i < 8; i++ {
+		p := NewPosting(0, "Posting **number**")
+		if _, err := p.Store(); nil != err {
+			t.Fatal(err)
+		}
+		defer p.Delete()
+		pl.Add(NewPosting(p.ID(), ""))
+	}
+	pl.render()
+
+	for _, p := range *pl {
+		if _, ok := phGet(p.ID(), p.lastModified); !ok {
+			t.Errorf("posting %s not rendered", p.IDstr())
+		}
+	}
+} // TestTPostList_render()
+
+/* _EoF_ */
@@ -9,6 +9,7 @@ package nele
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -103,6 +104,9 @@ func (p *TPosting) Before(aID uint64) bool {
 // `ChangeID()` changes the ID of the current posting including the
 // persistence layer.
 //
+// The posting's attachments (if any) are moved along and the links
+// to them (as well as the links from other postings) are updated.
+//
 // Note: This method is provided for rare cases when a posting's ID
 // has to be changed.
 //
@@ -120,8 +124,10 @@ func (p *TPosting) ChangeID(aID uint64) error {
 
 		return err
 	}
+	phDrop(oldID)
+	pcPostingsChanged()
 
-	return nil
+	return errors.Join(moveAttachments(oldID, aID), wlRename(oldID, aID))
 } // ChangeID()
 
 // `Clear()` resets the text field to its zero value.
@@ -167,13 +173,22 @@ func (p *TPosting) Date() string {
 // `Delete()` removes the posting/article from the persistence layer
 // returning a possible I/O error.
 //
+// The posting's attachments (if any) are removed as well.
+//
 // This method does NOT empty the markdown text of the object;
 // for that call the `[Clear]` method.
 //
 // Returns:
 //   - `error`: A possible error during processing the request.
 func (p *TPosting) Delete() error {
-	return poPersistence.Delete(p.id)
+	if err := poPersistence.Delete(p.id); nil != err {
+		return err
+	}
+	phDrop(p.id)
+	wlIndex.remove(p.id)
+	pcPostingsChanged()
+
+	return removeAttachments(p.id)
 } // Delete()
 
 // `Equal()` reports whether this posting is of the same time as `aID`.
@@ -257,7 +272,19 @@ func (p *TPosting) Len() int {
 // Returns:
 //   - `error`: A possible error during processing the request.
 func (p *TPosting) Load() error {
-	pp, err := poPersistence.Read(p.id)
+	return p.LoadContext(context.Background())
+} // Load()
+
+// `LoadContext()` reads the Markdown from the persistence layer
+// observing `aCtx`, returning a possible I/O error.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `error`: A possible error during processing the request.
+func (p *TPosting) LoadContext(aCtx context.Context) error {
+	pp, err := poPersistence.ReadContext(aCtx, p.id)
 	if nil != err {
 		return err
 	}
@@ -265,7 +292,7 @@ func (p *TPosting) Load() error {
 	p.markdown = pp.markdown
 
 	return nil
-} // Load()
+} // LoadContext()
 
 // `PathFileName()` returns the article's complete path-/filename.
 //
@@ -283,18 +310,21 @@ func (p *TPosting) PathFileName() string {
 
 // `Post()` returns the article's HTML markup.
 //
-// This method uses the `Markdown()` method to get the latest version of
-// the article's Markdown text.
-// It then converts this text to HTML using the `MDtoHTML()` function and
-// wraps it with the necessary HTML tags using the `MarkupTags()` function.
+// This method uses the `Markdown()` method to get the latest version
+// of the article's Markdown text.
+// After replacing the wiki links and shortcodes it marks up the
+// #hashtags/@mentions by `MarkupTags()` and then converts the text
+// to HTML using the configured Markdown renderer (see
+// `SetMarkdownRenderer()`); finally the HTML gets highlighted and
+// sanitised before the shortcodes are expanded.
 //
-// The resulting HTML is returned as a `template.HTML` value.
+// The resulting HTML is cached per posting ID and modification time,
+// so later calls for the same version of the text don't render it again.
 //
 // Returns:
 //   - `template.HTML`: The HTML markup of the current posting's text.
 func (p *TPosting) Post() template.HTML {
-	// make sure we have the most recent version:
-	return template.HTML(MarkupTags(MDtoHTML(p.Markdown()))) // #nosec G203
+	return postHTML(p)
 } // Post()
 
 // `Markdown()` returns the Markdown of this article.
@@ -353,16 +383,44 @@ func (p *TPosting) Set(aMarkdown []byte) *TPosting {
 //   - `int`: The number of bytes written.
 //   - 'error`: A possible error, or `nil` on success.
 func (p *TPosting) Store() (int, error) {
+	return p.StoreContext(context.Background())
+} // Store()
+
+// `StoreContext()` writes the article's Markdown to the persistence
+// layer observing `aCtx`, returning the number of bytes written and
+// a possible I/O error.
+//
+// All postings should be written by this method since it keeps the
+// page cache and the wiki links' index up to date.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `int`: The number of bytes written.
+//   - 'error`: A possible error, or `nil` on success.
+func (p *TPosting) StoreContext(aCtx context.Context) (int, error) {
 	if nil == p {
 		return 0, se.Wrap(errors.New("nil pointer"), 1)
 	}
 
-	if p.Exists() {
-		return poPersistence.Update(p)
+	if poPersistence.ExistsContext(aCtx, p.id) {
+		result, err := poPersistence.UpdateContext(aCtx, p)
+		pcCache.drop(p.id)
+		if nil == err {
+			wlIndex.update(p)
+		}
+
+		return result, err
+	}
+	result, err := poPersistence.CreateContext(aCtx, p)
+	pcPostingsChanged()
+	if nil == err {
+		wlIndex.update(p)
 	}
 
-	return poPersistence.Create(p)
-} // Store()
+	return result, err
+} // StoreContext()
 
 // `String()` returns a stringified version of the posting instance.
 //
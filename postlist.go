@@ -8,8 +8,11 @@ Copyright © 2019, 2024  M.Watermann, 10247 Berlin, Germany
 package nele
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/mwat56/apachelogger"
@@ -87,14 +90,26 @@ func (pl *TPostList) Add(aPosting *TPosting) *TPostList {
 // Returns:
 //   - `*TPostList`: A list with the postings of the current day.
 func (pl *TPostList) Day() *TPostList {
+	return pl.DayContext(context.Background())
+} // Day()
+
+// `DayContext()` adds all postings of the current day to the list
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//
+// Returns:
+//   - `*TPostList`: A list with the postings of the current day.
+func (pl *TPostList) DayContext(aCtx context.Context) *TPostList {
 	t := time.Now()
 	y, m, d := t.Year(), t.Month(), t.Day()
 
 	tLo := time.Date(y, m, d, 0, 0, 0, -1, time.Local)
 	tHi := time.Date(y, m, d+1, 0, 0, 0, 0, time.Local)
 
-	return pl.doTimeWalk(tLo, tHi)
-} // Day()
+	return pl.doTimeWalk(aCtx, tLo, tHi)
+} // DayContext()
 
 // `Delete()` removes `aPosting` from the list, returning the (possibly
 // modified) list and whether the operation war successful.
@@ -125,12 +140,13 @@ func (pl *TPostList) Delete(aPosting *TPosting) (*TPostList, bool) {
 // `doTimeWalk()` computes the first and last posting to process.
 //
 // Parameters:
+//   - `aCtx`: The context to observe.
 //   - `aLo` is the earliest ID time to use.
 //   - `aHi` is the latest ID time to use.
 //
 // Returns:
 //   - `*TPostList`: A list with postings between `aLo` and `aHi`.
-func (pl *TPostList) doTimeWalk(aLo, aHi time.Time) *TPostList {
+func (pl *TPostList) doTimeWalk(aCtx context.Context, aLo, aHi time.Time) *TPostList {
 	if tn := time.Now(); tn.Before(aHi) {
 		aHi = tn // exclude postings from the future ;-)
 	}
@@ -138,12 +154,12 @@ func (pl *TPostList) doTimeWalk(aLo, aHi time.Time) *TPostList {
 	wf := func(aID uint64) error {
 		tID := id2time(aID)
 		if tID.After(aLo) && tID.Before(aHi) {
-			bgAddPosting(pl, aID)
+			bgAddPosting(aCtx, pl, aID)
 		}
 
 		return nil
 	} // wf()
-	poPersistence.Walk(wf)
+	poPersistence.WalkContext(aCtx, wf)
 
 	return pl
 } // doTimeWalk()
@@ -243,6 +259,20 @@ func (pl *TPostList) Len() int {
 // Returns:
 //   - `*TPostList`: A list with the postings of the given year and month.
 func (pl *TPostList) Month(aYear int, aMonth time.Month) *TPostList {
+	return pl.MonthContext(context.Background(), aYear, aMonth)
+} // Month()
+
+// `MonthContext()` adds all postings of `aMonth` to the list
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aYear`: The year to lookup; if zero the current year is used.
+//   - `aMonth`: The year's month to lookup; if zero the current month is used.
+//
+// Returns:
+//   - `*TPostList`: A list with the postings of the given year and month.
+func (pl *TPostList) MonthContext(aCtx context.Context, aYear int, aMonth time.Month) *TPostList {
 	var (
 		y int
 		m time.Month
@@ -263,8 +293,8 @@ func (pl *TPostList) Month(aYear int, aMonth time.Month) *TPostList {
 	tLo = time.Date(y, m, 1, 0, 0, 0, 0, time.Local)
 	tHi := time.Date(y, m+1, 1, 0, 0, 0, -1, time.Local)
 
-	return pl.doTimeWalk(tLo, tHi)
-} // Month()
+	return pl.doTimeWalk(aCtx, tLo, tHi)
+} // MonthContext()
 
 // `Newest()` adds the last `aLimit` of postings to the list.
 //
@@ -278,6 +308,20 @@ func (pl *TPostList) Month(aYear int, aMonth time.Month) *TPostList {
 // Returns:
 //   - `error`: A possible error during processing of the request.
 func (pl *TPostList) Newest(aLimit, aOffset int) error {
+	return pl.NewestContext(context.Background(), aLimit, aOffset)
+} // Newest()
+
+// `NewestContext()` adds the last `aLimit` of postings to the list
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aLimit`: The number of articles to show.
+//   - `aOffset`: The start number to use.
+//
+// Returns:
+//   - `error`: A possible error during processing of the request.
+func (pl *TPostList) NewestContext(aCtx context.Context, aLimit, aOffset int) error {
 	var lCnt, oCnt int
 
 	if 0 == aLimit {
@@ -299,14 +343,45 @@ func (pl *TPostList) Newest(aLimit, aOffset int) error {
 			// reached the requested limit
 			return ErrSkipAll
 		}
-		bgAddPosting(pln, aID)
+		bgAddPosting(aCtx, pln, aID)
 
 		return nil
 	} // wf()
+	err := poPersistence.WalkContext(aCtx, wf)
+
+	// assign only after the walk since `insert()` may reallocate `pln`:
 	(*pl) = (*pln)
 
-	return poPersistence.Walk(wf)
-} // Newest()
+	return err
+} // NewestContext()
+
+// `render()` renders the HTML of all postings in the list concurrently
+// so that the template later finds them already in the HTML cache.
+//
+// Returns:
+//   - `*TPostList`: The current list of postings.
+func (pl *TPostList) render() *TPostList {
+	if (nil == pl) || (2 > len(*pl)) {
+		return pl
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for idx := range *pl {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(aPosting *TPosting) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			aPosting.Post()
+		}(&(*pl)[idx])
+	}
+	wg.Wait()
+
+	return pl
+} // render()
 
 // `Sort()` returns the list sorted by posting IDs (i.e. date/time)
 // in descending order.
@@ -346,6 +421,21 @@ func (pl *TPostList) String() (rStr string) {
 // Returns:
 //   - `*TPostList`: A list with the postings of the given year, month, and day.
 func (pl *TPostList) Week(aYear int, aMonth time.Month, aDay int) *TPostList {
+	return pl.WeekContext(context.Background(), aYear, aMonth, aDay)
+} // Week()
+
+// `WeekContext()` adds all postings of the current week to the list
+// observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aYear` The year to lookup; if zero the current year is used.
+//   - `aMonth` The year's month to lookup; if zero the current month is used.
+//   - `aDay` The month's day to lookup; if zero the current day is used.
+//
+// Returns:
+//   - `*TPostList`: A list with the postings of the given year, month, and day.
+func (pl *TPostList) WeekContext(aCtx context.Context, aYear int, aMonth time.Month, aDay int) *TPostList {
 	var y, d int
 	var m time.Month
 	tLo := time.Now()
@@ -377,8 +467,8 @@ func (pl *TPostList) Week(aYear int, aMonth time.Month, aDay int) *TPostList {
 	tLo = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
 	tHi := tLo.Add((time.Hour * 24 * 7) + 1)
 
-	return pl.doTimeWalk(tLo, tHi)
-} // Week()
+	return pl.doTimeWalk(aCtx, tLo, tHi)
+} // WeekContext()
 
 // --------------------------------------------------------------------------
 // utility functions:
@@ -388,12 +478,13 @@ func (pl *TPostList) Week(aYear int, aMonth time.Month, aDay int) *TPostList {
 // The data associated with `aID` is loaded from storage.
 //
 // Parameters:
+//   - `aCtx`: The context to observe.
 //   - `aPostList`: The `TPostList` instance to add to.
 //   - `aID` is the identifier of the new posting to add.
-func bgAddPosting(aPostList *TPostList, aID uint64) {
+func bgAddPosting(aCtx context.Context, aPostList *TPostList, aID uint64) {
 	post := NewPosting(aID, "")
 
-	if err := post.Load(); nil != err {
+	if err := post.LoadContext(aCtx); nil != err {
 		apachelogger.Err("TPostList.bgAddPosting()",
 			fmt.Sprintf("TPosting.Load(%q): %v", id2str(aID), err))
 	} else {
@@ -415,9 +506,22 @@ func bgAddPosting(aPostList *TPostList, aID uint64) {
 // Returns:
 //   - `*TPostList`: The found list.
 func SearchPostings(aText string) *TPostList {
-	result, _ := poPersistence.Search(aText, 0, 0)
+	return SearchPostingsContext(context.Background(), aText)
+} // SearchPostings()
+
+// `SearchPostingsContext()` traverses all postings looking for `aText`
+// in the respective post's text observing `aCtx`.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aText`: The text to look for in the postings.
+//
+// Returns:
+//   - `*TPostList`: The found list.
+func SearchPostingsContext(aCtx context.Context, aText string) *TPostList {
+	result, _ := poPersistence.SearchContext(aCtx, aText, 0, 0)
 
 	return result
-} // SearchPostings()
+} // SearchPostingsContext()
 
 /* _EoF_ */
@@ -0,0 +1,180 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the sanitising of the postings' HTML
+ * removing e.g. scripts and event handlers.
+ */
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+type (
+	// `ISanitiser` removes unwanted markup from the postings' HTML.
+	//
+	// Implementations must be safe for concurrent use.
+	ISanitiser interface {
+		//
+		// `ID()` returns the sanitiser's identifier; it must change
+		// whenever the sanitiser's output changes.
+		//
+		// Returns:
+		//	- `string`: The sanitiser's name.
+		ID() string
+
+		//
+		// `Sanitise()` returns the allowed parts of `aHTML`.
+		//
+		// Parameters:
+		//	- `aHTML` The HTML to clean up.
+		//
+		// Returns:
+		//	- `[]byte`: The sanitised HTML.
+		Sanitise(aHTML []byte) []byte
+	}
+
+	// `tPolicySanitiser` keeps only the elements and attributes
+	// allowed by its policy.
+	tPolicySanitiser struct {
+		id     string
+		policy *bluemonday.Policy
+	}
+
+	// `tTrustedSanitiser` accepts all HTML.
+	tTrustedSanitiser struct{}
+)
+
+const (
+	// Names of the available sanitisers:
+	saStrict  = `strict`
+	saTrusted = `trusted`
+)
+
+var (
+	// The sanitiser used for the postings.
+	//
+	// It should be considered `R/O` after the initial configuration.
+	saSanitiser ISanitiser = NewSanitiser(false, ``)
+
+	// RegEx to validate an element or attribute name.
+	saNameRE = regexp.MustCompile(`^[a-zA-Z][\w-]*$`)
+)
+
+// `NewSanitiser()` returns a sanitiser for the postings' HTML.
+//
+// The strict default policy allows the common text markup (including
+// images, tables, and footnotes) but neither scripts, styles, forms,
+// nor embedded frames. `aAllow` can add more elements (`video`) and
+// attributes (`video.src`) to that policy; separate the entries by
+// blanks or commas.
+//
+// Parameters:
+//   - `aTrusted`: Whether to accept all HTML, i.e. not sanitise at all.
+//   - `aAllow`: Additional elements/attributes to allow.
+//
+// Returns:
+//   - `ISanitiser`: The requested sanitiser.
+func NewSanitiser(aTrusted bool, aAllow string) ISanitiser {
+	if aTrusted {
+		return tTrustedSanitiser{}
+	}
+
+	policy := bluemonday.UGCPolicy()
+	// the author's own links shouldn't be devalued
+	policy.RequireNoFollowOnLinks(false)
+	// used by the highlighting, footnotes, and #hashtags
+	policy.AllowAttrs(`class`).Matching(bluemonday.SpaceSeparatedTokens).Globally()
+	policy.AllowAttrs(`role`).Matching(regexp.MustCompile(`^doc-[a-z]+$`)).Globally()
+	policy.AllowElements(`kbd`)
+	// task lists
+	policy.AllowAttrs(`type`).Matching(regexp.MustCompile(`^checkbox$`)).OnElements(`input`)
+	policy.AllowAttrs(`checked`, `disabled`).Matching(regexp.MustCompile(`^$`)).OnElements(`input`)
+
+	result := tPolicySanitiser{
+		id:     saStrict,
+		policy: policy,
+	}
+	allow := strings.Fields(strings.ReplaceAll(strings.ToLower(aAllow), `,`, ` `))
+	if 0 == len(allow) {
+		return result
+	}
+
+	for _, entry := range allow {
+		element, attr, _ := strings.Cut(entry, `.`)
+		if !saNameRE.MatchString(element) {
+			continue
+		}
+		if 0 == len(attr) {
+			policy.AllowElements(element)
+		} else if saNameRE.MatchString(attr) {
+			policy.AllowAttrs(attr).OnElements(element)
+		}
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(strings.Join(allow, ` `)))
+	result.id = fmt.Sprintf("%s%08x", saStrict, hash.Sum32())
+
+	return result
+} // NewSanitiser()
+
+// `Sanitiser()` returns the sanitiser used for the postings.
+//
+// Returns:
+//   - `ISanitiser`: The current HTML sanitiser.
+func Sanitiser() ISanitiser {
+	return saSanitiser
+} // Sanitiser()
+
+// `SetSanitiser()` sets the sanitiser to use for the postings.
+//
+// A `nil` argument is ignored.
+//
+// Parameters:
+//   - `aSanitiser`: The HTML sanitiser to use.
+func SetSanitiser(aSanitiser ISanitiser) {
+	if nil != aSanitiser {
+		saSanitiser = aSanitiser
+	}
+} // SetSanitiser()
+
+// --------------------------------------------------------------------------
+// tPolicySanitiser methods
+
+// `ID()` returns the sanitiser's identifier.
+func (ps tPolicySanitiser) ID() string {
+	return ps.id
+} // ID()
+
+// `Sanitise()` returns the allowed parts of `aHTML`.
+func (ps tPolicySanitiser) Sanitise(aHTML []byte) []byte {
+	return ps.policy.SanitizeBytes(aHTML)
+} // Sanitise()
+
+// --------------------------------------------------------------------------
+// tTrustedSanitiser methods
+
+// `ID()` returns the sanitiser's identifier.
+func (tTrustedSanitiser) ID() string {
+	return saTrusted
+} // ID()
+
+// `Sanitise()` returns `aHTML` unchanged.
+func (tTrustedSanitiser) Sanitise(aHTML []byte) []byte {
+	return aHTML
+} // Sanitise()
+
+/* _EoF_ */
@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSanitiser_xss(t *testing.T) {
+	sa := NewSanitiser(false, ``)
+
+	// none of these may survive in the sanitised HTML
+	// (harmless plain text like `alert(1)` may remain)
+	bad := []string{`<script`, `javascript:`, `onerror`, `onload`,
+		`ontoggle`, `onmouseover`, `<iframe`, `<object`, `<embed`, `<form`,
+		`<style`, `style=`, `<svg`, `<math`, `<base`, `<meta`, `vbscript:`, `data:text`}
+
+	tests := []struct {
+		name string
+		html string
+	}{
+		{" 1", `<p>Hi <script>alert(1)</script></p>`},
+		{" 2", `<img src="x" onerror="alert(1)">`},
+		{" 3", `<a href="javascript:alert(1)">click</a>`},
+		{" 4", `<a href="&#106;avascript:alert(1)">click</a>`},
+		{" 5", `<a href=" JaVaScRiPt:alert(1)">click</a>`},
+		{" 6", `<iframe src="https://evil.example/"></iframe>`},
+		{" 7", `<svg onload="alert(1)"><circle r="1"/></svg>`},
+		{" 8", `<div style="background:url(javascript:alert(1))">x</div>`},
+		{" 9", `<object data="evil.swf"></object><embed src="evil.swf">`},
+		{"10", `<form action="https://evil.example/"><input type="password"></form>`},
+		{"11", `<details open ontoggle="alert(1)"><summary>x</summary></details>`},
+		{"12", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>`},
+		{"13", `<p onmouseover="alert(1)">hover</p>`},
+		{"14", `<style>body{display:none}</style><base href="https://evil.example/">`},
+		{"15", `<meta http-equiv="refresh" content="0;url=https://evil.example/">`},
+		{"16", `<a href="vbscript:msgbox(1)">x</a><img src="data:text/html;base64,PHNjcmlwdD4=">`},
+		{"17", `<scr<script>ipt>alert(1)</script>`},
+		{"18", `<img src=x onerror=alert(1)//`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.ToLower(string(sa.Sanitise([]byte(tt.html))))
+			for _, b := range bad {
+				if strings.Contains(got, b) {
+					t.Errorf("Sanitise(%q) = %q, contains %q", tt.html, got, b)
+				}
+			}
+		})
+	}
+} // TestNewSanitiser_xss()
+
+func TestNewSanitiser_allowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted bool
+		allow   string
+		html    string
+		want    string
+	}{
+		{" 1", false, ``, `<pre class="language-go chroma">
+<span class="kd">func</span></pre>`, `<pre class="language-go chroma">
+<span class="kd">func</span></pre>`},
+		{" 2", false, ``, `<a href="/hl/test" class="smaller">#test</a>`, `<a href="/hl/test" class="smaller">#test</a>`},
+		{" 3", false, ``, `<a href="https://example.com/">x</a>`, `<a href="https://example.com/">x</a>`},
+		{" 4", false, ``, `<sup class="footnote-ref" id="fnref:1"><a href="#fn:1">1</a></sup>`, `<sup class="footnote-ref" id="fnref:1"><a href="#fn:1">1</a></sup>`},
+		{" 5", false, ``, `<li><input checked="" disabled="" type="checkbox"> done</li>`, `<li><input checked="" disabled="" type="checkbox"> done</li>`},
+		{" 6", false, ``, `<img src="/img/a.png" alt="a">`, `<img src="/img/a.png" alt="a">`},
+		{" 7", false, ``, `<video src="/static/a.mp4"></video>`, ``},
+		{" 8", false, `video, video.src`, `<video src="/static/a.mp4"></video>`, `<video src="/static/a.mp4"></video>`},
+		{" 9", true, ``, `<script>alert(1)</script>`, `<script>alert(1)</script>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := NewSanitiser(tt.trusted, tt.allow)
+			if got := string(sa.Sanitise([]byte(tt.html))); got != tt.want {
+				t.Errorf("Sanitise() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // TestNewSanitiser_allowed()
+
+func TestNewSanitiser_ID(t *testing.T) {
+	if id := NewSanitiser(false, ``).ID(); saStrict != id {
+		t.Errorf("ID() = %q, want %q", id, saStrict)
+	}
+	if id := NewSanitiser(true, `video`).ID(); saTrusted != id {
+		t.Errorf("ID() = %q, want %q", id, saTrusted)
+	}
+	id1, id2 := NewSanitiser(false, `video`).ID(), NewSanitiser(false, `audio`).ID()
+	if (id1 == id2) || (saStrict == id1) {
+		t.Errorf("ID() = %q, %q, want different IDs", id1, id2)
+	}
+} // TestNewSanitiser_ID()
+
+func Test_phRender_sanitised(t *testing.T) {
+	prep4Tests()
+
+	p := NewPosting(0, "Text <script>alert(1)</script> and <b onclick=\"x()\">bold</b>\n\n{{< youtube dQw4w9WgXcQ >}}")
+	got, _ := phRender(p, p.Markdown(), 0)
+	if strings.Contains(string(got), `<script`) || strings.Contains(string(got), `onclick`) {
+		t.Errorf("phRender() = %q, want sanitised HTML", got)
+	}
+	if !strings.Contains(string(got), `<b>bold</b>`) {
+		t.Errorf("phRender() = %q, want allowed markup", got)
+	}
+	// the shortcodes' markup is kept
+	if !strings.Contains(string(got), `<iframe srcdoc="`) {
+		t.Errorf("phRender() = %q, want the shortcode's frame", got)
+	}
+} // Test_phRender_sanitised()
+
+/* _EoF_ */
@@ -10,6 +10,7 @@ package nele
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -20,6 +21,13 @@ import (
 	"github.com/mwat56/screenshot"
 )
 
+const (
+	// `ssMaxWorkers` is the max. number of postings processed
+	// concurrently by `goUpdateAllLinkScreenshots()`; each of them
+	// may start a (resource hungry) headless browser instance.
+	ssMaxWorkers = 4
+)
+
 type (
 	// `tImgURL` represents a pair of image name and page URL.
 	tImgURL struct {
@@ -130,6 +138,8 @@ func goSetLinkScreenshots(aPosting *TPosting) {
 
 // `goUpdateAllLinkScreenshots()` prepares the external links in
 // all postings to use a page screenshot image (if available).
+//
+// At most `ssMaxWorkers` postings are processed concurrently.
 func goUpdateAllLinkScreenshots() {
 	wf := func(aID uint64) error {
 		post := NewPosting(aID, "")
@@ -138,13 +148,14 @@ func goUpdateAllLinkScreenshots() {
 			return nil
 		}
 
-		go goSetLinkScreenshots(post)
-		runtime.Gosched() // get the background operation started
+		goSetLinkScreenshots(post)
 
 		return nil
 	} // wf()
 
-	poPersistence.Walk(wf)
+	if err := WalkParallel(context.Background(), ssMaxWorkers, wf, nil); nil != err {
+		apachelogger.Err("goUpdateAllLinkScreenshots()", err.Error())
+	}
 } // goUpdateAllLinkScreenshots()
 
 // `preparePost()` creates a screenshot image and updates `aLink`
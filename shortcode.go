@@ -0,0 +1,720 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the shortcodes (like `{{< youtube ID >}}`)
+ * which can be used inside the postings to embed richer content.
+ *
+ * Shortcodes are either registered from Go by `RegisterShortcode()`
+ * or defined by a template `<dataDir>/views/shortcodes/<name>.gohtml`.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	se "github.com/mwat56/sourceerror"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+)
+
+type (
+	// `TShortcode` is a single shortcode call inside a posting.
+	TShortcode struct {
+		Name     string            // the shortcode's name
+		Args     []string          // the positional arguments
+		Params   map[string]string // the named (`key="value"`) arguments
+		Posting  *TPosting         // the posting using the shortcode
+		depth    int               // nesting level of embedded postings
+		source   string            // the shortcode's original text
+		volatile bool              // output depends on more than the text
+	}
+
+	// `tSCtemplate` is the parsed template of a shortcode.
+	tSCtemplate struct {
+		tpl     *template.Template // the template (`nil` if there's none)
+		modTime time.Time          // modification time of the template file
+	}
+
+	// `TShortcodeFunc` renders a shortcode.
+	//
+	// Parameters:
+	//	- `aShortcode`: The shortcode call to render.
+	//
+	// Returns:
+	//	- `template.HTML`: The shortcode's HTML.
+	//	- `error`: A possible error, or `nil` on success.
+	TShortcodeFunc func(aShortcode *TShortcode) (template.HTML, error)
+)
+
+const (
+	// Max. nesting level of postings embedded by `{{< posting >}}`.
+	scMaxDepth = 2
+
+	// Format of the placeholders replacing the shortcodes while
+	// the Markdown is rendered.
+	scPlaceholder = `NELESC%dX`
+
+	// Time between two checks of the shortcode templates' directory.
+	scCheckInterval = 10 * time.Second
+)
+
+var (
+	// RegEx to find a shortcode; the escaped form `{{</* … */>}}`
+	// is shown literally.
+	scRE = regexp.MustCompile(`\{\{<[ \t]*(/\*)?[ \t]*([a-zA-Z][\w-]*)((?:[ \t]+[^>\n]*?)?)[ \t]*(\*/)?[ \t]*>\}\}`)
+	//                                    1111          222222222222222  3333333333333333333333           4444
+
+	// RegEx to split a shortcode's arguments.
+	scArgRE = regexp.MustCompile(`([\w-]+)=(?:"([^"]*)"|(\S+))|"([^"]*)"|(\S+)`)
+	//                            1111111     2222222   333     4444444   555
+
+	// RegEx to find the placeholders in the rendered HTML.
+	scPlaceholderRE = regexp.MustCompile(`NELESC(\d+)X`)
+
+	// The registered shortcode functions (see `init()`).
+	scFuncs = make(map[string]TShortcodeFunc)
+
+	// The parsed shortcode templates.
+	scTemplates = make(map[string]tSCtemplate)
+
+	// The version of the shortcode templates (see `scTemplatesID()`)
+	// and the time it was determined.
+	scTemplatesVersion string
+	scTemplatesChecked time.Time
+
+	// Guard against concurrent access of `scFuncs`, `scTemplates`,
+	// and `scTemplatesVersion`.
+	scMtx sync.RWMutex
+)
+
+func init() {
+	// The built-in shortcodes are registered here to avoid an
+	// initialisation cycle (`posting` renders postings itself).
+	scFuncs[`gallery`] = scGallery
+	scFuncs[`map`] = scMap
+	scFuncs[`posting`] = scPosting
+	scFuncs[`vimeo`] = scVimeo
+	scFuncs[`youtube`] = scYouTube
+} // init()
+
+// `RegisterShortcode()` makes `aFunc` available as the shortcode
+// named `aName`, replacing a possibly existing one.
+//
+// Parameters:
+//   - `aName`: The shortcode's name as used in the postings.
+//   - `aFunc`: The function rendering the shortcode.
+func RegisterShortcode(aName string, aFunc TShortcodeFunc) {
+	if (0 == len(aName)) || (nil == aFunc) {
+		return
+	}
+	scMtx.Lock()
+	scFuncs[aName] = aFunc
+	scMtx.Unlock()
+} // RegisterShortcode()
+
+// --------------------------------------------------------------------------
+// TShortcode methods
+
+// `Arg()` returns the positional argument with index `aIdx`.
+//
+// Parameters:
+//   - `aIdx`: The zero-based index of the argument.
+//
+// Returns:
+//   - `string`: The argument, or an empty string if missing.
+func (sc *TShortcode) Arg(aIdx int) string {
+	if (0 > aIdx) || (len(sc.Args) <= aIdx) {
+		return ``
+	}
+
+	return sc.Args[aIdx]
+} // Arg()
+
+// `Volatile()` marks the shortcode's output as depending on data
+// other than the posting's text (like e.g. another posting) so the
+// posting's HTML won't be cached.
+func (sc *TShortcode) Volatile() {
+	sc.volatile = true
+} // Volatile()
+
+// `render()` returns the HTML of the shortcode.
+//
+// Unknown shortcodes and failing ones are shown literally.
+//
+// Returns:
+//   - `[]byte`: The shortcode's HTML.
+//   - `bool`: Whether the shortcode was expanded.
+func (sc *TShortcode) render() ([]byte, bool) {
+	scMtx.RLock()
+	fn, ok := scFuncs[sc.Name]
+	scMtx.RUnlock()
+	if !ok {
+		fn = scTemplate
+	}
+
+	result, err := fn(sc)
+	if nil != err {
+		apachelogger.Err("TShortcode.render()",
+			fmt.Sprintf("%s: %v", sc.source, err))
+
+		return []byte(template.HTMLEscapeString(sc.source)), false
+	}
+
+	return []byte(result), true
+} // render()
+
+// --------------------------------------------------------------------------
+// helper functions
+
+// `scExpand()` replaces the placeholders in `aPage` by the HTML
+// of the respective shortcodes.
+//
+// A placeholder standing alone in a paragraph replaces the whole
+// paragraph. Only placeholders in the page's text are expanded;
+// those ending up elsewhere (e.g. in an attribute like a link's
+// URL, or inside of code and links) are replaced by the shortcode's
+// escaped source.
+//
+// Parameters:
+//   - `aPage`: The rendered HTML of the posting.
+//   - `aCalls`: The shortcodes as returned by `scPrepare()`.
+//
+// Returns:
+//   - `[]byte`: The page with the shortcodes expanded.
+//   - `bool`: Whether any shortcode was marked volatile.
+func scExpand(aPage []byte, aCalls []*TShortcode) ([]byte, bool) {
+	if 0 == len(aCalls) {
+		return aPage, false
+	}
+
+	var (
+		result   bytes.Buffer
+		volatile bool
+		inside   int // nesting level of `a`, `code`, and `pre` elements
+		pos      int // position of the current token in `aPage`
+	)
+	// `call()` returns the shortcode of the placeholder `aMatch`.
+	call := func(aMatch []byte) *TShortcode {
+		idx, err := strconv.Atoi(string(scPlaceholderRE.FindSubmatch(aMatch)[1]))
+		if (nil != err) || (len(aCalls) <= idx) {
+			return nil
+		}
+
+		return aCalls[idx]
+	} // call()
+
+	// `expand()` replaces the placeholders in `aText`, rendering the
+	// shortcodes if `aRender` is `true`.
+	expand := func(aText []byte, aRender bool) []byte {
+		return scPlaceholderRE.ReplaceAllFunc(aText, func(aMatch []byte) []byte {
+			sc := call(aMatch)
+			if nil == sc {
+				return aMatch
+			}
+			if !aRender {
+				return []byte(template.HTMLEscapeString(sc.source))
+			}
+			page, _ := sc.render()
+			volatile = volatile || sc.volatile
+
+			return page
+		})
+	} // expand()
+
+	z := html.NewTokenizer(bytes.NewReader(aPage))
+	for tt := z.Next(); html.ErrorToken != tt; tt = z.Next() {
+		raw := z.Raw()
+		pos += len(raw)
+		switch tt {
+		case html.TextToken:
+			if (0 == inside) && (len(raw) == len(scPlaceholderRE.Find(raw))) &&
+				bytes.HasSuffix(result.Bytes(), []byte(`<p>`)) &&
+				bytes.HasPrefix(aPage[pos:], []byte(`</p>`)) {
+				if sc := call(raw); nil != sc {
+					page, ok := sc.render()
+					volatile = volatile || sc.volatile
+					if ok {
+						// replace the whole paragraph
+						result.Truncate(result.Len() - len(`<p>`))
+						result.Write(page)
+						z.Next() // skip the `</p>`
+						pos += len(`</p>`)
+					} else {
+						result.Write(page)
+					}
+					continue
+				}
+			}
+			result.Write(expand(raw, 0 == inside))
+
+		case html.StartTagToken, html.EndTagToken:
+			if name, _ := z.TagName(); slices.Contains([]string{`a`, `code`, `pre`}, string(name)) {
+				if html.StartTagToken == tt {
+					inside++
+				} else if 0 < inside {
+					inside--
+				}
+			}
+			result.Write(expand(raw, false))
+
+		default:
+			result.Write(expand(raw, false))
+		}
+	}
+
+	return result.Bytes(), volatile
+} // scExpand()
+
+// `scParse()` returns the shortcode call `aName` with the arguments
+// given by `aArgs`.
+//
+// Parameters:
+//   - `aSource`: The shortcode's original text.
+//   - `aName`: The shortcode's name.
+//   - `aArgs`: The shortcode's arguments.
+//
+// Returns:
+//   - `*TShortcode`: The shortcode call.
+func scParse(aSource, aName, aArgs string) *TShortcode {
+	result := &TShortcode{
+		Name:   aName,
+		Params: make(map[string]string),
+		source: aSource,
+	}
+	for _, m := range scArgRE.FindAllStringSubmatch(aArgs, -1) {
+		switch {
+		case 0 < len(m[1]):
+			result.Params[m[1]] = m[2] + m[3]
+		case 0 < len(m[4]):
+			result.Args = append(result.Args, m[4])
+		default:
+			result.Args = append(result.Args, m[5])
+		}
+	}
+
+	return result
+} // scParse()
+
+// `scDetect()` returns the positions of the shortcodes in `aMarkdown`
+// (as returned by `scRE.FindAllSubmatchIndex()`).
+//
+// Shortcodes inside of code spans and blocks, raw HTML, link texts,
+// and images are ignored.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's Markdown text.
+//
+// Returns:
+//   - `[][]int`: The positions of the shortcodes and their parts.
+func scDetect(aMarkdown []byte) [][]int {
+	matches := scRE.FindAllSubmatchIndex(aMarkdown, -1)
+	if 0 == len(matches) {
+		return nil
+	}
+
+	var skip [][2]int // the text ranges to ignore
+	addLines := func(aLines *text.Segments) {
+		if 0 < aLines.Len() {
+			skip = append(skip, [2]int{aLines.At(0).Start, aLines.At(aLines.Len() - 1).Stop})
+		}
+	} // addLines()
+	doc := gmParser.Parse(text.NewReader(aMarkdown))
+	_ = ast.Walk(doc, func(aNode ast.Node, aEntering bool) (ast.WalkStatus, error) {
+		if !aEntering {
+			return ast.WalkContinue, nil
+		}
+		switch aNode.Kind() {
+		case ast.KindCodeBlock, ast.KindFencedCodeBlock, ast.KindHTMLBlock:
+			addLines(aNode.Lines())
+			return ast.WalkSkipChildren, nil
+
+		case ast.KindRawHTML:
+			segs := aNode.(*ast.RawHTML).Segments
+			if (0 < segs.Len()) && !bytes.HasSuffix(aMarkdown[:segs.At(0).Start], []byte(`{{`)) {
+				// not a shortcode like `{{<name>}}`
+				addLines(segs)
+			}
+			return ast.WalkSkipChildren, nil
+
+		case ast.KindCodeSpan, ast.KindImage, ast.KindLink:
+			start, stop := len(aMarkdown), 0
+			_ = ast.Walk(aNode, func(aChild ast.Node, aEntering bool) (ast.WalkStatus, error) {
+				if t, ok := aChild.(*ast.Text); ok && aEntering {
+					start, stop = min(start, t.Segment.Start), max(stop, t.Segment.Stop)
+				}
+				return ast.WalkContinue, nil
+			})
+			if start < stop {
+				skip = append(skip, [2]int{start, stop})
+			}
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	result := matches[:0]
+	for _, m := range matches {
+		if !slices.ContainsFunc(skip, func(aRange [2]int) bool {
+			return (m[0] < aRange[1]) && (aRange[0] < m[1])
+		}) {
+			result = append(result, m)
+		}
+	}
+
+	return result
+} // scDetect()
+
+// `scPrepare()` replaces all shortcodes in `aMarkdown` (outside of
+// code, raw HTML, and links) by placeholders which survive the
+// Markdown rendering.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's Markdown text.
+//   - `aPosting`: The posting being rendered.
+//   - `aDepth`: The nesting level of embedded postings.
+//
+// Returns:
+//   - `[]byte`: The Markdown with placeholders.
+//   - `[]*TShortcode`: The shortcodes found.
+func scPrepare(aMarkdown []byte, aPosting *TPosting, aDepth int) ([]byte, []*TShortcode) {
+	if !bytes.Contains(aMarkdown, []byte(`{{<`)) {
+		return aMarkdown, nil
+	}
+
+	var (
+		calls  []*TShortcode
+		result []byte
+		last   int // end of the text copied so far
+	)
+	for _, m := range scDetect(aMarkdown) {
+		result = append(result, aMarkdown[last:m[0]]...)
+		last = m[1]
+		name, args := string(aMarkdown[m[4]:m[5]]), string(aMarkdown[m[6]:m[7]])
+		if (0 <= m[2]) && (0 <= m[8]) {
+			// escaped shortcode: show it literally
+			result = append(result, `{{< `+strings.TrimSpace(name+args)+` >}}`...)
+			continue
+		}
+		sc := scParse(string(aMarkdown[m[0]:m[1]]), name, args)
+		sc.Posting, sc.depth = aPosting, aDepth
+		calls = append(calls, sc)
+		result = append(result, fmt.Sprintf(scPlaceholder, len(calls)-1)...)
+	}
+	if 0 == last {
+		return aMarkdown, nil
+	}
+
+	return append(result, aMarkdown[last:]...), calls
+} // scPrepare()
+
+// `scTemplate()` renders a shortcode by the template
+// `views/shortcodes/<name>.gohtml`.
+//
+// The template gets the shortcode as its data, i.e. it can use
+// `.Name`, `.Args`, `.Params`, `.Posting`, and `.Arg`.
+// A template changed in the data directory is read again.
+//
+// Parameters:
+//   - `aShortcode`: The shortcode call to render.
+//
+// Returns:
+//   - `template.HTML`: The shortcode's HTML.
+//   - `error`: A possible error, or `nil` on success.
+func scTemplate(aShortcode *TShortcode) (template.HTML, error) {
+	var modTime time.Time // zero for the templates shipped
+	if fi, err := os.Stat(scTemplateFile(aShortcode.Name)); nil == err {
+		modTime = fi.ModTime()
+	}
+
+	scMtx.RLock()
+	entry, ok := scTemplates[aShortcode.Name]
+	scMtx.RUnlock()
+
+	if !ok || !entry.modTime.Equal(modTime) {
+		tpl, err := scLoadTemplate(aShortcode.Name)
+		if nil != err {
+			return ``, err
+		}
+		entry = tSCtemplate{tpl: tpl, modTime: modTime}
+		scMtx.Lock()
+		scTemplates[aShortcode.Name] = entry
+		scMtx.Unlock()
+	}
+	if nil == entry.tpl {
+		return ``, se.Wrap(fmt.Errorf("unknown shortcode '%s'", aShortcode.Name), 1)
+	}
+
+	var buf bytes.Buffer
+	if err := entry.tpl.Execute(&buf, aShortcode); nil != err {
+		return ``, se.Wrap(err, 1)
+	}
+
+	return template.HTML(buf.String()), nil // #nosec G203
+} // scTemplate()
+
+// `scTemplateFile()` returns the path of the template of the
+// shortcode `aName` in the data directory.
+//
+// Parameters:
+//   - `aName`: The shortcode's name.
+//
+// Returns:
+//   - `string`: The template's path-/filename.
+func scTemplateFile(aName string) string {
+	return filepath.Join(AppArgs.DataDir, `views`, `shortcodes`, aName+`.gohtml`)
+} // scTemplateFile()
+
+// `scTemplatesID()` identifies the current version of the shortcode
+// templates in the data directory, i.e. the latest modification of
+// that directory or one of its files.
+//
+// The directory is checked at most every `scCheckInterval`.
+//
+// Returns:
+//   - `string`: The templates' version.
+func scTemplatesID() string {
+	scMtx.RLock()
+	result, checked := scTemplatesVersion, scTemplatesChecked
+	scMtx.RUnlock()
+	if time.Since(checked) < scCheckInterval {
+		return result
+	}
+
+	var latest time.Time
+	dir := filepath.Dir(scTemplateFile(`x`))
+	if fi, err := os.Stat(dir); nil == err {
+		latest = fi.ModTime()
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if fi, err := entry.Info(); (nil == err) && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	result = strconv.FormatInt(latest.UnixNano(), 36)
+
+	scMtx.Lock()
+	scTemplatesVersion, scTemplatesChecked = result, time.Now()
+	scMtx.Unlock()
+
+	return result
+} // scTemplatesID()
+
+// `scLoadTemplate()` reads the template of the shortcode `aName`
+// from the `views/shortcodes/` directory below `AppArgs.DataDir`,
+// falling back to the templates shipped with the program.
+//
+// Parameters:
+//   - `aName`: The shortcode's name.
+//
+// Returns:
+//   - `*template.Template`: The parsed template, or `nil` if there's none.
+//   - `error`: A possible error, or `nil` on success.
+func scLoadTemplate(aName string) (*template.Template, error) {
+	fc, err := os.ReadFile(scTemplateFile(aName)) /* #nosec G304 */
+	if nil != err {
+		if fc, err = viewsFS.ReadFile(path.Join(`views`, `shortcodes`, aName+`.gohtml`)); nil != err {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, se.Wrap(err, 2)
+		}
+	}
+
+	tpl, err := template.New(aName).Funcs(viewFunctionMap).Parse(string(fc))
+	if nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+
+	return tpl, nil
+} // scLoadTemplate()
+
+// --------------------------------------------------------------------------
+// built-in shortcodes
+
+var (
+	// RegEx to validate a YouTube video ID.
+	scYouTubeRE = regexp.MustCompile(`^[\w-]{6,20}$`)
+
+	// RegEx to validate a Vimeo video ID.
+	scVimeoRE = regexp.MustCompile(`^\d{1,12}$`)
+)
+
+// `scClickToLoad()` returns the markup of an external embed which is
+// only loaded after the reader clicked on it, so the external site gets
+// no request (and no data about the reader) before.
+//
+// The frame initially shows a local placeholder (`srcdoc`) whose link
+// loads the external content into the frame; the page itself holds
+// no `src` pointing to the external site.
+//
+// Parameters:
+//   - `aClass`: The embed's type used as CSS class.
+//   - `aTitle`: The text to show before loading.
+//   - `aSrc`: The URL of the embedded frame.
+//   - `aLink`: The URL of the content on the external site.
+//
+// Returns:
+//   - `template.HTML`: The embed's markup.
+func scClickToLoad(aClass, aTitle, aSrc, aLink string) template.HTML {
+	title := template.HTMLEscapeString(aTitle)
+	placeholder := `<style>body{display:flex;align-items:center;justify-content:center;height:100vh;margin:0;background:#333;font-family:sans-serif}` +
+		`a{color:#fff;font-size:1.2em;text-decoration:none}</style><a href="` +
+		template.HTMLEscapeString(aSrc) + `" rel="noreferrer">▶ ` + title + `</a>`
+
+	return template.HTML(`<div class="sc-embed sc-` + aClass + `"><iframe srcdoc="` +
+		template.HTMLEscapeString(placeholder) + `" title="` + title +
+		`" allowfullscreen referrerpolicy="no-referrer"></iframe><p class="small"><a href="` +
+		template.HTMLEscapeString(aLink) + `" rel="noopener">` +
+		template.HTMLEscapeString(aLink) + `</a></p></div>`) // #nosec G203
+} // scClickToLoad()
+
+// `scGallery()` renders all images of a directory as a gallery.
+//
+// The directory (given relative to `AppArgs.DataDir`) must be below
+// `attachments/`, `img/`, or `static/`; without argument the posting's
+// own attachments are shown.
+//
+//	{{< gallery img/holidays >}}
+func scGallery(aShortcode *TShortcode) (template.HTML, error) {
+	dir := path.Clean(`/` + aShortcode.Arg(0))[1:]
+	if 0 == len(dir) {
+		if nil == aShortcode.Posting {
+			return ``, se.Wrap(errors.New("missing directory"), 1)
+		}
+		dir = atDirName + `/` + aShortcode.Posting.IDstr()
+	}
+	switch strings.SplitN(dir, `/`, 2)[0] {
+	case atDirName, `img`, `static`:
+		// accepted directories
+	default:
+		return ``, se.Wrap(fmt.Errorf("invalid directory '%s'", dir), 1)
+	}
+	// files may be added or removed later on
+	aShortcode.Volatile()
+
+	entries, err := os.ReadDir(filepath.Join(AppArgs.DataDir, filepath.FromSlash(dir)))
+	if nil != err && !errors.Is(err, fs.ErrNotExist) {
+		return ``, se.Wrap(err, 2)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`<div class="sc-gallery">`)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !(TMediaFile{Name: entry.Name()}).IsImage() {
+			continue
+		}
+		url := template.HTMLEscapeString(`/` + dir + `/` + entry.Name())
+		fmt.Fprintf(&buf, `<a href="%s"><img src="%s" alt="%s" loading="lazy"></a>`,
+			url, url, template.HTMLEscapeString(entry.Name()))
+	}
+	buf.WriteString(`</div>`)
+
+	return template.HTML(buf.String()), nil // #nosec G203
+} // scGallery()
+
+// `scMap()` renders an OpenStreetMap showing the given position.
+//
+//	{{< map 52.5163 13.3777 [zoom] >}}
+func scMap(aShortcode *TShortcode) (template.HTML, error) {
+	lat, err1 := strconv.ParseFloat(aShortcode.Arg(0), 64)
+	lon, err2 := strconv.ParseFloat(aShortcode.Arg(1), 64)
+	if (nil != err1) || (nil != err2) || (90 < lat) || (-90 > lat) || (180 < lon) || (-180 > lon) {
+		return ``, se.Wrap(errors.New("invalid position"), 1)
+	}
+	zoom, err := strconv.Atoi(aShortcode.Arg(2))
+	if (nil != err) || (1 > zoom) || (19 < zoom) {
+		zoom = 15
+	}
+	// size of the shown area at the given zoom level
+	delta := 360.0 / float64(int(1)<<zoom)
+
+	src := fmt.Sprintf("https://www.openstreetmap.org/export/embed.html?bbox=%.5f,%.5f,%.5f,%.5f&layer=mapnik&marker=%.5f,%.5f",
+		lon-delta, lat-delta/2, lon+delta, lat+delta/2, lat, lon)
+	link := fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.5f&mlon=%.5f#map=%d/%.5f/%.5f",
+		lat, lon, zoom, lat, lon)
+
+	return scClickToLoad(`map`, fmt.Sprintf("OpenStreetMap: %.5f, %.5f", lat, lon), src, link), nil
+} // scMap()
+
+// `scPosting()` quotes another posting.
+//
+//	{{< posting 17f3a2b4c5d6e7f8 >}}
+func scPosting(aShortcode *TShortcode) (template.HTML, error) {
+	id := str2id(aShortcode.Arg(0))
+	if 0 == id {
+		return ``, se.Wrap(errors.New("invalid posting ID"), 1)
+	}
+	// the quoted posting may be changed independently
+	aShortcode.Volatile()
+
+	quoted := NewPosting(id, "")
+	if err := quoted.Load(); nil != err {
+		return ``, err
+	}
+	link := `<a href="/p/` + quoted.IDstr() + `">` + quoted.Date() + `</a>`
+	if (nil != aShortcode.Posting) && (id == aShortcode.Posting.id) ||
+		(scMaxDepth <= aShortcode.depth) {
+		// don't quote recursively
+		return template.HTML(`<p class="sc-posting">` + link + `</p>`), nil // #nosec G203
+	}
+	page, _ := phRender(quoted, quoted.Markdown(), aShortcode.depth+1)
+
+	return template.HTML(`<blockquote class="sc-posting">` + string(page) +
+		`<p class="small right">` + link + `</p></blockquote>`), nil // #nosec G203
+} // scPosting()
+
+// `scVimeo()` renders a click-to-load Vimeo video.
+//
+//	{{< vimeo 123456789 >}}
+func scVimeo(aShortcode *TShortcode) (template.HTML, error) {
+	id := aShortcode.Arg(0)
+	if !scVimeoRE.MatchString(id) {
+		return ``, se.Wrap(errors.New("invalid video ID"), 1)
+	}
+
+	return scClickToLoad(`vimeo`, `Vimeo: `+id,
+		`https://player.vimeo.com/video/`+id+`?dnt=1`,
+		`https://vimeo.com/`+id), nil
+} // scVimeo()
+
+// `scYouTube()` renders a click-to-load YouTube video using the
+// privacy-enhanced mode.
+//
+//	{{< youtube dQw4w9WgXcQ >}}
+func scYouTube(aShortcode *TShortcode) (template.HTML, error) {
+	id := aShortcode.Arg(0)
+	if !scYouTubeRE.MatchString(id) {
+		return ``, se.Wrap(errors.New("invalid video ID"), 1)
+	}
+
+	return scClickToLoad(`youtube`, `YouTube: `+id,
+		`https://www.youtube-nocookie.com/embed/`+id,
+		`https://www.youtube.com/watch?v=`+id), nil
+} // scYouTube()
+
+/* _EoF_ */
@@ -0,0 +1,186 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"html/template"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_scParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       string
+		wantArgs   []string
+		wantParams map[string]string
+	}{
+		{" 1", ``, nil, map[string]string{}},
+		{" 2", ` abc`, []string{`abc`}, map[string]string{}},
+		{" 3", ` 52.5 13.4 12`, []string{`52.5`, `13.4`, `12`}, map[string]string{}},
+		{" 4", ` "two words" one`, []string{`two words`, `one`}, map[string]string{}},
+		{" 5", ` src="/img/a b.jpg" w=10`, nil, map[string]string{`src`: `/img/a b.jpg`, `w`: `10`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scParse(``, `test`, tt.args)
+			if !reflect.DeepEqual(got.Args, tt.wantArgs) {
+				t.Errorf("scParse().Args = %q, want %q", got.Args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(got.Params, tt.wantParams) {
+				t.Errorf("scParse().Params = %q, want %q", got.Params, tt.wantParams)
+			}
+		})
+	}
+} // Test_scParse()
+
+func Test_scPrepare(t *testing.T) {
+	tests := []struct {
+		name      string
+		md        string
+		wantCalls int
+	}{
+		{" 1", "Text {{< upper abc >}} and {{<upper def>}}", 2},
+		{" 2", "Use `{{< upper abc >}}` here", 0},
+		{" 3", "Code:\n\n    {{< upper abc >}}\n", 0},
+		{" 4", "```\n{{< upper abc >}}\n```", 0},
+		{" 5", "[link {{< upper abc >}}](/p/x) {{< upper def >}}", 1},
+		{" 6", `<span title="{{< upper abc >}}">x</span>`, 0},
+		{" 7", "{{< upper\nabc >}}", 0},
+		{" 8", "{{</* upper abc */>}}", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, calls := scPrepare([]byte(tt.md), nil, 0); len(calls) != tt.wantCalls {
+				t.Errorf("scPrepare() = %d calls, want %d", len(calls), tt.wantCalls)
+			}
+		})
+	}
+} // Test_scPrepare()
+
+func Test_phRender_shortcodes(t *testing.T) {
+	prep4Tests()
+	RegisterShortcode(`upper`, func(aShortcode *TShortcode) (template.HTML, error) {
+		return template.HTML(`<b>` + strings.ToUpper(aShortcode.Arg(0)) + `</b>`), nil
+	})
+	RegisterShortcode(`clock`, func(aShortcode *TShortcode) (template.HTML, error) {
+		aShortcode.Volatile()
+		return `<span>now</span>`, nil
+	})
+
+	tests := []struct {
+		name     string
+		md       string
+		want     string
+		volatile bool
+	}{
+		{" 1", "Text {{< upper abc >}} more", "<p>Text <b>ABC</b> more</p>", false},
+		{" 2", "{{< youtube dQw4w9WgXcQ >}}", `<div class="sc-embed sc-youtube"><iframe srcdoc="`, false},
+		{" 3", "{{< youtube dQw4w9WgXcQ >}}", `href=&#34;https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ&#34;`, false},
+		{" 4", "{{< vimeo 12345 >}}", `?dnt=1`, false},
+		{" 5", "{{< map 52.5163 13.3777 >}}", `#map=15/52.51630/13.37770`, false},
+		{" 6", "{{</* upper abc */>}}", "<p>{{&lt; upper abc &gt;}}</p>", false},
+		{" 7", "```\n{{< upper abc >}}\n```", "{{&lt; upper abc &gt;}}", false},
+		{" 8", "{{< unknown abc >}}", "<p>{{&lt; unknown abc &gt;}}</p>", false},
+		{" 9", `{{< youtube "bad id!" >}}`, `<p>{{&lt; youtube &#34;bad id!&#34; &gt;}}</p>`, false},
+		{"10", "{{< clock >}}", "<span>now</span>", true},
+		{"11", `{{< figure src="/img/a.jpg" caption="A & B" >}}`, `<figcaption>A &amp; B</figcaption>`, false},
+		{"12", "{{< gallery ../etc >}}", "<p>{{&lt; gallery ../etc &gt;}}</p>", false},
+		{"13", "Use `{{< upper abc >}}` here", "<code>{{&lt; upper abc &gt;}}</code>", false},
+		{"15", "[x]({{< upper abc >}})", `href="{{&lt; upper abc &gt;}}"`, false},
+		{"14", "Code:\n\n    {{< upper abc >}}\n", "<pre>\n{{&lt; upper abc &gt;}}\n</pre>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPosting(0, tt.md)
+			got, volatile := phRender(p, p.Markdown(), 0)
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("phRender() = %q, want %q", got, tt.want)
+			}
+			if volatile != tt.volatile {
+				t.Errorf("phRender() volatile = %v, want %v", volatile, tt.volatile)
+			}
+		})
+	}
+} // Test_phRender_shortcodes()
+
+func Test_scClickToLoad(t *testing.T) {
+	got := string(scClickToLoad(`map`, `A "map"`, `https://example.com/embed?a=1&b=2`, `https://example.com/`))
+	if strings.Contains(got, ` src=`) {
+		t.Errorf("scClickToLoad() = %q, want no external source", got)
+	}
+	if !strings.Contains(got, `href=&#34;https://example.com/embed?a=1&amp;amp;b=2&#34;`) ||
+		!strings.Contains(got, `title="A &#34;map&#34;"`) {
+		t.Errorf("scClickToLoad() = %q, want the escaped placeholder", got)
+	}
+} // Test_scClickToLoad()
+
+func Test_scTemplate(t *testing.T) {
+	prep4Tests()
+	fName := scTemplateFile(`zztest`)
+	if err := os.WriteFile(fName, []byte(`<i>{{.Arg 0}}</i>`), 0640); nil != err {
+		t.Fatal(err)
+	}
+	defer os.Remove(fName)
+
+	sc := scParse(``, `zztest`, ` one`)
+	if got, err := scTemplate(sc); (nil != err) || (`<i>one</i>` != got) || sc.volatile {
+		t.Errorf("scTemplate() = %q, %v, volatile %v", got, err, sc.volatile)
+	}
+	id := scTemplatesID()
+
+	// a changed template is read again
+	if err := os.WriteFile(fName, []byte(`<b>{{.Arg 0}}</b>`), 0640); nil != err {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(fName, later, later)
+	if got, err := scTemplate(sc); (nil != err) || (`<b>one</b>` != got) {
+		t.Errorf("scTemplate() = %q, %v, want the changed template", got, err)
+	}
+	scTemplatesChecked = time.Time{}
+	if scTemplatesID() == id {
+		t.Errorf("scTemplatesID() = %q, want a new version", id)
+	}
+} // Test_scTemplate()
+
+func Test_scPosting(t *testing.T) {
+	prep4Tests()
+	SetPersistence(NewFSpersistence())
+
+	quoted := NewPosting(0, "The *quoted* text")
+	if _, err := quoted.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer quoted.Delete()
+
+	p := NewPosting(0, "See {{< posting "+quoted.IDstr()+" >}}")
+	got := string(p.Post())
+	if !strings.Contains(got, `<blockquote class="sc-posting"><p>The <em>quoted</em> text</p>`) ||
+		!strings.Contains(got, `href="/p/`+quoted.IDstr()+`"`) {
+		t.Errorf("Post() = %q", got)
+	}
+
+	// a posting quoting itself isn't expanded recursively
+	self := NewPosting(0, "")
+	self.Set([]byte("Me {{< posting " + self.IDstr() + " >}}"))
+	if _, err := self.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer self.Delete()
+	if got := string(NewPosting(self.ID(), "").Post()); strings.Contains(got, "<blockquote") {
+		t.Errorf("Post() = %q, want no recursion", got)
+	}
+} // Test_scPosting()
+
+/* _EoF_ */
@@ -0,0 +1,374 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file generates the `/sitemap.xml` and `/robots.txt` files.
+ *
+ * see: https://www.sitemaps.org/protocol.html
+ */
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	ht "github.com/mwat56/hashtags"
+	se "github.com/mwat56/sourceerror"
+)
+
+const (
+	// `smNamespace` is the XML namespace of sitemaps.
+	smNamespace = `http://www.sitemaps.org/schemas/sitemap/0.9`
+
+	// `smTimeFormat` is the (W3C datetime) layout of `<lastmod>`.
+	smTimeFormat = `2006-01-02T15:04:05Z07:00`
+)
+
+type (
+	// `tSMurl` is a single sitemap entry (or a sitemap in an index).
+	tSMurl struct {
+		Loc     string    `xml:"loc"`
+		LastMod string    `xml:"lastmod,omitempty"`
+		lastMod time.Time // for sorting and the `Last-Modified` header
+	}
+
+	// `tSMurlset` is a sitemap.
+	tSMurlset struct {
+		XMLName xml.Name `xml:"urlset"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		URLs    []tSMurl `xml:"url"`
+	}
+
+	// `tSMindex` is a sitemap index.
+	tSMindex struct {
+		XMLName  xml.Name `xml:"sitemapindex"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Sitemaps []tSMurl `xml:"sitemap"`
+	}
+)
+
+var (
+	// `smMaxURLs` is the max. number of URLs in a single sitemap;
+	// if there are more a sitemap index is sent instead.
+	smMaxURLs = 50000
+
+	// The default `robots.txt` template (used if there's no such
+	// file in the `dataDir`).
+	//
+	//go:embed robots.txt
+	smRobotsDefault string
+
+	// RegEx to find a `Sitemap` line in `robots.txt`.
+	smSitemapRE = regexp.MustCompile(`(?im)^\s*sitemap\s*:`)
+
+	// RegEx to match the name of a partial sitemap.
+	smPageRE = regexp.MustCompile(`^sitemap-([1-9][0-9]*)\.xml$`)
+)
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `listIndexable()` reports whether the month or week list page for
+// the given date may be indexed by search engines, i.e. whether the
+// date is older than 30 days.
+//
+// Parameters:
+//   - `aYear`: The year of the list page.
+//   - `aMonth`: The month of the list page.
+//   - `aDay`: The day of the list page.
+//
+// Returns:
+//   - `bool`: `true` if the list page may be indexed.
+func listIndexable(aYear int, aMonth time.Month, aDay int) bool {
+	return time.Date(aYear, aMonth, aDay+30, 0, 0, 0, 0, time.Local).
+		Before(time.Now())
+} // listIndexable()
+
+// `smAdd()` records `aLastMod` for `aPath` in `aList` if it's newer
+// than the time already recorded.
+func smAdd(aList map[string]time.Time, aPath string, aLastMod time.Time) {
+	if aLastMod.After(aList[aPath]) {
+		aList[aPath] = aLastMod
+	}
+} // smAdd()
+
+// `smPageNo()` returns the number of the partial sitemap named by
+// `aPath` (e.g. `sitemap-2.xml`) or zero if `aPath` is no such name.
+func smPageNo(aPath string) int {
+	match := smPageRE.FindStringSubmatch(aPath)
+	if nil == match {
+		return 0
+	}
+	no, _ := strconv.Atoi(match[1])
+
+	return no
+} // smPageNo()
+
+// `smReply()` sends `aData` as XML document.
+func smReply(aWriter http.ResponseWriter, aRequest *http.Request, aData any) {
+	out, err := xml.MarshalIndent(aData, "", "\t")
+	if nil != err {
+		apachelogger.Err("smReply()",
+			fmt.Sprintf("xml.Marshal(): %v", err))
+		http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `public, max-age=3600`)
+	aWriter.Header().Set(`Content-Type`, `application/xml; charset=utf-8`)
+	if http.MethodHead == aRequest.Method {
+		return
+	}
+	_, _ = aWriter.Write([]byte(xml.Header))
+	_, _ = aWriter.Write(out)
+} // smReply()
+
+// `robotsTxt()` returns the contents of the `robots.txt` file.
+//
+// The file `robots.txt` in the `dataDir` (or the default one) is
+// a Go text template which can use `{{.BaseURL}}` (the blog's
+// public URL) and `{{.Sitemap}}` (the sitemap's URL); a `Sitemap`
+// line is added if the template has none.
+//
+// Parameters:
+//   - `aBaseURL`: The blog's public scheme and host.
+//
+// Returns:
+//   - `[]byte`: The rules for web robots.
+//   - `error`: A possible I/O or template error, or `nil` on success.
+func robotsTxt(aBaseURL string) ([]byte, error) {
+	tpl := smRobotsDefault
+	fc, err := os.ReadFile(filepath.Join(AppArgs.DataDir, `robots.txt`)) // #nosec G304
+	if nil == err {
+		tpl = string(fc)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, se.Wrap(err, 1)
+	}
+	t, err := template.New(`robots.txt`).Parse(tpl)
+	if nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+
+	data := struct{ BaseURL, Sitemap string }{
+		BaseURL: aBaseURL,
+		Sitemap: aBaseURL + `/sitemap.xml`,
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	if !smSitemapRE.Match(buf.Bytes()) {
+		buf.WriteString("\nSitemap: " + data.Sitemap + "\n")
+	}
+
+	return buf.Bytes(), nil
+} // robotsTxt()
+
+// --------------------------------------------------------------------------
+// TPageHandler methods
+
+// `handleRobots()` sends the `robots.txt` file.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+func (ph *TPageHandler) handleRobots(aWriter http.ResponseWriter, aRequest *http.Request) {
+	txt, err := robotsTxt(publicBaseURL(aRequest))
+	if nil != err {
+		apachelogger.Err("TPageHandler.handleRobots()",
+			fmt.Sprintf("robotsTxt(): %v", err))
+		http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `public, max-age=86400`)
+	aWriter.Header().Set(`Content-Type`, `text/plain; charset=utf-8`)
+	aWriter.Header().Set(`Content-Length`, strconv.Itoa(len(txt)))
+	if http.MethodHead == aRequest.Method {
+		return
+	}
+	_, _ = aWriter.Write(txt)
+} // handleRobots()
+
+// `handleSitemap()` sends the sitemap.
+//
+// If there are more than `smMaxURLs` URLs the `/sitemap.xml` is a
+// sitemap index referring to the partial sitemaps `/sitemap-1.xml`,
+// `/sitemap-2.xml`, etc.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//   - `aPage`: The number of the partial sitemap (or zero).
+func (ph *TPageHandler) handleSitemap(aWriter http.ResponseWriter, aRequest *http.Request, aPage int) {
+	list, err := ph.sitemapURLs(aRequest.Context(), publicBaseURL(aRequest))
+	if nil != err {
+		apachelogger.Err("TPageHandler.handleSitemap()",
+			fmt.Sprintf("sitemapURLs(): %v", err))
+		http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pages := (len(list) + smMaxURLs - 1) / smMaxURLs
+	if (aPage > pages) || ((0 < aPage) && (1 == pages)) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+
+	var lastMod time.Time
+	hash := fnv.New64a()
+	fmt.Fprint(hash, aPage, smMaxURLs)
+	for idx := range list {
+		if list[idx].lastMod.After(lastMod) {
+			lastMod = list[idx].lastMod
+		}
+		fmt.Fprint(hash, list[idx].Loc, list[idx].LastMod)
+	}
+	if lastMod.IsZero() {
+		lastMod = time.Unix(0, 0)
+	}
+	if feedNotModified(aWriter, aRequest, lastMod, fmt.Sprintf(`W/"%x"`, hash.Sum64())) {
+		return
+	}
+
+	if (0 == aPage) && (1 < pages) {
+		index := tSMindex{Xmlns: smNamespace}
+		base := publicBaseURL(aRequest)
+		for page := 1; page <= pages; page++ {
+			var pageMod time.Time
+			for _, entry := range list[(page-1)*smMaxURLs : min(page*smMaxURLs, len(list))] {
+				if entry.lastMod.After(pageMod) {
+					pageMod = entry.lastMod
+				}
+			}
+			index.Sitemaps = append(index.Sitemaps, tSMurl{
+				Loc:     fmt.Sprintf("%s/sitemap-%d.xml", base, page),
+				LastMod: pageMod.Format(smTimeFormat),
+			})
+		}
+		smReply(aWriter, aRequest, index)
+		return
+	}
+
+	if 0 < aPage {
+		list = list[(aPage-1)*smMaxURLs : min(aPage*smMaxURLs, len(list))]
+	}
+	smReply(aWriter, aRequest, tSMurlset{Xmlns: smNamespace, URLs: list})
+} // handleSitemap()
+
+// `sitemapURLs()` returns the URLs of all postings along with the
+// month, week, and #hashtag list pages which search engines may
+// index.
+//
+// The URLs are listed newest first, each with the last modification
+// time of the (newest) posting it shows.
+//
+// Parameters:
+//   - `aCtx`: The context for the persistence layer operations.
+//   - `aBaseURL`: The blog's public scheme and host.
+//
+// Returns:
+//   - `[]tSMurl`: The sitemap entries.
+//   - `error`: A possible error walking the postings.
+func (ph *TPageHandler) sitemapURLs(aCtx context.Context, aBaseURL string) ([]tSMurl, error) {
+	var newest time.Time
+	lists := make(map[string]time.Time)
+	postings := make(map[string]time.Time)
+	modified := make(map[uint64]time.Time)
+
+	err := poPersistence.WalkContext(aCtx, func(aID uint64) error {
+		post, err := poPersistence.ReadContext(aCtx, aID)
+		if nil != err {
+			return nil // skip unreadable postings
+		}
+		lastMod := feedUpdated(post)
+		modified[aID] = lastMod
+		postings[`/p/`+post.IDstr()] = lastMod
+		if lastMod.After(newest) {
+			newest = lastMod
+		}
+
+		// the month and week lists are addressed by their last day:
+		y, m, _ := post.Time().Date()
+		if last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.Local); listIndexable(last.Date()) {
+			smAdd(lists, `/m/`+last.Format(time.DateOnly), lastMod)
+		}
+		sunday := post.Time().AddDate(0, 0, (7-int(post.Time().Weekday()))%7)
+		if listIndexable(sunday.Date()) {
+			smAdd(lists, `/w/`+sunday.Format(time.DateOnly), lastMod)
+		}
+
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	if nil != ph.hashList {
+		for _, item := range ph.hashList.List() {
+			if !strings.HasPrefix(item.Tag, string(ht.MarkHash)) {
+				continue
+			}
+			path := `/hl/` + url.PathEscape(strings.TrimPrefix(item.Tag, string(ht.MarkHash)))
+			for _, id := range ph.hashList.HashList(item.Tag) {
+				if lastMod, ok := modified[id]; ok {
+					smAdd(lists, path, lastMod)
+				}
+			}
+		}
+	}
+
+	result := make([]tSMurl, 0, 1+len(postings)+len(lists))
+	if !newest.IsZero() {
+		result = append(result, tSMurl{
+			Loc:     aBaseURL + `/`,
+			LastMod: newest.Format(smTimeFormat),
+			lastMod: newest,
+		})
+	}
+	for _, group := range []map[string]time.Time{postings, lists} {
+		paths := make([]string, 0, len(group))
+		for path := range group {
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			if group[paths[i]].Equal(group[paths[j]]) {
+				return paths[i] > paths[j]
+			}
+			return group[paths[i]].After(group[paths[j]])
+		})
+		for _, path := range paths {
+			result = append(result, tSMurl{
+				Loc:     aBaseURL + path,
+				LastMod: group[path].Format(smTimeFormat),
+				lastMod: group[path],
+			})
+		}
+	}
+
+	return result, nil
+} // sitemapURLs()
+
+/* _EoF_ */
@@ -0,0 +1,202 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_listIndexable(t *testing.T) {
+	now := time.Now()
+	old := now.AddDate(0, 0, -31)
+	recent := now.AddDate(0, 0, -29)
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{" 1", old, true},
+		{" 2", recent, false},
+		{" 3", now, false},
+		{" 4", time.Date(2019, 4, 13, 0, 0, 0, 0, time.Local), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y, m, d := tt.date.Date()
+			if got := listIndexable(y, m, d); got != tt.want {
+				t.Errorf("listIndexable(%s) = %v, want %v", tt.date.Format(time.DateOnly), got, tt.want)
+			}
+		})
+	}
+} // Test_listIndexable()
+
+func Test_smPageNo(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{" 1", "sitemap-1.xml", 1},
+		{" 2", "sitemap-12.xml", 12},
+		{" 3", "sitemap-0.xml", 0},
+		{" 4", "sitemap.xml", 0},
+		{" 5", "sitemap-x.xml", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := smPageNo(tt.path); got != tt.want {
+				t.Errorf("smPageNo(%q) = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+} // Test_smPageNo()
+
+func TestTPageHandler_handleSitemap(t *testing.T) {
+	ph := prepAPITest(t)
+	oldURL, oldMax := AppArgs.PublicURL, smMaxURLs
+	AppArgs.PublicURL = "https://blog.example.com"
+	t.Cleanup(func() {
+		AppArgs.PublicURL, smMaxURLs = oldURL, oldMax
+	})
+
+	// an old posting (indexable lists) and a recent one (not indexable)
+	oldDay := time.Date(2019, 4, 10, 12, 0, 0, 0, time.Local) // a Wednesday
+	oldPost := NewPosting(time2id(oldDay), "an old posting")
+	newPost := NewPosting(0, "a new posting")
+	for _, p := range []*TPosting{oldPost, newPost} {
+		if _, err := p.Store(); nil != err {
+			t.Fatal(err)
+		}
+		defer p.Delete()
+	}
+
+	get := func(aPath string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ph.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, aPath, nil))
+		return rec
+	}
+
+	rec := get("/sitemap.xml")
+	var urlset struct {
+		URLs []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &urlset); (http.StatusOK != rec.Code) || (nil != err) {
+		t.Fatalf("sitemap.xml: %d %v\n%s", rec.Code, err, rec.Body)
+	}
+	locs := make(map[string]string, len(urlset.URLs))
+	for _, u := range urlset.URLs {
+		locs[u.Loc] = u.LastMod
+	}
+	base := AppArgs.PublicURL
+	for _, want := range []string{"/", "/p/" + oldPost.IDstr(), "/p/" + newPost.IDstr(), "/m/2019-04-30", "/w/2019-04-14"} {
+		if _, ok := locs[base+want]; !ok {
+			t.Errorf("sitemap misses %q", want)
+		}
+	}
+	if want := oldPost.lastModified.Format(smTimeFormat); locs[base+"/p/"+oldPost.IDstr()] != want {
+		t.Errorf("lastmod = %q, want %q", locs[base+"/p/"+oldPost.IDstr()], want)
+	}
+	y, m, _ := time.Now().Date()
+	if _, ok := locs[base+"/m/"+time.Date(y, m+1, 0, 0, 0, 0, 0, time.Local).Format(time.DateOnly)]; ok {
+		t.Error("sitemap lists the current month")
+	}
+
+	// unchanged sitemaps aren't sent again
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	ph.ServeHTTP(rec, req)
+	if http.StatusNotModified != rec.Code {
+		t.Errorf("conditional GET: status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec = get("/sitemap-1.xml"); http.StatusNotFound != rec.Code {
+		t.Errorf("partial sitemap without index: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// large sitemaps are split up
+	smMaxURLs = 2
+	rec = get("/sitemap.xml")
+	var index struct {
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &index); (nil != err) || (2 > len(index.Sitemaps)) {
+		t.Fatalf("sitemap index: %v\n%s", err, rec.Body)
+	}
+	if want := base + "/sitemap-1.xml"; index.Sitemaps[0].Loc != want {
+		t.Errorf("first sitemap = %q, want %q", index.Sitemaps[0].Loc, want)
+	}
+	rec = get("/sitemap-2.xml")
+	urlset.URLs = nil
+	if err := xml.Unmarshal(rec.Body.Bytes(), &urlset); (nil != err) || (0 == len(urlset.URLs)) || (2 < len(urlset.URLs)) {
+		t.Errorf("sitemap-2.xml: %v\n%s", err, rec.Body)
+	}
+
+	// robots.txt
+	rec = get("/robots.txt")
+	if body := rec.Body.String(); !strings.Contains(body, "Sitemap: "+base+"/sitemap.xml\n") ||
+		!strings.Contains(body, "Disallow: /xmlrpc\n") {
+		t.Errorf("robots.txt = %q", body)
+	}
+} // TestTPageHandler_handleSitemap()
+
+func Test_robotsTxt(t *testing.T) {
+	saved := AppArgs.DataDir
+	defer func() { AppArgs.DataDir = saved }()
+	AppArgs.DataDir = t.TempDir()
+	const base = "https://blog.example.org"
+
+	// the default rules
+	got, err := robotsTxt(base)
+	if (nil != err) || !strings.Contains(string(got), "Disallow: /xmlrpc\n") ||
+		!strings.HasSuffix(string(got), "Sitemap: "+base+"/sitemap.xml\n") {
+		t.Errorf("robotsTxt(default) = %q, %v", got, err)
+	}
+
+	// a site-specific file without template markup
+	fName := filepath.Join(AppArgs.DataDir, "robots.txt")
+	if err = os.WriteFile(fName, []byte("User-agent: BadBot\nDisallow: /\n"), 0640); nil != err {
+		t.Fatal(err)
+	}
+	if got, err = robotsTxt(base); (nil != err) ||
+		("User-agent: BadBot\nDisallow: /\n\nSitemap: "+base+"/sitemap.xml\n" != string(got)) {
+		t.Errorf("robotsTxt(custom) = %q, %v", got, err)
+	}
+
+	// a template using the blog's URL
+	if err = os.WriteFile(fName, []byte("Disallow: /private/\nHost: {{.BaseURL}}\nSitemap: {{.Sitemap}}\n"), 0640); nil != err {
+		t.Fatal(err)
+	}
+	if got, err = robotsTxt(base); (nil != err) ||
+		("Disallow: /private/\nHost: "+base+"\nSitemap: "+base+"/sitemap.xml\n" != string(got)) {
+		t.Errorf("robotsTxt(template) = %q, %v", got, err)
+	}
+
+	// an invalid template
+	if err = os.WriteFile(fName, []byte("{{.Nope"), 0640); nil != err {
+		t.Fatal(err)
+	}
+	if _, err = robotsTxt(base); nil == err {
+		t.Error("robotsTxt(invalid) expected an error")
+	}
+} // Test_robotsTxt()
+
+/* _EoF_ */
@@ -0,0 +1,501 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the renaming/merging of #hashtags/@mentions
+ * across all postings with a preview of the changes and a change
+ * log allowing to undo them.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	ht "github.com/mwat56/hashtags"
+	se "github.com/mwat56/sourceerror"
+)
+
+type (
+	// `TTagDiff` is a single line changed by renaming a tag.
+	TTagDiff struct {
+		Line int    `json:"line"` // the line number (1-based)
+		Old  string `json:"old"`  // the line's current text
+		New  string `json:"new"`  // the line's new text
+	}
+
+	// `TTagChange` describes the changes of a posting affected by
+	// renaming a tag.
+	TTagChange struct {
+		ID    string     // the posting's ID
+		Date  string     // the posting's date
+		Key   string     // the posting's ID and modification time
+		Count int        // the number of replaced tags
+		Diff  []TTagDiff // the changed lines
+		id    uint64
+		after []byte // the posting's new Markdown text
+	}
+
+	// `TTagRevision` are the lines of a posting changed by renaming
+	// a tag.
+	TTagRevision struct {
+		ID     string     `json:"id"`
+		Lines  []TTagDiff `json:"lines"`
+		Undone bool       `json:"undone,omitempty"`
+	}
+
+	// `TTagLogEntry` is an entry of the tag renaming's change log.
+	TTagLogEntry struct {
+		ID        string         `json:"id"`
+		Time      time.Time      `json:"time"`
+		Search    string         `json:"search"`
+		Replace   string         `json:"replace"`
+		Revisions []TTagRevision `json:"revisions"`
+		Undone    *time.Time     `json:"undone,omitempty"`
+	}
+)
+
+const (
+	// `xtFileName` is the name of the file storing the change log
+	// (in the `DataDir` directory).
+	xtFileName = `tagchanges.json`
+
+	// `xtMaxLog` is the max. number of change log entries to keep.
+	xtMaxLog = 100
+)
+
+var (
+	// `ErrTagChange` is returned for an unknown or already undone change.
+	ErrTagChange = errors.New("unknown or undone tag change")
+
+	// `ErrTagInvalid` is returned for an invalid #hashtag/@mention.
+	ErrTagInvalid = errors.New("invalid #hashtag/@mention")
+
+	// Guard against concurrent renaming and the change log's file.
+	xtMtx sync.Mutex
+)
+
+// --------------------------------------------------------------------------
+// TTagLogEntry methods
+
+// `Date()` returns the change's time as a string.
+//
+// Returns:
+//   - `string`: The change's date/time formatted as `YYYY-MM-DD hh:mm`.
+func (le TTagLogEntry) Date() string {
+	return le.Time.Format(`2006-01-02 15:04`)
+} // Date()
+
+// `IsUndone()` reports whether the change was reverted.
+//
+// Returns:
+//   - `bool`: `true` if the change was undone, `false` otherwise.
+func (le TTagLogEntry) IsUndone() bool {
+	return nil != le.Undone
+} // IsUndone()
+
+// --------------------------------------------------------------------------
+// exported functions
+
+// `ApplyTagRename()` replaces the #hashtag/@mention `aSearchTag` by
+// `aReplaceTag` in all postings and records the changes in the
+// change log.
+//
+// `aKeys` are the `Key` values of the postings to change as returned
+// by `PreviewTagRename()`; postings modified since the preview are
+// skipped. A `nil` list changes all affected postings.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aList`: The hashlist to update (may be `nil`).
+//   - `aSearchTag`: The #tag/@mention to find.
+//   - `aReplaceTag`: The #tag/@mention to use instead.
+//   - `aKeys`: The postings to change.
+//
+// Returns:
+//   - `*TTagLogEntry`: The recorded change.
+//   - `[]string`: The IDs of the skipped postings.
+//   - `error`: A possible error, or `nil` on success.
+func ApplyTagRename(aCtx context.Context, aList *ht.THashTags, aSearchTag, aReplaceTag string, aKeys []string) (*TTagLogEntry, []string, error) {
+	xtMtx.Lock()
+	defer xtMtx.Unlock()
+
+	changes, err := xtPlan(aCtx, aSearchTag, aReplaceTag)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	var (
+		errs    []error
+		skipped []string
+	)
+	result := &TTagLogEntry{
+		ID:      fmt.Sprintf("%x", time.Now().UnixNano()),
+		Time:    time.Now(),
+		Search:  aSearchTag,
+		Replace: aReplaceTag,
+	}
+	for _, change := range changes {
+		if (nil != aKeys) && !slices.Contains(aKeys, change.Key) {
+			skipped = append(skipped, change.ID)
+			continue
+		}
+		p := NewPosting(change.id, "")
+		if err = p.Load(); nil != err {
+			errs = append(errs, err)
+			continue
+		}
+		before := p.Markdown()
+		if _, err = p.Set(change.after).Store(); nil != err {
+			errs = append(errs, err)
+			continue
+		}
+		result.Revisions = append(result.Revisions, TTagRevision{
+			ID:    change.ID,
+			Lines: xtDiff(before, p.Markdown()),
+		})
+		xtUpdate(aList, p)
+	}
+	if 0 < len(result.Revisions) {
+		pcPostingsChanged()
+		errs = append(errs, xtAppend(*result))
+	}
+
+	return result, skipped, errors.Join(errs...)
+} // ApplyTagRename()
+
+// `PreviewTagRename()` returns the changes of all postings affected
+// by replacing the #hashtag/@mention `aSearchTag` by `aReplaceTag`.
+//
+// Only whole tags are matched (case-insensitive), i.e. `#go` matches
+// neither `#golang` nor `#gopher`; tags in code, links, and
+// shortcodes are left alone.
+//
+// Parameters:
+//   - `aCtx`: The context to observe.
+//   - `aSearchTag`: The #tag/@mention to find.
+//   - `aReplaceTag`: The #tag/@mention to use instead.
+//
+// Returns:
+//   - `[]TTagChange`: The affected postings, newest first.
+//   - `error`: A possible error, or `nil` on success.
+func PreviewTagRename(aCtx context.Context, aSearchTag, aReplaceTag string) ([]TTagChange, error) {
+	return xtPlan(aCtx, aSearchTag, aReplaceTag)
+} // PreviewTagRename()
+
+// `TagRenameLog()` returns the change log of the tag renamings,
+// newest first.
+//
+// Returns:
+//   - `[]TTagLogEntry`: The recorded changes.
+func TagRenameLog() []TTagLogEntry {
+	xtMtx.Lock()
+	defer xtMtx.Unlock()
+
+	result, err := xtLoad()
+	if nil != err {
+		apachelogger.Err("TagRenameLog()", err.Error())
+	}
+	slices.Reverse(result)
+
+	return result
+} // TagRenameLog()
+
+// `UndoTagRename()` reverts the tag renaming `aChangeID`.
+//
+// Postings whose changed lines were modified since the renaming are
+// skipped; the change is marked as undone only after all its
+// postings were reverted, so the skipped ones can be tried again.
+//
+// Parameters:
+//   - `aList`: The hashlist to update (may be `nil`).
+//   - `aChangeID`: The ID of the change log entry to revert.
+//
+// Returns:
+//   - `*TTagLogEntry`: The reverted change.
+//   - `[]string`: The IDs of the skipped postings.
+//   - `error`: A possible error, or `nil` on success.
+func UndoTagRename(aList *ht.THashTags, aChangeID string) (*TTagLogEntry, []string, error) {
+	xtMtx.Lock()
+	defer xtMtx.Unlock()
+
+	entries, err := xtLoad()
+	if nil != err {
+		return nil, nil, err
+	}
+	idx := slices.IndexFunc(entries, func(aEntry TTagLogEntry) bool {
+		return aEntry.ID == aChangeID
+	})
+	if (0 > idx) || entries[idx].IsUndone() {
+		return nil, nil, se.Wrap(ErrTagChange, 1)
+	}
+
+	var (
+		errs    []error
+		skipped []string
+	)
+	result := &entries[idx]
+	reverted := 0
+	for i := range result.Revisions {
+		rev := &result.Revisions[i]
+		if rev.Undone {
+			reverted++
+			continue
+		}
+		p := NewPosting(str2id(rev.ID), "")
+		if err = p.Load(); nil != err {
+			skipped = append(skipped, rev.ID)
+			continue
+		}
+		md, ok := xtRevert(p.Markdown(), rev.Lines)
+		if !ok {
+			skipped = append(skipped, rev.ID)
+			continue
+		}
+		if _, err = p.Set(md).Store(); nil != err {
+			errs = append(errs, err)
+			continue
+		}
+		rev.Undone = true
+		reverted++
+		xtUpdate(aList, p)
+	}
+	pcPostingsChanged()
+	if len(result.Revisions) == reverted {
+		now := time.Now()
+		result.Undone = &now
+	}
+	errs = append(errs, xtStore(entries))
+
+	return result, skipped, errors.Join(errs...)
+} // UndoTagRename()
+
+// --------------------------------------------------------------------------
+// helper functions
+
+// `xtAppend()` adds `aEntry` to the change log.
+//
+// NOTE: The caller must hold the `xtMtx` lock.
+func xtAppend(aEntry TTagLogEntry) error {
+	entries, err := xtLoad()
+	if nil != err {
+		return err
+	}
+
+	return xtStore(append(entries, aEntry))
+} // xtAppend()
+
+// `xtCheck()` checks whether `aSearchTag` and `aReplaceTag` are
+// single #hashtags/@mentions.
+func xtCheck(aSearchTag, aReplaceTag string) error {
+	for _, tag := range []string{aSearchTag, aReplaceTag} {
+		matches := htScan([]byte(tag), 0, len(tag))
+		if (1 != len(matches)) || (0 != matches[0].start) || (len(tag) != matches[0].end) {
+			return se.Wrap(fmt.Errorf("%w: %q", ErrTagInvalid, tag), 2)
+		}
+	}
+
+	return nil
+} // xtCheck()
+
+// `xtDiff()` returns the lines differing between `aOld` and `aNew`.
+//
+// Since replacing a tag never adds or removes a line both texts are
+// compared line by line.
+func xtDiff(aOld, aNew []byte) []TTagDiff {
+	var result []TTagDiff
+	oldLines := strings.Split(string(aOld), "\n")
+	newLines := strings.Split(string(aNew), "\n")
+	for idx, line := range oldLines {
+		if (idx < len(newLines)) && (line != newLines[idx]) {
+			result = append(result, TTagDiff{
+				Line: idx + 1,
+				Old:  line,
+				New:  newLines[idx],
+			})
+		}
+	}
+
+	return result
+} // xtDiff()
+
+// `xtLoad()` reads the change log, oldest entry first.
+//
+// NOTE: The caller must hold the `xtMtx` lock.
+func xtLoad() ([]TTagLogEntry, error) {
+	data, err := os.ReadFile(filepath.Join(AppArgs.DataDir, xtFileName))
+	if nil != err {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, se.Wrap(err, 1)
+	}
+
+	var result []TTagLogEntry
+	if err = json.Unmarshal(data, &result); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+
+	return result, nil
+} // xtLoad()
+
+// `xtPlan()` returns the changes of all postings affected by
+// replacing `aSearchTag` by `aReplaceTag`.
+func xtPlan(aCtx context.Context, aSearchTag, aReplaceTag string) ([]TTagChange, error) {
+	if err := xtCheck(aSearchTag, aReplaceTag); nil != err {
+		return nil, err
+	}
+
+	var (
+		mtx    sync.Mutex
+		result []TTagChange
+	)
+	wf := func(aID uint64) error {
+		p := NewPosting(aID, "")
+		if err := p.Load(); (nil != err) || (0 == p.Len()) {
+			// no contents, no joy ...
+			return nil
+		}
+		md, count := xtReplace(p.Markdown(), aSearchTag, aReplaceTag)
+		if 0 == count {
+			return nil
+		}
+		change := TTagChange{
+			ID:    p.IDstr(),
+			Date:  p.Date(),
+			Key:   fmt.Sprintf("%s-%x", p.IDstr(), p.lastModified.UnixNano()),
+			Count: count,
+			Diff:  xtDiff(p.Markdown(), md),
+			id:    aID,
+			after: md,
+		}
+		mtx.Lock()
+		result = append(result, change)
+		mtx.Unlock()
+
+		return nil
+	} // wf()
+
+	if err := WalkParallel(aCtx, 0, wf, nil); nil != err {
+		return nil, err
+	}
+	slices.SortFunc(result, func(a, b TTagChange) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return result, nil
+} // xtPlan()
+
+// `xtReplace()` replaces the #hashtag/@mention `aSearchTag` in
+// `aMarkdown` by `aReplaceTag`.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's Markdown text.
+//   - `aSearchTag`: The #tag/@mention to find (case-insensitive).
+//   - `aReplaceTag`: The #tag/@mention to use instead.
+//
+// Returns:
+//   - `[]byte`: The changed Markdown text.
+//   - `int`: The number of replaced tags.
+func xtReplace(aMarkdown []byte, aSearchTag, aReplaceTag string) ([]byte, int) {
+	// wiki links and shortcodes are no tags (see `htIndexText()`)
+	hidden := append(scRE.FindAllIndex(aMarkdown, -1),
+		wlLinkRE.FindAllIndex(aMarkdown, -1)...)
+	isHidden := func(aMatch tHTmatch) bool {
+		return slices.ContainsFunc(hidden, func(aLoc []int) bool {
+			return (aLoc[0] <= aMatch.start) && (aMatch.end <= aLoc[1])
+		})
+	} // isHidden()
+
+	var (
+		count, last int
+		result      []byte
+	)
+	for _, match := range htDetect(aMarkdown) {
+		tag := string(aMarkdown[match.start:match.end])
+		if (tag == aReplaceTag) || !strings.EqualFold(tag, aSearchTag) || isHidden(match) {
+			continue
+		}
+		result = append(result, aMarkdown[last:match.start]...)
+		result = append(result, aReplaceTag...)
+		last = match.end
+		count++
+	}
+	if 0 == count {
+		return aMarkdown, 0
+	}
+
+	return append(result, aMarkdown[last:]...), count
+} // xtReplace()
+
+// `xtRevert()` restores the lines of `aMarkdown` changed by `aLines`.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's current Markdown text.
+//   - `aLines`: The lines changed by renaming a tag.
+//
+// Returns:
+//   - `[]byte`: The reverted Markdown text.
+//   - `bool`: Whether all lines are unchanged since the renaming.
+func xtRevert(aMarkdown []byte, aLines []TTagDiff) ([]byte, bool) {
+	lines := strings.Split(string(aMarkdown), "\n")
+	for _, diff := range aLines {
+		if (1 > diff.Line) || (len(lines) < diff.Line) || (lines[diff.Line-1] != diff.New) {
+			return nil, false
+		}
+		lines[diff.Line-1] = diff.Old
+	}
+
+	return []byte(strings.Join(lines, "\n")), true
+} // xtRevert()
+
+// `xtStore()` writes `aEntries` to the change log's file.
+//
+// NOTE: The caller must hold the `xtMtx` lock.
+func xtStore(aEntries []TTagLogEntry) error {
+	if xtMaxLog < len(aEntries) {
+		aEntries = aEntries[len(aEntries)-xtMaxLog:]
+	}
+	data, err := json.MarshalIndent(aEntries, "", "\t")
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	fName := filepath.Join(AppArgs.DataDir, xtFileName)
+	if err = os.MkdirAll(filepath.Dir(fName), 0770); nil != err {
+		return se.Wrap(err, 1)
+	}
+	tmpName := fName + `~`
+	if err = os.WriteFile(tmpName, data, 0640); nil != err {
+		return se.Wrap(err, 1)
+	}
+	if err = os.Rename(tmpName, fName); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	return nil
+} // xtStore()
+
+// `xtUpdate()` updates the hashlist entries of `aPosting`.
+func xtUpdate(aList *ht.THashTags, aPosting *TPosting) {
+	if (nil != aList) && aList.IDupdate(aPosting.id, htIndexText(aPosting.Markdown())) {
+		htTouch()
+	}
+} // xtUpdate()
+
+/* _EoF_ */
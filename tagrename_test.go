@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_xtCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		search  string
+		replace string
+		wantErr bool
+	}{
+		{" 1", `#go`, `#golang`, false},
+		{" 2", `@chelseamanning`, `@Chelsea_Manning`, false},
+		{" 3", `#go`, `@go`, false},
+		{" 4", ``, `#go`, true},
+		{" 5", `go`, `#go`, true},
+		{" 6", `#go`, `golang`, true},
+		{" 7", `#go`, `#go lang`, true},
+		{" 8", `#go`, `#go_`, true},
+		{" 9", `#go`, `#0a0a0a`, true},
+		{"10", `#go`, `#cafe`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := xtCheck(tt.search, tt.replace); (nil != err) != tt.wantErr {
+				t.Errorf("xtCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+} // Test_xtCheck()
+
+func Test_xtReplace(t *testing.T) {
+	tests := []struct {
+		name      string
+		markdown  string
+		want      string
+		wantCount int
+	}{
+		{" 1", `#go and #golang and #gopher`, `#golang and #golang and #gopher`, 1},
+		{" 2", `#Go, #GO! (#go)`, `#golang, #golang! (#golang)`, 3},
+		{" 3", "`#go` and\n\n```\n#go\n```\n", "`#go` and\n\n```\n#go\n```\n", 0},
+		{" 4", `[#go](https://example.com/#go) https://example.com/#go`, `[#go](https://example.com/#go) https://example.com/#go`, 0},
+		{" 5", `{{< figure src="/img/a.png" caption="#go" >}} #go`, `{{< figure src="/img/a.png" caption="#go" >}} #golang`, 1},
+		{" 6", "line 1\n#go on line 2", "line 1\n#golang on line 2", 1},
+		{" 7", `#golang stays`, `#golang stays`, 0},
+		{" 8", `me#go and C#go`, `me#go and C#go`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := xtReplace([]byte(tt.markdown), `#go`, `#golang`)
+			if string(got) != tt.want {
+				t.Errorf("xtReplace() = %q, want %q", got, tt.want)
+			}
+			if count != tt.wantCount {
+				t.Errorf("xtReplace() count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+} // Test_xtReplace()
+
+func TestApplyTagRename(t *testing.T) {
+	prep4Tests()
+	SetPersistence(NewFSpersistence())
+	ctx := context.Background()
+	defer os.Remove(filepath.Join(AppArgs.DataDir, xtFileName))
+
+	const before = "About #xtRenameTest and #xtRenameTester\n\nmore #XTrenametest"
+	p := NewPosting(0, before)
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(p.ID(), "").Delete() }()
+
+	changes, err := PreviewTagRename(ctx, `#xtrenametest`, `#xtRenamed`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (1 != len(changes)) || (2 != changes[0].Count) || (2 != len(changes[0].Diff)) {
+		t.Fatalf("PreviewTagRename() = %v", changes)
+	}
+
+	// a stale preview doesn't change anything
+	entry, skipped, err := ApplyTagRename(ctx, nil, `#xtrenametest`, `#xtRenamed`, []string{p.IDstr() + `-0`})
+	if (nil != err) || (0 != len(entry.Revisions)) || (1 != len(skipped)) {
+		t.Fatalf("ApplyTagRename(stale) = %v, %v, %v", entry, skipped, err)
+	}
+
+	entry, skipped, err = ApplyTagRename(ctx, nil, `#xtrenametest`, `#xtRenamed`, []string{changes[0].Key})
+	if (nil != err) || (1 != len(entry.Revisions)) || (0 != len(skipped)) {
+		t.Fatalf("ApplyTagRename() = %v, %v, %v", entry, skipped, err)
+	}
+	// only the changed lines are recorded
+	if lines := entry.Revisions[0].Lines; (2 != len(lines)) || (3 != lines[1].Line) ||
+		("more #XTrenametest" != lines[1].Old) || ("more #xtRenamed" != lines[1].New) {
+		t.Errorf("Revisions[0].Lines = %v", lines)
+	}
+	if err = p.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "About #xtRenamed and #xtRenameTester\n\nmore #xtRenamed"; string(p.Markdown()) != want {
+		t.Errorf("Markdown() = %q, want %q", p.Markdown(), want)
+	}
+	if log := TagRenameLog(); (0 == len(log)) || (log[0].ID != entry.ID) {
+		t.Errorf("TagRenameLog() = %v", log)
+	}
+
+	// a posting changed meanwhile is skipped and the change not undone
+	p.Set([]byte("About #xtRenamed and #xtRenameTester\n\nmore #xtRenamed, edited"))
+	if _, err = p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	undone, skipped, err := UndoTagRename(nil, entry.ID)
+	if (nil != err) || (1 != len(skipped)) || undone.IsUndone() {
+		t.Fatalf("UndoTagRename(changed) = %v, %v, %v", undone, skipped, err)
+	}
+	if log := TagRenameLog(); log[0].IsUndone() {
+		t.Errorf("TagRenameLog() = %v, want the change not undone", log)
+	}
+
+	// other lines may change
+	p.Set([]byte("About #xtRenamed and #xtRenameTester\nnew line\nmore #xtRenamed"))
+	if _, err = p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	if undone, skipped, err = UndoTagRename(nil, entry.ID); (nil != err) || (0 != len(skipped)) || !undone.IsUndone() {
+		t.Fatalf("UndoTagRename() = %v, %v, %v", undone, skipped, err)
+	}
+	if err = p.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "About #xtRenameTest and #xtRenameTester\nnew line\nmore #XTrenametest"; string(p.Markdown()) != want {
+		t.Errorf("Markdown() = %q, want %q", p.Markdown(), want)
+	}
+	if _, _, err = UndoTagRename(nil, entry.ID); nil == err {
+		t.Error("UndoTagRename() twice: expected an error")
+	}
+} // TestApplyTagRename()
+
+func Test_xtRevert(t *testing.T) {
+	lines := []TTagDiff{{Line: 2, Old: `#go`, New: `#golang`}}
+	tests := []struct {
+		name   string
+		md     string
+		want   string
+		wantOK bool
+	}{
+		{" 1", "a\n#golang\nb", "a\n#go\nb", true},
+		{" 2", "a\n#golang!\nb", "", false},
+		{" 3", "a", "", false},
+		{" 4", "x\n#golang", "x\n#go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := xtRevert([]byte(tt.md), lines)
+			if (string(got) != tt.want) || (ok != tt.wantOK) {
+				t.Errorf("xtRevert() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+} // Test_xtRevert()
+
+/* _EoF_ */
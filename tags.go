@@ -11,30 +11,54 @@ package nele
  */
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/mwat56/apachelogger"
 	ht "github.com/mwat56/hashtags"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
 )
 
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
-var (
-	// RegEx to find PREformatted parts in an HTML page.
-	htAHrefRE = regexp.MustCompile(`(?si)(<a[^>]*>.*?</a>)`)
+type (
+	// `tHTmatch` is the position of a #hashtag/@mention in a text.
+	tHTmatch struct {
+		start, end int
+	}
+)
 
-	// RegEx to identify a numeric HTML entity.
-	htEntityRE = regexp.MustCompile(`(#[0-9]+;)`)
+var (
+	// RegEx to match a hexadecimal colour value; `htValid()` requires
+	// it to contain at least one digit.
+	htColourRE = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+)
 
-	// match: #hashtag|@mention
-	htHashMentionRE = regexp.MustCompile(`(?i)([@#][\p{L}’'\d_§-]+)(.?|$)`)
-	//                                         1111111111111111111  2222
-	// NOTE: compare with `github.com/mwat56/hashtags/`
+var (
+	// The time (in nanoseconds) of the hashlist's latest change.
+	htChanged atomic.Int64
 )
 
+// `htChangedAt()` returns the time of the hashlist's latest change.
+func htChangedAt() time.Time {
+	return time.Unix(0, htChanged.Load())
+} // htChangedAt()
+
+// `htTouch()` records a change of the hashlist.
+func htTouch() {
+	htChanged.Store(time.Now().UnixNano())
+} // htTouch()
+
 // --------------------------------------------------------------------------
 
 // `AddTagID()` checks a newly added `aPosting` for #hashtags and @mentions.
@@ -43,13 +67,19 @@ var (
 //   - `aList`: The hashlist to use (update).
 //   - `aPosting`: The new posting to handle.
 func AddTagID(aList *ht.THashTags, aPosting *TPosting) {
-	go aList.IDparse(aPosting.ID(), aPosting.Markdown())
+	pcPostingsChanged()
+	go func() {
+		aList.IDparse(aPosting.ID(), htIndexText(aPosting.Markdown()))
+		htTouch()
+	}()
 
 	runtime.Gosched() // get the background operation started
 } // AddTagID()
 
 // `InitHashlist()` initialises the hash list.
 //
+// The postings are processed concurrently in background.
+//
 // Parameters:
 //   - `aList`: The list of #hashtags/@mentions to update.
 func InitHashlist(aList *ht.THashTags) {
@@ -61,20 +91,20 @@ func InitHashlist(aList *ht.THashTags) {
 		}
 
 		if 0 < post.Len() {
-			aList.IDparse(aID, post.Markdown())
+			aList.IDparse(aID, htIndexText(post.Markdown()))
 		}
 
 		return nil
 	} // wf()
 
-	go poPersistence.Walk(wf)
+	go func() {
+		_ = WalkParallel(context.Background(), 0, wf, nil)
+		htTouch()
+	}()
 	runtime.Gosched() // get the background operation started
 } // InitHashlist()
 
 var (
-	// RegEx to match texts like `#----`.
-	htHyphenRE = regexp.MustCompile(`#[^-]*--`)
-
 	// Lookup table for URL to use in `MarkupCloud()`.
 	htListLookup = map[bool]string{
 		true:  `/hl/`,
@@ -117,94 +147,209 @@ func MarkupCloud(aList *ht.THashTags) []template.HTML {
 	return tl
 } // MarkupCloud()
 
-// `MarkupTags()` returns `aPage` with all #hashtags/@mentions marked up
-// as a HREF links.
+// `MarkupTags()` returns `aMarkdown` with all #hashtags/@mentions
+// marked up as HREF links.
+//
+// Only tags in the posting's prose are recognised (see `htDetect()`),
+// i.e. not in code, URLs, link texts, or raw HTML.
+//
+// Parameters:
+//   - `aMarkdown`: The Markdown text to process.
+//
+// Returns:
+//   - `[]byte`: The Markdown text with the tags' links.
+func MarkupTags(aMarkdown []byte) []byte {
+	tags := htDetect(aMarkdown)
+	if 0 == len(tags) {
+		return aMarkdown
+	}
+
+	result := make([]byte, 0, len(aMarkdown)+len(tags)*48)
+	last := 0
+	for _, tag := range tags {
+		hash := string(aMarkdown[tag.start:tag.end])
+		result = append(result, aMarkdown[last:tag.start]...)
+		result = append(result, `<a href="`+htListLookup[ht.MarkHash == hash[0]]+
+			strings.ToLower(hash[1:])+`" class="smaller">`+hash+`</a>`...)
+		last = tag.end
+	}
+
+	return append(result, aMarkdown[last:]...)
+} // MarkupTags()
+
+// `htBoundary()` reports whether a #hashtag/@mention may start at
+// `aPos` of `aText`, i.e. whether it's not part of a word, an email
+// address, a path, or an HTML entity.
+//
+// Parameters:
+//   - `aText`: The text to check.
+//   - `aPos`: The position of the possible tag's mark.
+//
+// Returns:
+//   - `bool`: Whether a tag may start at `aPos`.
+func htBoundary(aText []byte, aPos int) bool {
+	if 0 == aPos {
+		return true
+	}
+	r, _ := utf8.DecodeLastRune(aText[:aPos])
+	if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return false
+	}
+
+	return !strings.ContainsRune(`#&/@\`, r)
+} // htBoundary()
+
+// `htDetect()` returns the positions of all #hashtags/@mentions
+// in the prose of `aMarkdown`.
+//
+// The text is parsed into its Markdown syntax tree whose plain text
+// nodes are scanned for tags; code spans and blocks, links (incl.
+// autolinked URLs), images, and raw HTML are skipped.
 //
 // Parameters:
-//   - `aPage`: The HTML page to process.
-func MarkupTags(aPage []byte) []byte {
-	var ( // re-use variables
-		cnt, hits    int
-		err          error
-		re           *regexp.Regexp
-		repl, search string
+//   - `aMarkdown`: The Markdown text to search.
+//
+// Returns:
+//   - `[]tHTmatch`: The tags found (in order of appearance).
+func htDetect(aMarkdown []byte) []tHTmatch {
+	if !bytes.ContainsAny(aMarkdown, `#@`) {
+		return nil
+	}
+
+	var (
+		result  []tHTmatch
+		scanned int // end of the text scanned so far
 	)
-	// (0) Check whether there are any links present:
-	linkMatches := htAHrefRE.FindAll(aPage, -1)
-	if (nil != linkMatches) || (0 < len(linkMatches)) {
-		// (1) replace the links with a dummy text:
-		for hits, cnt = len(linkMatches), 0; cnt < hits; cnt++ {
-			search = regexp.QuoteMeta(string(linkMatches[cnt]))
-			if re, err = regexp.Compile(search); nil == err {
-				repl = fmt.Sprintf(`</-%d-%d-%d-%d-/>`, cnt, cnt, cnt, cnt)
-				aPage = re.ReplaceAllLiteral(aPage, []byte(repl))
+	doc := gmParser.Parse(text.NewReader(aMarkdown))
+	_ = ast.Walk(doc, func(aNode ast.Node, aEntering bool) (ast.WalkStatus, error) {
+		if !aEntering {
+			return ast.WalkContinue, nil
+		}
+		switch aNode.Kind() {
+		case ast.KindAutoLink, ast.KindCodeBlock, ast.KindCodeSpan,
+			ast.KindFencedCodeBlock, ast.KindHTMLBlock, ast.KindImage,
+			ast.KindLink, ast.KindRawHTML:
+			return ast.WalkSkipChildren, nil
+
+		case ast.KindText:
+			seg := aNode.(*ast.Text).Segment
+			if seg.Start < scanned {
+				break // already scanned as part of a previous node
+			}
+			// the parser splits the text at possible delimiters
+			// (like `_`) so we join the adjacent text nodes:
+			stop := seg.Stop
+			for next, ok := aNode.NextSibling().(*ast.Text); ok && (next.Segment.Start == stop); next, ok = next.NextSibling().(*ast.Text) {
+				stop = next.Segment.Stop
 			}
+			result = append(result, htScan(aMarkdown, seg.Start, stop)...)
+			scanned = stop
 		}
-	}
 
-	// (2) markup the #hashtags/@mentions:
-	result := htHashMentionRE.ReplaceAllStringFunc(string(aPage),
-		func(aString string) string {
-			sub := htHashMentionRE.FindSubmatch([]byte(aString))
-			if (nil == sub) || (0 == len(sub)) || (0 == len(sub[1])) {
-				return aString
-			}
+		return ast.WalkContinue, nil
+	})
 
-			var suffix, url string
+	return result
+} // htDetect()
 
-			hash := string(sub[1])
-			// '_' can be both, part of the hashtag and italic
-			// markup so we must remove it if it's at the end:
-			if '_' == hash[len(hash)-1] {
-				hash = hash[:len(hash)-1]
-				suffix = `_`
-			}
+// `htIndexText()` returns the #hashtags/@mentions of `aMarkdown` as
+// recognised by `MarkupTags()`, separated by blanks.
+//
+// Feeding this text (instead of the whole posting) to the hash list
+// makes sure that the list holds exactly the tags shown as links.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's Markdown text.
+//
+// Returns:
+//   - `[]byte`: The posting's tags.
+func htIndexText(aMarkdown []byte) []byte {
+	// use the same text as `phRender()` does
+	md, _ := wlPrepare(aMarkdown)
+	md, _ = scPrepare(md, nil, 0)
+
+	var result []byte
+	for _, tag := range htDetect(md) {
+		if 0 < len(result) {
+			result = append(result, ' ')
+		}
+		result = append(result, md[tag.start:tag.end]...)
+	}
+
+	return result
+} // htIndexText()
 
-			if ht.MarkHash == hash[0] {
-				if 0 < len(sub[2]) {
-					switch sub[2][0] {
-					case '"':
-						// double quote following a possible hashtag: most
-						// probably an URL#fragment, hence leave it as is
-						return aString
-					case ')':
-						// This is a tricky one: it can either be a
-						// normal right round bracket or the end of
-						// a Markdown link. Here we assume that it's
-						// the latter one and ignore this match:
-						return aString
-					case ';':
-						if htEntityRE.MatchString(aString) {
-							// leave HTML entities as is
-							return aString
-						}
-					}
-				}
-				if htHyphenRE.MatchString(hash) {
-					return aString
-				}
-				url = "/hl/" + strings.ToLower(hash[1:])
-			} else {
-				url = "/ml/" + strings.ToLower(hash[1:])
+// `htScan()` returns the #hashtags/@mentions in the plain text
+// `aText[aStart:aEnd]`.
+//
+// Parameters:
+//   - `aText`: The whole Markdown text.
+//   - `aStart`: The start of the text to scan.
+//   - `aEnd`: The end of the text to scan.
+//
+// Returns:
+//   - `[]tHTmatch`: The tags found.
+func htScan(aText []byte, aStart, aEnd int) []tHTmatch {
+	var result []tHTmatch
+
+	for pos := aStart; pos < aEnd; pos++ {
+		if c := aText[pos]; ((ht.MarkHash != c) && (ht.MarkMention != c)) ||
+			!htBoundary(aText, pos) {
+			continue
+		}
+
+		end := pos + 1
+		for end < aEnd {
+			r, size := utf8.DecodeRune(aText[end:aEnd])
+			if !htTagRune(r) {
+				break
 			}
-			if 0 < len(sub[2]) {
-				suffix += string(sub[2])
+			end += size
+		}
+		// '_' can be both, part of the tag and italic markup, and
+		// quotes or hyphens at the end are punctuation:
+		for pos+1 < end {
+			r, size := utf8.DecodeLastRune(aText[pos:end])
+			if !strings.ContainsRune(`_-'’`, r) {
+				break
 			}
+			end -= size
+		}
+		if tag := aText[pos:end]; htValid(tag) {
+			result = append(result, tHTmatch{start: pos, end: end})
+		}
+		pos = end - 1
+	}
 
-			return `<a href="` + url + `" class="smaller">` + hash + `</a>` + suffix
-		})
+	return result
+} // htScan()
 
-	// (3) replace the link dummies with the real markup:
-	for hits, cnt = len(linkMatches), 0; cnt < hits; cnt++ {
-		search = fmt.Sprintf(`</-%d-%d-%d-%d-/>`, cnt, cnt, cnt, cnt)
-		if re, err = regexp.Compile(search); nil == err {
-			result = re.ReplaceAllLiteralString(result,
-				string(linkMatches[cnt]))
-		}
+// `htTagRune()` reports whether `aRune` may be part of a
+// #hashtag/@mention.
+func htTagRune(aRune rune) bool {
+	return unicode.IsLetter(aRune) || unicode.IsDigit(aRune) ||
+		strings.ContainsRune(`_§-'’`, aRune)
+} // htTagRune()
+
+// `htValid()` reports whether `aTag` (including its mark) is
+// a #hashtag/@mention.
+//
+// Texts without any letter or digit (like `#----`) and hexadecimal
+// colour values (like `#0a0a0a`) are rejected.
+func htValid(aTag []byte) bool {
+	if (2 > len(aTag)) || bytes.Contains(aTag, []byte(`--`)) {
+		return false
+	}
+	if !bytes.ContainsFunc(aTag[1:], func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) {
+		return false
 	}
 
-	return []byte(result)
-} // MarkupTags()
+	// words like `#cafe` or `#decade` are no colour values
+	return !((ht.MarkHash == aTag[0]) && htColourRE.Match(aTag) &&
+		bytes.ContainsAny(aTag, `0123456789`))
+} // htValid()
 
 // `ReadHashlist()` reads all postings to (re-)build the list of
 // #hashtags/@mentions disregarding any pre-existing list.
@@ -221,7 +366,11 @@ func ReadHashlist(aList *ht.THashTags) {
 //   - `aList`: The hashlist to update.
 //   - `aID`: The ID of the posting to remove.
 func RemoveIDTags(aList *ht.THashTags, aID uint64) {
-	go aList.IDremove(aID)
+	pcPostingsChanged()
+	go func() {
+		aList.IDremove(aID)
+		htTouch()
+	}()
 
 	runtime.Gosched() // get the background operation started
 } // RemoveIDTags()
@@ -233,68 +382,33 @@ func RemoveIDTags(aList *ht.THashTags, aID uint64) {
 //   - `aOldID`: The posting's old ID.
 //   - `aNewID`: The posting's new ID.
 func RenameIDTags(aList *ht.THashTags, aOldID, aNewID uint64) {
-	go aList.IDrename(aOldID, aNewID)
+	pcPostingsChanged()
+	go func() {
+		aList.IDrename(aOldID, aNewID)
+		htTouch()
+	}()
 
 	runtime.Gosched() // get the background operation started
 } // RenameIDTags()
 
 // `ReplaceTag()` replaces the #tags/@mentions in `aList`.
 //
+// Only whole tags are replaced (see `PreviewTagRename()`) and the
+// changes are recorded in the change log (see `UndoTagRename()`).
+//
 // Parameters:
 //   - `aList`: The hashlist to update.
 //   - `aSearchTag`: The old #tag/@mention to find.
 //   - `aReplaceTag`: The new #tag/@mention to use.
 func ReplaceTag(aList *ht.THashTags, aSearchTag, aReplaceTag string) {
-	if (nil == aList) || (0 == len(aSearchTag)) || (0 == len(aReplaceTag)) {
-		return
-	}
-
-	switch aSearchTag[0] {
-	case ht.MarkHash, ht.MarkMention:
-		switch aReplaceTag[0] {
-		case ht.MarkHash, ht.MarkMention:
-			// nothing to do
-		default:
-			return
-		}
-	default:
+	if nil == aList {
 		return
 	}
 
-	searchRE, err := regexp.Compile(`(?i)\` + aSearchTag)
-	if nil != err {
-		return //se.Wrap(err, 2)
+	if _, _, err := ApplyTagRename(context.Background(), aList,
+		aSearchTag, aReplaceTag, nil); nil != err {
+		apachelogger.Err("ReplaceTag()", err.Error())
 	}
-
-	wf := func(aID uint64) error {
-		post := NewPosting(aID, "")
-		if err := post.Load(); nil != err {
-			// no contents, no joy ...
-			return nil
-		}
-
-		if 0 == post.Len() {
-			// no contents, no joy ...
-			return nil
-		}
-
-		if !searchRE.Match(post.Markdown()) {
-			return nil
-		}
-
-		nMarkdown := searchRE.ReplaceAllLiteral(
-			post.Markdown(),
-			[]byte(aReplaceTag))
-
-		post.Set(nMarkdown).Store()
-
-		aList.IDupdate(aID, nMarkdown)
-
-		return nil
-	} // wf()
-
-	poPersistence.Walk(wf)
-	// runtime.Gosched() // get the background operation started
 } // ReplaceTag()
 
 // `UpdateTags()` updates the #hashtag/@mention references of `aPosting`.
@@ -303,7 +417,12 @@ func ReplaceTag(aList *ht.THashTags, aSearchTag, aReplaceTag string) {
 //   - `aList`: The hashlist to update.
 //   - `aPosting`: The new posting to process.
 func UpdateTags(aList *ht.THashTags, aPosting *TPosting) {
-	go aList.IDupdate(aPosting.ID(), aPosting.Markdown())
+	pcCache.drop(aPosting.ID())
+	go func() {
+		if aList.IDupdate(aPosting.ID(), htIndexText(aPosting.Markdown())) {
+			htTouch()
+		}
+	}()
 
 	runtime.Gosched() // get the background operation started
 } // UpdateTags()
@@ -46,6 +46,16 @@ func Test_MarkupTags(t *testing.T) {
 		// TODO: Add test cases.
 		{" 1", args{p1}, w1},
 		{" 2", args{p2}, w2},
+		{" 3", args{[]byte("```c\n#include <stdio.h>\n```")}, []byte("```c\n#include <stdio.h>\n```")},
+		{" 4", args{[]byte("use `#define` and\n\n    #pragma once")}, []byte("use `#define` and\n\n    #pragma once")},
+		{" 5", args{[]byte(`see https://example.com/page#anchor and <https://example.com/#top>`)}, []byte(`see https://example.com/page#anchor and <https://example.com/#top>`)},
+		{" 6", args{[]byte(`[#notag](/hl/x) and ![#alt](/img/a.png)`)}, []byte(`[#notag](/hl/x) and ![#alt](/img/a.png)`)},
+		{" 7", args{[]byte(`colour #ff0000 or #0a0 but #fine`)}, []byte(`colour #ff0000 or #0a0 but <a href="/hl/fine" class="smaller">#fine</a>`)},
+		{" 8", args{[]byte(`mail me@example.com, not C#, \#escaped`)}, []byte(`mail me@example.com, not C#, \#escaped`)},
+		{" 9", args{[]byte("## Heading {#anchor}\n\ntext (#tag) #Tag2.")}, []byte("## Heading {#anchor}\n\ntext (<a href=\"/hl/tag\" class=\"smaller\">#tag</a>) <a href=\"/hl/tag2\" class=\"smaller\">#Tag2</a>.")},
+		{"10", args{[]byte(`<span title="#x">#y</span>`)}, []byte(`<span title="#x"><a href="/hl/y" class="smaller">#y</a></span>`)},
+		{"11", args{[]byte(`#cafe #feed #face`)}, []byte(`<a href="/hl/cafe" class="smaller">#cafe</a> <a href="/hl/feed" class="smaller">#feed</a> <a href="/hl/face" class="smaller">#face</a>`)},
+		{"12", args{[]byte(`#decade #add #bad #c0ffee`)}, []byte(`<a href="/hl/decade" class="smaller">#decade</a> <a href="/hl/add" class="smaller">#add</a> <a href="/hl/bad" class="smaller">#bad</a> #c0ffee`)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -56,6 +66,25 @@ func Test_MarkupTags(t *testing.T) {
 	}
 } // Test_MarkupTags()
 
+func Test_htIndexText(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{" 1", `no tags`, ``},
+		{" 2", "#one and @two_\n\n```\n#three\n```\n[#four](/x) `#five` #six", `#one @two #six`},
+		{" 3", `{{< figure caption="#seven" >}} #eight`, `#eight`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(htIndexText([]byte(tt.md))); got != tt.want {
+				t.Errorf("htIndexText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_htIndexText()
+
 func Test_ReplaceTag(t *testing.T) {
 	prep4Tests()
 
@@ -0,0 +1,172 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the cache validators (`ETag` and `Last-Modified`)
+ * of the generated pages so that clients can send conditional requests
+ * (`If-None-Match`, `If-Modified-Since`) and get a `304 Not Modified`
+ * reply if nothing has changed since their last visit.
+ */
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"net/http"
+	"time"
+)
+
+type (
+	// `tHeadWriter` is used for `HEAD` requests: it sends the
+	// headers but discards the page's body.
+	tHeadWriter struct {
+		http.ResponseWriter
+	}
+
+	// `tPageValidator` collects the data a generated page depends on.
+	tPageValidator struct {
+		hash    hash.Hash64 // hash of the page's data
+		ids     []uint64    // IDs of the postings shown
+		lastMod time.Time   // newest modification time
+	}
+)
+
+var (
+	// `pvStarted` is the program's start time; all pages depend on
+	// the templates (and the program) loaded at that time.
+	pvStarted = time.Now()
+
+	// `pvDataKeys` are the keys of the basic page data which the
+	// rendered pages depend on.
+	pvDataKeys = []string{
+		`CSS`, `HashCount`, `isAuth`, `Lang`, `MentionCount`, `NOW`,
+		`PostingCount`, `Taglist`,
+	}
+)
+
+// `Write()` discards `aData` pretending it was sent.
+//
+// Parameters:
+//   - `aData`: The data (not) to send.
+//
+// Returns:
+//   - `int`: The length of `aData`.
+//   - `error`: Always `nil`.
+func (hw *tHeadWriter) Write(aData []byte) (int, error) {
+	return len(aData), nil
+} // Write()
+
+// `newPageValidator()` returns a validator for the page answering
+// `aRequest` using the basic page data `aData`.
+//
+// Parameters:
+//   - `aRequest`: The remote user's request.
+//   - `aData`: The page's template data.
+//
+// Returns:
+//   - `*tPageValidator`: The new page validator.
+func newPageValidator(aRequest *http.Request, aData *TemplateData) *tPageValidator {
+	y, m, d := time.Now().Date()
+	result := &tPageValidator{
+		hash:    fnv.New64a(),
+		lastMod: time.Date(y, m, d, 0, 0, 0, 0, time.Local),
+	}
+	if pvStarted.After(result.lastMod) {
+		result.lastMod = pvStarted
+	}
+	if changed := htChangedAt(); changed.After(result.lastMod) {
+		result.lastMod = changed
+	}
+
+	fmt.Fprint(result.hash, aRequest.URL.RequestURI(), pvStarted.UnixNano())
+	if nil != aData {
+		for _, key := range pvDataKeys {
+			val, _ := aData.Get(key)
+			fmt.Fprintf(result.hash, "|%s=%v", key, val)
+		}
+	}
+
+	return result
+} // newPageValidator()
+
+// `add()` includes `aValues` in the page's validator.
+//
+// Parameters:
+//   - `aValues`: The data the page depends on.
+//
+// Returns:
+//   - `*tPageValidator`: The updated validator.
+func (pv *tPageValidator) add(aValues ...any) *tPageValidator {
+	fmt.Fprint(pv.hash, aValues...)
+
+	return pv
+} // add()
+
+// `addPosting()` includes `aPosting` in the page's validator.
+//
+// Parameters:
+//   - `aPosting`: The posting shown by the page.
+//
+// Returns:
+//   - `*tPageValidator`: The updated validator.
+func (pv *tPageValidator) addPosting(aPosting *TPosting) *tPageValidator {
+	lastMod := feedUpdated(aPosting)
+	if lastMod.After(pv.lastMod) {
+		pv.lastMod = lastMod
+	}
+	fmt.Fprint(pv.hash, `|`, aPosting.IDstr(), lastMod.UnixNano())
+	pv.ids = append(pv.ids, aPosting.ID())
+
+	return pv
+} // addPosting()
+
+// `addPostings()` includes all postings of `aList` in the page's
+// validator.
+//
+// Parameters:
+//   - `aList`: The postings shown by the page.
+//
+// Returns:
+//   - `*tPageValidator`: The updated validator.
+func (pv *tPageValidator) addPostings(aList *TPostList) *tPageValidator {
+	if nil != aList {
+		for idx := range *aList {
+			pv.addPosting(&(*aList)[idx])
+		}
+	}
+
+	return pv
+} // addPostings()
+
+// `notModified()` sets the page's `ETag` and `Last-Modified` headers
+// and answers `304 Not Modified` if the client's copy is current.
+//
+// Parameters:
+//   - `aWriter`: The writer to respond to the remote user.
+//   - `aRequest`: The remote user's request.
+//
+// Returns:
+//   - `bool`: `true` if the page doesn't need to be sent.
+func (pv *tPageValidator) notModified(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if 0 == len(aWriter.Header().Get(`Cache-Control`)) {
+		// let the client revalidate its copy on every visit
+		aWriter.Header().Set(`Cache-Control`, `private, no-cache`)
+	}
+	if cw, ok := aWriter.(*tPCwriter); ok {
+		// the page may be cached
+		cw.validated(pv.ids)
+	}
+
+	return feedNotModified(aWriter, aRequest, pv.lastMod,
+		fmt.Sprintf(`W/"%x"`, pv.hash.Sum64()))
+} // notModified()
+
+/* _EoF_ */
@@ -0,0 +1,91 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTPageHandler_conditionalGET(t *testing.T) {
+	ph := prepAPITest(t)
+
+	p := NewPosting(0, "A #cached posting")
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer p.Delete()
+
+	// `get()` sends a request for `aPath` with the given header.
+	get := func(aMethod, aPath, aHeader, aValue string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(aMethod, aPath, nil)
+		if 0 < len(aHeader) {
+			req.Header.Set(aHeader, aValue)
+		}
+		rec := httptest.NewRecorder()
+		ph.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/p/" + p.IDstr(), "/n/", "/m/", "/w/", "/q/cached", "/faq/"} {
+		rec := get(http.MethodGet, path, "", "")
+		etag, lastMod := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+		if (http.StatusOK != rec.Code) || (0 == len(etag)) || (0 == len(lastMod)) {
+			t.Fatalf("%s: status = %d, ETag = %q, Last-Modified = %q", path, rec.Code, etag, lastMod)
+		}
+		if cc := rec.Header().Get("Cache-Control"); "private, no-cache" != cc {
+			t.Errorf("%s: Cache-Control = %q, want %q", path, cc, "private, no-cache")
+		}
+		if rec = get(http.MethodGet, path, "If-None-Match", etag); http.StatusNotModified != rec.Code {
+			t.Errorf("%s: If-None-Match: status = %d, want %d", path, rec.Code, http.StatusNotModified)
+		}
+		if 0 < rec.Body.Len() {
+			t.Errorf("%s: 304 reply with body", path)
+		}
+		if rec = get(http.MethodGet, path, "If-Modified-Since", lastMod); http.StatusNotModified != rec.Code {
+			t.Errorf("%s: If-Modified-Since: status = %d, want %d", path, rec.Code, http.StatusNotModified)
+		}
+		past := time.Now().AddDate(-1, 0, 0).UTC().Format(http.TimeFormat)
+		if rec = get(http.MethodGet, path, "If-Modified-Since", past); http.StatusOK != rec.Code {
+			t.Errorf("%s: old If-Modified-Since: status = %d, want %d", path, rec.Code, http.StatusOK)
+		}
+		if rec = get(http.MethodHead, path, "If-None-Match", etag); http.StatusNotModified != rec.Code {
+			t.Errorf("%s: HEAD If-None-Match: status = %d, want %d", path, rec.Code, http.StatusNotModified)
+		}
+	}
+
+	// HEAD sends the headers only
+	path := "/p/" + p.IDstr()
+	rec := get(http.MethodHead, path, "", "")
+	if (http.StatusOK != rec.Code) || (0 < rec.Body.Len()) {
+		t.Errorf("HEAD: status = %d, body length = %d", rec.Code, rec.Body.Len())
+	}
+	etag := get(http.MethodGet, path, "", "").Header().Get("ETag")
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("HEAD: ETag = %q, want %q", rec.Header().Get("ETag"), etag)
+	}
+
+	// a changed posting invalidates the validators
+	listTag := get(http.MethodGet, "/n/", "", "").Header().Get("ETag")
+	p.Set([]byte("A #changed posting"))
+	if _, err := p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	if rec = get(http.MethodGet, path, "If-None-Match", etag); http.StatusOK != rec.Code {
+		t.Errorf("changed posting: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec = get(http.MethodGet, "/n/", "If-None-Match", listTag); http.StatusOK != rec.Code {
+		t.Errorf("changed list: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+} // TestTPageHandler_conditionalGET()
+
+/* _EoF_ */
@@ -101,12 +101,13 @@ func newChange() *tDataChange {
 
 const (
 	// replacement text for `reHrefRE`
-	reHrefReplace = ` target="_extern" $1`
+	reHrefReplace = `$1 target="_extern" $2`
 )
 
 var (
-	// RegEx to HREF= tag attributes
-	reHrefRE = regexp.MustCompile(` (href="http)`)
+	// RegEx to HREF= attributes of A tags (other tags like the
+	// `<link rel="canonical">` in the page's head don't open a window)
+	reHrefRE = regexp.MustCompile(`(<a(?:\s[^>]*?)?)\s(href="http)`)
 
 	viewFunctionMap = template.FuncMap{
 		"change":   newChange, // a new change structure
@@ -38,7 +38,8 @@ func Test_addExternURLtargets(t *testing.T) {
 		{" 1", p1, w1},
 		{" 2", p2, w2},
 		{" 3", p3, w3},
-		// TODO: Add test cases.
+		{" 4", []byte(`<link rel="canonical" href="https://site/page"><a class="x" href="https://site/">`),
+			[]byte(`<link rel="canonical" href="https://site/page"><a class="x" target="_extern" href="https://site/">`)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,746 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides sending and receiving of Webmentions.
+ *
+ * When a posting is created or edited all external pages it links
+ * to are notified (provided they announce a Webmention endpoint).
+ *
+ * Mentions received at `/webmention` are verified in background and
+ * shown below the respective article once an authenticated user
+ * approved them.
+ *
+ * see: https://www.w3.org/TR/webmention/
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	se "github.com/mwat56/sourceerror"
+)
+
+const (
+	// `wmFileName` is the name of the file storing the received
+	// mentions (below `AppArgs.DataDir`).
+	wmFileName = `webmentions.json`
+
+	// `wmMaxBody` is the max. size of a fetched page.
+	wmMaxBody = 1 << 20
+
+	// `wmMaxPending` is the max. number of not yet approved mentions.
+	wmMaxPending = 500
+
+	// `wmMaxPendingSource` is the max. number of not yet approved
+	// mentions from a single source host.
+	wmMaxPendingSource = 10
+
+	// `wmQueueSize` is the max. number of mentions waiting for
+	// their verification.
+	wmQueueSize = 64
+
+	// `wmTimeout` is the max. duration of a single remote request.
+	wmTimeout = 10 * time.Second
+
+	// `wmWorkers` is the number of concurrent verifications.
+	wmWorkers = 4
+)
+
+type (
+	// `TWebmention` is a single received mention of a posting.
+	TWebmention struct {
+		Approved bool      `json:"approved"` // shown to the public
+		ID       string    `json:"id"`       // ID used for moderation
+		PostID   string    `json:"post"`     // ID of the mentioned posting
+		Received time.Time `json:"received"` // time of (last) verification
+		Source   string    `json:"source"`   // URL of the mentioning page
+		Target   string    `json:"target"`   // URL of the mentioned posting
+		Title    string    `json:"title"`    // title of the mentioning page
+	}
+
+	// `TWebmentions` is the list of all received mentions.
+	TWebmentions struct {
+		baseURL  string                  // public URL of the blog
+		client   *http.Client            // client for remote requests
+		fName    string                  // name of the file storing the list
+		mentions map[string]*TWebmention // mentions indexed by their ID
+		mtx      sync.RWMutex            // guard against concurrent accesses
+		once     sync.Once               // start the verification workers
+		private  bool                    // allow local addresses (for testing)
+		queue    chan tWMRequest         // mentions waiting for verification
+		wg       sync.WaitGroup          // running verifications/deliveries
+	}
+
+	// `tWMRequest` is a received mention waiting for its verification.
+	tWMRequest struct {
+		postID         uint64
+		source, target string
+	}
+)
+
+var (
+	// `ErrWebmentionTarget` is returned for invalid mention targets.
+	ErrWebmentionTarget = errors.New("invalid webmention target")
+
+	// `ErrWebmentionSource` is returned for invalid mention sources.
+	ErrWebmentionSource = errors.New("invalid webmention source")
+
+	// `ErrWebmentionAddress` is returned for remote requests to
+	// local or private network addresses.
+	ErrWebmentionAddress = errors.New("webmention: local network address")
+
+	// `ErrWebmentionLimit` is returned if too many mentions are
+	// waiting for their verification or approval.
+	ErrWebmentionLimit = errors.New("too many pending webmentions")
+
+	// The shared address space of carrier-grade NAT (RFC 6598).
+	_, wmCGNAT, _ = net.ParseCIDR(`100.64.0.0/10`)
+
+	// RegEx to find the external links of a rendered posting.
+	wmHrefRE = regexp.MustCompile(`(?i)<a\s[^>]*?href="(https?://[^"]+)"`)
+
+	// RegEx to find a `Link` header's entries.
+	wmLinkHeaderRE = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="?([^";,]*)"?`)
+
+	// RegExes to find a page's `<link>` and `<a>` elements and their
+	// `rel` and `href` attributes.
+	wmRelRE      = regexp.MustCompile(`(?i)\srel\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	wmHrefAttrRE = regexp.MustCompile(`(?i)\shref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	wmTagRE      = regexp.MustCompile(`(?is)<(?:link|a)\s[^>]*>`)
+
+	// RegEx to find a page's title.
+	wmTitleRE = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// --------------------------------------------------------------------------
+// constructor function:
+
+// `NewWebmentions()` returns the list of received mentions.
+//
+// A missing file is not considered an error but results in an
+// empty list.
+//
+// Parameters:
+//   - `aBaseURL`: The public URL of the blog (e.g. `https://host`).
+//   - `aFilename`: The name of the file storing the mentions.
+//
+// Returns:
+//   - `*TWebmentions`: The list of received mentions.
+//   - `error`: A possible I/O or decoding error.
+func NewWebmentions(aBaseURL, aFilename string) (*TWebmentions, error) {
+	result := &TWebmentions{
+		baseURL:  strings.TrimSuffix(aBaseURL, `/`),
+		fName:    aFilename,
+		mentions: make(map[string]*TWebmention),
+		queue:    make(chan tWMRequest, wmQueueSize),
+	}
+	result.client = wmPublicClient(wmTimeout, func() bool {
+		return result.private
+	})
+
+	data, err := os.ReadFile(aFilename) /* #nosec G304 */
+	if nil != err {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, se.Wrap(err, 3)
+	}
+
+	var list []*TWebmention
+	if err = json.Unmarshal(data, &list); nil != err {
+		return nil, se.Wrap(err, 1)
+	}
+	for _, wm := range list {
+		result.mentions[wm.ID] = wm
+	}
+
+	return result, nil
+} // NewWebmentions()
+
+// --------------------------------------------------------------------------
+// helper functions:
+
+// `wmAttr()` returns the value of the first submatch of `aRE` in `aTag`.
+func wmAttr(aRE *regexp.Regexp, aTag string) (string, bool) {
+	match := aRE.FindStringSubmatch(aTag)
+	if nil == match {
+		return "", false
+	}
+	for _, val := range match[1:] {
+		if 0 < len(val) {
+			return html.UnescapeString(val), true
+		}
+	}
+
+	return "", true
+} // wmAttr()
+
+// `wmCheckAddress()` rejects connections to local or private
+// network addresses.
+//
+// Parameters:
+//   - `aAddress`: The resolved `host:port` address to connect to.
+//
+// Returns:
+//   - `error`: `ErrWebmentionAddress` for a non-public address, or `nil`.
+func wmCheckAddress(aAddress string) error {
+	host, _, err := net.SplitHostPort(aAddress)
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	ip := net.ParseIP(host)
+	if (nil == ip) || !ip.IsGlobalUnicast() || ip.IsPrivate() ||
+		wmCGNAT.Contains(ip) {
+		// `IsGlobalUnicast()` excludes loopback, link-local,
+		// multicast, and unspecified addresses.
+		return fmt.Errorf("%w: %s", ErrWebmentionAddress, host)
+	}
+
+	return nil
+} // wmCheckAddress()
+
+// `wmEndpoint()` returns the Webmention endpoint announced by a page.
+//
+// The endpoint is looked for in the `Link` header first and then in
+// the `<link>` and `<a>` elements of the page's HTML.
+//
+// Parameters:
+//   - `aPageURL`: The (final) URL of the page.
+//   - `aHeader`: The page's HTTP headers.
+//   - `aBody`: The page's HTML.
+//
+// Returns:
+//   - `string`: The absolute endpoint URL or an empty string.
+func wmEndpoint(aPageURL *url.URL, aHeader http.Header, aBody []byte) string {
+	var endpoint string
+	found := false
+
+	for _, link := range aHeader.Values(`Link`) {
+		for _, match := range wmLinkHeaderRE.FindAllStringSubmatch(link, -1) {
+			if wmHasRel(match[2]) {
+				endpoint, found = match[1], true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		for _, tag := range wmTagRE.FindAllString(string(aBody), -1) {
+			if rel, ok := wmAttr(wmRelRE, tag); !ok || !wmHasRel(rel) {
+				continue
+			}
+			if href, ok := wmAttr(wmHrefAttrRE, tag); ok {
+				endpoint, found = href, true
+				break
+			}
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	// An empty `href` refers to the page itself.
+	u, err := aPageURL.Parse(strings.TrimSpace(endpoint))
+	if (nil != err) || ((`https` != u.Scheme) && (`http` != u.Scheme)) {
+		return ""
+	}
+
+	return u.String()
+} // wmEndpoint()
+
+// `wmHasRel()` reports whether the `rel` value `aRel` contains
+// the `webmention` token.
+func wmHasRel(aRel string) bool {
+	for _, rel := range strings.Fields(strings.ToLower(aRel)) {
+		if `webmention` == rel {
+			return true
+		}
+	}
+
+	return false
+} // wmHasRel()
+
+// `wmLinks()` returns the external links of `aPosting`.
+//
+// Parameters:
+//   - `aPosting`: The posting to inspect.
+//   - `aBaseURL`: The blog's own URL whose links are skipped.
+//
+// Returns:
+//   - `[]string`: The (unique) external link URLs.
+func wmLinks(aPosting *TPosting, aBaseURL string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, match := range wmHrefRE.FindAllStringSubmatch(string(aPosting.Post()), -1) {
+		link := html.UnescapeString(match[1])
+		if seen[link] || strings.HasPrefix(link, aBaseURL+`/`) {
+			continue
+		}
+		seen[link] = true
+		result = append(result, link)
+	}
+
+	return result
+} // wmLinks()
+
+// `wmPublicClient()` returns an HTTP client which refuses to connect
+// to local or private network addresses (see `wmCheckAddress()`).
+//
+// Every connection (incl. redirects and discovered endpoints) is
+// checked after the host name was resolved.
+// The client is used for all requests to URLs provided by remote
+// users, i.e. for the Webmentions as well as for ActivityPub.
+//
+// Parameters:
+//   - `aTimeout`: The max. duration of a request.
+//   - `aAllowLocal`: Reports whether local addresses are allowed (for testing).
+//
+// Returns:
+//   - `*http.Client`: The new HTTP client.
+func wmPublicClient(aTimeout time.Duration, aAllowLocal func() bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: aTimeout,
+		Control: func(aNetwork, aAddress string, aConn syscall.RawConn) error {
+			if aAllowLocal() {
+				return nil
+			}
+			return wmCheckAddress(aAddress)
+		},
+	}
+
+	return &http.Client{
+		Timeout: aTimeout,
+		Transport: &http.Transport{
+			// no proxy: it would hide the actual address
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     aTimeout,
+			TLSHandshakeTimeout: aTimeout,
+		},
+	}
+} // wmPublicClient()
+
+// --------------------------------------------------------------------------
+// TWebmentions methods
+
+// `Approve()` makes the mention with `aID` visible to the public.
+//
+// Parameters:
+//   - `aID`: The ID of the mention to approve.
+//
+// Returns:
+//   - `error`: `ErrWebmentionSource` for an unknown ID, or an I/O error.
+func (wl *TWebmentions) Approve(aID string) error {
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	wm, ok := wl.mentions[aID]
+	if !ok {
+		return ErrWebmentionSource
+	}
+	wm.Approved = true
+	pcCache.drop(str2id(wm.PostID))
+
+	return wl.store()
+} // Approve()
+
+// `Delete()` removes the mention with `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the mention to remove.
+//
+// Returns:
+//   - `error`: `ErrWebmentionSource` for an unknown ID, or an I/O error.
+func (wl *TWebmentions) Delete(aID string) error {
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	wm, ok := wl.mentions[aID]
+	if !ok {
+		return ErrWebmentionSource
+	}
+	delete(wl.mentions, aID)
+	pcCache.drop(str2id(wm.PostID))
+
+	return wl.store()
+} // Delete()
+
+// `fetch()` retrieves the page at `aURL`.
+//
+// Returns:
+//   - `*http.Response`: The response with a body of at most `wmMaxBody` bytes.
+//   - `[]byte`: The page's body.
+//   - `error`: A possible network error.
+func (wl *TWebmentions) fetch(aCtx context.Context, aURL string) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(aCtx, wmTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, aURL, nil)
+	if nil != err {
+		return nil, nil, se.Wrap(err, 1)
+	}
+	req.Header.Set(`Accept`, `text/html, */*;q=0.5`)
+
+	resp, err := wl.client.Do(req)
+	if nil != err {
+		return nil, nil, se.Wrap(err, 1)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, wmMaxBody))
+	if nil != err {
+		return nil, nil, se.Wrap(err, 1)
+	}
+
+	return resp, body, nil
+} // fetch()
+
+// `List()` returns the mentions of the posting with `aPostID`.
+//
+// Parameters:
+//   - `aPostID`: The ID of the mentioned posting.
+//   - `aAll`: Whether to include the not yet approved mentions.
+//
+// Returns:
+//   - `[]TWebmention`: The mentions sorted by their receiving time.
+func (wl *TWebmentions) List(aPostID uint64, aAll bool) []TWebmention {
+	if nil == wl {
+		return nil
+	}
+	postID := id2str(aPostID)
+	wl.mtx.RLock()
+	defer wl.mtx.RUnlock()
+
+	var result []TWebmention
+	for _, wm := range wl.mentions {
+		if (postID == wm.PostID) && (aAll || wm.Approved) {
+			result = append(result, *wm)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Received.Equal(result[j].Received) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Received.Before(result[j].Received)
+	})
+
+	return result
+} // List()
+
+// `Receive()` accepts a mention of one of our postings.
+//
+// The given URLs are checked immediately while the `aSource` page
+// is verified in background.
+//
+// Parameters:
+//   - `aSource`: The URL of the mentioning page.
+//   - `aTarget`: The URL of the mentioned posting.
+//
+// Returns:
+//   - `error`: `ErrWebmentionSource`, `ErrWebmentionTarget`, `ErrWebmentionLimit`, or `nil`.
+func (wl *TWebmentions) Receive(aSource, aTarget string) error {
+	su, err := url.Parse(aSource)
+	if (nil != err) || ((`https` != su.Scheme) && (`http` != su.Scheme)) || (0 == len(su.Host)) {
+		return ErrWebmentionSource
+	}
+	if aSource == aTarget {
+		return ErrWebmentionSource
+	}
+	tu, err := url.Parse(aTarget)
+	if (nil != err) || !strings.HasPrefix(aTarget, wl.baseURL+`/p/`) {
+		return ErrWebmentionTarget
+	}
+	_, _, postID := URLparts(tu.Path)
+	if (0 == postID) || !poPersistence.Exists(postID) {
+		return ErrWebmentionTarget
+	}
+
+	wl.mtx.RLock()
+	err = wl.checkPending(aSource, aTarget)
+	wl.mtx.RUnlock()
+	if nil != err {
+		return err
+	}
+
+	wl.once.Do(func() {
+		for range wmWorkers {
+			go wl.work()
+		}
+	})
+	wl.wg.Add(1)
+	select {
+	case wl.queue <- tWMRequest{postID: postID, source: aSource, target: aTarget}:
+		return nil
+	default:
+		wl.wg.Done()
+		return ErrWebmentionLimit
+	}
+} // Receive()
+
+// `checkPending()` checks whether another mention from `aSource`
+// may be accepted.
+//
+// Known mentions (i.e. updates) are always accepted.
+//
+// NOTE: The caller must hold the (read) lock.
+//
+// Parameters:
+//   - `aSource`: The URL of the mentioning page.
+//   - `aTarget`: The URL of the mentioned posting.
+//
+// Returns:
+//   - `error`: `ErrWebmentionLimit` if too many mentions are pending.
+func (wl *TWebmentions) checkPending(aSource, aTarget string) error {
+	su, err := url.Parse(aSource)
+	if nil != err {
+		return ErrWebmentionSource
+	}
+	var pending, fromSource int
+	for _, wm := range wl.mentions {
+		if (aSource == wm.Source) && (aTarget == wm.Target) {
+			return nil
+		}
+		if wm.Approved {
+			continue
+		}
+		pending++
+		if u, err := url.Parse(wm.Source); (nil == err) && strings.EqualFold(u.Hostname(), su.Hostname()) {
+			fromSource++
+		}
+	}
+	if (wmMaxPending <= pending) || (wmMaxPendingSource <= fromSource) {
+		return ErrWebmentionLimit
+	}
+
+	return nil
+} // checkPending()
+
+// `RemovePost()` removes all mentions of the posting with `aPostID`.
+//
+// Parameters:
+//   - `aPostID`: The ID of the removed posting.
+func (wl *TWebmentions) RemovePost(aPostID uint64) {
+	if nil == wl {
+		return
+	}
+	postID := id2str(aPostID)
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	removed := false
+	for id, wm := range wl.mentions {
+		if postID == wm.PostID {
+			delete(wl.mentions, id)
+			removed = true
+		}
+	}
+	if removed {
+		if err := wl.store(); nil != err {
+			apachelogger.Err("TWebmentions.RemovePost()",
+				fmt.Sprintf("store(): %v", err))
+		}
+	}
+} // RemovePost()
+
+// `send()` notifies the page at `aTarget` about `aSource`.
+func (wl *TWebmentions) send(aSource, aTarget string) error {
+	resp, body, err := wl.fetch(context.Background(), aTarget)
+	if nil != err {
+		return err
+	}
+	endpoint := wmEndpoint(resp.Request.URL, resp.Header, body)
+	if 0 == len(endpoint) {
+		return nil // nobody to tell
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wmTimeout)
+	defer cancel()
+	form := url.Values{`source`: {aSource}, `target`: {aTarget}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint,
+		strings.NewReader(form.Encode()))
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	req.Header.Set(`Content-Type`, `application/x-www-form-urlencoded`)
+
+	resp, err = wl.client.Do(req)
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, wmMaxBody))
+	if (200 > resp.StatusCode) || (299 < resp.StatusCode) {
+		return fmt.Errorf("POST %s: %s", endpoint, resp.Status)
+	}
+
+	return nil
+} // send()
+
+// `Send()` notifies all external pages linked by `aPosting` in
+// background.
+//
+// It's safe to call this method on a `nil` instance in which case
+// nothing happens.
+//
+// Parameters:
+//   - `aPosting`: The new or edited posting.
+func (wl *TWebmentions) Send(aPosting *TPosting) {
+	if nil == wl {
+		return
+	}
+	source := wl.baseURL + `/p/` + aPosting.IDstr()
+
+	for _, link := range wmLinks(aPosting, wl.baseURL) {
+		wl.wg.Add(1)
+		go func(aTarget string) {
+			defer wl.wg.Done()
+			if err := wl.send(source, aTarget); nil != err {
+				apachelogger.Err("TWebmentions.Send()",
+					fmt.Sprintf("send(%s, %s): %v", source, aTarget, err))
+			}
+		}(link)
+	}
+} // Send()
+
+// `store()` writes the list to its file.
+//
+// NOTE: The caller must hold the write lock.
+func (wl *TWebmentions) store() error {
+	list := make([]*TWebmention, 0, len(wl.mentions))
+	for _, wm := range wl.mentions {
+		list = append(list, wm)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	data, err := json.MarshalIndent(list, "", "\t")
+	if nil != err {
+		return se.Wrap(err, 1)
+	}
+	if err = os.MkdirAll(filepath.Dir(wl.fName), 0770); nil != err {
+		return se.Wrap(err, 1)
+	}
+	tmpName := wl.fName + `~`
+	if err = os.WriteFile(tmpName, data, 0640); nil != err {
+		return se.Wrap(err, 1)
+	}
+	if err = os.Rename(tmpName, wl.fName); nil != err {
+		return se.Wrap(err, 1)
+	}
+
+	return nil
+} // store()
+
+// `verify()` checks whether `aSource` actually links to `aTarget`
+// and adds (or updates, or removes) the respective mention.
+func (wl *TWebmentions) verify(aSource, aTarget string, aPostID uint64) error {
+	resp, body, err := wl.fetch(context.Background(), aSource)
+	if nil != err {
+		return err
+	}
+
+	linked := false
+	switch resp.StatusCode {
+	case http.StatusOK:
+		page := string(body)
+		linked = strings.Contains(page, aTarget) ||
+			strings.Contains(page, html.EscapeString(aTarget))
+	case http.StatusGone:
+		// the source was deleted
+	default:
+		return fmt.Errorf("GET %s: %s", aSource, resp.Status)
+	}
+
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	var known *TWebmention
+	for _, wm := range wl.mentions {
+		if (aSource == wm.Source) && (aTarget == wm.Target) {
+			known = wm
+			break
+		}
+	}
+	if !linked {
+		if nil == known {
+			return fmt.Errorf("%w: no link to %s", ErrWebmentionSource, aTarget)
+		}
+		delete(wl.mentions, known.ID)
+		pcCache.drop(aPostID)
+		return wl.store()
+	}
+
+	if nil == known {
+		if err = wl.checkPending(aSource, aTarget); nil != err {
+			return err
+		}
+		id, err := tkRandom(6)
+		if nil != err {
+			return err
+		}
+		known = &TWebmention{
+			ID:     id,
+			PostID: id2str(aPostID),
+			Source: aSource,
+			Target: aTarget,
+		}
+		wl.mentions[id] = known
+	}
+	known.Received = time.Now().Truncate(time.Second)
+	known.Title = aSource
+	if match := wmTitleRE.FindSubmatch(body); nil != match {
+		if title := strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), ` `); 0 < len(title) {
+			known.Title = title
+		}
+	}
+	pcCache.drop(aPostID)
+
+	return wl.store()
+} // verify()
+
+// `work()` verifies the queued mentions.
+func (wl *TWebmentions) work() {
+	for req := range wl.queue {
+		if err := wl.verify(req.source, req.target, req.postID); nil != err {
+			apachelogger.Err("TWebmentions.work()",
+				fmt.Sprintf("verify(%s, %s): %v", req.source, req.target, err))
+		}
+		wl.wg.Done()
+	}
+} // work()
+
+// `Wait()` blocks until all running verifications and deliveries
+// are done.
+func (wl *TWebmentions) Wait() {
+	if nil != wl {
+		wl.wg.Wait()
+	}
+} // Wait()
+
+/* _EoF_ */
@@ -0,0 +1,261 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_wmEndpoint(t *testing.T) {
+	page, _ := url.Parse("https://example.com/dir/page")
+	hdr := func(aLink string) http.Header {
+		h := http.Header{}
+		if 0 < len(aLink) {
+			h.Set("Link", aLink)
+		}
+		return h
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   string
+	}{
+		{" 1", hdr(`<https://wm.example.org/ep>; rel="webmention"`), "", "https://wm.example.org/ep"},
+		{" 2", hdr(`</ep>; rel="other", <ep2>; rel="webmention"`), "", "https://example.com/dir/ep2"},
+		{" 3", hdr(""), `<html><link rel="webmention" href="/wm?x=1&amp;y=2"></html>`, "https://example.com/wm?x=1&y=2"},
+		{" 4", hdr(""), `<a href="ep" rel="me webmention">x</a>`, "https://example.com/dir/ep"},
+		{" 5", hdr(""), `<link rel="webmention" href="">`, "https://example.com/dir/page"},
+		{" 6", hdr(""), `<link rel="stylesheet" href="/css">`, ""},
+		{" 7", hdr(`<https://header.example.org/>; rel=webmention`), `<link rel="webmention" href="/body">`, "https://header.example.org/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wmEndpoint(page, tt.header, []byte(tt.body)); got != tt.want {
+				t.Errorf("wmEndpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_wmEndpoint()
+
+// `tWMStandIn` simulates the remote sites linking and linked to.
+type tWMStandIn struct {
+	mtx      sync.Mutex
+	gone     bool
+	received []string
+	target   string
+}
+
+func (si *tWMStandIn) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Request) {
+	si.mtx.Lock()
+	defer si.mtx.Unlock()
+
+	switch aRequest.URL.Path {
+	case "/endpoint":
+		si.received = append(si.received, aRequest.FormValue("target"))
+		aWriter.WriteHeader(http.StatusAccepted)
+	case "/header":
+		aWriter.Header().Set("Link", `</endpoint>; rel="webmention"`)
+		fmt.Fprint(aWriter, "<html><body>header</body></html>")
+	case "/html":
+		fmt.Fprint(aWriter, `<html><head><link rel="webmention" href="endpoint"></head></html>`)
+	case "/linking":
+		if si.gone {
+			http.Error(aWriter, "gone", http.StatusGone)
+			return
+		}
+		fmt.Fprintf(aWriter, `<html><head><title>A  linking
+			page</title></head><body><a href="%s">here</a></body></html>`, si.target)
+	default:
+		fmt.Fprint(aWriter, "<html><body>nothing</body></html>")
+	}
+} // ServeHTTP()
+
+func TestTWebmentions(t *testing.T) {
+	ph := prepAPITest(t)
+	blog := httptest.NewServer(ph)
+	defer blog.Close()
+	wl, err := NewWebmentions(blog.URL, filepath.Join(t.TempDir(), wmFileName))
+	if nil != err {
+		t.Fatal(err)
+	}
+	ph.webmentions = wl
+
+	si := new(tWMStandIn)
+	remote := httptest.NewServer(si)
+	defer remote.Close()
+
+	// the test servers use the loopback address:
+	if _, _, err = wl.fetch(context.Background(), remote.URL+"/linking"); !errors.Is(err, ErrWebmentionAddress) {
+		t.Errorf("fetch(loopback) error = %v, want %v", err, ErrWebmentionAddress)
+	}
+	wl.private = true
+
+	p := NewPosting(0, fmt.Sprintf("see [one](%s/header), [two](%s/html), [three](%s/none), and [us](%s/n/)",
+		remote.URL, remote.URL, remote.URL, blog.URL))
+	if _, err = p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer p.Delete()
+	target := blog.URL + "/p/" + p.IDstr()
+	si.target = target
+
+	// sending
+	wl.Send(p)
+	wl.Wait()
+	sort.Strings(si.received)
+	if want := remote.URL + "/header," + remote.URL + "/html"; strings.Join(si.received, ",") != want {
+		t.Errorf("sent to %v, want %q", si.received, want)
+	}
+
+	// receiving
+	post := func(aSource, aTarget string) int {
+		resp, err := http.PostForm(blog.URL+"/webmention",
+			url.Values{"source": {aSource}, "target": {aTarget}})
+		if nil != err {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := post(remote.URL+"/linking", "https://elsewhere.example.org/p/"+p.IDstr()); http.StatusBadRequest != got {
+		t.Errorf("foreign target: status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := post("ftp://"+remote.URL[7:], target); http.StatusBadRequest != got {
+		t.Errorf("invalid source: status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := post(remote.URL+"/none", target); http.StatusAccepted != got {
+		t.Errorf("unlinked source: status = %d, want %d", got, http.StatusAccepted)
+	}
+	if got := post(remote.URL+"/linking", target); http.StatusAccepted != got {
+		t.Errorf("linking source: status = %d, want %d", got, http.StatusAccepted)
+	}
+	wl.Wait()
+
+	list := wl.List(p.ID(), true)
+	if (1 != len(list)) || list[0].Approved || ("A linking page" != list[0].Title) {
+		t.Fatalf("List(all) = %+v, want one unapproved mention", list)
+	}
+	if 0 != len(wl.List(p.ID(), false)) {
+		t.Error("unapproved mention listed publicly")
+	}
+
+	getPage := func() string {
+		resp, err := http.Get(target)
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if !strings.Contains(resp.Header.Get("Link"), blog.URL+"/webmention") {
+			t.Errorf("missing Link header: %q", resp.Header.Get("Link"))
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if err = wl.Approve(list[0].ID); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(getPage(), remote.URL+"/linking") {
+		t.Error("approved mention not shown")
+	}
+
+	// a reloaded list keeps the mentions
+	if wl2, err := NewWebmentions(blog.URL, wl.fName); nil != err {
+		t.Error(err)
+	} else if 1 != len(wl2.List(p.ID(), false)) {
+		t.Errorf("reloaded list = %v, want one mention", wl2.List(p.ID(), true))
+	}
+
+	// a deleted source removes the mention
+	si.mtx.Lock()
+	si.gone = true
+	si.mtx.Unlock()
+	post(remote.URL+"/linking", target)
+	wl.Wait()
+	if 0 != len(wl.List(p.ID(), true)) {
+		t.Error("mention of deleted source kept")
+	}
+} // TestTWebmentions()
+
+func TestTWebmentions_limits(t *testing.T) {
+	prepAPITest(t)
+	wl, err := NewWebmentions("http://blog.example.org", filepath.Join(t.TempDir(), wmFileName))
+	if nil != err {
+		t.Fatal(err)
+	}
+	p := NewPosting(0, "mentioned")
+	if _, err = p.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer p.Delete()
+	target := wl.baseURL + "/p/" + p.IDstr()
+
+	for i := range wmMaxPendingSource {
+		id := fmt.Sprintf("wm%d", i)
+		wl.mentions[id] = &TWebmention{
+			ID:     id,
+			PostID: p.IDstr(),
+			Source: fmt.Sprintf("https://spam.example.com/%d", i),
+			Target: target,
+		}
+	}
+	if err = wl.Receive("https://spam.example.com/more", target); !errors.Is(err, ErrWebmentionLimit) {
+		t.Errorf("Receive(spam) error = %v, want %v", err, ErrWebmentionLimit)
+	}
+	// updates of known mentions are accepted:
+	if err = wl.checkPending("https://spam.example.com/1", target); nil != err {
+		t.Errorf("checkPending(known) error = %v", err)
+	}
+	// other sources are accepted:
+	if err = wl.checkPending("https://other.example.com/", target); nil != err {
+		t.Errorf("checkPending(other) error = %v", err)
+	}
+} // TestTWebmentions_limits()
+
+func Test_wmCheckAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{" 1", "93.184.216.34:443", false},
+		{" 2", "[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{" 3", "127.0.0.1:80", true},
+		{" 4", "[::1]:80", true},
+		{" 5", "10.1.2.3:80", true},
+		{" 6", "172.16.0.1:80", true},
+		{" 7", "192.168.1.1:80", true},
+		{" 8", "169.254.169.254:80", true},
+		{" 9", "[fe80::1]:80", true},
+		{"10", "[fd00::1]:80", true},
+		{"11", "0.0.0.0:80", true},
+		{"12", "100.64.0.1:80", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := wmCheckAddress(tt.address); (nil != err) != tt.wantErr {
+				t.Errorf("wmCheckAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+} // Test_wmCheckAddress()
+
+/* _EoF_ */
@@ -0,0 +1,608 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the wiki-style links between postings
+ * (`[[<id>]]`, `[[<title>]]`, and `[[<ref>|text]]`) and the index
+ * of backlinks.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type (
+	// `TBacklink` is a posting referencing another one.
+	TBacklink struct {
+		ID    string // the referencing posting's ID
+		Date  string // the referencing posting's date
+		Title string // the referencing posting's title
+	}
+
+	// `tWLindex` holds the links between the postings.
+	tWLindex struct {
+		built  bool                           // the index was filled
+		from   map[uint64][]uint64            // posting => linked postings
+		to     map[uint64]map[uint64]struct{} // posting => linking postings
+		refs   map[uint64][]string            // posting => its references (IDs and titles)
+		heads  map[uint64]string              // posting => its title
+		titles map[string][]uint64            // title => postings with that title
+		mtx    sync.Mutex                     // guard against concurrent accesses
+	}
+)
+
+var (
+	// RegEx to find a wiki link (`[[<ref>]]` or `[[<ref>|text]]`).
+	wlLinkRE = regexp.MustCompile(`\[\[([^\]|\n]+?)(?:\|([^\]\n]+))?\]\]`)
+	//                                 11111111111       222222222
+
+	// RegEx to find a Markdown link to a posting (`[text](/p/<id>)`).
+	wlPostRE = regexp.MustCompile(`\]\(/p/([0-9a-fA-F]{16})\)`)
+	//                                    111111111111111111
+
+	// The index of all links between the postings.
+	wlIndex = &tWLindex{
+		from:   make(map[uint64][]uint64),
+		to:     make(map[uint64]map[uint64]struct{}),
+		refs:   make(map[uint64][]string),
+		heads:  make(map[uint64]string),
+		titles: make(map[string][]uint64),
+	}
+)
+
+// `Backlinks()` returns the postings referencing the posting `aID`,
+// newest first.
+//
+// Parameters:
+//   - `aID`: The ID of the referenced posting.
+//
+// Returns:
+//   - `[]TBacklink`: The list of referencing postings.
+func Backlinks(aID uint64) []TBacklink {
+	ids := wlIndex.sources(aID)
+	result := make([]TBacklink, 0, len(ids))
+	for _, id := range ids {
+		p := NewPosting(id, "")
+		if err := p.Load(); nil != err {
+			continue
+		}
+		md, _ := wlPrepare(p.Markdown())
+		result = append(result, TBacklink{
+			ID:    p.IDstr(),
+			Date:  p.Date(),
+			Title: feedTitle(md),
+		})
+	}
+
+	return result
+} // Backlinks()
+
+// --------------------------------------------------------------------------
+// tWLindex methods
+
+// `build()` fills the index from all postings unless done before.
+//
+// The caller must hold the write lock.
+func (wi *tWLindex) build() {
+	if wi.built || (nil == poPersistence) {
+		return
+	}
+	_ = poPersistence.Walk(func(aID uint64) error {
+		p := NewPosting(aID, "")
+		if err := p.Load(); nil == err {
+			if refs := wlRefs(p.Markdown()); 0 < len(refs) {
+				wi.refs[aID] = refs
+			}
+			wi.setTitle(aID, wlTitle(feedHeadline(p.Markdown())))
+		}
+
+		return nil
+	})
+	// all titles are known now
+	for id, refs := range wi.refs {
+		wi.set(id, wi.resolve(refs))
+	}
+	wi.built = true
+} // build()
+
+// `newest()` returns the latest posting with the title `aTitle`.
+//
+// The caller must hold the lock.
+//
+// Parameters:
+//   - `aTitle`: The title as returned by `wlTitle()`.
+//
+// Returns:
+//   - `uint64`: The ID of the posting.
+//   - `bool`: Whether a posting with that title exists.
+func (wi *tWLindex) newest(aTitle string) (uint64, bool) {
+	if ids := wi.titles[aTitle]; 0 < len(ids) {
+		return slices.Max(ids), true
+	}
+
+	return 0, false
+} // newest()
+
+// `referencing()` returns the postings referencing one of `aTitles`.
+//
+// The caller must hold the lock.
+//
+// Parameters:
+//   - `aTitles`: The titles as returned by `wlTitle()`.
+//
+// Returns:
+//   - `[]uint64`: The IDs of the referencing postings.
+func (wi *tWLindex) referencing(aTitles ...string) []uint64 {
+	var result []uint64
+	for id, refs := range wi.refs {
+		if slices.ContainsFunc(refs, func(aRef string) bool {
+			return slices.Contains(aTitles, aRef)
+		}) {
+			result = append(result, id)
+		}
+	}
+
+	return result
+} // referencing()
+
+// `relink()` resolves the references of the postings `aIDs` again.
+//
+// The cached pages of those postings and all postings gaining or
+// losing a link are dropped. The caller must hold the lock.
+//
+// Parameters:
+//   - `aIDs`: The IDs of the postings to update.
+func (wi *tWLindex) relink(aIDs ...uint64) {
+	for _, id := range aIDs {
+		targets := wi.resolve(wi.refs[id])
+		old := wi.set(id, targets)
+		pcCache.drop(append(append(old, targets...), id)...)
+	}
+} // relink()
+
+// `remove()` drops the links of the posting `aID`.
+//
+// Parameters:
+//   - `aID`: The ID of the removed posting.
+func (wi *tWLindex) remove(aID uint64) {
+	wi.mtx.Lock()
+	defer wi.mtx.Unlock()
+
+	if wi.built {
+		wi.set(aID, nil)
+		delete(wi.refs, aID)
+		if title := wi.setTitle(aID, ``); 0 < len(title) {
+			wi.relink(wi.referencing(title)...)
+		}
+	}
+} // remove()
+
+// `rename()` moves the links of the posting `aOldID` to `aNewID`.
+//
+// Parameters:
+//   - `aOldID`: The posting's former ID.
+//   - `aNewID`: The posting's new ID.
+//
+// Returns:
+//   - `[]uint64`: The postings linking to the former ID.
+func (wi *tWLindex) rename(aOldID, aNewID uint64) []uint64 {
+	wi.mtx.Lock()
+	defer wi.mtx.Unlock()
+
+	wi.build()
+	var result []uint64
+	for id := range wi.to[aOldID] {
+		if id == aOldID {
+			id = aNewID // a link to itself
+		}
+		result = append(result, id)
+	}
+	wi.set(aNewID, wi.set(aOldID, nil))
+	if refs, ok := wi.refs[aOldID]; ok {
+		delete(wi.refs, aOldID)
+		wi.refs[aNewID] = refs
+	}
+	if title := wi.setTitle(aOldID, ``); 0 < len(title) {
+		wi.setTitle(aNewID, title)
+		// links by title follow the posting
+		wi.relink(wi.referencing(title)...)
+	}
+
+	return result
+} // rename()
+
+// `reset()` empties the index, e.g. after changing the persistence layer.
+func (wi *tWLindex) reset() {
+	wi.mtx.Lock()
+	defer wi.mtx.Unlock()
+
+	clear(wi.from)
+	clear(wi.to)
+	clear(wi.refs)
+	clear(wi.heads)
+	clear(wi.titles)
+	wi.built = false
+} // reset()
+
+// `resolve()` returns the IDs of the postings referenced by `aRefs`.
+//
+// The caller must hold the lock.
+//
+// Parameters:
+//   - `aRefs`: The references as returned by `wlRefs()`.
+//
+// Returns:
+//   - `[]uint64`: The IDs of the existing postings referenced.
+func (wi *tWLindex) resolve(aRefs []string) []uint64 {
+	var result []uint64
+	for _, ref := range aRefs {
+		id, ok := wlID(ref)
+		if !ok {
+			id, ok = wi.newest(ref)
+		}
+		if ok && !slices.Contains(result, id) {
+			result = append(result, id)
+		}
+	}
+
+	return result
+} // resolve()
+
+// `set()` replaces the links of the posting `aID` by `aTargets`.
+//
+// The caller must hold the write lock.
+//
+// Parameters:
+//   - `aID`: The ID of the linking posting.
+//   - `aTargets`: The IDs of the linked postings.
+//
+// Returns:
+//   - `[]uint64`: The IDs of the formerly linked postings.
+func (wi *tWLindex) set(aID uint64, aTargets []uint64) []uint64 {
+	result := wi.from[aID]
+	for _, target := range result {
+		delete(wi.to[target], aID)
+		if 0 == len(wi.to[target]) {
+			delete(wi.to, target)
+		}
+	}
+	if 0 == len(aTargets) {
+		delete(wi.from, aID)
+
+		return result
+	}
+
+	wi.from[aID] = aTargets
+	for _, target := range aTargets {
+		if nil == wi.to[target] {
+			wi.to[target] = make(map[uint64]struct{})
+		}
+		wi.to[target][aID] = struct{}{}
+	}
+
+	return result
+} // set()
+
+// `setTitle()` records `aTitle` as the title of the posting `aID`.
+//
+// The caller must hold the write lock.
+//
+// Parameters:
+//   - `aID`: The ID of the posting.
+//   - `aTitle`: The posting's title as returned by `wlTitle()`.
+//
+// Returns:
+//   - `string`: The posting's former title.
+func (wi *tWLindex) setTitle(aID uint64, aTitle string) string {
+	result := wi.heads[aID]
+	if result == aTitle {
+		return result
+	}
+	if 0 < len(result) {
+		wi.titles[result] = slices.DeleteFunc(wi.titles[result], func(aOther uint64) bool {
+			return aOther == aID
+		})
+		if 0 == len(wi.titles[result]) {
+			delete(wi.titles, result)
+		}
+	}
+	if 0 == len(aTitle) {
+		delete(wi.heads, aID)
+
+		return result
+	}
+	wi.heads[aID] = aTitle
+	wi.titles[aTitle] = append(wi.titles[aTitle], aID)
+
+	return result
+} // setTitle()
+
+// `sources()` returns the IDs of the postings linking to `aID`,
+// newest first.
+//
+// Parameters:
+//   - `aID`: The ID of the linked posting.
+//
+// Returns:
+//   - `[]uint64`: The IDs of the linking postings.
+func (wi *tWLindex) sources(aID uint64) []uint64 {
+	wi.mtx.Lock()
+	defer wi.mtx.Unlock()
+
+	wi.build()
+	result := make([]uint64, 0, len(wi.to[aID]))
+	for id := range wi.to[aID] {
+		if id != aID {
+			result = append(result, id)
+		}
+	}
+	slices.Sort(result)
+	slices.Reverse(result)
+
+	return result
+} // sources()
+
+// `title()` returns the latest posting with the title `aTitle`.
+//
+// Parameters:
+//   - `aTitle`: The title as returned by `wlTitle()`.
+//
+// Returns:
+//   - `uint64`: The ID of the posting.
+//   - `bool`: Whether a posting with that title exists.
+func (wi *tWLindex) title(aTitle string) (uint64, bool) {
+	wi.mtx.Lock()
+	defer wi.mtx.Unlock()
+
+	wi.build()
+
+	return wi.newest(aTitle)
+} // title()
+
+// `update()` records the current links and title of `aPosting`.
+//
+// If the title changed the postings referencing the former or new
+// title are linked again. The cached pages of all postings gaining
+// or losing a link are dropped.
+//
+// Parameters:
+//   - `aPosting`: The changed posting.
+func (wi *tWLindex) update(aPosting *TPosting) {
+	wi.mtx.Lock()
+	defer wi.mtx.Unlock()
+
+	if !wi.built {
+		return // the current state will be read when needed
+	}
+	md := aPosting.Markdown()
+	if refs := wlRefs(md); 0 < len(refs) {
+		wi.refs[aPosting.id] = refs
+	} else {
+		delete(wi.refs, aPosting.id)
+	}
+	changed := []uint64{aPosting.id}
+	title := wlTitle(feedHeadline(md))
+	if old := wi.setTitle(aPosting.id, title); old != title {
+		for _, id := range wi.referencing(old, title) {
+			if id != aPosting.id {
+				changed = append(changed, id)
+			}
+		}
+	}
+	wi.relink(changed...)
+} // update()
+
+// --------------------------------------------------------------------------
+// helper functions
+
+// `wlID()` returns the posting ID given by the reference `aRef`.
+//
+// Parameters:
+//   - `aRef`: The reference used in a wiki link.
+//
+// Returns:
+//   - `uint64`: The ID of the referenced posting.
+//   - `bool`: Whether `aRef` is a posting ID.
+func wlID(aRef string) (uint64, bool) {
+	if 16 != len(aRef) {
+		return 0, false
+	}
+	id := str2id(aRef)
+
+	return id, (0 != id)
+} // wlID()
+
+// `wlPrepare()` converts the wiki links in `aMarkdown` to Markdown links.
+//
+// A link by ID without text shows the linked posting's date, a link
+// by title the title as written; references which can't be resolved
+// are left alone.
+//
+// Parameters:
+//   - `aMarkdown`: The posting's Markdown text.
+//
+// Returns:
+//   - `[]byte`: The Markdown text with the wiki links replaced.
+//   - `bool`: Whether some links refer to titles (which may change).
+func wlPrepare(aMarkdown []byte) ([]byte, bool) {
+	if !bytes.Contains(aMarkdown, []byte(`[[`)) {
+		return aMarkdown, false
+	}
+
+	byTitle := false
+	result := mdTextLines(aMarkdown, func(aLine []byte) []byte {
+		return wlLinkRE.ReplaceAllFunc(aLine, func(aMatch []byte) []byte {
+			sub := wlLinkRE.FindSubmatch(aMatch)
+			_, isID := wlID(string(sub[1]))
+			byTitle = byTitle || !isID
+			id, ok := wlResolve(string(sub[1]))
+			if !ok {
+				return aMatch
+			}
+			text := bytes.TrimSpace(sub[2])
+			if 0 == len(text) {
+				if isID {
+					text = []byte(NewPosting(id, "").Date())
+				} else {
+					text = bytes.TrimSpace(sub[1])
+				}
+			}
+
+			return []byte(fmt.Sprintf("[%s](/p/%s)", text, id2str(id)))
+		})
+	})
+
+	return result, byTitle
+} // wlPrepare()
+
+// `wlRelink()` changes all links to the posting `aOldID` in the
+// posting `aID` to point to `aNewID` instead.
+//
+// Parameters:
+//   - `aID`: The ID of the posting to change.
+//   - `aOldID`: The linked posting's former ID.
+//   - `aNewID`: The linked posting's new ID.
+//
+// Returns:
+//   - `error`: A possible error, or `nil` on success.
+func wlRelink(aID, aOldID, aNewID uint64) error {
+	p := NewPosting(aID, "")
+	if err := p.Load(); nil != err {
+		return err
+	}
+
+	newStr := []byte(id2str(aNewID))
+	relink := func(aRE *regexp.Regexp) func([]byte) []byte {
+		return func(aMatch []byte) []byte {
+			loc := aRE.FindSubmatchIndex(aMatch)
+			// links by title follow the posting anyway
+			if id, ok := wlID(string(aMatch[loc[2]:loc[3]])); !ok || (id != aOldID) {
+				return aMatch
+			}
+			result := append([]byte{}, aMatch[:loc[2]]...)
+			result = append(result, newStr...)
+
+			return append(result, aMatch[loc[3]:]...)
+		}
+	} // relink()
+
+	oldMD := p.Markdown()
+	md := mdTextLines(bytes.Clone(oldMD), func(aLine []byte) []byte {
+		aLine = wlLinkRE.ReplaceAllFunc(aLine, relink(wlLinkRE))
+
+		return wlPostRE.ReplaceAllFunc(aLine, relink(wlPostRE))
+	})
+	if bytes.Equal(md, oldMD) {
+		return nil
+	}
+	_, err := p.Set(md).Store()
+
+	return err
+} // wlRelink()
+
+// `wlRename()` updates the links after the posting `aOldID` got
+// the new ID `aNewID`.
+//
+// Parameters:
+//   - `aOldID`: The posting's former ID.
+//   - `aNewID`: The posting's new ID.
+//
+// Returns:
+//   - `error`: A possible error, or `nil` on success.
+func wlRename(aOldID, aNewID uint64) error {
+	var errs []error
+	for _, id := range wlIndex.rename(aOldID, aNewID) {
+		if err := wlRelink(id, aOldID, aNewID); nil != err {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+} // wlRename()
+
+// `wlRefs()` returns the references of all links in `aMarkdown`,
+// i.e. the IDs of the linked postings and the titles used by
+// wiki links (as returned by `wlTitle()`).
+//
+// Parameters:
+//   - `aMarkdown`: The posting's Markdown text.
+//
+// Returns:
+//   - `[]string`: The posting's references.
+func wlRefs(aMarkdown []byte) []string {
+	var result []string
+	add := func(aRef []byte) {
+		ref := wlTitle(string(aRef))
+		if id, ok := wlID(string(aRef)); ok {
+			ref = id2str(id)
+		}
+		if (0 < len(ref)) && !slices.Contains(result, ref) {
+			result = append(result, ref)
+		}
+	} // add()
+
+	mdTextLines(aMarkdown, func(aLine []byte) []byte {
+		for _, sub := range wlLinkRE.FindAllSubmatch(aLine, -1) {
+			add(sub[1])
+		}
+		for _, sub := range wlPostRE.FindAllSubmatch(aLine, -1) {
+			add(sub[1])
+		}
+
+		return aLine
+	})
+
+	return result
+} // wlRefs()
+
+// `wlResolve()` returns the ID of the posting referenced by `aRef`.
+//
+// A reference is either a posting's ID or its title, i.e. the first
+// line of its text (like e.g. a leading heading) as used for the
+// feeds and page titles; the comparison of titles ignores case and
+// repeated blanks. If several postings have the same title the
+// latest one is used.
+//
+// Parameters:
+//   - `aRef`: The reference used in a wiki link.
+//
+// Returns:
+//   - `uint64`: The ID of the referenced posting.
+//   - `bool`: Whether `aRef` could be resolved.
+func wlResolve(aRef string) (uint64, bool) {
+	if id, ok := wlID(aRef); ok {
+		return id, true
+	}
+	if title := wlTitle(aRef); 0 < len(title) {
+		return wlIndex.title(title)
+	}
+
+	return 0, false
+} // wlResolve()
+
+// `wlTitle()` returns `aText` normalised for comparing titles.
+//
+// Parameters:
+//   - `aText`: The title to normalise.
+//
+// Returns:
+//   - `string`: The lower-case title with single blanks.
+func wlTitle(aText string) string {
+	return strings.ToLower(strings.Join(strings.Fields(aText), ` `))
+} // wlTitle()
+
+/* _EoF_ */
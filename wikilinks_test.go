@@ -0,0 +1,201 @@
+/*
+Copyright © 2024 M.Watermann, 10247 Berlin, Germany
+
+			All rights reserved
+		EMail : <support@mwat.de>
+*/
+
+package nele
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_wlPrepare(t *testing.T) {
+	id := uint64(time.Date(2024, 6, 28, 12, 0, 0, 0, time.Local).UnixNano())
+	ids := id2str(id)
+
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{" 1", `no links`, `no links`},
+		{" 2", `see [[` + ids + `]]`, `see [2024-06-28](/p/` + ids + `)`},
+		{" 3", `see [[` + ids + `|that text]]`, `see [that text](/p/` + ids + `)`},
+		{" 4", `see [[` + strings.ToUpper(ids) + `| it ]]`, `see [it](/p/` + ids + `)`},
+		{" 5", `see [[some title]]`, `see [[some title]]`},
+		{" 6", "```\n[[" + ids + "]]\n```", "```\n[[" + ids + "]]\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := wlPrepare([]byte(tt.md)); string(got) != tt.want {
+				t.Errorf("wlPrepare() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_wlPrepare()
+
+func Test_wlRefs(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want []string
+	}{
+		{" 1", `no links`, nil},
+		{" 2", `[[17f3a2b4c5d6e7f8]] and [[17F3A2B4C5D6E7F8|again]]`, []string{`17f3a2b4c5d6e7f8`}},
+		{" 3", `[[17f3a2b4c5d6e7f8]] and [x](/p/17f3a2b4c5d6e7f9)`, []string{`17f3a2b4c5d6e7f8`, `17f3a2b4c5d6e7f9`}},
+		{" 4", "```\n[[17f3a2b4c5d6e7f8]]\n```", nil},
+		{" 5", `[[Some  Title]] and [[some title|again]]`, []string{`some title`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wlRefs([]byte(tt.md)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wlRefs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_wlRefs()
+
+func TestBacklinks(t *testing.T) {
+	prep4Tests()
+	SetPersistence(NewFSpersistence())
+
+	target := NewPosting(0, "The target")
+	if _, err := target.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(target.ID(), "").Delete() }()
+
+	source := NewPosting(0, "Linking [["+target.IDstr()+"|the target]]")
+	if _, err := source.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(source.ID(), "").Delete() }()
+
+	got := Backlinks(target.ID())
+	if (1 != len(got)) || (source.IDstr() != got[0].ID) || ("Linking the target" != got[0].Title) {
+		t.Fatalf("Backlinks() = %v", got)
+	}
+
+	// renaming the target updates the linking posting
+	nid := target.ID() + 1000
+	if err := target.ChangeID(nid); nil != err {
+		t.Fatal(err)
+	}
+	if got := Backlinks(nid); 1 != len(got) {
+		t.Errorf("Backlinks(new) = %v", got)
+	}
+	source = NewPosting(source.ID(), "")
+	if err := source.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "[[" + id2str(nid) + "|the target]]"; !strings.Contains(string(source.Markdown()), want) {
+		t.Errorf("Markdown() = %q, want %q", source.Markdown(), want)
+	}
+
+	// renaming the source updates the index
+	sid := source.ID() + 1000
+	if err := source.ChangeID(sid); nil != err {
+		t.Fatal(err)
+	}
+	if got := Backlinks(nid); (1 != len(got)) || (id2str(sid) != got[0].ID) {
+		t.Errorf("Backlinks() = %v, want %s", got, id2str(sid))
+	}
+
+	// removing the link
+	source = NewPosting(sid, "No more links")
+	if _, err := source.Store(); nil != err {
+		t.Fatal(err)
+	}
+	if got := Backlinks(nid); 0 != len(got) {
+		t.Errorf("Backlinks() = %v, want none", got)
+	}
+
+	// deleting the source
+	source.Set([]byte("[[" + id2str(nid) + "]]"))
+	if _, err := source.Store(); nil != err {
+		t.Fatal(err)
+	}
+	if err := source.Delete(); nil != err {
+		t.Fatal(err)
+	}
+	if got := Backlinks(nid); 0 != len(got) {
+		t.Errorf("Backlinks() = %v, want none", got)
+	}
+} // TestBacklinks()
+
+func TestBacklinks_title(t *testing.T) {
+	prep4Tests()
+	SetPersistence(NewFSpersistence())
+
+	target := NewPosting(0, "# The *Wiki* Target\n\nSome text")
+	if _, err := target.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(target.ID(), "").Delete() }()
+
+	source := NewPosting(0, "See [[the wiki  target]]")
+	if _, err := source.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(source.ID(), "").Delete() }()
+
+	if got := Backlinks(target.ID()); (1 != len(got)) || (source.IDstr() != got[0].ID) {
+		t.Fatalf("Backlinks() = %v, want %s", got, source.IDstr())
+	}
+	md, byTitle := wlPrepare(source.Markdown())
+	if want := "See [the wiki  target](/p/" + target.IDstr() + ")"; (want != string(md)) || !byTitle {
+		t.Errorf("wlPrepare() = %q, %v, want %q, true", md, byTitle, want)
+	}
+
+	// the latest posting with that title is linked
+	other := NewPosting(0, "The wiki target")
+	if _, err := other.Store(); nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = NewPosting(other.ID(), "").Delete() }()
+	if got := Backlinks(other.ID()); 1 != len(got) {
+		t.Errorf("Backlinks(other) = %v, want %s", got, source.IDstr())
+	}
+	if got := Backlinks(target.ID()); 0 != len(got) {
+		t.Errorf("Backlinks(target) = %v, want none", got)
+	}
+	if got := string(NewPosting(source.ID(), "").Post()); !strings.Contains(got, `/p/`+other.IDstr()) {
+		t.Errorf("Post() = %q, want a link to %s", got, other.IDstr())
+	}
+
+	// changing a title links the postings again
+	other.Set([]byte("Another title"))
+	if _, err := other.Store(); nil != err {
+		t.Fatal(err)
+	}
+	if got := Backlinks(target.ID()); 1 != len(got) {
+		t.Errorf("Backlinks(target) = %v, want %s", got, source.IDstr())
+	}
+
+	// renaming the target keeps the link by title
+	nid := target.ID() + 1000
+	if err := target.ChangeID(nid); nil != err {
+		t.Fatal(err)
+	}
+	if got := Backlinks(nid); 1 != len(got) {
+		t.Errorf("Backlinks(new) = %v, want %s", got, source.IDstr())
+	}
+	if err := source.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "See [[the wiki  target]]"; want != string(source.Markdown()) {
+		t.Errorf("Markdown() = %q, want %q", source.Markdown(), want)
+	}
+	if id, ok := wlResolve(`The Wiki Target`); !ok || (nid != id) {
+		t.Errorf("wlResolve() = %x, %v, want %x", id, ok, nid)
+	}
+} // TestBacklinks_title()
+
+/* _EoF_ */